@@ -0,0 +1,49 @@
+package tork
+
+import (
+	"time"
+)
+
+// TaskArtifacts declares the files a task consumes from, and
+// publishes to, the artifact store. Artifacts are scoped to the
+// job: a task can consume any artifact published by a task
+// which ran before it in the same job.
+type TaskArtifacts struct {
+	// Inputs are placed at their path before the task starts.
+	Inputs []*TaskArtifact `json:"inputs,omitempty"`
+	// Outputs are collected from their path once the task
+	// completed successfully.
+	Outputs []*TaskArtifact `json:"outputs,omitempty"`
+}
+
+// TaskArtifact maps the name of an artifact to a path (a file
+// or a directory) in the task's environment.
+type TaskArtifact struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// Artifact describes an artifact held by the artifact store.
+type Artifact struct {
+	Name      string    `json:"name,omitempty"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+}
+
+func (a *TaskArtifacts) Clone() *TaskArtifacts {
+	return &TaskArtifacts{
+		Inputs:  cloneTaskArtifacts(a.Inputs),
+		Outputs: cloneTaskArtifacts(a.Outputs),
+	}
+}
+
+func cloneTaskArtifacts(as []*TaskArtifact) []*TaskArtifact {
+	if as == nil {
+		return nil
+	}
+	result := make([]*TaskArtifact, len(as))
+	for i, a := range as {
+		result[i] = &TaskArtifact{Name: a.Name, Path: a.Path}
+	}
+	return result
+}
@@ -0,0 +1,166 @@
+package artifact
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Archive returns a tar archive of the file or directory at p.
+// The entries of the archive are named relative to the parent
+// of p, the same way the archives returned by Docker's
+// CopyFromContainer are.
+func Archive(p string) (io.ReadCloser, error) {
+	if _, err := os.Stat(p); err != nil {
+		return nil, errors.Wrapf(err, "error reading artifact %s", p)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		base := filepath.Dir(p)
+		err := filepath.Walk(p, func(fp string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() && !fi.IsDir() {
+				return nil // skip symlinks, devices etc.
+			}
+			rel, err := filepath.Rel(base, fp)
+			if err != nil {
+				return err
+			}
+			hdr, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(rel)
+			if fi.IsDir() {
+				hdr.Name = hdr.Name + "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			f, err := os.Open(fp)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// Extract extracts an archive produced by Archive so that its
+// root entry (the archived file or directory) is placed at p.
+func Extract(r io.Reader, p string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error reading artifact archive")
+		}
+		name, err := rebaseName(hdr.Name, filepath.ToSlash(p))
+		if err != nil {
+			return err
+		}
+		target := filepath.FromSlash(name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return errors.Wrapf(err, "error creating directory %s", target)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return errors.Wrapf(err, "error creating directory %s", filepath.Dir(target))
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return errors.Wrapf(err, "error creating file %s", target)
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return errors.Wrapf(err, "error writing file %s", target)
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Rebase rewrites the entries of an archive produced by Archive
+// so that its root entry is named p, which must be absolute. The
+// resulting archive is meant to be extracted at the root of a
+// container's filesystem.
+func Rebase(r io.Reader, p string) (io.ReadCloser, error) {
+	if !path.IsAbs(p) {
+		return nil, errors.Errorf("artifact path must be absolute: %s", p)
+	}
+	root := strings.TrimPrefix(path.Clean(p), "/")
+	if root == "" {
+		return nil, errors.Errorf("invalid artifact path: %s", p)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		tr := tar.NewReader(r)
+		tw := tar.NewWriter(pw)
+		err := func() error {
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					return tw.Close()
+				}
+				if err != nil {
+					return err
+				}
+				name, err := rebaseName(hdr.Name, root)
+				if err != nil {
+					return err
+				}
+				if hdr.Typeflag == tar.TypeDir {
+					name = name + "/"
+				}
+				hdr.Name = name
+				if err := tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+				if _, err := io.Copy(tw, tr); err != nil {
+					return err
+				}
+			}
+		}()
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// rebaseName replaces the first element of the
+// entry's name with root.
+func rebaseName(name, root string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "", errors.Errorf("invalid artifact entry: %s", name)
+	}
+	_, rest, _ := strings.Cut(name, "/")
+	if rest == "" {
+		return path.Clean(root), nil
+	}
+	return path.Join(root, rest), nil
+}
@@ -0,0 +1,105 @@
+package artifact
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveExtractDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "segments")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "720p"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "index.m3u8"), []byte("playlist"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "720p", "1.ts"), []byte("segment"), 0644))
+
+	r, err := Archive(src)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	dst := filepath.Join(t.TempDir(), "some", "output")
+	assert.NoError(t, Extract(r, dst))
+
+	b, err := os.ReadFile(filepath.Join(dst, "index.m3u8"))
+	assert.NoError(t, err)
+	assert.Equal(t, "playlist", string(b))
+	b, err = os.ReadFile(filepath.Join(dst, "720p", "1.ts"))
+	assert.NoError(t, err)
+	assert.Equal(t, "segment", string(b))
+}
+
+func TestArchiveExtractFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "video.mp4")
+	assert.NoError(t, os.WriteFile(src, []byte("video"), 0644))
+
+	r, err := Archive(src)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	dst := filepath.Join(t.TempDir(), "input.mp4")
+	assert.NoError(t, Extract(r, dst))
+
+	b, err := os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "video", string(b))
+}
+
+func TestArchiveMissing(t *testing.T) {
+	_, err := Archive(filepath.Join(t.TempDir(), "nothing"))
+	assert.Error(t, err)
+}
+
+func TestRebase(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "out")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644))
+
+	r, err := Archive(src)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	rr, err := Rebase(r, "/data/in")
+	assert.NoError(t, err)
+	defer rr.Close()
+
+	names := []string{}
+	tr := tar.NewReader(rr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	assert.Equal(t, []string{"data/in/", "data/in/a.txt"}, names)
+
+	_, err = Rebase(r, "relative/path")
+	assert.Error(t, err)
+	_, err = Rebase(r, "/")
+	assert.Error(t, err)
+}
+
+func Test_rebaseName(t *testing.T) {
+	tests := []struct {
+		name     string
+		root     string
+		expected string
+	}{
+		{"video.mp4", "data/in.mp4", "data/in.mp4"},
+		{"out/", "data/in", "data/in"},
+		{"out/a/b.txt", "data/in", "data/in/a/b.txt"},
+		{"out/../../etc/passwd", "data/in", "data/in/passwd"},
+		{"../../etc/passwd", "data/in", "data/in/passwd"},
+	}
+	for _, test := range tests {
+		name, err := rebaseName(test.name, test.root)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, name, test.name)
+	}
+	_, err := rebaseName("/", "data")
+	assert.Error(t, err)
+}
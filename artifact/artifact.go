@@ -0,0 +1,45 @@
+package artifact
+
+import (
+	"context"
+	"io"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+)
+
+const (
+	STORE_LOCAL = "local"
+	STORE_S3    = "s3"
+)
+
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+var namePattern = regexp.MustCompile(`^[0-9a-zA-Z_][-0-9a-zA-Z_.]*$`)
+
+// Store persists the artifacts produced by tasks so they can be
+// consumed by the subsequent tasks of the same job, which may
+// run on other hosts. Artifacts are stored as tar archives of
+// the file or directory they were collected from.
+type Store interface {
+	Put(ctx context.Context, jobID, name string, r io.Reader) error
+	Get(ctx context.Context, jobID, name string) (io.ReadCloser, error)
+	List(ctx context.Context, jobID string) ([]*tork.Artifact, error)
+}
+
+// ValidName returns true if name can be used as
+// the name of an artifact.
+func ValidName(name string) bool {
+	return len(name) <= 64 && namePattern.MatchString(name)
+}
+
+func checkKey(jobID, name string) error {
+	if !namePattern.MatchString(jobID) {
+		return errors.Errorf("invalid job id: %s", jobID)
+	}
+	if !ValidName(name) {
+		return errors.Errorf("invalid artifact name: %s", name)
+	}
+	return nil
+}
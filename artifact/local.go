@@ -0,0 +1,107 @@
+package artifact
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+)
+
+const archiveExt = ".tar"
+
+// LocalStore keeps the artifacts on the local filesystem,
+// under <dir>/<job id>/<name>.tar. It can be shared between
+// the workers and the coordinator through a network filesystem.
+type LocalStore struct {
+	dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, errors.New("artifacts directory is required")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "error creating artifacts directory %s", dir)
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, jobID, name string, r io.Reader) error {
+	if err := checkKey(jobID, name); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.dir, jobID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "error creating directory %s", dir)
+	}
+	// write to a temp file first so that readers never
+	// see a partially written artifact
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return errors.Wrapf(err, "error creating temp file")
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "error writing artifact %s", name)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, name+archiveExt)); err != nil {
+		return errors.Wrapf(err, "error writing artifact %s", name)
+	}
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, jobID, name string) (io.ReadCloser, error) {
+	if err := checkKey(jobID, name); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(s.dir, jobID, name+archiveExt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrArtifactNotFound
+		}
+		return nil, errors.Wrapf(err, "error reading artifact %s", name)
+	}
+	return f, nil
+}
+
+func (s *LocalStore) List(ctx context.Context, jobID string) ([]*tork.Artifact, error) {
+	if !namePattern.MatchString(jobID) {
+		return nil, errors.Errorf("invalid job id: %s", jobID)
+	}
+	entries, err := os.ReadDir(filepath.Join(s.dir, jobID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*tork.Artifact{}, nil
+		}
+		return nil, errors.Wrapf(err, "error listing artifacts")
+	}
+	result := make([]*tork.Artifact, 0, len(entries))
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), archiveExt)
+		if !ok || e.IsDir() || !ValidName(name) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading artifact %s", name)
+		}
+		result = append(result, &tork.Artifact{
+			Name:      name,
+			Size:      fi.Size(),
+			CreatedAt: fi.ModTime().UTC(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	jobID := uuid.NewUUID()
+
+	list, err := s.List(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	assert.NoError(t, s.Put(ctx, jobID, "video", bytes.NewReader([]byte("some video"))))
+	assert.NoError(t, s.Put(ctx, jobID, "thumbnail.png", bytes.NewReader([]byte("img"))))
+
+	r, err := s.Get(ctx, jobID, "video")
+	assert.NoError(t, err)
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "some video", string(b))
+
+	// artifacts are overwritten
+	assert.NoError(t, s.Put(ctx, jobID, "video", bytes.NewReader([]byte("other video"))))
+
+	list, err = s.List(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "thumbnail.png", list[0].Name)
+	assert.Equal(t, int64(3), list[0].Size)
+	assert.Equal(t, "video", list[1].Name)
+	assert.Equal(t, int64(11), list[1].Size)
+
+	_, err = s.Get(ctx, jobID, "nothing")
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+	_, err = s.Get(ctx, uuid.NewUUID(), "video")
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+
+	assert.Error(t, s.Put(ctx, jobID, "../video", bytes.NewReader([]byte("x"))))
+	_, err = s.Get(ctx, "..", "video")
+	assert.Error(t, err)
+	_, err = s.List(ctx, "../..")
+	assert.Error(t, err)
+}
+
+func TestValidName(t *testing.T) {
+	assert.True(t, ValidName("video"))
+	assert.True(t, ValidName("video-720p.mp4"))
+	assert.True(t, ValidName("_frames"))
+	assert.False(t, ValidName(""))
+	assert.False(t, ValidName(".hidden"))
+	assert.False(t, ValidName("a/b"))
+	assert.False(t, ValidName("{{ item.index }}"))
+}
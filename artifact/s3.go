@@ -0,0 +1,340 @@
+package artifact
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+)
+
+const (
+	s3DateFormat    = "20060102T150405Z"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3EmptyChecksum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+type S3Config struct {
+	// Endpoint is the URL of the S3-compatible service
+	// (e.g. http://localhost:9000). Defaults to AWS S3.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Prefix is prepended to the keys of the artifacts.
+	Prefix string
+	// PathStyle addresses the bucket as part of the path
+	// (<endpoint>/<bucket>/<key>) rather than the host name,
+	// as most S3-compatible services expect.
+	PathStyle bool
+	Client    *http.Client
+}
+
+// S3Store keeps the artifacts in an S3 bucket, or in
+// any storage service which implements the S3 API.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid s3 endpoint: %s", cfg.Endpoint)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, errors.Errorf("invalid s3 endpoint: %s", cfg.Endpoint)
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Store{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   client,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, jobID, name string, r io.Reader) error {
+	if err := checkKey(jobID, name); err != nil {
+		return err
+	}
+	// S3 requires the length (and we need the checksum) of
+	// the payload up front, so it is buffered to a temp file
+	f, err := os.CreateTemp("", "tork-artifact-*")
+	if err != nil {
+		return errors.Wrapf(err, "error creating temp file")
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return errors.Wrapf(err, "error buffering artifact %s", name)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := s.newRequest(ctx, http.MethodPut, s.key(jobID, name), nil, io.NopCloser(f))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := s.do(req, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return errors.Wrapf(err, "error uploading artifact %s", name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("error uploading artifact %s: %s", name, s3Error(resp))
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, jobID, name string) (io.ReadCloser, error) {
+	if err := checkKey(jobID, name); err != nil {
+		return nil, err
+	}
+	req, err := s.newRequest(ctx, http.MethodGet, s.key(jobID, name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, s3EmptyChecksum)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading artifact %s", name)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrArtifactNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, errors.Errorf("error downloading artifact %s: %s", name, s3Error(resp))
+	}
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List(ctx context.Context, jobID string) ([]*tork.Artifact, error) {
+	if !namePattern.MatchString(jobID) {
+		return nil, errors.Errorf("invalid job id: %s", jobID)
+	}
+	prefix := s.cfg.Prefix + jobID + "/"
+	result := make([]*tork.Artifact, 0)
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		req, err := s.newRequest(ctx, http.MethodGet, "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, s3EmptyChecksum)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing artifacts")
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := errors.Errorf("error listing artifacts: %s", s3Error(resp))
+			resp.Body.Close()
+			return nil, err
+		}
+		lr := s3ListResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&lr)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding artifacts listing")
+		}
+		for _, c := range lr.Contents {
+			name, ok := strings.CutSuffix(strings.TrimPrefix(c.Key, prefix), archiveExt)
+			if !ok || !ValidName(name) {
+				continue
+			}
+			result = append(result, &tork.Artifact{
+				Name:      name,
+				Size:      c.Size,
+				CreatedAt: c.LastModified.UTC(),
+			})
+		}
+		if !lr.IsTruncated || lr.NextContinuationToken == "" {
+			break
+		}
+		token = lr.NextContinuationToken
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (s *S3Store) key(jobID, name string) string {
+	return s.cfg.Prefix + jobID + "/" + name + archiveExt
+}
+
+func (s *S3Store) newRequest(ctx context.Context, method, key string, q url.Values, body io.ReadCloser) (*http.Request, error) {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	if q != nil {
+		u.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating s3 request")
+	}
+	return req, nil
+}
+
+func (s *S3Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	signV4(req, payloadHash, s.cfg.Region, s.cfg.AccessKey, s.cfg.SecretKey, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// signV4 signs the request with AWS Signature Version 4.
+func signV4(req *http.Request, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.Format(s3DateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if accessKey == "" {
+		return // anonymous access
+	}
+	// canonical headers
+	headers := map[string]string{"host": req.Host}
+	if headers["host"] == "" {
+		headers["host"] = req.URL.Host
+	}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-type" || lk == "content-md5" || lk == "range" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	// canonical query string
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vs := query[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(crHash[:]),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode encodes s as specified by SigV4: every byte
+// except the unreserved characters is percent-encoded.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3Error(resp *http.Response) string {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	msg := strings.TrimSpace(string(b))
+	if msg == "" {
+		return resp.Status
+	}
+	return fmt.Sprintf("%s: %s", resp.Status, msg)
+}
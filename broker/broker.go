@@ -9,12 +9,35 @@ import (
 type Provider func() (Broker, error)
 
 const (
-	BROKER_INMEMORY     = "inmemory"
-	BROKER_RABBITMQ     = "rabbitmq"
-	TOPIC_JOB           = "job.*"
-	TOPIC_JOB_COMPLETED = "job.completed"
-	TOPIC_JOB_FAILED    = "job.failed"
-	TOPIC_SCHEDULED_JOB = "scheduled.job"
+	BROKER_INMEMORY      = "inmemory"
+	BROKER_RABBITMQ      = "rabbitmq"
+	BROKER_POSTGRES      = "postgres"
+	BROKER_NATS          = "nats"
+	TOPIC_JOB            = "job.*"
+	TOPIC_JOB_COMPLETED  = "job.completed"
+	TOPIC_JOB_FAILED     = "job.failed"
+	TOPIC_JOB_CANCELLED  = "job.cancelled"
+	TOPIC_TASK           = "task.*"
+	TOPIC_TASK_SCHEDULED = "task.scheduled"
+	TOPIC_TASK_RUNNING   = "task.running"
+	TOPIC_TASK_PROGRESS  = "task.progress"
+	TOPIC_TASK_COMPLETED = "task.completed"
+	TOPIC_TASK_SKIPPED   = "task.skipped"
+	TOPIC_TASK_FAILED    = "task.failed"
+	TOPIC_TASK_CANCELLED = "task.cancelled"
+	TOPIC_SCHEDULED_JOB  = "scheduled.job"
+	TOPIC_LOG_PART       = "log.part"
+)
+
+// Updates about jobs which aren't done yet are published under
+// their own prefix so that the subscribers of TOPIC_JOB are only
+// notified once a job completes, fails or gets cancelled.
+const (
+	TOPIC_JOB_UPDATE    = "job-update.*"
+	TOPIC_JOB_SCHEDULED = "job-update.scheduled"
+	TOPIC_JOB_RUNNING   = "job-update.running"
+	TOPIC_JOB_PAUSED    = "job-update.paused"
+	TOPIC_JOB_PROGRESS  = "job-update.progress"
 )
 
 // Broker is the message-queue, pub/sub mechanism used for delivering tasks.
@@ -2,6 +2,7 @@ package broker
 
 import (
 	"context"
+	"slices"
 	"sync/atomic"
 
 	"sync"
@@ -27,7 +28,7 @@ type InMemoryBroker struct {
 type topic struct {
 	name       string
 	ch         chan any
-	subs       []func(event any)
+	subs       []*tsub
 	terminate  chan any
 	terminated chan any
 	mu         sync.RWMutex
@@ -49,7 +50,7 @@ func newTopic(name string) *topic {
 			case m := <-t.ch:
 				t.mu.RLock()
 				for _, sub := range t.subs {
-					sub(m)
+					sub.handler(m)
 				}
 				t.mu.RUnlock()
 			}
@@ -59,10 +60,24 @@ func newTopic(name string) *topic {
 	return t
 }
 
-func (t *topic) subscribe(handler func(ev any)) {
+type tsub struct {
+	handler func(ev any)
+}
+
+func (t *topic) subscribe(handler func(ev any)) *tsub {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sub := &tsub{handler: handler}
+	t.subs = append(t.subs, sub)
+	return sub
+}
+
+func (t *topic) unsubscribe(sub *tsub) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	t.subs = append(t.subs, handler)
+	t.subs = slices.DeleteFunc(t.subs, func(s *tsub) bool {
+		return s == sub
+	})
 }
 
 func (t *topic) publish(ev any) {
@@ -259,7 +274,15 @@ func (b *InMemoryBroker) SubscribeForEvents(ctx context.Context, topic string, h
 		t = newTopic(topic)
 		b.topics.Set(topic, t)
 	}
-	t.subscribe(handler)
+	sub := t.subscribe(handler)
+	// the subscription lasts until its context is done
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			log.Debug().Msgf("unsubscribing from events on %s", topic)
+			t.unsubscribe(sub)
+		}()
+	}
 	return nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -234,6 +235,24 @@ func TestInMemorSubsribeForEvent(t *testing.T) {
 	close(processed2)
 }
 
+func TestInMemoryUnsubscribeForEvents(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	sctx, cancel := context.WithCancel(ctx)
+	processed := atomic.Int32{}
+	err := b.SubscribeForEvents(sctx, broker.TOPIC_JOB, func(event any) {
+		processed.Add(1)
+	})
+	assert.NoError(t, err)
+	err = b.PublishEvent(ctx, broker.TOPIC_JOB_COMPLETED, &tork.Job{})
+	assert.NoError(t, err)
+	cancel()
+	time.Sleep(time.Millisecond * 100)
+	err = b.PublishEvent(ctx, broker.TOPIC_JOB_COMPLETED, &tork.Job{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), processed.Load())
+}
+
 func TestInMemoryHealthChech(t *testing.T) {
 	ctx := context.Background()
 	b := broker.NewInMemoryBroker()
@@ -0,0 +1,604 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/internal/wildcard"
+)
+
+const (
+	DefaultConsumerTimeout = time.Minute * 30
+	DefaultHeartbeatTTL    = time.Minute
+	DefaultPollInterval    = time.Second
+)
+
+const (
+	streamPrefix   = "TORK_"
+	subjectQueues  = "tork.q"
+	subjectEvents  = "tork.events"
+	headerType     = "Tork-Type"
+	metadataQueue  = "tork.queue"
+	maxPriority    = 9
+	defaultTimeout = time.Second * 10
+)
+
+// NATSBroker is an implementation of the Broker interface on top
+// of NATS JetStream. Every queue is backed by a work-queue stream.
+// Tasks published to a task queue go to a subject per priority
+// level, each with its own durable consumer so that higher priority
+// tasks can be fetched first. Coordinator and exclusive queues have
+// a single priority level. Events are published over core NATS
+// subjects.
+type NATSBroker struct {
+	nc              *nats.Conn
+	js              jetstream.JetStream
+	streams         *syncx.Map[string, jetstream.Stream]
+	subscriptions   map[string]*subscription
+	mu              sync.RWMutex
+	shuttingDown    bool
+	consumerTimeout time.Duration
+	heartbeatTTL    time.Duration
+	pollInterval    time.Duration
+}
+
+type subscription struct {
+	qname  string
+	cancel chan struct{}
+	done   chan struct{}
+}
+
+type Option = func(b *NATSBroker)
+
+// WithConsumerTimeout sets the maximum amount of time JetStream
+// will wait for a message ack from a consumer before redelivering
+// the message. Default: 30 minutes
+func WithConsumerTimeout(timeout time.Duration) Option {
+	return func(b *NATSBroker) {
+		b.consumerTimeout = timeout
+	}
+}
+
+// WithHeartbeatTTL sets the TTL for a heartbeat pending in the queue.
+func WithHeartbeatTTL(ttl time.Duration) Option {
+	return func(b *NATSBroker) {
+		b.heartbeatTTL = ttl
+	}
+}
+
+// WithPollInterval sets the maximum amount of time an idle
+// subscriber waits on its queue before checking for cancellation
+// and for higher priority messages. Default: 1 second
+func WithPollInterval(interval time.Duration) Option {
+	return func(b *NATSBroker) {
+		b.pollInterval = interval
+	}
+}
+
+func NewNATSBroker(url string, opts ...Option) (*NATSBroker, error) {
+	nc, err := nats.Connect(url, nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to NATS")
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, errors.Wrapf(err, "error creating JetStream context")
+	}
+	b := &NATSBroker{
+		nc:              nc,
+		js:              js,
+		streams:         new(syncx.Map[string, jetstream.Stream]),
+		subscriptions:   make(map[string]*subscription),
+		consumerTimeout: DefaultConsumerTimeout,
+		heartbeatTTL:    DefaultHeartbeatTTL,
+		pollInterval:    DefaultPollInterval,
+	}
+	for _, o := range opts {
+		o(b)
+	}
+	return b, nil
+}
+
+// token converts a queue name to a string which is safe to
+// use as both a stream name and a subject token.
+func token(qname string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, qname)
+}
+
+func streamName(qname string) string {
+	return streamPrefix + token(qname)
+}
+
+func subject(qname string, priority int) string {
+	return fmt.Sprintf("%s.%s.%d", subjectQueues, token(qname), priority)
+}
+
+func (b *NATSBroker) declareQueue(ctx context.Context, qname string) (jetstream.Stream, error) {
+	if s, ok := b.streams.Get(qname); ok {
+		return s, nil
+	}
+	log.Debug().Msgf("declaring queue: %s", qname)
+	cfg := jetstream.StreamConfig{
+		Name:      streamName(qname),
+		Subjects:  []string{fmt.Sprintf("%s.%s.*", subjectQueues, token(qname))},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+		Metadata:  map[string]string{metadataQueue: qname},
+	}
+	if strings.HasPrefix(qname, broker.QUEUE_EXCLUSIVE_PREFIX) {
+		cfg.Storage = jetstream.MemoryStorage
+	}
+	if qname == broker.QUEUE_HEARTBEAT {
+		cfg.MaxAge = b.heartbeatTTL
+	}
+	s, err := b.js.CreateOrUpdateStream(ctx, cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error declaring queue %s", qname)
+	}
+	b.streams.Set(qname, s)
+	return s, nil
+}
+
+// declareConsumers returns the queue's consumers
+// ordered from the highest to the lowest priority.
+func (b *NATSBroker) declareConsumers(ctx context.Context, s jetstream.Stream, qname string) ([]jetstream.Consumer, error) {
+	priorities := 0
+	if broker.IsTaskQueue(qname) {
+		priorities = maxPriority
+	}
+	consumers := make([]jetstream.Consumer, 0, priorities+1)
+	for p := priorities; p >= 0; p-- {
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:       fmt.Sprintf("p%d", p),
+			FilterSubject: subject(qname, p),
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			AckWait:       b.consumerTimeout,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "error declaring consumer for queue %s", qname)
+		}
+		consumers = append(consumers, c)
+	}
+	return consumers, nil
+}
+
+func (b *NATSBroker) Queues(ctx context.Context) ([]broker.QueueInfo, error) {
+	qis := make([]broker.QueueInfo, 0)
+	streams := b.js.ListStreams(ctx)
+	for si := range streams.Info() {
+		qname, ok := si.Config.Metadata[metadataQueue]
+		if !ok {
+			continue
+		}
+		qi := broker.QueueInfo{
+			Name: qname,
+			Size: int(si.State.Msgs),
+		}
+		s, err := b.js.Stream(ctx, si.Config.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting stream %s", si.Config.Name)
+		}
+		consumers := s.ListConsumers(ctx)
+		for ci := range consumers.Info() {
+			qi.Unacked = qi.Unacked + ci.NumAckPending
+			qi.Subscribers = max(qi.Subscribers, ci.NumWaiting)
+		}
+		if err := consumers.Err(); err != nil {
+			return nil, errors.Wrapf(err, "error listing consumers for queue %s", qname)
+		}
+		qis = append(qis, qi)
+	}
+	if err := streams.Err(); err != nil {
+		return nil, errors.Wrapf(err, "error listing streams")
+	}
+	return qis, nil
+}
+
+func (b *NATSBroker) publish(ctx context.Context, qname string, m any) error {
+	if _, err := b.declareQueue(ctx, qname); err != nil {
+		return err
+	}
+	priority := 0
+	if t, ok := m.(*tork.Task); ok && broker.IsTaskQueue(qname) {
+		priority = min(max(t.Priority, 0), maxPriority)
+	}
+	msg, err := encode(subject(qname, priority), m)
+	if err != nil {
+		return err
+	}
+	if _, err := b.js.PublishMsg(ctx, msg); err != nil {
+		return errors.Wrapf(err, "unable to publish message")
+	}
+	return nil
+}
+
+func (b *NATSBroker) subscribe(ctx context.Context, qname string, handler func(m any) error) error {
+	if b.isShuttingDown() {
+		return errors.New("broker is shutting down")
+	}
+	dctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	s, err := b.declareQueue(dctx, qname)
+	if err != nil {
+		return err
+	}
+	consumers, err := b.declareConsumers(dctx, s, qname)
+	if err != nil {
+		return err
+	}
+	id := uuid.NewUUID()
+	sub := &subscription{
+		qname:  qname,
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subscriptions[id] = sub
+	b.mu.Unlock()
+	log.Debug().Msgf("created subscription %s for queue: %s", id, qname)
+	go func() {
+		defer close(sub.done)
+		for {
+			select {
+			case <-sub.cancel:
+				log.Debug().Msgf("subscription for queue %s canceled", qname)
+				b.removeSubscription(id)
+				b.deleteTransientQueue(context.Background(), qname)
+				return
+			case <-ctx.Done():
+				log.Debug().Msgf("context canceled, stopping subscription for queue: %s", qname)
+				b.removeSubscription(id)
+				b.deleteTransientQueue(context.Background(), qname)
+				return
+			default:
+			}
+			msg, err := b.next(consumers)
+			if err != nil {
+				if b.nc.IsClosed() {
+					return
+				}
+				log.Error().
+					Err(err).
+					Msgf("error fetching message from queue: %s", qname)
+				time.Sleep(b.pollInterval)
+				continue
+			}
+			if msg == nil {
+				continue
+			}
+			b.handle(qname, msg, handler)
+		}
+	}()
+	return nil
+}
+
+// next fetches the next message from the highest priority
+// consumer that has one, waiting up to the poll interval on
+// the lowest priority consumer when the queue is empty.
+func (b *NATSBroker) next(consumers []jetstream.Consumer) (jetstream.Msg, error) {
+	for _, c := range consumers[:len(consumers)-1] {
+		batch, err := c.FetchNoWait(1)
+		if err != nil {
+			return nil, err
+		}
+		for msg := range batch.Messages() {
+			return msg, nil
+		}
+	}
+	batch, err := consumers[len(consumers)-1].Fetch(1, jetstream.FetchMaxWait(b.pollInterval))
+	if err != nil {
+		return nil, err
+	}
+	for msg := range batch.Messages() {
+		return msg, nil
+	}
+	return nil, nil
+}
+
+func (b *NATSBroker) handle(qname string, msg jetstream.Msg, handler func(m any) error) {
+	m, err := decode(msg.Headers().Get(headerType), msg.Data())
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("queue", qname).
+			Str("body", string(msg.Data())).
+			Msg("failed to deserialize message")
+		if err := msg.Term(); err != nil {
+			log.Error().Err(err).Msg("failed to reject message")
+		}
+		return
+	}
+	if err := handler(m); err != nil {
+		log.Error().
+			Err(err).
+			Str("queue", qname).
+			Str("body", string(msg.Data())).
+			Msg("failed to handle message")
+		if err := msg.Term(); err != nil {
+			log.Error().Err(err).Msg("failed to reject message")
+		}
+		return
+	}
+	if err := msg.Ack(); err != nil {
+		log.Error().Err(err).Msg("failed to ack message")
+	}
+}
+
+// isTransient reports whether the queue belongs to a single
+// node, and so has no use once that node is gone.
+func isTransient(qname string) bool {
+	return strings.HasPrefix(qname, broker.QUEUE_EXCLUSIVE_PREFIX) || broker.IsNodeQueue(qname)
+}
+
+// deleteTransientQueue deletes the stream of a transient queue
+// so that the streams of past nodes don't pile up on the server.
+func (b *NATSBroker) deleteTransientQueue(ctx context.Context, qname string) {
+	if !isTransient(qname) {
+		return
+	}
+	b.streams.Delete(qname)
+	if err := b.js.DeleteStream(ctx, streamName(qname)); err != nil &&
+		!errors.Is(err, jetstream.ErrStreamNotFound) && !b.nc.IsClosed() {
+		log.Error().
+			Err(err).
+			Msgf("error deleting queue: %s", qname)
+	}
+}
+
+func (b *NATSBroker) removeSubscription(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscriptions, id)
+}
+
+func encode(subj string, m any) (*nats.Msg, error) {
+	switch m.(type) {
+	case *tork.Task, *tork.Job, *tork.Node, *tork.TaskLogPart, *tork.ScheduledJob:
+	default:
+		return nil, errors.Errorf("unknown type: %T", m)
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to serialize the message")
+	}
+	msg := nats.NewMsg(subj)
+	msg.Header.Set(headerType, fmt.Sprintf("%T", m))
+	msg.Data = body
+	return msg, nil
+}
+
+func decode(mtype string, body []byte) (any, error) {
+	var m any
+	switch mtype {
+	case "*tork.Task":
+		m = &tork.Task{}
+	case "*tork.Job":
+		m = &tork.Job{}
+	case "*tork.Node":
+		m = &tork.Node{}
+	case "*tork.TaskLogPart":
+		m = &tork.TaskLogPart{}
+	case "*tork.ScheduledJob":
+		m = &tork.ScheduledJob{}
+	default:
+		return nil, errors.Errorf("unknown message type: %s", mtype)
+	}
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (b *NATSBroker) PublishTask(ctx context.Context, qname string, t *tork.Task) error {
+	return b.publish(ctx, qname, t)
+}
+
+func (b *NATSBroker) SubscribeForTasks(qname string, handler func(t *tork.Task) error) error {
+	return b.subscribe(context.Background(), qname, func(m any) error {
+		t, ok := m.(*tork.Task)
+		if !ok {
+			return errors.Errorf("expecting a *tork.Task but got %T", m)
+		}
+		return handler(t)
+	})
+}
+
+func (b *NATSBroker) PublishTaskProgress(ctx context.Context, t *tork.Task) error {
+	return b.publish(ctx, broker.QUEUE_PROGRESS, t)
+}
+
+func (b *NATSBroker) SubscribeForTaskProgress(handler func(t *tork.Task) error) error {
+	return b.subscribe(context.Background(), broker.QUEUE_PROGRESS, func(m any) error {
+		t, ok := m.(*tork.Task)
+		if !ok {
+			return errors.Errorf("expecting a *tork.Task but got %T", m)
+		}
+		return handler(t)
+	})
+}
+
+func (b *NATSBroker) PublishHeartbeat(ctx context.Context, n *tork.Node) error {
+	return b.publish(ctx, broker.QUEUE_HEARTBEAT, n)
+}
+
+func (b *NATSBroker) SubscribeForHeartbeats(handler func(n *tork.Node) error) error {
+	return b.subscribe(context.Background(), broker.QUEUE_HEARTBEAT, func(m any) error {
+		n, ok := m.(*tork.Node)
+		if !ok {
+			return errors.Errorf("expecting a *tork.Node but got %T", m)
+		}
+		return handler(n)
+	})
+}
+
+func (b *NATSBroker) PublishJob(ctx context.Context, j *tork.Job) error {
+	return b.publish(ctx, broker.QUEUE_JOBS, j)
+}
+
+func (b *NATSBroker) SubscribeForJobs(handler func(j *tork.Job) error) error {
+	return b.subscribe(context.Background(), broker.QUEUE_JOBS, func(m any) error {
+		j, ok := m.(*tork.Job)
+		if !ok {
+			return errors.Errorf("expecting a *tork.Job but got %T", m)
+		}
+		return handler(j)
+	})
+}
+
+func (b *NATSBroker) PublishTaskLogPart(ctx context.Context, p *tork.TaskLogPart) error {
+	return b.publish(ctx, broker.QUEUE_LOGS, p)
+}
+
+func (b *NATSBroker) SubscribeForTaskLogPart(handler func(p *tork.TaskLogPart)) error {
+	return b.subscribe(context.Background(), broker.QUEUE_LOGS, func(m any) error {
+		p, ok := m.(*tork.TaskLogPart)
+		if !ok {
+			return errors.Errorf("expecting a *tork.TaskLogPart but got %T", m)
+		}
+		handler(p)
+		return nil
+	})
+}
+
+func (b *NATSBroker) PublishEvent(ctx context.Context, topic string, event any) error {
+	msg, err := encode(fmt.Sprintf("%s.%s", subjectEvents, topic), event)
+	if err != nil {
+		return err
+	}
+	if err := b.nc.PublishMsg(msg); err != nil {
+		return errors.Wrapf(err, "unable to publish event")
+	}
+	return nil
+}
+
+func (b *NATSBroker) SubscribeForEvents(ctx context.Context, pattern string, handler func(event any)) error {
+	if b.isShuttingDown() {
+		return errors.New("broker is shutting down")
+	}
+	// topic wildcards match across tokens (e.g. job.* matches
+	// job.x.y.z) so subscribe broadly and filter locally.
+	subj := fmt.Sprintf("%s.%s", subjectEvents, pattern)
+	if strings.Contains(pattern, "*") {
+		subj = fmt.Sprintf("%s.>", subjectEvents)
+	}
+	prefix := subjectEvents + "."
+	ns, err := b.nc.Subscribe(subj, func(msg *nats.Msg) {
+		topic := strings.TrimPrefix(msg.Subject, prefix)
+		if !wildcard.Match(pattern, topic) {
+			return
+		}
+		ev, err := decode(msg.Header.Get(headerType), msg.Data)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("topic", topic).
+				Str("body", string(msg.Data)).
+				Msg("failed to deserialize event")
+			return
+		}
+		handler(ev)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error subscribing for events on %s", pattern)
+	}
+	id := uuid.NewUUID()
+	sub := &subscription{
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subscriptions[id] = sub
+	b.mu.Unlock()
+	go func() {
+		defer close(sub.done)
+		select {
+		case <-ctx.Done():
+		case <-sub.cancel:
+		}
+		b.removeSubscription(id)
+		if err := ns.Unsubscribe(); err != nil && !b.nc.IsClosed() {
+			log.Error().Err(err).Msgf("error unsubscribing from %s", pattern)
+		}
+	}()
+	return nil
+}
+
+func (b *NATSBroker) HealthCheck(ctx context.Context) error {
+	if status := b.nc.Status(); status != nats.CONNECTED {
+		return errors.Errorf("NATS connection is %s", status)
+	}
+	return nil
+}
+
+func (b *NATSBroker) isShuttingDown() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.shuttingDown
+}
+
+func (b *NATSBroker) Shutdown(ctx context.Context) error {
+	// when running in standalone mode both the coordinator
+	// and the worker will attempt to shutdown the broker
+	if b.isShuttingDown() {
+		return nil
+	}
+	b.mu.Lock()
+	b.shuttingDown = true
+	subs := make([]*subscription, 0, len(b.subscriptions))
+	for _, sub := range b.subscriptions {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+	for _, sub := range subs {
+		close(sub.cancel)
+	}
+	// the subscriptions may be stuck in their handlers,
+	// so delete their transient queues right away
+	for _, sub := range subs {
+		b.deleteTransientQueue(ctx, sub.qname)
+	}
+	// let's give the coordinator's subscribers a grace
+	// period to allow them to cleanly exit
+	for _, sub := range subs {
+		if sub.qname == "" || !broker.IsCoordinatorQueue(sub.qname) {
+			continue
+		}
+		log.Debug().
+			Msgf("waiting for subscription %s to terminate", sub.qname)
+		select {
+		case <-ctx.Done():
+		case <-sub.done:
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		if err := b.nc.Drain(); err != nil {
+			log.Error().Err(err).Msg("error draining NATS connection")
+		}
+		b.nc.Close()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBroker(t *testing.T, opts ...Option) *NATSBroker {
+	b, err := NewNATSBroker(newTestServer(t).ClientURL(), opts...)
+	assert.NoError(t, err)
+	return b
+}
+
+func newTestServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	assert.NoError(t, err)
+	go s.Start()
+	if !s.ReadyForConnections(time.Second * 10) {
+		t.Fatal("NATS server is not ready for connections")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestNATSPublishAndSubsribeForTask(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	processed := make(chan any)
+	qname := fmt.Sprintf("%stest-%s", broker.QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	err := b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		processed <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+	err = b.PublishTask(ctx, qname, &tork.Task{})
+	assert.NoError(t, err)
+	<-processed
+}
+
+func TestNATSGetQueues(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	qname := fmt.Sprintf("%stest-%s", broker.QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	for i := 0; i < 3; i++ {
+		err := b.PublishTask(ctx, qname, &tork.Task{Priority: i})
+		assert.NoError(t, err)
+	}
+	qis, err := b.Queues(ctx)
+	assert.NoError(t, err)
+	found := false
+	for _, qi := range qis {
+		if qi.Name == qname {
+			found = true
+			assert.Equal(t, 3, qi.Size)
+			assert.Equal(t, 0, qi.Unacked)
+		}
+	}
+	assert.True(t, found)
+
+	block := make(chan any)
+	defer close(block)
+	started := make(chan any)
+	err = b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		started <- 1
+		<-block
+		return nil
+	})
+	assert.NoError(t, err)
+	<-started
+
+	qis, err = b.Queues(ctx)
+	assert.NoError(t, err)
+	for _, qi := range qis {
+		if qi.Name == qname {
+			assert.Equal(t, 3, qi.Size)
+			assert.Equal(t, 1, qi.Unacked)
+		}
+	}
+}
+
+func TestNATSPublishAndSubsribeForHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	processed := make(chan any)
+	err := b.SubscribeForHeartbeats(func(n *tork.Node) error {
+		processed <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+	err = b.PublishHeartbeat(ctx, &tork.Node{})
+	assert.NoError(t, err)
+	<-processed
+}
+
+func TestNATSHeartbeatExpires(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, WithHeartbeatTTL(time.Millisecond*200))
+	err := b.PublishHeartbeat(ctx, &tork.Node{})
+	assert.NoError(t, err)
+	// the server checks for expired messages about once a second
+	time.Sleep(time.Second * 3)
+	processed := make(chan any, 1)
+	err = b.SubscribeForHeartbeats(func(n *tork.Node) error {
+		processed <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+	select {
+	case <-processed:
+		t.Fatal("expected the heartbeat to expire")
+	case <-time.After(time.Second * 2):
+	}
+}
+
+func TestNATSPublishAndSubsribeForJob(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	processed := make(chan any)
+	err := b.SubscribeForJobs(func(j *tork.Job) error {
+		close(processed)
+		return nil
+	})
+	assert.NoError(t, err)
+	err = b.PublishJob(ctx, &tork.Job{})
+	assert.NoError(t, err)
+	<-processed
+}
+
+func TestNATSPublishConcurrent(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	testq := fmt.Sprintf("%stest-%s", broker.QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	processed := make(chan string, 300)
+	for i := 0; i < 3; i++ {
+		err := b.SubscribeForTasks(testq, func(t *tork.Task) error {
+			processed <- t.ID
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				err := b.PublishTask(ctx, testq, &tork.Task{ID: uuid.NewUUID()})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	for i := 0; i < 300; i++ {
+		id := <-processed
+		assert.False(t, seen[id], "task %s delivered more than once", id)
+		seen[id] = true
+	}
+}
+
+func TestNATSTaskPriority(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	qname := fmt.Sprintf("test-%s", uuid.NewUUID())
+	for i := 0; i < 5; i++ {
+		err := b.PublishTask(ctx, qname, &tork.Task{Priority: i})
+		assert.NoError(t, err)
+	}
+	processed := make(chan int, 5)
+	err := b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		processed <- t.Priority
+		return nil
+	})
+	assert.NoError(t, err)
+	for i := 4; i >= 0; i-- {
+		assert.Equal(t, i, <-processed)
+	}
+}
+
+func TestNATSTaskPriorityWhileSubscribed(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	qname := fmt.Sprintf("test-%s", uuid.NewUUID())
+	block := make(chan any)
+	processed := make(chan int, 4)
+	err := b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		processed <- t.Priority
+		<-block
+		return nil
+	})
+	assert.NoError(t, err)
+	err = b.PublishTask(ctx, qname, &tork.Task{Priority: 0})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, <-processed)
+	for i := 1; i <= 3; i++ {
+		err := b.PublishTask(ctx, qname, &tork.Task{Priority: i})
+		assert.NoError(t, err)
+	}
+	close(block)
+	for i := 3; i >= 1; i-- {
+		assert.Equal(t, i, <-processed)
+	}
+}
+
+func TestNATSFailedMessageIsNotRedelivered(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	qname := fmt.Sprintf("%stest-%s", broker.QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	processed := make(chan any, 2)
+	err := b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		processed <- 1
+		return fmt.Errorf("something bad happened")
+	})
+	assert.NoError(t, err)
+	err = b.PublishTask(ctx, qname, &tork.Task{})
+	assert.NoError(t, err)
+	<-processed
+	select {
+	case <-processed:
+		t.Fatal("expected the message to be discarded")
+	case <-time.After(time.Second * 2):
+	}
+}
+
+func TestNATSShutdown(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	mu := sync.Mutex{}
+	qname := fmt.Sprintf("%stest-%s", broker.QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	err := b.SubscribeForTasks(qname, func(t1 *tork.Task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// should not be able to block
+		// the termination process
+		time.Sleep(time.Hour)
+		return nil
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		err = b.PublishTask(ctx, qname, &tork.Task{})
+		assert.NoError(t, err)
+	}
+	// cleanly shutdown
+	err = b.Shutdown(ctx)
+	assert.NoError(t, err)
+	// there should be no more processing past the shutdown
+	err = b.PublishTask(ctx, qname, &tork.Task{})
+	assert.Error(t, err)
+}
+
+func TestNATSShutdownDeletesTransientQueues(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	b, err := NewNATSBroker(s.ClientURL())
+	assert.NoError(t, err)
+	other, err := NewNATSBroker(s.ClientURL())
+	assert.NoError(t, err)
+	nodeID := uuid.NewUUID()
+	xq := fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, nodeID)
+	nq := broker.NodeTaskQueue(nodeID)
+	err = b.SubscribeForTasks(xq, func(t *tork.Task) error { return nil })
+	assert.NoError(t, err)
+	err = b.SubscribeForTasks(nq, func(t *tork.Task) error { return nil })
+	assert.NoError(t, err)
+	err = b.SubscribeForTasks(broker.QUEUE_DEFAULT, func(t *tork.Task) error { return nil })
+	assert.NoError(t, err)
+	queues := func() []string {
+		qis, err := other.Queues(ctx)
+		assert.NoError(t, err)
+		names := make([]string, 0, len(qis))
+		for _, qi := range qis {
+			names = append(names, qi.Name)
+		}
+		return names
+	}
+	assert.Contains(t, queues(), xq)
+	assert.Contains(t, queues(), nq)
+
+	err = b.Shutdown(ctx)
+	assert.NoError(t, err)
+	assert.NotContains(t, queues(), xq)
+	assert.NotContains(t, queues(), nq)
+	// shared queues outlive the nodes
+	assert.Contains(t, queues(), broker.QUEUE_DEFAULT)
+	assert.NoError(t, other.Shutdown(ctx))
+}
+
+func TestNATSSubsribeForEvent(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	defer func() {
+		// cleanly shutdown
+		assert.NoError(t, b.Shutdown(ctx))
+	}()
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateCompleted,
+	}
+	processed1 := make(chan any, 30)
+	processed2 := make(chan any, 10)
+	err := b.SubscribeForEvents(ctx, broker.TOPIC_JOB, func(event any) {
+		j2 := event.(*tork.Job)
+		assert.Equal(t, j1.ID, j2.ID)
+		processed1 <- 1
+	})
+	assert.NoError(t, err)
+	err = b.SubscribeForEvents(ctx, broker.TOPIC_JOB_COMPLETED, func(event any) {
+		j2 := event.(*tork.Job)
+		assert.Equal(t, j1.ID, j2.ID)
+		processed2 <- 1
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		err = b.PublishEvent(ctx, broker.TOPIC_JOB_COMPLETED, j1)
+		assert.NoError(t, err)
+		err = b.PublishEvent(ctx, broker.TOPIC_JOB_FAILED, j1)
+		assert.NoError(t, err)
+		err = b.PublishEvent(ctx, "job.x.y.z", j1)
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < 30; i++ {
+		<-processed1
+	}
+	for i := 0; i < 10; i++ {
+		<-processed2
+	}
+}
+
+func TestNATSPublishUnknownEvent(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	err := b.SubscribeForEvents(ctx, broker.TOPIC_JOB, func(event any) {})
+	assert.NoError(t, err)
+	err = b.PublishEvent(ctx, broker.TOPIC_JOB_COMPLETED, "not a thing")
+	assert.Error(t, err)
+}
+
+func TestNATSHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	assert.NoError(t, b.HealthCheck(ctx))
+	assert.NoError(t, b.Shutdown(ctx))
+	assert.Error(t, b.HealthCheck(ctx))
+}
+
+func TestNATSTaskLogPartAndProgress(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+	logs := make(chan any)
+	err := b.SubscribeForTaskLogPart(func(p *tork.TaskLogPart) {
+		close(logs)
+	})
+	assert.NoError(t, err)
+	progress := make(chan any)
+	err = b.SubscribeForTaskProgress(func(t *tork.Task) error {
+		close(progress)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, b.PublishTaskLogPart(ctx, &tork.TaskLogPart{}))
+	assert.NoError(t, b.PublishTaskProgress(ctx, &tork.Task{}))
+	<-logs
+	<-progress
+}
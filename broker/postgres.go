@@ -0,0 +1,793 @@
+package broker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/internal/wildcard"
+)
+
+const (
+	POSTGRES_DEFAULT_CONSUMER_TIMEOUT = time.Minute * 30
+	POSTGRES_DEFAULT_POLL_INTERVAL    = time.Second * 5
+)
+
+const (
+	pgChannel          = "tork_broker"
+	pgNotifyQueue      = "q:"
+	pgNotifyEvent      = "e"
+	pgSchemaLock       = 8675309
+	pgConsumerTTL      = time.Minute
+	pgCursorTTL        = pgCleanupInterval * 5
+	pgCleanupInterval  = time.Minute
+	pgDefaultHeartbeat = time.Millisecond * defaultHeartbeatTTL
+)
+
+const pgSchema = `
+CREATE TABLE IF NOT EXISTS tork_broker_messages (
+    id           bigserial    not null primary key,
+    queue        varchar(256) not null,
+    priority     int          not null default 0,
+    mtype        varchar(64)  not null,
+    body         text         not null,
+    created_at   timestamptz  not null default now(),
+    expires_at   timestamptz,
+    locked_until timestamptz,
+    locked_by    varchar(64)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tork_broker_messages_queue ON tork_broker_messages (queue,priority DESC,id);
+
+CREATE TABLE IF NOT EXISTS tork_broker_events (
+    id         bigserial    not null primary key,
+    topic      varchar(256) not null,
+    mtype      varchar(64)  not null,
+    body       text         not null,
+    created_at timestamptz  not null default now()
+);
+
+ALTER TABLE tork_broker_events ADD COLUMN IF NOT EXISTS xid xid8 not null default pg_current_xact_id();
+
+CREATE INDEX IF NOT EXISTS idx_tork_broker_events_created_at ON tork_broker_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_tork_broker_events_xid ON tork_broker_events (xid,id);
+
+CREATE TABLE IF NOT EXISTS tork_broker_consumers (
+    id           varchar(64)  not null primary key,
+    queue        varchar(256) not null,
+    last_seen_at timestamptz  not null
+);
+
+CREATE TABLE IF NOT EXISTS tork_broker_cursors (
+    id           varchar(64)  not null primary key,
+    xid          xid8         not null,
+    event_id     bigint       not null,
+    last_seen_at timestamptz  not null
+);
+`
+
+// PostgresBroker is an implementation of the Broker interface
+// which uses Postgres tables as queues. Messages are claimed using
+// FOR UPDATE SKIP LOCKED so that any number of consumers can safely
+// compete over the same queue, and LISTEN/NOTIFY is used to wake up
+// consumers and to fan out events.
+//
+// Events are read in commit order: the ID of the transaction that
+// published an event is recorded along with it and events are only
+// read once every transaction with a lower ID has finished, so an
+// event whose transaction commits late is never skipped. As a
+// consequence, a long running transaction on the database delays
+// the delivery of events until it finishes.
+//
+// Every broker records how far it read the events, and an event is
+// only deleted once all the brokers have read past it.
+type PostgresBroker struct {
+	id              string
+	db              *sqlx.DB
+	listener        *pq.Listener
+	subscriptions   map[string]*pgSubscription
+	mu              sync.RWMutex
+	shuttingDown    bool
+	consumerTimeout time.Duration
+	heartbeatTTL    time.Duration
+	pollInterval    time.Duration
+	lastEventXID    int64
+	lastEventID     int64
+	done            chan struct{}
+	stopped         chan struct{}
+}
+
+type pgSubscription struct {
+	qname   string
+	pattern string
+	handler func(msg any) error
+	wake    chan struct{}
+	cancel  chan struct{}
+	done    chan struct{}
+	events  []any
+	emu     sync.Mutex
+}
+
+type pgMessage struct {
+	ID    int64  `db:"id"`
+	MType string `db:"mtype"`
+	Body  string `db:"body"`
+}
+
+type PostgresOption = func(b *PostgresBroker)
+
+// WithPostgresConsumerTimeout sets the maximum amount of time a
+// consumer may hold on to a message before it is deemed undelivered
+// and made available to other consumers. Default: 30 minutes
+func WithPostgresConsumerTimeout(timeout time.Duration) PostgresOption {
+	return func(b *PostgresBroker) {
+		b.consumerTimeout = timeout
+	}
+}
+
+// WithPostgresPollInterval sets how often idle consumers check
+// their queue in case a notification was missed. Default: 5 seconds
+func WithPostgresPollInterval(interval time.Duration) PostgresOption {
+	return func(b *PostgresBroker) {
+		b.pollInterval = interval
+	}
+}
+
+// WithPostgresHeartbeatTTL sets the TTL for a heartbeat pending in the queue.
+func WithPostgresHeartbeatTTL(ttl time.Duration) PostgresOption {
+	return func(b *PostgresBroker) {
+		b.heartbeatTTL = ttl
+	}
+}
+
+func NewPostgresBroker(dsn string, opts ...PostgresOption) (*PostgresBroker, error) {
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to postgres")
+	}
+	b := &PostgresBroker{
+		id:              uuid.NewUUID(),
+		db:              db,
+		subscriptions:   make(map[string]*pgSubscription),
+		consumerTimeout: POSTGRES_DEFAULT_CONSUMER_TIMEOUT,
+		heartbeatTTL:    pgDefaultHeartbeat,
+		pollInterval:    POSTGRES_DEFAULT_POLL_INTERVAL,
+		done:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(b)
+	}
+	if err := b.initSchema(); err != nil {
+		return nil, err
+	}
+	if err := b.skipEvents(); err != nil {
+		return nil, err
+	}
+	if err := b.saveCursor(); err != nil {
+		return nil, err
+	}
+	b.listener = pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Error().Err(err).Msg("postgres broker listener error")
+		}
+	})
+	if err := b.listener.Listen(pgChannel); err != nil {
+		return nil, errors.Wrapf(err, "error listening on %s", pgChannel)
+	}
+	go b.dispatch()
+	return b, nil
+}
+
+func (b *PostgresBroker) initSchema() error {
+	tx, err := b.db.Beginx()
+	if err != nil {
+		return errors.Wrapf(err, "error starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	// serialize schema creation across brokers starting concurrently
+	if _, err := tx.Exec("select pg_advisory_xact_lock($1)", pgSchemaLock); err != nil {
+		return errors.Wrapf(err, "error acquiring schema lock")
+	}
+	if _, err := tx.Exec(pgSchema); err != nil {
+		return errors.Wrapf(err, "error creating broker schema")
+	}
+	return tx.Commit()
+}
+
+// dispatch routes notifications to the relevant subscriptions
+// and periodically expunges expired messages and events.
+func (b *PostgresBroker) dispatch() {
+	defer close(b.stopped)
+	cleanup := time.NewTicker(pgCleanupInterval)
+	defer cleanup.Stop()
+	poll := time.NewTicker(b.pollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case n := <-b.listener.Notify:
+			if n == nil {
+				// the listener reconnected so we
+				// may have missed notifications
+				b.wakeAll()
+				b.deliverEvents()
+				continue
+			}
+			if n.Extra == pgNotifyEvent {
+				b.deliverEvents()
+			} else if qname, ok := strings.CutPrefix(n.Extra, pgNotifyQueue); ok {
+				b.wakeQueue(qname)
+			}
+		case <-poll.C:
+			b.deliverEvents()
+		case <-cleanup.C:
+			if err := b.cleanup(); err != nil {
+				log.Error().Err(err).Msg("error cleaning up postgres broker tables")
+			}
+		}
+	}
+}
+
+func (b *PostgresBroker) wakeQueue(qname string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subscriptions {
+		if sub.qname == qname {
+			sub.notify()
+		}
+	}
+}
+
+func (b *PostgresBroker) wakeAll() {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subscriptions {
+		sub.notify()
+	}
+}
+
+func (s *pgSubscription) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue hands an event over to the subscription's own
+// goroutine so that a slow handler never holds up the
+// dispatcher or any other subscription.
+func (s *pgSubscription) enqueue(ev any) {
+	s.emu.Lock()
+	s.events = append(s.events, ev)
+	s.emu.Unlock()
+	s.notify()
+}
+
+func (s *pgSubscription) dequeue() []any {
+	s.emu.Lock()
+	defer s.emu.Unlock()
+	evs := s.events
+	s.events = nil
+	return evs
+}
+
+func (b *PostgresBroker) eventSubscriptions() []*pgSubscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	subs := make([]*pgSubscription, 0)
+	for _, sub := range b.subscriptions {
+		if sub.pattern != "" {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+func (b *PostgresBroker) deliverEvents() {
+	subs := b.eventSubscriptions()
+	if len(subs) == 0 {
+		return
+	}
+	type eventRecord struct {
+		ID    int64  `db:"id"`
+		XID   int64  `db:"xid"`
+		Topic string `db:"topic"`
+		MType string `db:"mtype"`
+		Body  string `db:"body"`
+	}
+	rs := []eventRecord{}
+	// only read events of transactions older than the oldest
+	// transaction still in progress: no event can show up
+	// behind the cursor once it moved past them.
+	q := `select id, xid::text::bigint as xid, topic, mtype, body
+	      from tork_broker_events
+	      where (xid > $1::text::xid8 or (xid = $1::text::xid8 and id > $2))
+	      and xid < pg_snapshot_xmin(pg_current_snapshot())
+	      order by xid, id`
+	if err := b.db.Select(&rs, q, b.lastEventXID, b.lastEventID); err != nil {
+		log.Error().Err(err).Msg("error fetching events")
+		return
+	}
+	for _, r := range rs {
+		b.lastEventXID, b.lastEventID = r.XID, r.ID
+		ev, err := deserialize(r.MType, []byte(r.Body))
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("topic", r.Topic).
+				Str("body", r.Body).
+				Msg("failed to deserialize event")
+			continue
+		}
+		for _, sub := range subs {
+			if wildcard.Match(sub.pattern, r.Topic) {
+				sub.enqueue(ev)
+			}
+		}
+	}
+}
+
+// skipEvents moves the cursor past the events
+// which can be read at this point.
+func (b *PostgresBroker) skipEvents() error {
+	cursor := struct {
+		XID int64 `db:"xid"`
+		ID  int64 `db:"id"`
+	}{}
+	q := `select xid::text::bigint as xid, id from tork_broker_events
+	      where xid < pg_snapshot_xmin(pg_current_snapshot())
+	      order by xid desc, id desc limit 1`
+	if err := b.db.Get(&cursor, q); err != nil && err != sql.ErrNoRows {
+		return errors.Wrapf(err, "error getting the last event id")
+	}
+	if cursor.XID > b.lastEventXID || (cursor.XID == b.lastEventXID && cursor.ID > b.lastEventID) {
+		b.lastEventXID, b.lastEventID = cursor.XID, cursor.ID
+	}
+	return nil
+}
+
+// saveCursor records how far the broker read the events,
+// which holds back their cleanup until it reads past them.
+func (b *PostgresBroker) saveCursor() error {
+	q := `insert into tork_broker_cursors (id,xid,event_id,last_seen_at)
+	      values ($1,$2::text::xid8,$3,now())
+	      on conflict (id) do update set xid = excluded.xid, event_id = excluded.event_id, last_seen_at = now()`
+	if _, err := b.db.Exec(q, b.id, b.lastEventXID, b.lastEventID); err != nil {
+		return errors.Wrapf(err, "error saving the events cursor")
+	}
+	return nil
+}
+
+func (b *PostgresBroker) cleanup() error {
+	if _, err := b.db.Exec("delete from tork_broker_messages where expires_at < now()"); err != nil {
+		return errors.Wrapf(err, "error expunging expired messages")
+	}
+	// a broker which isn't subscribed to any
+	// event has no reason to hold them back
+	if len(b.eventSubscriptions()) == 0 {
+		if err := b.skipEvents(); err != nil {
+			return err
+		}
+	}
+	if err := b.saveCursor(); err != nil {
+		return err
+	}
+	if _, err := b.db.Exec("delete from tork_broker_cursors where last_seen_at < $1", time.Now().UTC().Add(-pgCursorTTL)); err != nil {
+		return errors.Wrapf(err, "error expunging stale cursors")
+	}
+	// delete the events which were read by every broker. The events of
+	// transactions still in progress are beyond the reach of any cursor.
+	q := `delete from tork_broker_events e
+	      where e.xid < pg_snapshot_xmin(pg_current_snapshot())
+	      and not exists (
+	        select 1 from tork_broker_cursors c
+	        where (c.xid, c.event_id) < (e.xid, e.id)
+	      )`
+	if _, err := b.db.Exec(q); err != nil {
+		return errors.Wrapf(err, "error expunging delivered events")
+	}
+	if _, err := b.db.Exec("delete from tork_broker_consumers where last_seen_at < $1", time.Now().UTC().Add(-pgConsumerTTL)); err != nil {
+		return errors.Wrapf(err, "error expunging stale consumers")
+	}
+	return nil
+}
+
+func (b *PostgresBroker) Queues(ctx context.Context) ([]QueueInfo, error) {
+	type queueRecord struct {
+		Name        string `db:"name"`
+		Size        int    `db:"size"`
+		Subscribers int    `db:"subscribers"`
+		Unacked     int    `db:"unacked"`
+	}
+	rs := []queueRecord{}
+	q := `with m as (
+	        select queue, count(*) as size, count(*) filter (where locked_until > now()) as unacked
+	        from tork_broker_messages
+	        where expires_at is null or expires_at > now()
+	        group by queue
+	      ),
+	      c as (
+	        select queue, count(*) as subscribers
+	        from tork_broker_consumers
+	        where last_seen_at > $1
+	        group by queue
+	      )
+	      select coalesce(m.queue,c.queue) as name,
+	             coalesce(m.size,0) as size,
+	             coalesce(c.subscribers,0) as subscribers,
+	             coalesce(m.unacked,0) as unacked
+	      from m full outer join c on m.queue = c.queue
+	      order by name`
+	if err := b.db.SelectContext(ctx, &rs, q, time.Now().UTC().Add(-pgConsumerTTL)); err != nil {
+		return nil, errors.Wrapf(err, "error getting queues")
+	}
+	qis := make([]QueueInfo, len(rs))
+	for i, r := range rs {
+		qis[i] = QueueInfo{
+			Name:        r.Name,
+			Size:        r.Size,
+			Subscribers: r.Subscribers,
+			Unacked:     r.Unacked,
+		}
+	}
+	return qis, nil
+}
+
+func (b *PostgresBroker) publish(ctx context.Context, qname string, msg any) error {
+	body, err := serialize(msg)
+	if err != nil {
+		return err
+	}
+	var priority int
+	if t, ok := msg.(*tork.Task); ok {
+		priority = t.Priority
+	}
+	var expiresAt *time.Time
+	if qname == QUEUE_HEARTBEAT {
+		exp := time.Now().UTC().Add(b.heartbeatTTL)
+		expiresAt = &exp
+	}
+	q := `with m as (
+	        insert into tork_broker_messages (queue,priority,mtype,body,expires_at)
+	        values ($1,$2,$3,$4,$5) returning queue
+	      )
+	      select pg_notify($6, $7 || queue) from m`
+	if _, err := b.db.ExecContext(ctx, q, qname, priority, fmt.Sprintf("%T", msg), string(body), expiresAt, pgChannel, pgNotifyQueue); err != nil {
+		return errors.Wrapf(err, "unable to publish message")
+	}
+	return nil
+}
+
+func (b *PostgresBroker) subscribe(ctx context.Context, qname string, handler func(msg any) error) error {
+	if b.isShuttingDown() {
+		return errors.New("broker is shutting down")
+	}
+	id := uuid.NewUUID()
+	sub := &pgSubscription{
+		qname:   qname,
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+		cancel:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := b.touchConsumer(id, qname); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.subscriptions[id] = sub
+	b.mu.Unlock()
+	log.Debug().Msgf("created consumer %s for queue: %s", id, qname)
+	go func() {
+		defer close(sub.done)
+		defer b.removeSubscription(id, sub)
+		lastSeen := time.Now()
+		for {
+			select {
+			case <-sub.cancel:
+				log.Debug().Msgf("subscription for queue %s canceled", qname)
+				return
+			case <-ctx.Done():
+				log.Debug().Msgf("context canceled, stopping subscription for queue: %s", qname)
+				return
+			default:
+			}
+			if time.Since(lastSeen) > pgConsumerTTL/2 {
+				if err := b.touchConsumer(id, qname); err != nil {
+					log.Error().Err(err).Msgf("error updating consumer for queue: %s", qname)
+				}
+				lastSeen = time.Now()
+			}
+			m, err := b.claim(id, qname)
+			if err != nil {
+				log.Error().Err(err).Msgf("error claiming message from queue: %s", qname)
+			}
+			if m == nil {
+				select {
+				case <-sub.cancel:
+				case <-ctx.Done():
+				case <-sub.wake:
+				case <-time.After(b.pollInterval):
+				}
+				continue
+			}
+			b.handle(id, qname, m, handler)
+		}
+	}()
+	return nil
+}
+
+// claim locks the next available message on the queue for the
+// given consumer. Messages whose lock expired (e.g. because their
+// consumer died) become available again.
+func (b *PostgresBroker) claim(consumerID, qname string) (*pgMessage, error) {
+	q := `update tork_broker_messages set locked_until = $2, locked_by = $3
+	      where id = (
+	        select id from tork_broker_messages
+	        where queue = $1
+	        and (locked_until is null or locked_until < now())
+	        and (expires_at is null or expires_at > now())
+	        order by priority desc, id
+	        limit 1
+	        for update skip locked
+	      )
+	      returning id, mtype, body`
+	m := pgMessage{}
+	if err := b.db.Get(&m, q, qname, time.Now().UTC().Add(b.consumerTimeout), consumerID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (b *PostgresBroker) handle(consumerID, qname string, m *pgMessage, handler func(msg any) error) {
+	if msg, err := deserialize(m.MType, []byte(m.Body)); err != nil {
+		log.Error().
+			Err(err).
+			Str("queue", qname).
+			Str("body", m.Body).
+			Str("type", m.MType).
+			Msg("failed to deserialize message")
+	} else if err := handler(msg); err != nil {
+		log.Error().
+			Err(err).
+			Str("queue", qname).
+			Str("body", m.Body).
+			Msg("failed to handle message")
+	}
+	// like a rejected message on RabbitMQ, a message that failed
+	// to be handled is discarded rather than requeued.
+	if _, err := b.db.Exec("delete from tork_broker_messages where id = $1 and locked_by = $2", m.ID, consumerID); err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to ack message")
+	}
+}
+
+func (b *PostgresBroker) touchConsumer(id, qname string) error {
+	q := `insert into tork_broker_consumers (id,queue,last_seen_at) values ($1,$2,$3)
+	      on conflict (id) do update set last_seen_at = excluded.last_seen_at`
+	if _, err := b.db.Exec(q, id, qname, time.Now().UTC()); err != nil {
+		return errors.Wrapf(err, "error registering consumer")
+	}
+	return nil
+}
+
+func (b *PostgresBroker) removeSubscription(id string, sub *pgSubscription) {
+	b.mu.Lock()
+	delete(b.subscriptions, id)
+	b.mu.Unlock()
+	if sub.qname == "" {
+		return
+	}
+	if _, err := b.db.Exec("delete from tork_broker_consumers where id = $1", id); err != nil {
+		log.Debug().Err(err).Msgf("error removing consumer for queue: %s", sub.qname)
+	}
+	// exclusive queues don't outlive their subscriber
+	if strings.HasPrefix(sub.qname, QUEUE_EXCLUSIVE_PREFIX) {
+		if _, err := b.db.Exec("delete from tork_broker_messages where queue = $1", sub.qname); err != nil {
+			log.Debug().Err(err).Msgf("error deleting queue: %s", sub.qname)
+		}
+	}
+}
+
+func (b *PostgresBroker) PublishTask(ctx context.Context, qname string, t *tork.Task) error {
+	return b.publish(ctx, qname, t)
+}
+
+func (b *PostgresBroker) SubscribeForTasks(qname string, handler func(t *tork.Task) error) error {
+	return b.subscribe(context.Background(), qname, func(msg any) error {
+		t, ok := msg.(*tork.Task)
+		if !ok {
+			return errors.Errorf("expecting a *tork.Task but got %T", msg)
+		}
+		return handler(t)
+	})
+}
+
+func (b *PostgresBroker) PublishTaskProgress(ctx context.Context, t *tork.Task) error {
+	return b.publish(ctx, QUEUE_PROGRESS, t)
+}
+
+func (b *PostgresBroker) SubscribeForTaskProgress(handler func(t *tork.Task) error) error {
+	return b.subscribe(context.Background(), QUEUE_PROGRESS, func(msg any) error {
+		t, ok := msg.(*tork.Task)
+		if !ok {
+			return errors.Errorf("expecting a *tork.Task but got %T", msg)
+		}
+		return handler(t)
+	})
+}
+
+func (b *PostgresBroker) PublishHeartbeat(ctx context.Context, n *tork.Node) error {
+	return b.publish(ctx, QUEUE_HEARTBEAT, n)
+}
+
+func (b *PostgresBroker) SubscribeForHeartbeats(handler func(n *tork.Node) error) error {
+	return b.subscribe(context.Background(), QUEUE_HEARTBEAT, func(msg any) error {
+		n, ok := msg.(*tork.Node)
+		if !ok {
+			return errors.Errorf("expecting a *tork.Node but got %T", msg)
+		}
+		return handler(n)
+	})
+}
+
+func (b *PostgresBroker) PublishJob(ctx context.Context, j *tork.Job) error {
+	return b.publish(ctx, QUEUE_JOBS, j)
+}
+
+func (b *PostgresBroker) SubscribeForJobs(handler func(j *tork.Job) error) error {
+	return b.subscribe(context.Background(), QUEUE_JOBS, func(msg any) error {
+		j, ok := msg.(*tork.Job)
+		if !ok {
+			return errors.Errorf("expecting a *tork.Job but got %T", msg)
+		}
+		return handler(j)
+	})
+}
+
+func (b *PostgresBroker) PublishTaskLogPart(ctx context.Context, p *tork.TaskLogPart) error {
+	return b.publish(ctx, QUEUE_LOGS, p)
+}
+
+func (b *PostgresBroker) SubscribeForTaskLogPart(handler func(p *tork.TaskLogPart)) error {
+	return b.subscribe(context.Background(), QUEUE_LOGS, func(msg any) error {
+		p, ok := msg.(*tork.TaskLogPart)
+		if !ok {
+			return errors.Errorf("expecting a *tork.TaskLogPart but got %T", msg)
+		}
+		handler(p)
+		return nil
+	})
+}
+
+func (b *PostgresBroker) PublishEvent(ctx context.Context, topic string, event any) error {
+	body, err := serialize(event)
+	if err != nil {
+		return err
+	}
+	q := `with e as (
+	        insert into tork_broker_events (topic,mtype,body) values ($1,$2,$3) returning id
+	      )
+	      select pg_notify($4, $5) from e`
+	if _, err := b.db.ExecContext(ctx, q, topic, fmt.Sprintf("%T", event), string(body), pgChannel, pgNotifyEvent); err != nil {
+		return errors.Wrapf(err, "unable to publish event")
+	}
+	return nil
+}
+
+func (b *PostgresBroker) SubscribeForEvents(ctx context.Context, pattern string, handler func(event any)) error {
+	if b.isShuttingDown() {
+		return errors.New("broker is shutting down")
+	}
+	id := uuid.NewUUID()
+	sub := &pgSubscription{
+		pattern: pattern,
+		handler: func(msg any) error {
+			handler(msg)
+			return nil
+		},
+		wake:   make(chan struct{}, 1),
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subscriptions[id] = sub
+	b.mu.Unlock()
+	go func() {
+		defer close(sub.done)
+		defer b.removeSubscription(id, sub)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.cancel:
+				return
+			case <-sub.wake:
+			}
+			for _, ev := range sub.dequeue() {
+				if err := sub.handler(ev); err != nil {
+					log.Error().Err(err).Str("pattern", pattern).Msg("failed to handle event")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *PostgresBroker) HealthCheck(ctx context.Context) error {
+	if b.isShuttingDown() {
+		return errors.New("broker is shutting down")
+	}
+	if err := b.db.PingContext(ctx); err != nil {
+		return errors.Wrapf(err, "error pinging postgres")
+	}
+	return nil
+}
+
+func (b *PostgresBroker) isShuttingDown() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.shuttingDown
+}
+
+func (b *PostgresBroker) Shutdown(ctx context.Context) error {
+	// when running in standalone mode both the coordinator
+	// and the worker will attempt to shutdown the broker
+	if b.isShuttingDown() {
+		return nil
+	}
+	b.mu.Lock()
+	b.shuttingDown = true
+	subs := make([]*pgSubscription, 0, len(b.subscriptions))
+	for _, sub := range b.subscriptions {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+	for _, sub := range subs {
+		close(sub.cancel)
+	}
+	// let's give the coordinator's subscribers a grace
+	// period to allow them to cleanly exit
+	for _, sub := range subs {
+		if !IsCoordinatorQueue(sub.qname) {
+			continue
+		}
+		log.Debug().
+			Msgf("waiting for subscription %s to terminate", sub.qname)
+		select {
+		case <-ctx.Done():
+		case <-sub.done:
+		}
+	}
+	close(b.done)
+	select {
+	case <-ctx.Done():
+	case <-b.stopped:
+	}
+	if err := b.listener.Close(); err != nil {
+		log.Error().Err(err).Msg("error closing postgres listener")
+	}
+	if _, err := b.db.Exec("delete from tork_broker_cursors where id = $1", b.id); err != nil {
+		log.Error().Err(err).Msg("error removing the events cursor")
+	}
+	if err := b.db.Close(); err != nil {
+		return errors.Wrapf(err, "error closing postgres connection")
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPostgresDSN = "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
+
+func TestPostgresPublishAndSubsribeForTask(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	processed := make(chan any)
+	qname := fmt.Sprintf("%stest-%s", QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	err = b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		processed <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+	err = b.PublishTask(ctx, qname, &tork.Task{})
+	<-processed
+	assert.NoError(t, err)
+}
+
+func TestPostgresGetQueues(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	qname := fmt.Sprintf("%stest-%s", QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	for i := 0; i < 3; i++ {
+		err = b.PublishTask(ctx, qname, &tork.Task{})
+		assert.NoError(t, err)
+	}
+	qis, err := b.Queues(ctx)
+	assert.NoError(t, err)
+	var found *QueueInfo
+	for _, qi := range qis {
+		if qi.Name == qname {
+			found = &qi
+		}
+	}
+	assert.NotNil(t, found)
+	assert.Equal(t, 3, found.Size)
+	assert.Equal(t, 0, found.Subscribers)
+	assert.Equal(t, 0, found.Unacked)
+
+	block := make(chan any)
+	defer close(block)
+	started := make(chan any)
+	err = b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		started <- 1
+		<-block
+		return nil
+	})
+	assert.NoError(t, err)
+	<-started
+
+	qis, err = b.Queues(ctx)
+	assert.NoError(t, err)
+	for _, qi := range qis {
+		if qi.Name == qname {
+			assert.Equal(t, 3, qi.Size)
+			assert.Equal(t, 1, qi.Subscribers)
+			assert.Equal(t, 1, qi.Unacked)
+		}
+	}
+}
+
+func TestPostgresPublishAndSubsribeForHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN, WithPostgresHeartbeatTTL(time.Second))
+	assert.NoError(t, err)
+	processed := make(chan any)
+	err = b.SubscribeForHeartbeats(func(n *tork.Node) error {
+		processed <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+	err = b.PublishHeartbeat(ctx, &tork.Node{})
+	assert.NoError(t, err)
+	<-processed
+	assert.NoError(t, b.Shutdown(ctx))
+}
+
+func TestPostgresPublishAndSubsribeForJob(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	processed := make(chan any)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		close(processed)
+		return nil
+	})
+	assert.NoError(t, err)
+	err = b.PublishJob(ctx, &tork.Job{})
+	<-processed
+	assert.NoError(t, err)
+	assert.NoError(t, b.Shutdown(ctx))
+}
+
+func TestPostgresPublishConcurrent(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	testq := fmt.Sprintf("%stest-%s", QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	processed := make(chan string, 300)
+	for i := 0; i < 3; i++ {
+		err = b.SubscribeForTasks(testq, func(t *tork.Task) error {
+			processed <- t.ID
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				err := b.PublishTask(ctx, testq, &tork.Task{ID: uuid.NewUUID()})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	for i := 0; i < 300; i++ {
+		id := <-processed
+		assert.False(t, seen[id], "task %s delivered more than once", id)
+		seen[id] = true
+	}
+}
+
+func TestPostgresShutdown(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	mu := sync.Mutex{}
+	qname := fmt.Sprintf("%stest-%s", QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	err = b.SubscribeForTasks(qname, func(t1 *tork.Task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// should not be able to block
+		// the termination process
+		time.Sleep(time.Hour)
+		return nil
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		err = b.PublishTask(ctx, qname, &tork.Task{})
+		assert.NoError(t, err)
+	}
+	// cleanly shutdown
+	err = b.Shutdown(ctx)
+	assert.NoError(t, err)
+	// there should be no more processing past the shutdown
+	err = b.PublishTask(ctx, qname, &tork.Task{})
+	assert.Error(t, err)
+}
+
+func TestPostgresSubsribeForEvent(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	defer func() {
+		// cleanly shutdown
+		err = b.Shutdown(ctx)
+		assert.NoError(t, err)
+	}()
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateCompleted,
+	}
+	processed1 := make(chan any, 30)
+	processed2 := make(chan any, 10)
+	err = b.SubscribeForEvents(ctx, TOPIC_JOB, func(event any) {
+		j2 := event.(*tork.Job)
+		assert.Equal(t, j1.ID, j2.ID)
+		processed1 <- 1
+	})
+	assert.NoError(t, err)
+	err = b.SubscribeForEvents(ctx, TOPIC_JOB_COMPLETED, func(event any) {
+		j2 := event.(*tork.Job)
+		assert.Equal(t, j1.ID, j2.ID)
+		processed2 <- 1
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		err = b.PublishEvent(ctx, TOPIC_JOB_COMPLETED, j1)
+		assert.NoError(t, err)
+		err = b.PublishEvent(ctx, TOPIC_JOB_FAILED, j1)
+		assert.NoError(t, err)
+		err = b.PublishEvent(ctx, "job.x.y.z", j1)
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < 30; i++ {
+		<-processed1
+	}
+	close(processed1)
+	for i := 0; i < 10; i++ {
+		<-processed2
+	}
+	close(processed2)
+}
+
+func TestPostgresEventCommittedOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN, WithPostgresPollInterval(time.Millisecond*100))
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, b.Shutdown(ctx))
+	}()
+	j1 := &tork.Job{ID: uuid.NewUUID()}
+	j2 := &tork.Job{ID: uuid.NewUUID()}
+	received := make(chan string, 2)
+	err = b.SubscribeForEvents(ctx, TOPIC_JOB, func(event any) {
+		received <- event.(*tork.Job).ID
+	})
+	assert.NoError(t, err)
+	// insert the first event in a transaction which
+	// only commits after a later event was delivered
+	body, err := serialize(j1)
+	assert.NoError(t, err)
+	tx, err := b.db.Beginx()
+	assert.NoError(t, err)
+	_, err = tx.Exec("insert into tork_broker_events (topic,mtype,body) values ($1,$2,$3)", TOPIC_JOB_COMPLETED, "*tork.Job", string(body))
+	assert.NoError(t, err)
+	err = b.PublishEvent(ctx, TOPIC_JOB_COMPLETED, j2)
+	assert.NoError(t, err)
+	select {
+	case id := <-received:
+		t.Fatalf("unexpected event for job %s before the first transaction committed", id)
+	case <-time.After(time.Millisecond * 500):
+	}
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, j1.ID, <-received)
+	assert.Equal(t, j2.ID, <-received)
+}
+
+func TestPostgresEventCleanup(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN, WithPostgresPollInterval(time.Millisecond*100))
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, b.Shutdown(ctx))
+	}()
+	other, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, other.Shutdown(ctx))
+	}()
+	j1 := &tork.Job{ID: uuid.NewUUID()}
+	received := make(chan string, 1)
+	err = b.SubscribeForEvents(ctx, TOPIC_JOB, func(event any) {
+		received <- event.(*tork.Job).ID
+	})
+	assert.NoError(t, err)
+	// publish an event in a transaction which
+	// stays open for longer than its age
+	body, err := serialize(j1)
+	assert.NoError(t, err)
+	tx, err := b.db.Beginx()
+	assert.NoError(t, err)
+	var id int64
+	err = tx.Get(&id, "insert into tork_broker_events (topic,mtype,body,created_at) values ($1,$2,$3,now() - interval '1 day') returning id", TOPIC_JOB_COMPLETED, "*tork.Job", string(body))
+	assert.NoError(t, err)
+	assert.NoError(t, other.cleanup())
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, j1.ID, <-received)
+	// the event is kept until every broker records it read it
+	assert.NoError(t, other.cleanup())
+	var count int
+	err = other.db.Get(&count, "select count(*) from tork_broker_events where id = $1", id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestPostgresSlowEventHandler(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, b.Shutdown(ctx))
+	}()
+	block := make(chan any)
+	defer close(block)
+	err = b.SubscribeForEvents(ctx, TOPIC_JOB, func(event any) {
+		<-block
+	})
+	assert.NoError(t, err)
+	processed := make(chan any, 3)
+	err = b.SubscribeForEvents(ctx, TOPIC_JOB, func(event any) {
+		processed <- 1
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		err = b.PublishEvent(ctx, TOPIC_JOB_COMPLETED, &tork.Job{ID: uuid.NewUUID()})
+		assert.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		<-processed
+	}
+	// queues keep being served while an event handler is busy
+	qname := fmt.Sprintf("test-%s", uuid.NewUUID())
+	tasks := make(chan any)
+	err = b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		close(tasks)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, b.PublishTask(ctx, qname, &tork.Task{}))
+	<-tasks
+}
+
+func TestPostgresPublishUnknownEvent(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	defer func() {
+		// cleanly shutdown
+		err = b.Shutdown(ctx)
+		assert.NoError(t, err)
+	}()
+	err = b.SubscribeForEvents(ctx, TOPIC_JOB, func(event any) {})
+	assert.NoError(t, err)
+
+	err = b.PublishEvent(ctx, TOPIC_JOB_COMPLETED, "not a thing")
+	assert.Error(t, err)
+}
+
+func TestPostgresHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	assert.NoError(t, b.HealthCheck(ctx))
+	assert.NoError(t, b.Shutdown(ctx))
+	assert.Error(t, b.HealthCheck(ctx))
+}
+
+func TestPostgresTaskPriority(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	qname := fmt.Sprintf("%stest-%s", QUEUE_EXCLUSIVE_PREFIX, uuid.NewUUID())
+	for i := 0; i < 5; i++ {
+		err = b.PublishTask(ctx, qname, &tork.Task{Priority: i})
+		assert.NoError(t, err)
+	}
+	processed := make(chan int, 5)
+	err = b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		processed <- t.Priority
+		return nil
+	})
+	assert.NoError(t, err)
+	for i := 4; i >= 0; i-- {
+		assert.Equal(t, i, <-processed)
+	}
+}
+
+func TestPostgresTaskLogPartAndProgress(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewPostgresBroker(testPostgresDSN)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, b.Shutdown(ctx))
+	}()
+	logs := make(chan any, 1)
+	err = b.SubscribeForTaskLogPart(func(p *tork.TaskLogPart) {
+		select {
+		case logs <- 1:
+		default:
+		}
+	})
+	assert.NoError(t, err)
+	progress := make(chan any, 1)
+	err = b.SubscribeForTaskProgress(func(t *tork.Task) error {
+		select {
+		case progress <- 1:
+		default:
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, b.PublishTaskLogPart(ctx, &tork.TaskLogPart{}))
+	assert.NoError(t, b.PublishTaskProgress(ctx, &tork.Task{}))
+	<-logs
+	<-progress
+}
@@ -1,6 +1,7 @@
 package broker
 
 import (
+	"fmt"
 	"strings"
 
 	"golang.org/x/exp/slices"
@@ -35,6 +36,9 @@ const (
 	// The prefix used for queues that
 	// are exclusive
 	QUEUE_EXCLUSIVE_PREFIX = "x-"
+	// The prefix used for the queues of the tasks
+	// which must run on a specific worker node
+	QUEUE_NODE_PREFIX = "node-"
 )
 
 type QueueInfo struct {
@@ -65,3 +69,13 @@ func IsWorkerQueue(qname string) bool {
 func IsTaskQueue(qname string) bool {
 	return !IsCoordinatorQueue(qname) && !strings.HasPrefix(qname, QUEUE_EXCLUSIVE_PREFIX)
 }
+
+// NodeTaskQueue returns the queue used to deliver
+// tasks which must run on a specific worker node.
+func NodeTaskQueue(nodeID string) string {
+	return fmt.Sprintf("%s%s", QUEUE_NODE_PREFIX, nodeID)
+}
+
+func IsNodeQueue(qname string) bool {
+	return strings.HasPrefix(qname, QUEUE_NODE_PREFIX)
+}
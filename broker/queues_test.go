@@ -25,3 +25,11 @@ func TestIsCoordinatorQueue(t *testing.T) {
 	assert.Equal(t, true, broker.IsCoordinatorQueue(broker.QUEUE_STARTED))
 	assert.Equal(t, true, broker.IsCoordinatorQueue(broker.QUEUE_PENDING))
 }
+
+func TestNodeTaskQueue(t *testing.T) {
+	qname := broker.NodeTaskQueue("1234")
+	assert.True(t, broker.IsNodeQueue(qname))
+	// pinned tasks keep their priority
+	assert.True(t, broker.IsTaskQueue(qname))
+	assert.False(t, broker.IsNodeQueue(broker.QUEUE_DEFAULT))
+}
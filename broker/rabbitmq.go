@@ -31,6 +31,7 @@ const (
 	keyDefault          = ""
 	defaultQueueType    = RABBITMQ_QUEUE_TYPE_CLASSIC
 	defaultHeartbeatTTL = 60000
+	nodeQueueExpires    = 3600000
 	defaultPriority     = uint8(0)
 	maxPriority         = uint8(9)
 )
@@ -405,10 +406,16 @@ func (b *RabbitMQBroker) declareQueue(exchange, key, qname string, ch *amqp.Chan
 	if !strings.HasPrefix(qname, QUEUE_EXCLUSIVE_PREFIX) {
 		args["x-queue-type"] = b.queueType
 	}
+	// a node's queue is shared by the consumers of the node on
+	// all of its connections. It survives the restarts of the
+	// broker and is removed once the node has been gone for a while.
+	if IsNodeQueue(qname) {
+		args["x-expires"] = nodeQueueExpires
+	}
 	args["x-consumer-timeout"] = b.consumerTimeout
 	_, err := ch.QueueDeclare(
 		qname,
-		b.durable || b.queueType == RABBITMQ_QUEUE_TYPE_QUORUM, // durable
+		b.durable || b.queueType == RABBITMQ_QUEUE_TYPE_QUORUM || IsNodeQueue(qname), // durable
 		false, // delete when unused
 		strings.HasPrefix(qname, QUEUE_EXCLUSIVE_PREFIX), // exclusive
 		false, // no-wait
@@ -6,7 +6,9 @@ import (
 	"github.com/runabol/tork/conf"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/datastore/postgres"
-	schema "github.com/runabol/tork/db/postgres"
+	"github.com/runabol/tork/datastore/sqlite"
+	pgschema "github.com/runabol/tork/db/postgres"
+	sqliteschema "github.com/runabol/tork/db/sqlite"
 	ucli "github.com/urfave/cli/v2"
 )
 
@@ -30,7 +32,17 @@ func migration(ctx *ucli.Context) error {
 		if err != nil {
 			return err
 		}
-		if err := pg.ExecScript(schema.SCHEMA); err != nil {
+		if err := pg.ExecScript(pgschema.SCHEMA); err != nil {
+			return errors.Wrapf(err, "error when trying to create db schema")
+		}
+	case datastore.DATASTORE_SQLITE:
+		path := conf.StringDefault("datastore.sqlite.path", "tork.db")
+		ds, err := sqlite.NewSQLiteDatastore(path, sqlite.WithDisableCleanup(true))
+		if err != nil {
+			return err
+		}
+		defer ds.Close()
+		if err := ds.ExecScript(sqliteschema.SCHEMA); err != nil {
 			return errors.Wrapf(err, "error when trying to create db schema")
 		}
 	default:
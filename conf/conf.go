@@ -112,6 +112,14 @@ func IntDefault(key string, dv int) int {
 	return konf.Int(key)
 }
 
+func Float64Default(key string, dv float64) float64 {
+	v := konf.Get(key)
+	if v == nil {
+		return dv
+	}
+	return konf.Float64(key)
+}
+
 func String(key string) string {
 	return konf.String(key)
 }
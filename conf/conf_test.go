@@ -236,6 +236,23 @@ func TestDurationDefault(t *testing.T) {
 	assert.Equal(t, time.Minute, conf.DurationDefault("main.other.duration", time.Minute))
 }
 
+func TestFloat64Default(t *testing.T) {
+	konf := `
+	[main]
+	some.ratio = 0.25
+	`
+	err := os.WriteFile("config.toml", []byte(konf), os.ModePerm)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, os.Remove("config.toml"))
+	}()
+	err = conf.LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, conf.Float64Default("main.some.ratio", 1))
+	assert.Equal(t, float64(1), conf.Float64Default("main.other.ratio", 1))
+}
+
 func TestBoolMap(t *testing.T) {
 	assert.NoError(t, os.Setenv("TORK_BOOLMAP_KEY1", "false"))
 	assert.NoError(t, os.Setenv("TORK_BOOLMAP_KEY2", "true"))
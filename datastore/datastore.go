@@ -2,6 +2,7 @@ package datastore
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/runabol/tork"
@@ -16,11 +17,16 @@ var (
 	ErrScheduledJobNotFound = errors.New("scheduled job not found")
 	ErrUserNotFound         = errors.New("user not found")
 	ErrRoleNotFound         = errors.New("role not found")
+	ErrTriggerNotFound      = errors.New("trigger not found")
+	ErrTemplateNotFound     = errors.New("template not found")
 	ErrContextNotFound      = errors.New("context not found")
+	ErrScheduledJobFired    = errors.New("scheduled job already fired")
 )
 
 const (
 	DATASTORE_POSTGRES = "postgres"
+	DATASTORE_INMEMORY = "inmemory"
+	DATASTORE_SQLITE   = "sqlite"
 )
 
 type Datastore interface {
@@ -29,6 +35,8 @@ type Datastore interface {
 	GetTaskByID(ctx context.Context, id string) (*tork.Task, error)
 	GetActiveTasks(ctx context.Context, jobID string) ([]*tork.Task, error)
 	GetNextTask(ctx context.Context, parentTaskID string) (*tork.Task, error)
+	GetRetryTasks(ctx context.Context, before time.Time) ([]*tork.Task, error)
+	GetLostTasks(ctx context.Context, heartbeatBefore time.Time) ([]*tork.Task, error)
 	CreateTaskLogPart(ctx context.Context, p *tork.TaskLogPart) error
 	GetTaskLogParts(ctx context.Context, taskID, q string, page, size int) (*Page[*tork.TaskLogPart], error)
 
@@ -40,6 +48,7 @@ type Datastore interface {
 	CreateJob(ctx context.Context, j *tork.Job) error
 	UpdateJob(ctx context.Context, id string, modify func(u *tork.Job) error) error
 	GetJobByID(ctx context.Context, id string) (*tork.Job, error)
+	GetTimedOutJobs(ctx context.Context, before time.Time) ([]*tork.Job, error)
 	GetJobLogParts(ctx context.Context, jobID, q string, page, size int) (*Page[*tork.TaskLogPart], error)
 	GetJobs(ctx context.Context, currentUser, q string, page, size int) (*Page[*tork.JobSummary], error)
 
@@ -49,6 +58,19 @@ type Datastore interface {
 	GetScheduledJobByID(ctx context.Context, id string) (*tork.ScheduledJob, error)
 	UpdateScheduledJob(ctx context.Context, id string, modify func(u *tork.ScheduledJob) error) error
 	DeleteScheduledJob(ctx context.Context, id string) error
+	GetActiveScheduledJobInstances(ctx context.Context, scheduledJobID string) ([]*tork.Job, error)
+	CreateScheduledJobFire(ctx context.Context, scheduledJobID, id string) error
+
+	CreateTrigger(ctx context.Context, t *tork.Trigger) error
+	GetTrigger(ctx context.Context, id string) (*tork.Trigger, error)
+	GetTriggers(ctx context.Context) ([]*tork.Trigger, error)
+	UpdateTrigger(ctx context.Context, id string, modify func(u *tork.Trigger) error) error
+	DeleteTrigger(ctx context.Context, id string) error
+
+	CreateTemplate(ctx context.Context, t *tork.Template) error
+	GetTemplate(ctx context.Context, name string, version int) (*tork.Template, error)
+	GetTemplates(ctx context.Context) ([]*tork.Template, error)
+	DeleteTemplate(ctx context.Context, name string, version int) error
 
 	CreateUser(ctx context.Context, u *tork.User) error
 	GetUser(ctx context.Context, username string) (*tork.User, error)
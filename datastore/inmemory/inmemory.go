@@ -0,0 +1,1563 @@
+package inmemory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/uuid"
+)
+
+var (
+	DefaultLogsRetentionDuration = time.Hour * 24 * 7   // 1 week
+	DefaultJobsRetentionDuration = time.Hour * 24 * 365 // 1 year
+	DefaultCleanupInterval       = time.Minute
+)
+
+// InMemoryDatastore is a datastore.Datastore which keeps all of
+// its state in memory. It is meant for tests and for throwaway,
+// single-process (standalone) deployments.
+//
+// Changes made inside WithTx are applied as they happen and are
+// reverted if the transaction function returns an error. A
+// transaction holds the store's write lock until it ends, so
+// other readers and writers never see its uncommitted changes.
+type InMemoryDatastore struct {
+	s  *store
+	tx *txn
+}
+
+type Option = func(ds *InMemoryDatastore)
+
+type store struct {
+	mu                    sync.RWMutex
+	tasks                 map[string]*tork.Task
+	logParts              map[string][]*tork.TaskLogPart
+	nodes                 map[string]*tork.Node
+	jobs                  map[string]*tork.Job
+	jobsPerms             map[string][]permRecord
+	scheduledJobs         map[string]*tork.ScheduledJob
+	scheduledJobsPerms    map[string][]permRecord
+	scheduledJobFires     map[string]string
+	triggers              map[string]*tork.Trigger
+	templates             map[string]*tork.Template
+	users                 map[string]*tork.User
+	roles                 map[string]*tork.Role
+	usersRoles            map[string][]string
+	logsRetentionDuration time.Duration
+	jobsRetentionDuration time.Duration
+	cleanupInterval       time.Duration
+	disableCleanup        bool
+	stop                  chan any
+	stopOnce              sync.Once
+}
+
+type permRecord struct {
+	userID string
+	roleID string
+}
+
+type txn struct {
+	undo []func()
+}
+
+func WithLogsRetentionDuration(dur time.Duration) Option {
+	return func(ds *InMemoryDatastore) {
+		ds.s.logsRetentionDuration = dur
+	}
+}
+
+func WithJobsRetentionDuration(dur time.Duration) Option {
+	return func(ds *InMemoryDatastore) {
+		ds.s.jobsRetentionDuration = dur
+	}
+}
+
+func WithCleanupInterval(dur time.Duration) Option {
+	return func(ds *InMemoryDatastore) {
+		ds.s.cleanupInterval = dur
+	}
+}
+
+func WithDisableCleanup(val bool) Option {
+	return func(ds *InMemoryDatastore) {
+		ds.s.disableCleanup = val
+	}
+}
+
+func NewInMemoryDatastore(opts ...Option) *InMemoryDatastore {
+	ds := &InMemoryDatastore{
+		s: &store{
+			tasks:                 make(map[string]*tork.Task),
+			logParts:              make(map[string][]*tork.TaskLogPart),
+			nodes:                 make(map[string]*tork.Node),
+			jobs:                  make(map[string]*tork.Job),
+			jobsPerms:             make(map[string][]permRecord),
+			scheduledJobs:         make(map[string]*tork.ScheduledJob),
+			scheduledJobsPerms:    make(map[string][]permRecord),
+			scheduledJobFires:     make(map[string]string),
+			triggers:              make(map[string]*tork.Trigger),
+			templates:             make(map[string]*tork.Template),
+			users:                 make(map[string]*tork.User),
+			roles:                 make(map[string]*tork.Role),
+			usersRoles:            make(map[string][]string),
+			logsRetentionDuration: DefaultLogsRetentionDuration,
+			jobsRetentionDuration: DefaultJobsRetentionDuration,
+			cleanupInterval:       DefaultCleanupInterval,
+			stop:                  make(chan any),
+		},
+	}
+	for _, opt := range opts {
+		opt(ds)
+	}
+	now := time.Now().UTC()
+	guest := &tork.User{
+		ID:        uuid.NewUUID(),
+		Name:      "Guest",
+		Username:  tork.USER_GUEST,
+		CreatedAt: &now,
+		Disabled:  true,
+	}
+	ds.s.users[guest.ID] = guest
+	public := &tork.Role{
+		ID:        uuid.NewUUID(),
+		Name:      "Public",
+		Slug:      tork.ROLE_PUBLIC,
+		CreatedAt: &now,
+	}
+	ds.s.roles[public.ID] = public
+	if !ds.s.disableCleanup && ds.s.cleanupInterval > 0 {
+		go ds.cleanupProcess()
+	}
+	return ds
+}
+
+func (ds *InMemoryDatastore) cleanupProcess() {
+	ticker := time.NewTicker(ds.s.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ds.s.stop:
+			return
+		case <-ticker.C:
+			n1, n2 := ds.cleanup()
+			if n1 > 0 {
+				log.Debug().Msgf("Expunged %d expired task log parts", n1)
+			}
+			if n2 > 0 {
+				log.Debug().Msgf("Expunged %d expired jobs", n2)
+			}
+		}
+	}
+}
+
+func (ds *InMemoryDatastore) cleanup() (int, int) {
+	ds.lock()
+	defer ds.unlock()
+	now := time.Now().UTC()
+	logsCutoff := now.Add(-ds.s.logsRetentionDuration)
+	var n1 int
+	for taskID, parts := range ds.s.logParts {
+		kept := make([]*tork.TaskLogPart, 0, len(parts))
+		for _, p := range parts {
+			if p.CreatedAt.Before(logsCutoff) {
+				n1 = n1 + 1
+				continue
+			}
+			kept = append(kept, p)
+		}
+		if len(kept) == 0 {
+			delete(ds.s.logParts, taskID)
+		} else {
+			ds.s.logParts[taskID] = kept
+		}
+	}
+	jobsCutoff := now.Add(-ds.s.jobsRetentionDuration)
+	ids := make([]string, 0)
+	for _, j := range ds.s.jobs {
+		if j.DeleteAt != nil && j.DeleteAt.Before(now) {
+			ids = append(ids, j.ID)
+			continue
+		}
+		if j.CreatedAt.Before(jobsCutoff) &&
+			(j.State == tork.JobStateCompleted || j.State == tork.JobStateFailed || j.State == tork.JobStateCancelled) {
+			ids = append(ids, j.ID)
+		}
+	}
+	ds.deleteJobs(ids)
+	return n1, len(ids)
+}
+
+// deleteJobs removes the given jobs along with their tasks,
+// log parts and permissions. Caller must hold the write lock.
+func (ds *InMemoryDatastore) deleteJobs(ids []string) {
+	for _, id := range ids {
+		j, ok := ds.s.jobs[id]
+		if !ok {
+			continue
+		}
+		perms := ds.s.jobsPerms[id]
+		delete(ds.s.jobs, id)
+		delete(ds.s.jobsPerms, id)
+		ds.journal(func() {
+			ds.s.jobs[id] = j
+			if perms != nil {
+				ds.s.jobsPerms[id] = perms
+			}
+		})
+		for tid, t := range ds.s.tasks {
+			if t.JobID != id {
+				continue
+			}
+			t := t
+			tid := tid
+			parts := ds.s.logParts[tid]
+			delete(ds.s.tasks, tid)
+			delete(ds.s.logParts, tid)
+			ds.journal(func() {
+				ds.s.tasks[tid] = t
+				if parts != nil {
+					ds.s.logParts[tid] = parts
+				}
+			})
+		}
+	}
+}
+
+func (ds *InMemoryDatastore) CreateTask(ctx context.Context, t *tork.Task) error {
+	if t.ID == "" {
+		return errors.Errorf("task id must not be empty")
+	}
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.jobs[t.JobID]; !ok {
+		return errors.Errorf("error inserting task to the db: unknown job %s", t.JobID)
+	}
+	if _, ok := ds.s.tasks[t.ID]; ok {
+		return errors.Errorf("error inserting task to the db: task %s already exists", t.ID)
+	}
+	ds.s.tasks[t.ID] = t.Clone()
+	ds.journal(func() {
+		delete(ds.s.tasks, t.ID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) UpdateTask(ctx context.Context, id string, modify func(u *tork.Task) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		itx, ok := tx.(*InMemoryDatastore)
+		if !ok {
+			return errors.New("unable to cast to an inmemory datastore")
+		}
+		t, err := itx.GetTaskByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := modify(t); err != nil {
+			return err
+		}
+		if !slices.Contains(taskStates, t.State) {
+			return errors.Errorf("error updating task %s: invalid state %s", id, t.State)
+		}
+		itx.lock()
+		defer itx.unlock()
+		prev, ok := itx.s.tasks[id]
+		if !ok {
+			return datastore.ErrTaskNotFound
+		}
+		t.ID = id
+		itx.s.tasks[id] = t
+		itx.journal(func() {
+			itx.s.tasks[id] = prev
+		})
+		return nil
+	})
+}
+
+func (ds *InMemoryDatastore) GetTaskByID(ctx context.Context, id string) (*tork.Task, error) {
+	ds.rlock()
+	defer ds.runlock()
+	t, ok := ds.s.tasks[id]
+	if !ok {
+		return nil, datastore.ErrTaskNotFound
+	}
+	return t.Clone(), nil
+}
+
+func (ds *InMemoryDatastore) GetActiveTasks(ctx context.Context, jobID string) ([]*tork.Task, error) {
+	ds.rlock()
+	defer ds.runlock()
+	actives := make([]*tork.Task, 0)
+	for _, t := range ds.s.tasks {
+		if t.JobID == jobID && t.IsActive() {
+			actives = append(actives, t.Clone())
+		}
+	}
+	sort.SliceStable(actives, func(i, j int) bool {
+		if actives[i].Position != actives[j].Position {
+			return actives[i].Position < actives[j].Position
+		}
+		return timeBefore(actives[i].CreatedAt, actives[j].CreatedAt)
+	})
+	return actives, nil
+}
+
+func (ds *InMemoryDatastore) GetNextTask(ctx context.Context, parentTaskID string) (*tork.Task, error) {
+	ds.rlock()
+	defer ds.runlock()
+	var next *tork.Task
+	for _, t := range ds.s.tasks {
+		if t.ParentID != parentTaskID || t.State != tork.TaskStateCreated {
+			continue
+		}
+		if next == nil ||
+			t.Position < next.Position ||
+			(t.Position == next.Position && timeBefore(t.CreatedAt, next.CreatedAt)) {
+			next = t
+		}
+	}
+	if next == nil {
+		return nil, datastore.ErrTaskNotFound
+	}
+	return next.Clone(), nil
+}
+
+func (ds *InMemoryDatastore) GetRetryTasks(ctx context.Context, before time.Time) ([]*tork.Task, error) {
+	ds.rlock()
+	defer ds.runlock()
+	result := make([]*tork.Task, 0)
+	for _, t := range ds.s.tasks {
+		if t.State != tork.TaskStateCreated || t.RetryAt == nil || t.RetryAt.After(before) {
+			continue
+		}
+		if j, ok := ds.s.jobs[t.JobID]; ok && j.State == tork.JobStatePaused {
+			continue
+		}
+		result = append(result, t.Clone())
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].RetryAt.Before(*result[j].RetryAt)
+	})
+	return result, nil
+}
+
+func (ds *InMemoryDatastore) GetLostTasks(ctx context.Context, heartbeatBefore time.Time) ([]*tork.Task, error) {
+	ds.rlock()
+	defer ds.runlock()
+	result := make([]*tork.Task, 0)
+	for _, t := range ds.s.tasks {
+		if t.State != tork.TaskStateScheduled && t.State != tork.TaskStateRunning {
+			continue
+		}
+		n, ok := ds.s.nodes[t.NodeID]
+		if !ok || !n.LastHeartbeatAt.Before(heartbeatBefore) {
+			continue
+		}
+		result = append(result, t.Clone())
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return timeBefore(result[i].CreatedAt, result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+func (ds *InMemoryDatastore) CreateTaskLogPart(ctx context.Context, p *tork.TaskLogPart) error {
+	if p.TaskID == "" {
+		return errors.Errorf("must provide task id")
+	}
+	if p.Number < 1 {
+		return errors.Errorf("part number must be > 0")
+	}
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.tasks[p.TaskID]; !ok {
+		return errors.Errorf("error inserting task log part to the db: unknown task %s", p.TaskID)
+	}
+	now := time.Now().UTC()
+	part := &tork.TaskLogPart{
+		ID:        uuid.NewUUID(),
+		Number:    p.Number,
+		TaskID:    p.TaskID,
+		Contents:  p.Contents,
+		CreatedAt: &now,
+	}
+	ds.s.logParts[p.TaskID] = append(ds.s.logParts[p.TaskID], part)
+	ds.journal(func() {
+		ds.s.logParts[p.TaskID] = without(ds.s.logParts[p.TaskID], part)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) GetTaskLogParts(ctx context.Context, taskID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+	searchTerm, _ := parseQuery(q)
+	ds.rlock()
+	defer ds.runlock()
+	items := make([]*tork.TaskLogPart, 0)
+	for _, p := range ds.s.logParts[taskID] {
+		if matches(searchTerm, p.Contents) {
+			items = append(items, cloneTaskLogPart(p))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Number > items[j].Number
+	})
+	return paginate(items, page, size), nil
+}
+
+func (ds *InMemoryDatastore) CreateNode(ctx context.Context, n *tork.Node) error {
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.nodes[n.ID]; ok {
+		return errors.Errorf("error inserting node to the db: node %s already exists", n.ID)
+	}
+	ds.s.nodes[n.ID] = n.Clone()
+	ds.journal(func() {
+		delete(ds.s.nodes, n.ID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) UpdateNode(ctx context.Context, id string, modify func(u *tork.Node) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		itx, ok := tx.(*InMemoryDatastore)
+		if !ok {
+			return errors.New("unable to cast to an inmemory datastore")
+		}
+		n, err := itx.GetNodeByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := modify(n); err != nil {
+			return err
+		}
+		itx.lock()
+		defer itx.unlock()
+		prev, ok := itx.s.nodes[id]
+		if !ok {
+			return datastore.ErrNodeNotFound
+		}
+		u := prev.Clone()
+		u.LastHeartbeatAt = n.LastHeartbeatAt
+		u.CPUPercent = n.CPUPercent
+		u.Status = n.Status
+		u.TaskCount = n.TaskCount
+		itx.s.nodes[id] = u
+		itx.journal(func() {
+			itx.s.nodes[id] = prev
+		})
+		return nil
+	})
+}
+
+func (ds *InMemoryDatastore) GetNodeByID(ctx context.Context, id string) (*tork.Node, error) {
+	ds.rlock()
+	defer ds.runlock()
+	n, ok := ds.s.nodes[id]
+	if !ok {
+		return nil, datastore.ErrNodeNotFound
+	}
+	return toNode(n), nil
+}
+
+func (ds *InMemoryDatastore) GetActiveNodes(ctx context.Context) ([]*tork.Node, error) {
+	ds.rlock()
+	defer ds.runlock()
+	timeout := time.Now().UTC().Add(-tork.LAST_HEARTBEAT_TIMEOUT)
+	ns := make([]*tork.Node, 0)
+	for _, n := range ds.s.nodes {
+		if n.LastHeartbeatAt.After(timeout) {
+			ns = append(ns, toNode(n))
+		}
+	}
+	sort.SliceStable(ns, func(i, j int) bool {
+		return ns[i].Name < ns[j].Name
+	})
+	return ns, nil
+}
+
+func (ds *InMemoryDatastore) CreateJob(ctx context.Context, j *tork.Job) error {
+	if j.ID == "" {
+		return errors.Errorf("job id must not be empty")
+	}
+	if j.CreatedBy == nil {
+		guest, err := ds.GetUser(ctx, tork.USER_GUEST)
+		if err != nil {
+			return err
+		}
+		j.CreatedBy = guest
+	}
+	if j.Tags == nil {
+		j.Tags = make([]string, 0)
+	}
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.jobs[j.ID]; ok {
+		return errors.Errorf("error inserting job to the db: job %s already exists", j.ID)
+	}
+	if _, ok := ds.s.users[j.CreatedBy.ID]; !ok {
+		return errors.Errorf("error inserting job to the db: unknown user %s", j.CreatedBy.ID)
+	}
+	stored := j.Clone()
+	stored.Execution = nil
+	stored.Permissions = nil
+	ds.s.jobs[j.ID] = stored
+	ds.s.jobsPerms[j.ID] = ds.toPermRecords(j.Permissions)
+	ds.journal(func() {
+		delete(ds.s.jobs, j.ID)
+		delete(ds.s.jobsPerms, j.ID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) UpdateJob(ctx context.Context, id string, modify func(u *tork.Job) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		itx, ok := tx.(*InMemoryDatastore)
+		if !ok {
+			return errors.New("unable to cast to an inmemory datastore")
+		}
+		itx.rlock()
+		r, ok := itx.s.jobs[id]
+		var j *tork.Job
+		if ok {
+			j = r.Clone()
+		}
+		itx.runlock()
+		if !ok {
+			return datastore.ErrJobNotFound
+		}
+		if err := modify(j); err != nil {
+			return err
+		}
+		if !slices.Contains(jobStates, j.State) {
+			return errors.Errorf("error updating job %s: invalid state %s", id, j.State)
+		}
+		itx.lock()
+		defer itx.unlock()
+		prev, ok := itx.s.jobs[id]
+		if !ok {
+			return datastore.ErrJobNotFound
+		}
+		j.ID = id
+		j.Execution = nil
+		j.Permissions = nil
+		itx.s.jobs[id] = j
+		itx.journal(func() {
+			itx.s.jobs[id] = prev
+		})
+		return nil
+	})
+}
+
+func (ds *InMemoryDatastore) GetTimedOutJobs(ctx context.Context, before time.Time) ([]*tork.Job, error) {
+	ds.rlock()
+	timedOut := make([]*tork.Job, 0)
+	for _, j := range ds.s.jobs {
+		if j.State != tork.JobStateScheduled && j.State != tork.JobStateRunning && j.State != tork.JobStatePaused {
+			continue
+		}
+		if j.TimeoutAt == nil || j.TimeoutAt.After(before) {
+			continue
+		}
+		timedOut = append(timedOut, j)
+	}
+	ds.runlock()
+	sort.SliceStable(timedOut, func(i, j int) bool {
+		return timedOut[i].TimeoutAt.Before(*timedOut[j].TimeoutAt)
+	})
+	result := make([]*tork.Job, len(timedOut))
+	for i, j := range timedOut {
+		full, err := ds.GetJobByID(ctx, j.ID)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = full
+	}
+	return result, nil
+}
+
+func (ds *InMemoryDatastore) GetJobByID(ctx context.Context, id string) (*tork.Job, error) {
+	ds.rlock()
+	defer ds.runlock()
+	r, ok := ds.s.jobs[id]
+	if !ok {
+		return nil, datastore.ErrJobNotFound
+	}
+	j := r.Clone()
+	exec := make([]*tork.Task, 0)
+	for _, t := range ds.s.tasks {
+		if t.JobID == id {
+			exec = append(exec, t.Clone())
+		}
+	}
+	sort.SliceStable(exec, func(i, j int) bool {
+		if exec[i].Position != exec[j].Position {
+			return exec[i].Position < exec[j].Position
+		}
+		return timeBefore(exec[i].StartedAt, exec[j].StartedAt)
+	})
+	j.Execution = exec
+	perms, err := ds.toPermissions(ds.s.jobsPerms[id])
+	if err != nil {
+		return nil, err
+	}
+	j.Permissions = perms
+	return j, nil
+}
+
+func (ds *InMemoryDatastore) GetJobLogParts(ctx context.Context, jobID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+	searchTerm, _ := parseQuery(q)
+	ds.rlock()
+	defer ds.runlock()
+	type jobLogPart struct {
+		task *tork.Task
+		part *tork.TaskLogPart
+	}
+	parts := make([]jobLogPart, 0)
+	for _, t := range ds.s.tasks {
+		if t.JobID != jobID {
+			continue
+		}
+		for _, p := range ds.s.logParts[t.ID] {
+			if matches(searchTerm, p.Contents) {
+				parts = append(parts, jobLogPart{task: t, part: p})
+			}
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		ti, tj := parts[i].task, parts[j].task
+		if ti.Position != tj.Position {
+			return ti.Position > tj.Position
+		}
+		if ti.ID != tj.ID {
+			return timeBefore(tj.CreatedAt, ti.CreatedAt)
+		}
+		if parts[i].part.Number != parts[j].part.Number {
+			return parts[i].part.Number > parts[j].part.Number
+		}
+		return timeBefore(parts[j].part.CreatedAt, parts[i].part.CreatedAt)
+	})
+	items := make([]*tork.TaskLogPart, len(parts))
+	for i, p := range parts {
+		items[i] = cloneTaskLogPart(p.part)
+	}
+	return paginate(items, page, size), nil
+}
+
+func (ds *InMemoryDatastore) GetJobs(ctx context.Context, currentUser, q string, page, size int) (*datastore.Page[*tork.JobSummary], error) {
+	searchTerm, tags := parseQuery(q)
+	ds.rlock()
+	defer ds.runlock()
+	visible := ds.permFilter(currentUser)
+	jobs := make([]*tork.Job, 0)
+	for _, j := range ds.s.jobs {
+		if !matches(searchTerm, j.Description, j.Name, j.State) {
+			continue
+		}
+		if len(tags) > 0 && !hasIntersection(tags, j.Tags) {
+			continue
+		}
+		if !visible(ds.s.jobsPerms[j.ID]) {
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	result := make([]*tork.JobSummary, len(jobs))
+	for i, j := range jobs {
+		result[i] = tork.NewJobSummary(j.Clone())
+	}
+	return paginate(result, page, size), nil
+}
+
+func (ds *InMemoryDatastore) CreateScheduledJob(ctx context.Context, sj *tork.ScheduledJob) error {
+	if sj.ID == "" {
+		return errors.Errorf("scheduled job id must not be empty")
+	}
+	if sj.CreatedBy == nil {
+		guest, err := ds.GetUser(ctx, tork.USER_GUEST)
+		if err != nil {
+			return err
+		}
+		sj.CreatedBy = guest
+	}
+	if sj.Tags == nil {
+		sj.Tags = make([]string, 0)
+	}
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.scheduledJobs[sj.ID]; ok {
+		return errors.Errorf("error inserting scheduled job to the db: scheduled job %s already exists", sj.ID)
+	}
+	if _, ok := ds.s.users[sj.CreatedBy.ID]; !ok {
+		return errors.Errorf("error inserting scheduled job to the db: unknown user %s", sj.CreatedBy.ID)
+	}
+	stored := sj.Clone()
+	stored.Permissions = nil
+	ds.s.scheduledJobs[sj.ID] = stored
+	ds.s.scheduledJobsPerms[sj.ID] = ds.toPermRecords(sj.Permissions)
+	ds.journal(func() {
+		delete(ds.s.scheduledJobs, sj.ID)
+		delete(ds.s.scheduledJobsPerms, sj.ID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) GetActiveScheduledJobs(ctx context.Context) ([]*tork.ScheduledJob, error) {
+	ds.rlock()
+	defer ds.runlock()
+	sjs := make([]*tork.ScheduledJob, 0)
+	for _, sj := range ds.s.scheduledJobs {
+		if sj.State == tork.ScheduledJobStateActive {
+			sjs = append(sjs, sj.Clone())
+		}
+	}
+	return sjs, nil
+}
+
+func (ds *InMemoryDatastore) GetScheduledJobs(ctx context.Context, currentUser string, page, size int) (*datastore.Page[*tork.ScheduledJobSummary], error) {
+	ds.rlock()
+	defer ds.runlock()
+	visible := ds.permFilter(currentUser)
+	sjs := make([]*tork.ScheduledJob, 0)
+	for _, sj := range ds.s.scheduledJobs {
+		if visible(ds.s.scheduledJobsPerms[sj.ID]) {
+			sjs = append(sjs, sj)
+		}
+	}
+	sort.SliceStable(sjs, func(i, j int) bool {
+		return sjs[i].CreatedAt.After(sjs[j].CreatedAt)
+	})
+	result := make([]*tork.ScheduledJobSummary, len(sjs))
+	for i, sj := range sjs {
+		result[i] = tork.NewScheduledJobSummary(sj.Clone())
+	}
+	return paginate(result, page, size), nil
+}
+
+func (ds *InMemoryDatastore) GetScheduledJobByID(ctx context.Context, id string) (*tork.ScheduledJob, error) {
+	ds.rlock()
+	defer ds.runlock()
+	r, ok := ds.s.scheduledJobs[id]
+	if !ok {
+		return nil, datastore.ErrScheduledJobNotFound
+	}
+	sj := r.Clone()
+	perms, err := ds.toPermissions(ds.s.scheduledJobsPerms[id])
+	if err != nil {
+		return nil, err
+	}
+	sj.Permissions = perms
+	return sj, nil
+}
+
+func (ds *InMemoryDatastore) UpdateScheduledJob(ctx context.Context, id string, modify func(u *tork.ScheduledJob) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		itx, ok := tx.(*InMemoryDatastore)
+		if !ok {
+			return errors.New("unable to cast to an inmemory datastore")
+		}
+		itx.rlock()
+		r, ok := itx.s.scheduledJobs[id]
+		var sj *tork.ScheduledJob
+		if ok {
+			sj = r.Clone()
+		}
+		itx.runlock()
+		if !ok {
+			return datastore.ErrScheduledJobNotFound
+		}
+		if err := modify(sj); err != nil {
+			return err
+		}
+		itx.lock()
+		defer itx.unlock()
+		prev, ok := itx.s.scheduledJobs[id]
+		if !ok {
+			return datastore.ErrScheduledJobNotFound
+		}
+		u := sj.Clone()
+		u.ID = prev.ID
+		u.CreatedAt = prev.CreatedAt
+		u.CreatedBy = prev.CreatedBy
+		u.Permissions = nil
+		if u.Tags == nil {
+			u.Tags = make([]string, 0)
+		}
+		itx.s.scheduledJobs[id] = u
+		itx.journal(func() {
+			itx.s.scheduledJobs[id] = prev
+		})
+		return nil
+	})
+}
+
+func (ds *InMemoryDatastore) GetActiveScheduledJobInstances(ctx context.Context, scheduledJobID string) ([]*tork.Job, error) {
+	ds.rlock()
+	active := make([]*tork.Job, 0)
+	for _, j := range ds.s.jobs {
+		if j.Schedule == nil || j.Schedule.ID != scheduledJobID {
+			continue
+		}
+		switch j.State {
+		case tork.JobStatePending,
+			tork.JobStateQueued,
+			tork.JobStateScheduled,
+			tork.JobStateRunning,
+			tork.JobStatePaused:
+			active = append(active, j)
+		}
+	}
+	ds.runlock()
+	sort.SliceStable(active, func(i, j int) bool {
+		return active[i].CreatedAt.Before(active[j].CreatedAt)
+	})
+	result := make([]*tork.Job, len(active))
+	for i, j := range active {
+		full, err := ds.GetJobByID(ctx, j.ID)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = full
+	}
+	return result, nil
+}
+
+func (ds *InMemoryDatastore) DeleteScheduledJob(ctx context.Context, id string) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		itx, ok := tx.(*InMemoryDatastore)
+		if !ok {
+			return errors.New("unable to cast to an inmemory datastore")
+		}
+		itx.lock()
+		defer itx.unlock()
+		ids := make([]string, 0)
+		for _, j := range itx.s.jobs {
+			if j.Schedule != nil && j.Schedule.ID == id {
+				ids = append(ids, j.ID)
+			}
+		}
+		itx.deleteJobs(ids)
+		for fid, sjid := range itx.s.scheduledJobFires {
+			if sjid == id {
+				delete(itx.s.scheduledJobFires, fid)
+				itx.journal(func() {
+					itx.s.scheduledJobFires[fid] = sjid
+				})
+			}
+		}
+		sj, ok := itx.s.scheduledJobs[id]
+		if !ok {
+			return nil
+		}
+		perms := itx.s.scheduledJobsPerms[id]
+		delete(itx.s.scheduledJobs, id)
+		delete(itx.s.scheduledJobsPerms, id)
+		itx.journal(func() {
+			itx.s.scheduledJobs[id] = sj
+			if perms != nil {
+				itx.s.scheduledJobsPerms[id] = perms
+			}
+		})
+		return nil
+	})
+}
+
+func (ds *InMemoryDatastore) CreateScheduledJobFire(ctx context.Context, scheduledJobID, id string) error {
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.scheduledJobFires[id]; ok {
+		return datastore.ErrScheduledJobFired
+	}
+	ds.s.scheduledJobFires[id] = scheduledJobID
+	ds.journal(func() {
+		delete(ds.s.scheduledJobFires, id)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) CreateTrigger(ctx context.Context, t *tork.Trigger) error {
+	if t.ID == "" {
+		return errors.Errorf("trigger id must not be empty")
+	}
+	if t.CreatedBy == nil {
+		guest, err := ds.GetUser(ctx, tork.USER_GUEST)
+		if err != nil {
+			return err
+		}
+		t.CreatedBy = guest
+	}
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.triggers[t.ID]; ok {
+		return errors.Errorf("error inserting trigger to the db: trigger %s already exists", t.ID)
+	}
+	if ds.findTrigger(t.Name) != nil {
+		return errors.Errorf("error inserting trigger to the db: name %s already exists", t.Name)
+	}
+	ds.s.triggers[t.ID] = t.Clone()
+	ds.journal(func() {
+		delete(ds.s.triggers, t.ID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) GetTrigger(ctx context.Context, id string) (*tork.Trigger, error) {
+	ds.rlock()
+	defer ds.runlock()
+	t := ds.findTrigger(id)
+	if t == nil {
+		return nil, datastore.ErrTriggerNotFound
+	}
+	return t.Clone(), nil
+}
+
+func (ds *InMemoryDatastore) GetTriggers(ctx context.Context) ([]*tork.Trigger, error) {
+	ds.rlock()
+	defer ds.runlock()
+	result := make([]*tork.Trigger, 0, len(ds.s.triggers))
+	for _, t := range ds.s.triggers {
+		result = append(result, t.Clone())
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (ds *InMemoryDatastore) UpdateTrigger(ctx context.Context, id string, modify func(u *tork.Trigger) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		itx, ok := tx.(*InMemoryDatastore)
+		if !ok {
+			return errors.New("unable to cast to an inmemory datastore")
+		}
+		itx.rlock()
+		r, ok := itx.s.triggers[id]
+		var t *tork.Trigger
+		if ok {
+			t = r.Clone()
+		}
+		itx.runlock()
+		if !ok {
+			return datastore.ErrTriggerNotFound
+		}
+		if err := modify(t); err != nil {
+			return err
+		}
+		itx.lock()
+		defer itx.unlock()
+		prev, ok := itx.s.triggers[id]
+		if !ok {
+			return datastore.ErrTriggerNotFound
+		}
+		if other := itx.findTrigger(t.Name); other != nil && other.ID != id {
+			return errors.Errorf("error updating trigger in the db: name %s already exists", t.Name)
+		}
+		u := t.Clone()
+		u.ID = prev.ID
+		u.CreatedAt = prev.CreatedAt
+		u.CreatedBy = prev.CreatedBy
+		itx.s.triggers[id] = u
+		itx.journal(func() {
+			itx.s.triggers[id] = prev
+		})
+		return nil
+	})
+}
+
+func (ds *InMemoryDatastore) DeleteTrigger(ctx context.Context, id string) error {
+	ds.lock()
+	defer ds.unlock()
+	t, ok := ds.s.triggers[id]
+	if !ok {
+		return datastore.ErrTriggerNotFound
+	}
+	delete(ds.s.triggers, id)
+	ds.journal(func() {
+		ds.s.triggers[id] = t
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) CreateTemplate(ctx context.Context, t *tork.Template) error {
+	if t.ID == "" {
+		return errors.Errorf("template id must not be empty")
+	}
+	if t.CreatedBy == nil {
+		guest, err := ds.GetUser(ctx, tork.USER_GUEST)
+		if err != nil {
+			return err
+		}
+		t.CreatedBy = guest
+	}
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.templates[t.ID]; ok {
+		return errors.Errorf("error inserting template to the db: template %s already exists", t.ID)
+	}
+	if ds.findTemplate(t.Name, t.Version) != nil {
+		return errors.Errorf("error inserting template to the db: %s@%d already exists", t.Name, t.Version)
+	}
+	ds.s.templates[t.ID] = t.Clone()
+	ds.journal(func() {
+		delete(ds.s.templates, t.ID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) GetTemplate(ctx context.Context, name string, version int) (*tork.Template, error) {
+	ds.rlock()
+	defer ds.runlock()
+	t := ds.findTemplate(name, version)
+	if t == nil {
+		return nil, datastore.ErrTemplateNotFound
+	}
+	return t.Clone(), nil
+}
+
+func (ds *InMemoryDatastore) GetTemplates(ctx context.Context) ([]*tork.Template, error) {
+	ds.rlock()
+	defer ds.runlock()
+	latest := make(map[string]*tork.Template)
+	for _, t := range ds.s.templates {
+		if l, ok := latest[t.Name]; !ok || t.Version > l.Version {
+			latest[t.Name] = t
+		}
+	}
+	result := make([]*tork.Template, 0, len(latest))
+	for _, t := range latest {
+		result = append(result, t.Clone())
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (ds *InMemoryDatastore) DeleteTemplate(ctx context.Context, name string, version int) error {
+	ds.lock()
+	defer ds.unlock()
+	deleted := make([]*tork.Template, 0)
+	for id, t := range ds.s.templates {
+		if t.Name == name && (version == 0 || t.Version == version) {
+			deleted = append(deleted, t)
+			delete(ds.s.templates, id)
+		}
+	}
+	if len(deleted) == 0 {
+		return datastore.ErrTemplateNotFound
+	}
+	ds.journal(func() {
+		for _, t := range deleted {
+			ds.s.templates[t.ID] = t
+		}
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) CreateUser(ctx context.Context, u *tork.User) error {
+	ds.lock()
+	defer ds.unlock()
+	if ds.findUser(u.Username) != nil {
+		return errors.Errorf("error inserting user to the db: username %s already exists", u.Username)
+	}
+	u.ID = uuid.NewUUID()
+	now := time.Now().UTC()
+	u.CreatedAt = &now
+	stored := u.Clone()
+	stored.Disabled = false
+	ds.s.users[u.ID] = stored
+	ds.journal(func() {
+		delete(ds.s.users, u.ID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) GetUser(ctx context.Context, uid string) (*tork.User, error) {
+	ds.rlock()
+	defer ds.runlock()
+	u := ds.findUser(uid)
+	if u == nil {
+		return nil, datastore.ErrUserNotFound
+	}
+	return u.Clone(), nil
+}
+
+func (ds *InMemoryDatastore) CreateRole(ctx context.Context, r *tork.Role) error {
+	ds.lock()
+	defer ds.unlock()
+	if ds.findRole(r.Slug) != nil {
+		return errors.Errorf("error inserting role to the db: slug %s already exists", r.Slug)
+	}
+	r.ID = uuid.NewUUID()
+	now := time.Now().UTC()
+	r.CreatedAt = &now
+	ds.s.roles[r.ID] = r.Clone()
+	ds.journal(func() {
+		delete(ds.s.roles, r.ID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) GetRole(ctx context.Context, id string) (*tork.Role, error) {
+	ds.rlock()
+	defer ds.runlock()
+	r := ds.findRole(id)
+	if r == nil {
+		return nil, datastore.ErrRoleNotFound
+	}
+	return r.Clone(), nil
+}
+
+func (ds *InMemoryDatastore) GetRoles(ctx context.Context) ([]*tork.Role, error) {
+	ds.rlock()
+	defer ds.runlock()
+	result := make([]*tork.Role, 0, len(ds.s.roles))
+	for _, r := range ds.s.roles {
+		result = append(result, r.Clone())
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (ds *InMemoryDatastore) GetUserRoles(ctx context.Context, userID string) ([]*tork.Role, error) {
+	ds.rlock()
+	defer ds.runlock()
+	roleIDs := ds.s.usersRoles[userID]
+	result := make([]*tork.Role, 0, len(roleIDs))
+	for _, roleID := range roleIDs {
+		if r, ok := ds.s.roles[roleID]; ok {
+			result = append(result, r.Clone())
+		}
+	}
+	return result, nil
+}
+
+func (ds *InMemoryDatastore) AssignRole(ctx context.Context, userID, roleID string) error {
+	ds.lock()
+	defer ds.unlock()
+	if _, ok := ds.s.users[userID]; !ok {
+		return errors.Errorf("error assigning role: unknown user %s", userID)
+	}
+	if _, ok := ds.s.roles[roleID]; !ok {
+		return errors.Errorf("error assigning role: unknown role %s", roleID)
+	}
+	if slices.Contains(ds.s.usersRoles[userID], roleID) {
+		return errors.Errorf("error assigning role: role %s is already assigned to user %s", roleID, userID)
+	}
+	ds.s.usersRoles[userID] = append(ds.s.usersRoles[userID], roleID)
+	ds.journal(func() {
+		ds.s.usersRoles[userID] = without(ds.s.usersRoles[userID], roleID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) UnassignRole(ctx context.Context, userID, roleID string) error {
+	ds.lock()
+	defer ds.unlock()
+	if !slices.Contains(ds.s.usersRoles[userID], roleID) {
+		return nil
+	}
+	ds.s.usersRoles[userID] = without(ds.s.usersRoles[userID], roleID)
+	ds.journal(func() {
+		ds.s.usersRoles[userID] = append(ds.s.usersRoles[userID], roleID)
+	})
+	return nil
+}
+
+func (ds *InMemoryDatastore) GetMetrics(ctx context.Context) (*tork.Metrics, error) {
+	ds.rlock()
+	defer ds.runlock()
+	s := &tork.Metrics{}
+	for _, j := range ds.s.jobs {
+		if j.State == tork.JobStateRunning {
+			s.Jobs.Running = s.Jobs.Running + 1
+		}
+	}
+	for _, t := range ds.s.tasks {
+		if t.State != tork.TaskStateRunning {
+			continue
+		}
+		if j, ok := ds.s.jobs[t.JobID]; ok && j.State == tork.JobStateRunning {
+			s.Tasks.Running = s.Tasks.Running + 1
+		}
+	}
+	var cpu float64
+	cutoff := time.Now().UTC().Add(-time.Minute * 5)
+	for _, n := range ds.s.nodes {
+		if n.LastHeartbeatAt.After(cutoff) {
+			s.Nodes.Running = s.Nodes.Running + 1
+			cpu = cpu + n.CPUPercent
+		}
+	}
+	if s.Nodes.Running > 0 {
+		s.Nodes.CPUPercent = cpu / float64(s.Nodes.Running)
+	}
+	return s, nil
+}
+
+// WithTx runs f within a transaction. Nested calls join the
+// outermost transaction, which is the only one that commits or
+// rolls back. The outermost transaction holds the store's write
+// lock until it ends.
+func (ds *InMemoryDatastore) WithTx(ctx context.Context, f func(tx datastore.Datastore) error) error {
+	if ds.tx != nil {
+		return f(ds)
+	}
+	ds.s.mu.Lock()
+	defer ds.s.mu.Unlock()
+	dsx := &InMemoryDatastore{
+		s:  ds.s,
+		tx: &txn{},
+	}
+	if err := f(dsx); err != nil {
+		dsx.rollback()
+		return err
+	}
+	return nil
+}
+
+func (ds *InMemoryDatastore) HealthCheck(ctx context.Context) error {
+	select {
+	case <-ds.s.stop:
+		return errors.New("datastore is closed")
+	default:
+		return nil
+	}
+}
+
+func (ds *InMemoryDatastore) Close() error {
+	ds.s.stopOnce.Do(func() {
+		close(ds.s.stop)
+	})
+	return nil
+}
+
+// journal records an undo step for the current transaction.
+// Caller must hold the write lock.
+func (ds *InMemoryDatastore) journal(undo func()) {
+	if ds.tx == nil {
+		return
+	}
+	ds.tx.undo = append(ds.tx.undo, undo)
+}
+
+func (ds *InMemoryDatastore) rollback() {
+	for i := len(ds.tx.undo) - 1; i >= 0; i-- {
+		ds.tx.undo[i]()
+	}
+	ds.tx.undo = nil
+}
+
+// lock acquires the store's write lock. Within a transaction
+// the lock is already held, so it is a no-op.
+func (ds *InMemoryDatastore) lock() {
+	if ds.tx == nil {
+		ds.s.mu.Lock()
+	}
+}
+
+func (ds *InMemoryDatastore) unlock() {
+	if ds.tx == nil {
+		ds.s.mu.Unlock()
+	}
+}
+
+// rlock acquires the store's read lock. Within a transaction
+// the write lock is already held, so it is a no-op.
+func (ds *InMemoryDatastore) rlock() {
+	if ds.tx == nil {
+		ds.s.mu.RLock()
+	}
+}
+
+func (ds *InMemoryDatastore) runlock() {
+	if ds.tx == nil {
+		ds.s.mu.RUnlock()
+	}
+}
+
+// findUser looks up a user by username or id.
+// Caller must hold the lock.
+func (ds *InMemoryDatastore) findUser(uid string) *tork.User {
+	if u, ok := ds.s.users[uid]; ok {
+		return u
+	}
+	for _, u := range ds.s.users {
+		if u.Username == uid {
+			return u
+		}
+	}
+	return nil
+}
+
+// findRole looks up a role by slug or id.
+// Caller must hold the lock.
+func (ds *InMemoryDatastore) findRole(id string) *tork.Role {
+	if r, ok := ds.s.roles[id]; ok {
+		return r
+	}
+	for _, r := range ds.s.roles {
+		if r.Slug == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (ds *InMemoryDatastore) findTrigger(id string) *tork.Trigger {
+	if t, ok := ds.s.triggers[id]; ok {
+		return t
+	}
+	for _, t := range ds.s.triggers {
+		if t.Name == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// findTemplate returns the given version of a template,
+// or its latest version when version is 0.
+func (ds *InMemoryDatastore) findTemplate(name string, version int) *tork.Template {
+	var result *tork.Template
+	for _, t := range ds.s.templates {
+		if t.Name != name {
+			continue
+		}
+		if version != 0 && t.Version == version {
+			return t
+		}
+		if version == 0 && (result == nil || t.Version > result.Version) {
+			result = t
+		}
+	}
+	return result
+}
+
+func (ds *InMemoryDatastore) toPermRecords(perms []*tork.Permission) []permRecord {
+	result := make([]permRecord, 0, len(perms))
+	for _, perm := range perms {
+		if perm.Role != nil {
+			var roleID string
+			if r := ds.findRole(perm.Role.Slug); r != nil {
+				roleID = r.ID
+			}
+			result = append(result, permRecord{roleID: roleID})
+		} else if perm.User != nil {
+			var userID string
+			if u := ds.findUser(perm.User.Username); u != nil {
+				userID = u.ID
+			}
+			result = append(result, permRecord{userID: userID})
+		}
+	}
+	return result
+}
+
+func (ds *InMemoryDatastore) toPermissions(rs []permRecord) ([]*tork.Permission, error) {
+	perms := make([]*tork.Permission, len(rs))
+	for i, rp := range rs {
+		p := &tork.Permission{}
+		if rp.roleID != "" {
+			r, ok := ds.s.roles[rp.roleID]
+			if !ok {
+				return nil, datastore.ErrRoleNotFound
+			}
+			p.Role = r.Clone()
+		} else {
+			u, ok := ds.s.users[rp.userID]
+			if !ok {
+				return nil, datastore.ErrUserNotFound
+			}
+			p.User = u.Clone()
+		}
+		perms[i] = p
+	}
+	return perms, nil
+}
+
+// permFilter returns a predicate which reports whether an object
+// with the given permissions is visible to the current user. Objects
+// without any permissions are visible to everyone.
+func (ds *InMemoryDatastore) permFilter(currentUser string) func(perms []permRecord) bool {
+	if currentUser == "" {
+		return func(perms []permRecord) bool { return true }
+	}
+	var userID string
+	for _, u := range ds.s.users {
+		if u.Username == currentUser {
+			userID = u.ID
+			break
+		}
+	}
+	roleIDs := ds.s.usersRoles[userID]
+	return func(perms []permRecord) bool {
+		if len(perms) == 0 {
+			return true
+		}
+		for _, p := range perms {
+			if userID != "" && p.userID == userID {
+				return true
+			}
+			if p.roleID != "" && slices.Contains(roleIDs, p.roleID) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var taskStates = []tork.TaskState{
+	"",
+	tork.TaskStateCreated,
+	tork.TaskStatePending,
+	tork.TaskStateScheduled,
+	tork.TaskStateRunning,
+	tork.TaskStateCancelled,
+	tork.TaskStateStopped,
+	tork.TaskStateCompleted,
+	tork.TaskStateFailed,
+	tork.TaskStateSkipped,
+}
+
+var jobStates = []tork.JobState{
+	"",
+	tork.JobStatePending,
+	tork.JobStateScheduled,
+	tork.JobStateRunning,
+	tork.JobStateCancelled,
+	tork.JobStateCompleted,
+	tork.JobStateFailed,
+	tork.JobStateRestart,
+	tork.JobStatePaused,
+	tork.JobStateQueued,
+}
+
+func toNode(n *tork.Node) *tork.Node {
+	c := n.Clone()
+	// if we hadn't seen an heartbeat for two or more
+	// consecutive periods we consider the node as offline
+	if c.LastHeartbeatAt.Before(time.Now().UTC().Add(-tork.HEARTBEAT_RATE*2)) && c.Status == tork.NodeStatusUP {
+		c.Status = tork.NodeStatusOffline
+	}
+	return c
+}
+
+func cloneTaskLogPart(p *tork.TaskLogPart) *tork.TaskLogPart {
+	return &tork.TaskLogPart{
+		ID:        p.ID,
+		Number:    p.Number,
+		TaskID:    p.TaskID,
+		Contents:  p.Contents,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+func paginate[T any](items []T, page, size int) *datastore.Page[T] {
+	offset := (page - 1) * size
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + size
+	if end > len(items) {
+		end = len(items)
+	}
+	totalPages := 0
+	if size > 0 {
+		totalPages = len(items) / size
+		if len(items)%size != 0 {
+			totalPages = totalPages + 1
+		}
+	}
+	return &datastore.Page[T]{
+		Items:      items[offset:end],
+		Number:     page,
+		Size:       end - offset,
+		TotalPages: totalPages,
+		TotalItems: len(items),
+	}
+}
+
+// matches reports whether every word of the search term
+// appears as a word in at least one of the given fields.
+func matches(searchTerm string, fields ...string) bool {
+	terms := tokenize(searchTerm)
+	if len(terms) == 0 {
+		return true
+	}
+	words := make(map[string]bool)
+	for _, f := range fields {
+		for _, w := range tokenize(f) {
+			words[w] = true
+		}
+	}
+	for _, t := range terms {
+		if !words[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func timeBefore(t1, t2 *time.Time) bool {
+	if t1 == nil || t2 == nil {
+		return t1 == nil && t2 != nil
+	}
+	return t1.Before(*t2)
+}
+
+func hasIntersection(a, b []string) bool {
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func without[T comparable](items []T, item T) []T {
+	result := make([]T, 0, len(items))
+	for _, i := range items {
+		if i != item {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func parseQuery(query string) (string, []string) {
+	terms := []string{}
+	tags := []string{}
+	parts := strings.Fields(query)
+	for _, part := range parts {
+		if strings.HasPrefix(part, "tag:") {
+			tags = append(tags, strings.TrimPrefix(part, "tag:"))
+		} else if strings.HasPrefix(part, "tags:") {
+			tags = append(tags, strings.Split(strings.TrimPrefix(part, "tags:"), ",")...)
+		} else {
+			terms = append(terms, part)
+		}
+	}
+	return strings.Join(terms, " "), tags
+}
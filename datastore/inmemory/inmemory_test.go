@@ -0,0 +1,162 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/internal/datastoretest"
+
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryDatastore(t *testing.T) {
+	datastoretest.Run(t, func(t *testing.T) datastore.Datastore {
+		ds := NewInMemoryDatastore(WithDisableCleanup(true))
+		t.Cleanup(func() {
+			assert.NoError(t, ds.Close())
+		})
+		return ds
+	})
+}
+
+func TestInMemoryGetTaskByIDCopy(t *testing.T) {
+	ctx := context.Background()
+	ds := NewInMemoryDatastore()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		Env:       map[string]string{"VAR1": "VAL1"},
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "VAL1", t2.Env["VAR1"])
+
+	// mutating the returned copy should not affect the stored task
+	t2.Env["VAR1"] = "OTHER"
+	t3, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "VAL1", t3.Env["VAR1"])
+}
+
+func TestInMemoryWithTxIsolation(t *testing.T) {
+	ctx := context.Background()
+	ds := NewInMemoryDatastore()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		State:     tork.TaskStateRunning,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+
+	updated := make(chan any)
+	errc := make(chan error)
+	go func() {
+		errc <- ds.WithTx(ctx, func(tx datastore.Datastore) error {
+			if err := tx.UpdateTask(ctx, t1.ID, func(u *tork.Task) error {
+				u.State = tork.TaskStateFailed
+				return nil
+			}); err != nil {
+				return err
+			}
+			close(updated)
+			// give the reader a chance to run
+			time.Sleep(time.Millisecond * 100)
+			return errors.New("something went wrong")
+		})
+	}()
+	<-updated
+
+	// the reader waits for the transaction to end
+	// and never sees its uncommitted changes
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateRunning, t2.State)
+	assert.Error(t, <-errc)
+}
+
+func TestInMemoryCleanup(t *testing.T) {
+	ctx := context.Background()
+	ds := NewInMemoryDatastore(
+		WithDisableCleanup(true),
+		WithJobsRetentionDuration(time.Hour*24*30),
+		WithLogsRetentionDuration(time.Hour),
+	)
+	now := time.Now().UTC()
+	jobs := []*tork.Job{
+		{
+			ID:        uuid.NewUUID(),
+			State:     tork.JobStateCompleted,
+			CreatedAt: now.Add(-time.Hour * 24 * 31),
+		},
+		{
+			ID:        uuid.NewUUID(),
+			State:     tork.JobStateRunning,
+			CreatedAt: now.Add(-time.Hour * 24 * 31),
+		},
+		{
+			ID:        uuid.NewUUID(),
+			State:     tork.JobStateCompleted,
+			CreatedAt: now,
+			DeleteAt:  &now,
+		},
+		{
+			ID:        uuid.NewUUID(),
+			State:     tork.JobStateCompleted,
+			CreatedAt: now,
+		},
+	}
+	for _, j := range jobs {
+		err := ds.CreateJob(ctx, j)
+		assert.NoError(t, err)
+	}
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     jobs[3].ID,
+		CreatedAt: &now,
+	}
+	err := ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+	err = ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+		Number:   1,
+		TaskID:   t1.ID,
+		Contents: "line 1",
+	})
+	assert.NoError(t, err)
+	past := now.Add(-time.Hour * 2)
+	ds.s.logParts[t1.ID][0].CreatedAt = &past
+
+	n1, n2 := ds.cleanup()
+	assert.Equal(t, 1, n1)
+	assert.Equal(t, 2, n2)
+
+	_, err = ds.GetJobByID(ctx, jobs[0].ID)
+	assert.Error(t, err)
+	_, err = ds.GetJobByID(ctx, jobs[1].ID)
+	assert.NoError(t, err)
+	_, err = ds.GetJobByID(ctx, jobs[2].ID)
+	assert.Error(t, err)
+	_, err = ds.GetJobByID(ctx, jobs[3].ID)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,1882 @@
+// Package datastoretest is a conformance suite for the
+// datastore.Datastore implementations.
+package datastoretest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run runs the tests every datastore.Datastore implementation must
+// pass. newDS is called once per test and must return an empty datastore.
+func Run(t *testing.T, newDS func(t *testing.T) datastore.Datastore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, ds datastore.Datastore)
+	}{
+		{"CreateAndGetTask", testCreateAndGetTask},
+		{"CreateTaskUnknownJob", testCreateTaskUnknownJob},
+		{"CreateJob", testCreateJob},
+		{"CreateAndGetParallelTask", testCreateAndGetParallelTask},
+		{"CreateTaskBadOutput", testCreateTaskBadOutput},
+		{"GetActiveTasks", testGetActiveTasks},
+		{"UpdateTask", testUpdateTask},
+		{"UpdateTaskConcurrently", testUpdateTaskConcurrently},
+		{"UpdateTaskBadStrings", testUpdateTaskBadStrings},
+		{"CreateAndGetNode", testCreateAndGetNode},
+		{"UpdateNode", testUpdateNode},
+		{"UpdateNodeConcurrently", testUpdateNodeConcurrently},
+		{"GetActiveNodes", testGetActiveNodes},
+		{"CreateAndGetJob", testCreateAndGetJob},
+		{"UpdateJob", testUpdateJob},
+		{"UpdateJobConcurrently", testUpdateJobConcurrently},
+		{"GetJobs", testGetJobs},
+		{"SearchJobs", testSearchJobs},
+		{"GetMetrics", testGetMetrics},
+		{"WithTxCreateTask", testWithTxCreateTask},
+		{"WithTxUpdateTask", testWithTxUpdateTask},
+		{"HealthCheck", testHealthCheck},
+		{"CreateAndGetTaskLogs", testCreateAndGetTaskLogs},
+		{"CreateAndGetTaskLogsMultiParts", testCreateAndGetTaskLogsMultiParts},
+		{"CreateAndGetTaskLogsLarge", testCreateAndGetTaskLogsLarge},
+		{"QueryTaskLogs", testQueryTaskLogs},
+		{"GetJobLogParts", testGetJobLogParts},
+		{"QueryJobLogParts", testQueryJobLogParts},
+		{"CreateRole", testCreateRole},
+		{"GetNextTask", testGetNextTask},
+		{"GetRetryTasks", testGetRetryTasks},
+		{"GetTimedOutJobs", testGetTimedOutJobs},
+		{"GetLostTasks", testGetLostTasks},
+		{"UpdateScheduledJob", testUpdateScheduledJob},
+		{"GetActiveScheduledJobInstances", testGetActiveScheduledJobInstances},
+		{"GetScheduledJobs", testGetScheduledJobs},
+		{"GetActiveScheduledJobs", testGetActiveScheduledJobs},
+		{"DeleteScheduledJob", testDeleteScheduledJob},
+		{"CreateScheduledJobFire", testCreateScheduledJobFire},
+		{"Triggers", testTriggers},
+		{"Templates", testTemplates},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newDS(t))
+		})
+	}
+}
+
+func testCreateAndGetTask(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.USER_GUEST, j1.CreatedBy.Username)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.USER_GUEST, j2.CreatedBy.Username)
+
+	t1 := tork.Task{
+		ID:          uuid.NewUUID(),
+		CreatedAt:   &now,
+		JobID:       j1.ID,
+		Description: "some description",
+		Networks:    []string{"some-network"},
+		Files:       map[string]string{"myfile": "hello world"},
+		Registry:    &tork.Registry{Username: "me", Password: "secret"},
+		GPUs:        "all",
+		If:          "true",
+		Tags:        []string{"tag1", "tag2"},
+		Workdir:     "/some/dir",
+		Priority:    2,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, t1.ID, t2.ID)
+	assert.Equal(t, t1.Description, t2.Description)
+	assert.Equal(t, []string([]string{"some-network"}), t2.Networks)
+	assert.Equal(t, map[string]string{"myfile": "hello world"}, t2.Files)
+	assert.Equal(t, "me", t2.Registry.Username)
+	assert.Equal(t, "secret", t2.Registry.Password)
+	assert.Equal(t, "all", t2.GPUs)
+	assert.Equal(t, "true", t2.If)
+	assert.Nil(t, t2.Parallel)
+	assert.Equal(t, []string([]string{"tag1", "tag2"}), t2.Tags)
+	assert.Equal(t, "/some/dir", t2.Workdir)
+	assert.Equal(t, 2, t2.Priority)
+
+	_, err = ds.GetTaskByID(ctx, uuid.NewUUID())
+	assert.ErrorIs(t, err, datastore.ErrTaskNotFound)
+}
+
+func testCreateTaskUnknownJob(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	err := ds.CreateTask(ctx, &tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     uuid.NewUUID(),
+	})
+	assert.Error(t, err)
+}
+
+func testCreateJob(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	u := &tork.User{
+		ID:        uuid.NewUUID(),
+		Username:  uuid.NewShortUUID(),
+		Name:      "Tester",
+		CreatedAt: &now,
+	}
+	err := ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedBy: u,
+		Tags:      []string{"tag-a", "tag-b"},
+		AutoDelete: &tork.AutoDelete{
+			After: "5h",
+		},
+		Secrets: map[string]string{
+			"password": "secret",
+		},
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	assert.Equal(t, u.Username, j1.CreatedBy.Username)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, u.Username, j2.CreatedBy.Username)
+	assert.Equal(t, []string{"tag-a", "tag-b"}, j2.Tags)
+	assert.Equal(t, "5h", j2.AutoDelete.After)
+	assert.Equal(t, map[string]string{"password": "secret"}, j2.Secrets)
+}
+
+func testCreateAndGetParallelTask(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		Parallel: &tork.ParallelTask{
+			Tasks: []*tork.Task{{
+				Name: "parallel task1",
+			}, {
+				Name: "parallel task2",
+			}},
+		},
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, t2.Parallel)
+}
+
+func testCreateTaskBadOutput(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:          uuid.NewUUID(),
+		CreatedAt:   &now,
+		JobID:       j1.ID,
+		Description: "some description",
+		Result:      string([]byte{0}),
+		Error:       string([]byte{0}),
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, t1.ID, t2.ID)
+	assert.Equal(t, t1.Description, t2.Description)
+}
+
+func testGetActiveTasks(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: time.Now().UTC(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	tasks := []*tork.Task{{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateScheduled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCancelled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCompleted,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateFailed,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, ta)
+		assert.NoError(t, err)
+	}
+	at, err := ds.GetActiveTasks(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(at))
+}
+
+func testUpdateTask(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	exitCode := 137
+	err = ds.UpdateTask(ctx, t1.ID, func(u *tork.Task) error {
+		u.State = tork.TaskStateScheduled
+		u.Result = "my result"
+		u.Queue = "somequeue"
+		u.Progress = 57.3
+		u.ExitCode = &exitCode
+		u.Outputs = map[string]any{"url": "s3://bucket/a.mp4", "size": float64(1024)}
+		u.Usage = &tork.TaskUsage{
+			WallSeconds: 12.5,
+			CPUSeconds:  3.25,
+			MemoryPeak:  1 << 30,
+			DiskRead:    4096,
+			DiskWrite:   8192,
+			NetworkRx:   100,
+			NetworkTx:   200,
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateScheduled, t2.State)
+	assert.Equal(t, "my result", t2.Result)
+	assert.Equal(t, "somequeue", t2.Queue)
+	assert.Equal(t, 57.3, t2.Progress)
+	assert.NotNil(t, t2.ExitCode)
+	assert.Equal(t, 137, *t2.ExitCode)
+	assert.Equal(t, map[string]any{"url": "s3://bucket/a.mp4", "size": float64(1024)}, t2.Outputs)
+	assert.Equal(t, &tork.TaskUsage{
+		WallSeconds: 12.5,
+		CPUSeconds:  3.25,
+		MemoryPeak:  1 << 30,
+		DiskRead:    4096,
+		DiskWrite:   8192,
+		NetworkRx:   100,
+		NetworkTx:   200,
+	}, t2.Usage)
+}
+
+func testUpdateTaskConcurrently(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		Parallel:  &tork.ParallelTask{},
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			defer wg.Done()
+			err := ds.UpdateTask(ctx, t1.ID, func(u *tork.Task) error {
+				u.State = tork.TaskStateScheduled
+				u.Result = "my result"
+				u.Parallel.Completions = u.Parallel.Completions + 1
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateScheduled, t2.State)
+	assert.Equal(t, "my result", t2.Result)
+	assert.Equal(t, 5, t2.Parallel.Completions)
+}
+
+func testUpdateTaskBadStrings(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	err = ds.UpdateTask(ctx, t1.ID, func(u *tork.Task) error {
+		u.State = tork.TaskStateScheduled
+		u.Result = string([]byte{0})
+		u.Error = string([]byte{0})
+		return nil
+	})
+	assert.NoError(t, err)
+
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateScheduled, t2.State)
+}
+
+func testCreateAndGetNode(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	n1 := &tork.Node{
+		ID:       uuid.NewUUID(),
+		Name:     "some node",
+		Hostname: "some-name",
+		Port:     1234,
+		Version:  "1.0.0",
+		Queues:   []string{"default", "gpu"},
+	}
+	err := ds.CreateNode(ctx, n1)
+	assert.NoError(t, err)
+	n2, err := ds.GetNodeByID(ctx, n1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, n1.ID, n2.ID)
+	assert.Equal(t, "some-name", n2.Hostname)
+	assert.Equal(t, 1234, n2.Port)
+	assert.Equal(t, "1.0.0", n2.Version)
+	assert.Equal(t, "some node", n2.Name)
+	assert.Equal(t, []string{"default", "gpu"}, n2.Queues)
+
+	_, err = ds.GetNodeByID(ctx, uuid.NewUUID())
+	assert.ErrorIs(t, err, datastore.ErrNodeNotFound)
+}
+
+func testUpdateNode(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	n1 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute),
+	}
+	err := ds.CreateNode(ctx, n1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	err = ds.UpdateNode(ctx, n1.ID, func(u *tork.Node) error {
+		u.LastHeartbeatAt = now
+		u.TaskCount = 2
+		return nil
+	})
+	assert.NoError(t, err)
+
+	n2, err := ds.GetNodeByID(ctx, n1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Hour(), n2.LastHeartbeatAt.Hour())
+	assert.Equal(t, now.Minute(), n2.LastHeartbeatAt.Minute())
+	assert.Equal(t, now.Second(), n2.LastHeartbeatAt.Second())
+	assert.Equal(t, 2, n2.TaskCount)
+}
+
+func testUpdateNodeConcurrently(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	n1 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute),
+	}
+	err := ds.CreateNode(ctx, n1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	wg := sync.WaitGroup{}
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			defer wg.Done()
+			err := ds.UpdateNode(ctx, n1.ID, func(u *tork.Node) error {
+				u.LastHeartbeatAt = now
+				u.CPUPercent = u.CPUPercent + 1
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	n2, err := ds.GetNodeByID(ctx, n1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Hour(), n2.LastHeartbeatAt.Hour())
+	assert.Equal(t, now.Minute(), n2.LastHeartbeatAt.Minute())
+	assert.Equal(t, now.Second(), n2.LastHeartbeatAt.Second())
+	assert.Equal(t, float64(5), n2.CPUPercent)
+}
+
+func testGetActiveNodes(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	n1 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Second * 20),
+	}
+	n2 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * 4),
+	}
+	n3 := &tork.Node{ // inactive
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * 10),
+	}
+	err := ds.CreateNode(ctx, n1)
+	assert.NoError(t, err)
+
+	err = ds.CreateNode(ctx, n2)
+	assert.NoError(t, err)
+
+	err = ds.CreateNode(ctx, n3)
+	assert.NoError(t, err)
+
+	ns, err := ds.GetActiveNodes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(ns))
+	assert.Equal(t, tork.NodeStatusUP, ns[0].Status)
+	assert.Equal(t, tork.NodeStatusOffline, ns[1].Status)
+}
+
+func testCreateAndGetJob(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+		Inputs: map[string]string{
+			"var1": "val1",
+		},
+		Defaults: &tork.JobDefaults{
+			Timeout: "5s",
+			Retry: &tork.TaskRetry{
+				Limit: 2,
+			},
+			Limits: &tork.TaskLimits{
+				CPUs:   ".5",
+				Memory: "10MB",
+			},
+		},
+		Webhooks: []*tork.Webhook{
+			{
+				URL: "http://example.com/1",
+				Headers: map[string]string{
+					"header1": "value1",
+				},
+			},
+			{
+				URL: "http://example.com/2",
+				Headers: map[string]string{
+					"header1": "value1",
+				},
+				Event: "job.StatusChange",
+			},
+		},
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		Permissions: []*tork.Permission{{
+			User: &tork.User{
+				Username: tork.USER_GUEST,
+			},
+		}},
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, j1.ID, j2.ID)
+	assert.Equal(t, j1.TraceParent, j2.TraceParent)
+	assert.Equal(t, "val1", j2.Inputs["var1"])
+	assert.Equal(t, "5s", j2.Defaults.Timeout)
+	assert.Equal(t, 2, j2.Defaults.Retry.Limit)
+	assert.Equal(t, ".5", j2.Defaults.Limits.CPUs)
+	assert.Equal(t, "10MB", j2.Defaults.Limits.Memory)
+	assert.Len(t, j2.Webhooks, 2)
+	assert.Equal(t, j1.Webhooks[0], j2.Webhooks[0])
+	assert.Equal(t, j1.Webhooks[1], j2.Webhooks[1])
+	assert.Equal(t, "guest", j2.Permissions[0].User.Username)
+
+	j3 := tork.Job{
+		ID: uuid.NewUUID(),
+		Permissions: []*tork.Permission{{
+			Role: &tork.Role{
+				Slug: tork.ROLE_PUBLIC,
+			},
+		}},
+	}
+	err = ds.CreateJob(ctx, &j3)
+	assert.NoError(t, err)
+	j4, err := ds.GetJobByID(ctx, j3.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "public", j4.Permissions[0].Role.Slug)
+
+	_, err = ds.GetJobByID(ctx, uuid.NewUUID())
+	assert.ErrorIs(t, err, datastore.ErrJobNotFound)
+}
+
+func testUpdateJob(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	j1 := tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStatePending,
+		Context: tork.JobContext{
+			Inputs: map[string]string{
+				"var1": "val1",
+			},
+		},
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	deleteAt := time.Now().UTC()
+	err = ds.UpdateJob(ctx, j1.ID, func(u *tork.Job) error {
+		u.State = tork.JobStateCompleted
+		u.Context.Inputs["var2"] = "val2"
+		u.DeleteAt = &deleteAt
+		u.Progress = 56
+		return nil
+	})
+	assert.NoError(t, err)
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateCompleted, j2.State)
+	assert.Equal(t, "val1", j2.Context.Inputs["var1"])
+	assert.Equal(t, "val2", j2.Context.Inputs["var2"])
+	assert.Equal(t, deleteAt.Unix(), j2.DeleteAt.Unix())
+	assert.Equal(t, float64(56), j2.Progress)
+}
+
+func testUpdateJobConcurrently(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	j1 := tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStatePending,
+		Context: tork.JobContext{
+			Inputs: map[string]string{
+				"var1": "val1",
+			},
+		},
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			defer wg.Done()
+			err := ds.UpdateJob(ctx, j1.ID, func(u *tork.Job) error {
+				u.State = tork.JobStateCompleted
+				u.Context.Inputs["var2"] = "val2"
+				u.Position = u.Position + 1
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.NoError(t, err)
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateCompleted, j2.State)
+	assert.Equal(t, "val1", j2.Context.Inputs["var1"])
+	assert.Equal(t, "val2", j2.Context.Inputs["var2"])
+	assert.Equal(t, 5, j2.Position)
+}
+
+func testGetJobs(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	for i := 0; i < 101; i++ {
+		j1 := tork.Job{
+			ID:   uuid.NewUUID(),
+			Name: fmt.Sprintf("Job %d", (i + 1)),
+			Tasks: []*tork.Task{
+				{
+					Name: "some task",
+				},
+			},
+		}
+		err := ds.CreateJob(ctx, &j1)
+		assert.NoError(t, err)
+
+		now := time.Now().UTC()
+		err = ds.CreateTask(ctx, &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     j1.ID,
+			State:     tork.TaskStateRunning,
+			CreatedAt: &now,
+		})
+		assert.NoError(t, err)
+	}
+	p1, err := ds.GetJobs(ctx, "", "", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p1.Size)
+	assert.Equal(t, 101, p1.TotalItems)
+	assert.Equal(t, 11, p1.TotalPages)
+
+	p2, err := ds.GetJobs(ctx, "", "", 2, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p2.Size)
+
+	p10, err := ds.GetJobs(ctx, "", "", 10, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p10.Size)
+
+	p11, err := ds.GetJobs(ctx, "", "", 11, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p11.Size)
+
+	assert.NotEqual(t, p2.Items[0].ID, p1.Items[9].ID)
+	assert.NotEqual(t, p2.Items[0].ID, p1.Items[9].ID)
+}
+
+func testSearchJobs(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	u1 := &tork.User{
+		ID:       uuid.NewUUID(),
+		Username: uuid.NewShortUUID(),
+		Name:     "Tester",
+	}
+	err := ds.CreateUser(ctx, u1)
+	assert.NoError(t, err)
+
+	u2 := &tork.User{
+		ID:       uuid.NewUUID(),
+		Username: uuid.NewShortUUID(),
+		Name:     "Tester",
+	}
+	err = ds.CreateUser(ctx, u2)
+	assert.NoError(t, err)
+
+	r := &tork.Role{
+		Slug: "test-role",
+		Name: "Test Role",
+	}
+	err = ds.CreateRole(ctx, r)
+	assert.NoError(t, err)
+
+	err = ds.AssignRole(ctx, u2.ID, r.ID)
+	assert.NoError(t, err)
+
+	u3 := &tork.User{
+		ID:       uuid.NewUUID(),
+		Username: uuid.NewShortUUID(),
+		Name:     "Tester",
+	}
+	err = ds.CreateUser(ctx, u3)
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		j1 := tork.Job{
+			ID:    uuid.NewUUID(),
+			Name:  fmt.Sprintf("Job %d", (i + 1)),
+			State: tork.JobStateRunning,
+			Tasks: []*tork.Task{{
+				Name: "some task",
+			}},
+			Tags: []string{fmt.Sprintf("tag-%d", i)},
+			Permissions: []*tork.Permission{{
+				User: u1,
+			}, {
+				Role: r,
+			}},
+		}
+		err := ds.CreateJob(ctx, &j1)
+		assert.NoError(t, err)
+
+		now := time.Now().UTC()
+		err = ds.CreateTask(ctx, &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     j1.ID,
+			State:     tork.TaskStateRunning,
+			CreatedAt: &now,
+		})
+		assert.NoError(t, err)
+	}
+
+	for i := 100; i < 101; i++ {
+		j1 := tork.Job{
+			ID:    uuid.NewUUID(),
+			Name:  fmt.Sprintf("Job %d", (i + 1)),
+			State: tork.JobStateRunning,
+			Tasks: []*tork.Task{{
+				Name: "some task",
+			}},
+			Tags: []string{fmt.Sprintf("tag-%d", i)},
+		}
+		err := ds.CreateJob(ctx, &j1)
+		assert.NoError(t, err)
+
+		now := time.Now().UTC()
+		err = ds.CreateTask(ctx, &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     j1.ID,
+			State:     tork.TaskStateRunning,
+			CreatedAt: &now,
+		})
+		assert.NoError(t, err)
+	}
+
+	p1, err := ds.GetJobs(ctx, "", "", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p1.Size)
+	assert.Equal(t, 101, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, "", "101", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p1.Size)
+	assert.Equal(t, 1, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, "", "tag:tag-1", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p1.Size)
+	assert.Equal(t, 1, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, "", "tag:not-a-tag", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, p1.Size)
+	assert.Equal(t, 0, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, "", "tags:not-a-tag,tag-1", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p1.Size)
+	assert.Equal(t, 1, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, "", "Job", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p1.Size)
+	assert.Equal(t, 101, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, "", "running", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p1.Size)
+	assert.Equal(t, 101, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, u1.Username, "running", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p1.Size)
+	assert.Equal(t, 101, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, u2.Username, "running", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p1.Size)
+	assert.Equal(t, 101, p1.TotalItems)
+
+	p1, err = ds.GetJobs(ctx, u3.Username, "running", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p1.Size)
+	assert.Equal(t, 1, p1.TotalItems)
+
+}
+
+func testGetMetrics(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	s, err := ds.GetMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, s.Jobs.Running)
+	assert.Equal(t, 0, s.Tasks.Running)
+	assert.Equal(t, float64(0), s.Nodes.CPUPercent)
+	assert.Equal(t, 0, s.Nodes.Running)
+
+	now := time.Now().UTC()
+
+	jobIDs := []string{}
+
+	for i := 0; i < 100; i++ {
+		var state tork.JobState
+		if i%2 == 0 {
+			state = tork.JobStateRunning
+		} else {
+			state = tork.JobStatePending
+		}
+		jid := uuid.NewUUID()
+		err := ds.CreateJob(ctx, &tork.Job{
+			ID:        jid,
+			State:     state,
+			CreatedAt: now,
+		})
+		assert.NoError(t, err)
+		jobIDs = append(jobIDs, jid)
+	}
+
+	for i := 0; i < 100; i++ {
+		var state tork.TaskState
+		if i%2 == 0 {
+			state = tork.TaskStateRunning
+		} else {
+			state = tork.TaskStatePending
+		}
+		err := ds.CreateTask(ctx, &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     jobIDs[i],
+			State:     state,
+			CreatedAt: &now,
+		})
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < 10; i++ {
+		err := ds.CreateNode(ctx, &tork.Node{
+			ID:              uuid.NewUUID(),
+			LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * time.Duration(i)),
+			CPUPercent:      float64(i * 10),
+		})
+		assert.NoError(t, err)
+	}
+
+	s, err = ds.GetMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, s.Jobs.Running)
+	assert.Equal(t, 50, s.Tasks.Running)
+	assert.Equal(t, float64(20), s.Nodes.CPUPercent)
+	assert.Equal(t, 5, s.Nodes.Running)
+}
+
+func testWithTxCreateTask(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		err := tx.CreateJob(ctx, &j1)
+		assert.NoError(t, err)
+		t1 := tork.Task{}
+		err = tx.CreateTask(ctx, &t1)
+		return err
+	})
+	assert.Error(t, err)
+
+	// job was created in a bad tx. should not exist
+	_, err = ds.GetJobByID(ctx, j1.ID)
+	assert.ErrorIs(t, err, datastore.ErrJobNotFound)
+}
+
+func testWithTxUpdateTask(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		State:     tork.TaskStateRunning,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+	err = ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		if err := tx.UpdateJob(ctx, j1.ID, func(u *tork.Job) error {
+			u.Position = 2
+			return nil
+		}); err != nil {
+			return err
+		}
+		return tx.UpdateTask(ctx, t1.ID, func(u *tork.Task) error {
+			u.State = tork.TaskStateFailed
+			u.State = tork.TaskState(strings.Repeat("x", 100)) // invalid state
+			return nil
+		})
+	})
+	assert.Error(t, err)
+	t11, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateRunning, t11.State)
+	// the job was updated in the same tx
+	j11, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, j11.Position)
+}
+
+func testHealthCheck(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	err := ds.HealthCheck(ctx)
+	assert.NoError(t, err)
+}
+
+func testCreateAndGetTaskLogs(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+
+	err = ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+		Number:   1,
+		TaskID:   t1.ID,
+		Contents: "line 1",
+	})
+	assert.NoError(t, err)
+
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, logs.Items, 1)
+	assert.Equal(t, "line 1", logs.Items[0].Contents)
+	assert.NotEmpty(t, logs.Items[0].ID)
+}
+
+func testCreateAndGetTaskLogsMultiParts(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+
+	parts := 10
+
+	wg := sync.WaitGroup{}
+	wg.Add(parts)
+
+	for i := 1; i <= parts; i++ {
+		go func(n int) {
+			defer wg.Done()
+			err := ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+				Number:   n,
+				TaskID:   t1.ID,
+				Contents: fmt.Sprintf("line %d", n),
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+
+	wg.Wait()
+
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, logs.Items, 10)
+	assert.Equal(t, "line 10", logs.Items[0].Contents)
+	assert.Equal(t, "line 1", logs.Items[9].Contents)
+}
+
+func testCreateAndGetTaskLogsLarge(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+
+	for i := 1; i <= 100; i++ {
+		err := ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+			Number:   i,
+			TaskID:   t1.ID,
+			Contents: fmt.Sprintf("line %d", i),
+		})
+		assert.NoError(t, err)
+	}
+
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, logs.Items, 10)
+	assert.Equal(t, "line 100", logs.Items[0].Contents)
+	assert.Equal(t, "line 91", logs.Items[9].Contents)
+	assert.Equal(t, 10, logs.Size)
+	assert.Equal(t, 10, logs.TotalPages)
+}
+
+func testQueryTaskLogs(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+
+	for i := 1; i <= 100; i++ {
+		err := ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+			Number:   i,
+			TaskID:   t1.ID,
+			Contents: fmt.Sprintf("line %d", i),
+		})
+		assert.NoError(t, err)
+	}
+
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "line 91", 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, logs.Items, 1)
+	assert.Equal(t, "line 91", logs.Items[0].Contents)
+}
+
+func testGetJobLogParts(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+
+	err = ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+		Number:   1,
+		TaskID:   t1.ID,
+		Contents: "line 1",
+	})
+	assert.NoError(t, err)
+
+	logs, err := ds.GetJobLogParts(ctx, j1.ID, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, logs.Items, 1)
+	assert.Equal(t, "line 1", logs.Items[0].Contents)
+}
+
+func testQueryJobLogParts(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+
+	for i := 1; i <= 100; i++ {
+		err := ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+			Number:   i,
+			TaskID:   t1.ID,
+			Contents: fmt.Sprintf("line %d", i),
+		})
+		assert.NoError(t, err)
+	}
+
+	logs, err := ds.GetJobLogParts(ctx, j1.ID, "line 91", 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, logs.Items, 1)
+	assert.Equal(t, "line 91", logs.Items[0].Contents)
+}
+
+func testCreateRole(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	uid := uuid.NewUUID()
+	r := &tork.Role{
+		ID:        uid,
+		Slug:      "test-role-" + uuid.NewUUID(),
+		Name:      "Test Role",
+		CreatedAt: &now,
+	}
+	err := ds.CreateRole(ctx, r)
+	assert.NoError(t, err)
+
+	// slugs are unique
+	err = ds.CreateRole(ctx, &tork.Role{
+		ID:        uuid.NewUUID(),
+		Slug:      r.Slug,
+		Name:      "Other Role",
+		CreatedAt: &now,
+	})
+	assert.Error(t, err)
+
+	role, err := ds.GetRole(ctx, r.Slug)
+	assert.NoError(t, err)
+	assert.Equal(t, r.Slug, role.Slug)
+
+	roles, err := ds.GetRoles(ctx)
+	assert.NoError(t, err)
+	assert.Greater(t, len(roles), 0)
+	assert.Equal(t, "Public", roles[0].Name)
+
+	u := &tork.User{
+		ID:        uuid.NewUUID(),
+		Username:  uuid.NewShortUUID(),
+		Name:      "Tester",
+		CreatedAt: &now,
+	}
+	err = ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	err = ds.AssignRole(ctx, u.ID, r.ID)
+	assert.NoError(t, err)
+
+	uroles, err := ds.GetUserRoles(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, uroles, 1)
+	assert.Equal(t, r.ID, uroles[0].ID)
+
+	err = ds.UnassignRole(ctx, u.ID, r.ID)
+	assert.NoError(t, err)
+
+	uroles, err = ds.GetUserRoles(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, uroles, 0)
+}
+
+func testGetNextTask(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: time.Now().UTC(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	parentTaskID := uuid.NewUUID()
+	childTaskID := uuid.NewUUID()
+
+	tasks := []*tork.Task{{
+		ID:        parentTaskID,
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        childTaskID,
+		ParentID:  parentTaskID,
+		State:     tork.TaskStateCreated,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCreated,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCreated,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, ta)
+		assert.NoError(t, err)
+	}
+	nt, err := ds.GetNextTask(ctx, parentTaskID)
+	assert.NoError(t, err)
+	assert.Equal(t, childTaskID, nt.ID)
+
+	_, err = ds.GetNextTask(ctx, childTaskID)
+	assert.ErrorIs(t, err, datastore.ErrTaskNotFound)
+}
+
+func testGetRetryTasks(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: time.Now().UTC(),
+	}
+	err := ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	due := &tork.Task{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCreated,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		RetryAt:   &past,
+	}
+	tasks := []*tork.Task{due, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCreated,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		RetryAt:   &future,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		RetryAt:   &past,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCreated,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+	ids := make(map[string]bool)
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, ta)
+		assert.NoError(t, err)
+		ids[ta.ID] = true
+	}
+	rts, err := ds.GetRetryTasks(ctx, now)
+	assert.NoError(t, err)
+	found := make([]*tork.Task, 0)
+	for _, rt := range rts {
+		if ids[rt.ID] {
+			found = append(found, rt)
+		}
+	}
+	assert.Len(t, found, 1)
+	assert.Equal(t, due.ID, found[0].ID)
+	assert.Equal(t, past.Unix(), found[0].RetryAt.Unix())
+
+	// the retries of paused jobs are held
+	err = ds.UpdateJob(ctx, j1.ID, func(u *tork.Job) error {
+		u.State = tork.JobStatePaused
+		return nil
+	})
+	assert.NoError(t, err)
+	rts, err = ds.GetRetryTasks(ctx, now)
+	assert.NoError(t, err)
+	for _, rt := range rts {
+		assert.False(t, ids[rt.ID])
+	}
+}
+
+func testGetTimedOutJobs(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	due := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: now,
+		Timeout:   "1m",
+		TimeoutAt: &past,
+	}
+	later := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: now,
+		Deadline:  &future,
+		TimeoutAt: &future,
+	}
+	jobs := []*tork.Job{due, later, {
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateFailed,
+		CreatedAt: now,
+		TimeoutAt: &past,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: now,
+	}}
+	ids := make(map[string]bool)
+	for _, j := range jobs {
+		err := ds.CreateJob(ctx, j)
+		assert.NoError(t, err)
+		ids[j.ID] = true
+	}
+	timedOut := func() []*tork.Job {
+		tjs, err := ds.GetTimedOutJobs(ctx, now)
+		assert.NoError(t, err)
+		found := make([]*tork.Job, 0)
+		for _, tj := range tjs {
+			if ids[tj.ID] {
+				found = append(found, tj)
+			}
+		}
+		return found
+	}
+	found := timedOut()
+	assert.Len(t, found, 1)
+	assert.Equal(t, due.ID, found[0].ID)
+	assert.Equal(t, "1m", found[0].Timeout)
+	assert.Equal(t, past.Unix(), found[0].TimeoutAt.Unix())
+
+	err := ds.UpdateJob(ctx, later.ID, func(u *tork.Job) error {
+		u.TimeoutAt = &past
+		return nil
+	})
+	assert.NoError(t, err)
+	found = timedOut()
+	assert.Len(t, found, 2)
+
+	// paused jobs keep timing out
+	err = ds.UpdateJob(ctx, later.ID, func(u *tork.Job) error {
+		u.State = tork.JobStatePaused
+		return nil
+	})
+	assert.NoError(t, err)
+	found = timedOut()
+	assert.Len(t, found, 2)
+}
+
+func testGetLostTasks(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	dead := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: now.Add(-time.Minute * 10),
+	}
+	alive := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: now.Add(-time.Second * 20),
+	}
+	err := ds.CreateNode(ctx, dead)
+	assert.NoError(t, err)
+	err = ds.CreateNode(ctx, alive)
+	assert.NoError(t, err)
+
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: now,
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	lost := &tork.Task{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		NodeID:    dead.ID,
+	}
+	tasks := []*tork.Task{lost, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		NodeID:    alive.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCompleted,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		NodeID:    dead.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateScheduled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+	ids := make(map[string]bool)
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, ta)
+		assert.NoError(t, err)
+		ids[ta.ID] = true
+	}
+	lts, err := ds.GetLostTasks(ctx, now.Add(-time.Minute*5))
+	assert.NoError(t, err)
+	found := make([]*tork.Task, 0)
+	for _, lt := range lts {
+		if ids[lt.ID] {
+			found = append(found, lt)
+		}
+	}
+	assert.Len(t, found, 1)
+	assert.Equal(t, lost.ID, found[0].ID)
+	assert.Equal(t, dead.ID, found[0].NodeID)
+}
+
+func testUpdateScheduledJob(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "Test Scheduled Job",
+		CreatedAt: now,
+		State:     tork.ScheduledJobStateActive,
+		Timezone:  "America/New_York",
+		Overlap:   tork.ScheduleOverlapQueue,
+		CatchUp: &tork.ScheduleCatchUp{
+			Policy: tork.ScheduleCatchUpAll,
+			Window: "2h",
+		},
+	}
+	err := ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
+	firedAt := now.Add(-time.Minute).Truncate(time.Minute)
+	err = ds.UpdateScheduledJob(ctx, sj.ID, func(u *tork.ScheduledJob) error {
+		u.State = tork.ScheduledJobStatePaused
+		u.LastFiredAt = &firedAt
+		u.Cron = "0 1 * * *"
+		u.Name = "Updated Scheduled Job"
+		u.Tasks = []*tork.Task{{Name: "some task"}}
+		u.Trigger = &tork.JobTrigger{
+			On:   []tork.JobState{tork.JobStateFailed},
+			Name: "ingest-*",
+			Tags: []string{"etl"},
+		}
+		u.InputSchema = map[string]tork.Input{
+			"count": {Type: tork.InputTypeInt, Required: true},
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	updatedSJ, err := ds.GetScheduledJobByID(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.ScheduledJobStatePaused, updatedSJ.State)
+	assert.Equal(t, "0 1 * * *", updatedSJ.Cron)
+	assert.Equal(t, "Updated Scheduled Job", updatedSJ.Name)
+	assert.Len(t, updatedSJ.Tasks, 1)
+	assert.Equal(t, sj.CreatedAt.Unix(), updatedSJ.CreatedAt.Unix())
+	assert.Equal(t, "America/New_York", updatedSJ.Timezone)
+	assert.Equal(t, tork.ScheduleOverlapQueue, updatedSJ.Overlap)
+	assert.Equal(t, tork.ScheduleCatchUpAll, updatedSJ.CatchUp.Policy)
+	assert.Equal(t, "2h", updatedSJ.CatchUp.Window)
+	assert.NotNil(t, updatedSJ.LastFiredAt)
+	assert.Equal(t, firedAt.Unix(), updatedSJ.LastFiredAt.Unix())
+	assert.Equal(t, []tork.JobState{tork.JobStateFailed}, updatedSJ.Trigger.On)
+	assert.Equal(t, map[string]tork.Input{"count": {Type: tork.InputTypeInt, Required: true}}, updatedSJ.InputSchema)
+	assert.Equal(t, "ingest-*", updatedSJ.Trigger.Name)
+	assert.Equal(t, []string{"etl"}, updatedSJ.Trigger.Tags)
+}
+
+func testGetActiveScheduledJobInstances(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "Test Scheduled Job",
+		Cron:      "* * * * *",
+		CreatedAt: now,
+		State:     tork.ScheduledJobStateActive,
+	}
+	err := ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
+	states := []tork.JobState{
+		tork.JobStateCompleted,
+		tork.JobStateRunning,
+		tork.JobStateQueued,
+		tork.JobStateFailed,
+	}
+	for i, state := range states {
+		err := ds.CreateJob(ctx, &tork.Job{
+			ID:        uuid.NewUUID(),
+			State:     state,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			Schedule: &tork.JobSchedule{
+				ID:   sj.ID,
+				Cron: sj.Cron,
+			},
+		})
+		assert.NoError(t, err)
+	}
+	// not an instance of the scheduled job
+	err = ds.CreateJob(ctx, &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: now,
+	})
+	assert.NoError(t, err)
+
+	instances, err := ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 2)
+	assert.Equal(t, tork.JobStateRunning, instances[0].State)
+	assert.Equal(t, tork.JobStateQueued, instances[1].State)
+	assert.Equal(t, sj.ID, instances[0].Schedule.ID)
+}
+
+func testGetScheduledJobs(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	for i := 0; i < 101; i++ {
+		j1 := tork.ScheduledJob{
+			ID:   uuid.NewUUID(),
+			Cron: "* * * * *",
+			Name: fmt.Sprintf("Scheduled Job %d", (i + 1)),
+			Tasks: []*tork.Task{
+				{
+					Name: "some task",
+				},
+			},
+		}
+		err := ds.CreateScheduledJob(ctx, &j1)
+		assert.NoError(t, err)
+	}
+	p1, err := ds.GetScheduledJobs(ctx, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p1.Size)
+	assert.Equal(t, 101, p1.TotalItems)
+
+	sj, err := ds.GetScheduledJobByID(ctx, p1.Items[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, p1.Items[0].ID, sj.ID)
+
+	p2, err := ds.GetScheduledJobs(ctx, "", 2, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p2.Size)
+
+	p10, err := ds.GetScheduledJobs(ctx, "", 10, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p10.Size)
+
+	p11, err := ds.GetScheduledJobs(ctx, "", 11, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p11.Size)
+
+	assert.NotEqual(t, p2.Items[0].ID, p1.Items[9].ID)
+	assert.NotEqual(t, p2.Items[0].ID, p1.Items[9].ID)
+}
+
+func testGetActiveScheduledJobs(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	u := &tork.User{
+		ID:        uuid.NewUUID(),
+		Username:  uuid.NewShortUUID(),
+		Name:      "Tester",
+		CreatedAt: &now,
+	}
+	err := ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	sj1 := &tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "Scheduled Job 1",
+		Cron:      "* * * * *",
+		CreatedAt: now,
+		CreatedBy: u,
+		State:     tork.ScheduledJobStateActive,
+	}
+	err = ds.CreateScheduledJob(ctx, sj1)
+	assert.NoError(t, err)
+
+	sj2 := &tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "Scheduled Job 2",
+		Cron:      "* * * * *",
+		CreatedAt: now,
+		CreatedBy: u,
+		State:     tork.ScheduledJobStatePaused,
+	}
+	err = ds.CreateScheduledJob(ctx, sj2)
+	assert.NoError(t, err)
+
+	activeJobs, err := ds.GetActiveScheduledJobs(ctx)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, activeJobs)
+	for _, aj := range activeJobs {
+		assert.Equal(t, tork.ScheduledJobStateActive, aj.State)
+	}
+}
+
+func testDeleteScheduledJob(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "Test Scheduled Job",
+		CreatedAt: now,
+		State:     tork.ScheduledJobStateActive,
+	}
+	err := ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: now,
+		Schedule:  &tork.JobSchedule{ID: sj.ID, Cron: sj.Cron},
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	err = ds.DeleteScheduledJob(ctx, sj.ID)
+	assert.NoError(t, err)
+
+	_, err = ds.GetScheduledJobByID(ctx, sj.ID)
+	assert.ErrorIs(t, err, datastore.ErrScheduledJobNotFound)
+
+	// the scheduled job's instances are deleted along with it
+	_, err = ds.GetJobByID(ctx, j1.ID)
+	assert.ErrorIs(t, err, datastore.ErrJobNotFound)
+}
+
+func testCreateScheduledJobFire(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "Test Scheduled Job",
+		CreatedAt: now,
+		State:     tork.ScheduledJobStateActive,
+	}
+	err := ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
+	id := uuid.NewUUID()
+	err = ds.CreateScheduledJobFire(ctx, sj.ID, id)
+	assert.NoError(t, err)
+
+	err = ds.CreateScheduledJobFire(ctx, sj.ID, id)
+	assert.ErrorIs(t, err, datastore.ErrScheduledJobFired)
+
+	err = ds.CreateScheduledJobFire(ctx, sj.ID, uuid.NewUUID())
+	assert.NoError(t, err)
+
+	// fires are deleted along with the scheduled job
+	err = ds.DeleteScheduledJob(ctx, sj.ID)
+	assert.NoError(t, err)
+}
+
+func testTriggers(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+
+	t1 := &tork.Trigger{
+		ID:          uuid.NewUUID(),
+		Name:        "test-trigger-" + uuid.NewShortUUID(),
+		Description: "some trigger",
+		Secret:      "s3cr3t",
+		Inputs:      map[string]string{"ref": "{{ body.ref }}"},
+		Job:         []byte(`{"name":"test job"}`),
+		CreatedAt:   time.Now().UTC(),
+	}
+	err := ds.CreateTrigger(ctx, t1)
+	assert.NoError(t, err)
+
+	// names are unique
+	err = ds.CreateTrigger(ctx, &tork.Trigger{
+		ID:        uuid.NewUUID(),
+		Name:      t1.Name,
+		Inputs:    map[string]string{},
+		Job:       []byte(`{}`),
+		CreatedAt: time.Now().UTC(),
+	})
+	assert.Error(t, err)
+
+	byID, err := ds.GetTrigger(ctx, t1.ID)
+	assert.NoError(t, err)
+	byName, err := ds.GetTrigger(ctx, t1.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, byID.ID, byName.ID)
+	assert.Equal(t, "s3cr3t", byName.Secret)
+	assert.Equal(t, "some trigger", byName.Description)
+	assert.Equal(t, "{{ body.ref }}", byName.Inputs["ref"])
+	assert.JSONEq(t, `{"name":"test job"}`, string(byName.Job))
+	assert.Equal(t, tork.USER_GUEST, byName.CreatedBy.Username)
+
+	ts, err := ds.GetTriggers(ctx)
+	assert.NoError(t, err)
+	found := false
+	for _, t2 := range ts {
+		if t2.ID == t1.ID {
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	err = ds.UpdateTrigger(ctx, t1.ID, func(u *tork.Trigger) error {
+		u.Secret = ""
+		u.Job = []byte(`{"name":"other job"}`)
+		return nil
+	})
+	assert.NoError(t, err)
+	updated, err := ds.GetTrigger(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, updated.Secret)
+	assert.JSONEq(t, `{"name":"other job"}`, string(updated.Job))
+	assert.Equal(t, t1.Name, updated.Name)
+
+	err = ds.DeleteTrigger(ctx, t1.ID)
+	assert.NoError(t, err)
+	_, err = ds.GetTrigger(ctx, t1.ID)
+	assert.ErrorIs(t, err, datastore.ErrTriggerNotFound)
+	err = ds.DeleteTrigger(ctx, t1.ID)
+	assert.ErrorIs(t, err, datastore.ErrTriggerNotFound)
+}
+
+func testTemplates(t *testing.T, ds datastore.Datastore) {
+	ctx := context.Background()
+	var err error
+
+	name := "test-template-" + uuid.NewShortUUID()
+	for v := 1; v <= 2; v++ {
+		err = ds.CreateTemplate(ctx, &tork.Template{
+			ID:          uuid.NewUUID(),
+			Name:        name,
+			Version:     v,
+			Description: fmt.Sprintf("version %d", v),
+			Parameters: []*tork.TemplateParameter{{
+				Name:     "size",
+				Type:     tork.InputTypeInt,
+				Required: v == 2,
+				Enum:     []string{"1", "2"},
+			}},
+			Job:       []byte(fmt.Sprintf(`{"name":"test job v%d"}`, v)),
+			CreatedAt: time.Now().UTC(),
+		})
+		assert.NoError(t, err)
+	}
+
+	// versions are unique
+	err = ds.CreateTemplate(ctx, &tork.Template{
+		ID:        uuid.NewUUID(),
+		Name:      name,
+		Version:   2,
+		Job:       []byte(`{}`),
+		CreatedAt: time.Now().UTC(),
+	})
+	assert.Error(t, err)
+
+	latest, err := ds.GetTemplate(ctx, name, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, latest.Version)
+	assert.Equal(t, "version 2", latest.Description)
+	assert.True(t, latest.Parameters[0].Required)
+	assert.Equal(t, []string{"1", "2"}, latest.Parameters[0].Enum)
+	assert.JSONEq(t, `{"name":"test job v2"}`, string(latest.Job))
+	assert.Equal(t, tork.USER_GUEST, latest.CreatedBy.Username)
+
+	v1, err := ds.GetTemplate(ctx, name, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+	assert.False(t, v1.Parameters[0].Required)
+
+	_, err = ds.GetTemplate(ctx, name, 3)
+	assert.ErrorIs(t, err, datastore.ErrTemplateNotFound)
+
+	ts, err := ds.GetTemplates(ctx)
+	assert.NoError(t, err)
+	found := 0
+	for _, t2 := range ts {
+		if t2.Name == name {
+			found++
+			assert.Equal(t, 2, t2.Version)
+		}
+	}
+	assert.Equal(t, 1, found)
+
+	err = ds.DeleteTemplate(ctx, name, 2)
+	assert.NoError(t, err)
+	latest, err = ds.GetTemplate(ctx, name, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, latest.Version)
+
+	err = ds.DeleteTemplate(ctx, name, 0)
+	assert.NoError(t, err)
+	_, err = ds.GetTemplate(ctx, name, 0)
+	assert.ErrorIs(t, err, datastore.ErrTemplateNotFound)
+	err = ds.DeleteTemplate(ctx, name, 0)
+	assert.ErrorIs(t, err, datastore.ErrTemplateNotFound)
+}
@@ -0,0 +1,26 @@
+package sqlstore
+
+// Dialect captures the differences between the SQL databases
+// the datastore runs on. Queries are written with $N placeholders
+// and only use the parts of SQL which are common to all of them,
+// everything else goes through the dialect.
+type Dialect interface {
+	// Rebind converts the $N placeholders of a query
+	// to the bind variables of the database.
+	Rebind(query string) string
+	// Array converts a string slice to a query argument
+	// for an array column.
+	Array(v []string) any
+	// ForUpdate returns the clause which locks the rows
+	// selected within a transaction.
+	ForUpdate() string
+	// In returns a condition which is true if the column
+	// is an element of the array parameter.
+	In(col, param string) string
+	// Overlaps returns a condition which is true if the array
+	// parameter is empty or shares an element with the array column.
+	Overlaps(col, param string) string
+	// Match returns a condition which is true if the given
+	// columns match the full-text search term parameter.
+	Match(param string, cols ...string) string
+}
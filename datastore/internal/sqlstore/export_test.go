@@ -0,0 +1,23 @@
+package sqlstore
+
+import "time"
+
+func (ds *Datastore) ExpungeExpiredTaskLogPart() (int, error) {
+	return ds.expungeExpiredTaskLogPart()
+}
+
+func (ds *Datastore) ExpungeExpiredJobs() (int, error) {
+	return ds.expungeExpiredJobs()
+}
+
+func (ds *Datastore) Cleanup() error {
+	return ds.cleanup()
+}
+
+func (ds *Datastore) CleanupInterval() time.Duration {
+	return *ds.cleanupInterval
+}
+
+func (ds *Datastore) SetLogsRetentionDuration(dur time.Duration) {
+	ds.logsRetentionDuration = &dur
+}
@@ -0,0 +1,2086 @@
+// Package sqlstore implements the datastore on top of a SQL
+// database. The backends only provide the connection and the
+// Dialect which captures the differences between their databases.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/slices"
+	"github.com/runabol/tork/internal/uuid"
+)
+
+type Datastore struct {
+	db                    *sqlx.DB
+	tx                    *sqlx.Tx
+	dialect               Dialect
+	logsRetentionDuration *time.Duration
+	jobsRetentionDuration *time.Duration
+	cleanupInterval       *time.Duration
+	rand                  *rand.Rand
+	disableCleanup        bool
+}
+
+var (
+	initialCleanupInterval       = minCleanupInterval
+	minCleanupInterval           = time.Minute
+	maxCleanupInterval           = time.Hour
+	DefaultLogsRetentionDuration = time.Hour * 24 * 7   // 1 week
+	DefaultJobsRetentionDuration = time.Hour * 24 * 365 // 1 year
+)
+
+type Option = func(ds *Datastore)
+
+func WithLogsRetentionDuration(dur time.Duration) Option {
+	return func(ds *Datastore) {
+		ds.logsRetentionDuration = &dur
+	}
+}
+
+func WithJobsRetentionDuration(dur time.Duration) Option {
+	return func(ds *Datastore) {
+		ds.jobsRetentionDuration = &dur
+	}
+}
+
+func WithDisableCleanup(val bool) Option {
+	return func(ds *Datastore) {
+		ds.disableCleanup = val
+	}
+}
+
+func New(db *sqlx.DB, dialect Dialect, opts ...Option) (*Datastore, error) {
+	ds := &Datastore{
+		db:      db,
+		dialect: dialect,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(ds)
+	}
+	ds.cleanupInterval = &initialCleanupInterval
+	if ds.logsRetentionDuration == nil {
+		ds.logsRetentionDuration = &DefaultLogsRetentionDuration
+	}
+	if ds.jobsRetentionDuration == nil {
+		ds.jobsRetentionDuration = &DefaultJobsRetentionDuration
+	}
+	if *ds.cleanupInterval < time.Minute {
+		return nil, errors.Errorf("cleanup interval can not be under 1 minute")
+	}
+	if *ds.logsRetentionDuration < time.Minute {
+		return nil, errors.Errorf("logs retention period can not be under 1 minute")
+	}
+	if *ds.jobsRetentionDuration < time.Minute {
+		return nil, errors.Errorf("jobs retention period can not be under 1 minute")
+	}
+	if !ds.disableCleanup {
+		go ds.cleanupProcess()
+	}
+	return ds, nil
+}
+
+func (ds *Datastore) cleanupProcess() {
+	for {
+		jitter := time.Second * (time.Duration(ds.rand.Intn(60) + 1))
+		time.Sleep(*ds.cleanupInterval + jitter)
+		if err := ds.cleanup(); err != nil {
+			log.Error().Err(err).Msg("error expunging task logs")
+		}
+	}
+}
+
+func (ds *Datastore) cleanup() error {
+	n1, err := ds.expungeExpiredTaskLogPart()
+	if err != nil {
+		return err
+	}
+	if n1 > 0 {
+		log.Debug().Msgf("Expunged %d expired task log parts from the DB", n1)
+	}
+	n2, err := ds.expungeExpiredJobs()
+	if err != nil {
+		return err
+	}
+	if n2 > 0 {
+		log.Debug().Msgf("Expunged %d expired jobs from the DB", n2)
+	}
+	n := n1 + n2
+	if n > 0 {
+		newCleanupInterval := (*ds.cleanupInterval) / 2
+		if newCleanupInterval < minCleanupInterval {
+			newCleanupInterval = minCleanupInterval
+		}
+		ds.cleanupInterval = &newCleanupInterval
+	} else {
+		newCleanupInterval := (*ds.cleanupInterval) * 2
+		if newCleanupInterval > maxCleanupInterval {
+			newCleanupInterval = maxCleanupInterval
+		}
+		ds.cleanupInterval = &newCleanupInterval
+	}
+	return nil
+}
+
+func (ds *Datastore) ExecScript(script string) error {
+	_, err := ds.exec(string(script))
+	return err
+}
+
+func (ds *Datastore) CreateTask(ctx context.Context, t *tork.Task) error {
+	var env *string
+	if t.Env != nil {
+		b, err := json.Marshal(t.Env)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.env")
+		}
+		s := string(b)
+		env = &s
+	}
+	var files *string
+	if t.Files != nil {
+		b, err := json.Marshal(t.Files)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.files")
+		}
+		s := string(b)
+		files = &s
+	}
+	pre, err := json.Marshal(t.Pre)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize task.pre")
+	}
+	post, err := json.Marshal(t.Post)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize task.post")
+	}
+	sidecars, err := json.Marshal(t.Sidecars)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize task.sidecars")
+	}
+	var retry *string
+	if t.Retry != nil {
+		b, err := json.Marshal(t.Retry)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.retry")
+		}
+		s := string(b)
+		retry = &s
+	}
+	var limits *string
+	if t.Limits != nil {
+		b, err := json.Marshal(t.Limits)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.limits")
+		}
+		s := string(b)
+		limits = &s
+	}
+	var parallel *string
+	if t.Parallel != nil {
+		b, err := json.Marshal(t.Parallel)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.parallel")
+		}
+		s := string(b)
+		parallel = &s
+	}
+	var each *string
+	if t.Each != nil {
+		b, err := json.Marshal(t.Each)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.each")
+		}
+		s := string(b)
+		each = &s
+	}
+	var subjob *string
+	if t.SubJob != nil {
+		b, err := json.Marshal(t.SubJob)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.subjob")
+		}
+		s := string(b)
+		subjob = &s
+	}
+	var registry *string
+	if t.Registry != nil {
+		b, err := json.Marshal(t.Registry)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.registry")
+		}
+		s := string(b)
+		registry = &s
+	}
+	var mounts *string
+	if len(t.Mounts) > 0 {
+		b, err := json.Marshal(t.Mounts)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.mounts")
+		}
+		s := string(b)
+		mounts = &s
+	}
+	var outputs *string
+	if t.Outputs != nil {
+		b, err := json.Marshal(t.Outputs)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.outputs")
+		}
+		s := string(b)
+		outputs = &s
+	}
+	var artifacts *string
+	if t.Artifacts != nil {
+		b, err := json.Marshal(t.Artifacts)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.artifacts")
+		}
+		s := string(b)
+		artifacts = &s
+	}
+	q := `insert into tasks (
+		    id, -- $1
+			job_id, -- $2
+			position, -- $3
+			name, -- $4
+			state, -- $5
+			created_at, -- $6
+			scheduled_at, -- $7
+			started_at, -- $8
+			completed_at, -- $9
+			failed_at, -- $10
+			cmd, -- $11
+			entrypoint, -- $12
+			run_script, -- $13
+			image, -- $14
+			env, -- $15
+			queue, -- $16
+			error_, -- $17
+			pre_tasks, -- $18
+			post_tasks, -- $19
+			mounts, -- $20
+			node_id, -- $21
+			retry, -- $22
+			limits, -- $23
+			timeout, -- $24
+			var, -- $25
+			result, -- $26
+			parallel, -- $27
+			parent_id, -- $28
+			each_, -- $29
+			description, -- $30
+			subjob, -- $31
+			networks, -- $32
+			files_, -- $33
+			registry, -- $34
+			gpus, -- $35
+			if_, -- $36
+			tags, -- $37
+			priority, -- $38
+			workdir, -- $39
+			sidecars, -- $40
+			retry_at, -- $41
+			exit_code, -- $42
+			outputs, -- $43
+			artifacts, -- $44
+			usage_wall_seconds, -- $45
+			usage_cpu_seconds, -- $46
+			usage_memory_peak, -- $47
+			usage_disk_read, -- $48
+			usage_disk_write, -- $49
+			usage_network_rx, -- $50
+			usage_network_tx -- $51
+		  ) 
+	      values (
+			$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,
+		    $15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,
+			$27,$28,$29,$30,$31,$32,$33,$34,$35,$36,$37,$38,
+			$39,$40,$41,$42,$43,$44,$45,$46,$47,$48,$49,$50,
+			$51)`
+	usage := newUsageRecord(t.Usage)
+	_, err = ds.exec(q,
+		t.ID,                           // $1
+		t.JobID,                        // $2
+		t.Position,                     // $3
+		t.Name,                         // $4
+		t.State,                        // $5
+		t.CreatedAt,                    // $6
+		t.ScheduledAt,                  // $7
+		t.StartedAt,                    // $8
+		t.CompletedAt,                  // $9
+		t.FailedAt,                     // $10
+		ds.dialect.Array(t.CMD),        // $11
+		ds.dialect.Array(t.Entrypoint), // $12
+		t.Run,                          // $13
+		t.Image,                        // $14
+		env,                            // $15
+		t.Queue,                        // $16
+		sanitizeString(t.Error),        // $17
+		pre,                            // $18
+		post,                           // $19
+		mounts,                         // $20
+		t.NodeID,                       // $21
+		retry,                          // $22
+		limits,                         // $23
+		t.Timeout,                      // $24
+		t.Var,                          // $25
+		sanitizeString(t.Result),       // $26
+		parallel,                       // $27
+		t.ParentID,                     // $28
+		each,                           // $29
+		t.Description,                  // $30
+		subjob,                         // $31
+		ds.dialect.Array(t.Networks),   // $32
+		files,                          // $33
+		registry,                       // $34
+		t.GPUs,                         // $35
+		t.If,                           // $36
+		ds.dialect.Array(t.Tags),       // $37
+		t.Priority,                     // $38
+		t.Workdir,                      // $39
+		sidecars,                       // $40
+		t.RetryAt,                      // $41
+		t.ExitCode,                     // $42
+		outputs,                        // $43
+		artifacts,                      // $44
+		usage.WallSeconds,              // $45
+		usage.CPUSeconds,               // $46
+		usage.MemoryPeak,               // $47
+		usage.DiskRead,                 // $48
+		usage.DiskWrite,                // $49
+		usage.NetworkRx,                // $50
+		usage.NetworkTx,                // $51
+	)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting task to the db")
+	}
+	return nil
+}
+
+func sanitizeString(s string) string {
+	return strings.ReplaceAll(s, "\u0000", "")
+}
+
+func (ds *Datastore) GetTaskByID(ctx context.Context, id string) (*tork.Task, error) {
+	r := taskRecord{}
+	if err := ds.get(&r, `SELECT * FROM tasks where id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrTaskNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching task from db")
+	}
+	return r.toTask()
+}
+
+func (ds *Datastore) UpdateTask(ctx context.Context, id string, modify func(t *tork.Task) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		tr := taskRecord{}
+		if err := ptx.get(&tr, fmt.Sprintf(`SELECT * FROM tasks where id = $1 %s`, ptx.dialect.ForUpdate()), id); err != nil {
+			return errors.Wrapf(err, "error fetching task %s from db", id)
+		}
+		t, err := tr.toTask()
+		if err != nil {
+			return err
+		}
+		if err := modify(t); err != nil {
+			return err
+		}
+		var each *string
+		if t.Each != nil {
+			b, err := json.Marshal(t.Each)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize task.each")
+			}
+			s := string(b)
+			each = &s
+		}
+		var parallel *string
+		if t.Parallel != nil {
+			b, err := json.Marshal(t.Parallel)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize task.parallel")
+			}
+			s := string(b)
+			parallel = &s
+		}
+		var subjob *string
+		if t.SubJob != nil {
+			b, err := json.Marshal(t.SubJob)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize task.subjob")
+			}
+			s := string(b)
+			subjob = &s
+		}
+		var limits *string
+		if t.Limits != nil {
+			b, err := json.Marshal(t.Limits)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize task.limits")
+			}
+			s := string(b)
+			limits = &s
+		}
+		var retry *string
+		if t.Retry != nil {
+			b, err := json.Marshal(t.Retry)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize task.retry")
+			}
+			s := string(b)
+			retry = &s
+		}
+		var outputs *string
+		if t.Outputs != nil {
+			b, err := json.Marshal(t.Outputs)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize task.outputs")
+			}
+			s := string(b)
+			outputs = &s
+		}
+		usage := newUsageRecord(t.Usage)
+		q := `update tasks set 
+				position = $1,
+				state = $2,
+				scheduled_at = $3,
+				started_at = $4,
+				completed_at = $5,
+				failed_at = $6,
+				error_ = $7,
+				node_id = $8,
+				result = $9,
+				each_ = $10,
+				subjob = $11,
+				parallel = $12,
+				limits = $13,
+				timeout = $14,
+				retry = $15,
+				queue = $16,
+				progress = $17,
+				priority = $18,
+				exit_code = $19,
+				outputs = $20,
+				usage_wall_seconds = $21,
+				usage_cpu_seconds = $22,
+				usage_memory_peak = $23,
+				usage_disk_read = $24,
+				usage_disk_write = $25,
+				usage_network_rx = $26,
+				usage_network_tx = $27
+			  where id = $28`
+		_, err = ptx.exec(q,
+			t.Position,               // $1
+			t.State,                  // $2
+			t.ScheduledAt,            // $3
+			t.StartedAt,              // $4
+			t.CompletedAt,            // $5
+			t.FailedAt,               // $6
+			sanitizeString(t.Error),  // $7
+			t.NodeID,                 // $8
+			sanitizeString(t.Result), // $9
+			each,                     // $10
+			subjob,                   // $11
+			parallel,                 // $12
+			limits,                   // $13
+			t.Timeout,                // $14
+			retry,                    // $15
+			t.Queue,                  // $16
+			t.Progress,               // $17
+			t.Priority,               // $18
+			t.ExitCode,               // $19
+			outputs,                  // $20
+			usage.WallSeconds,        // $21
+			usage.CPUSeconds,         // $22
+			usage.MemoryPeak,         // $23
+			usage.DiskRead,           // $24
+			usage.DiskWrite,          // $25
+			usage.NetworkRx,          // $26
+			usage.NetworkTx,          // $27
+			t.ID,                     // $28
+		)
+		if err != nil {
+			return errors.Wrapf(err, "error updating task %s", t.ID)
+		}
+		return nil
+	})
+}
+
+func (ds *Datastore) CreateNode(ctx context.Context, n *tork.Node) error {
+	q := `insert into nodes 
+	       (id,name,started_at,last_heartbeat_at,cpu_percent,queue,queues,status,hostname,task_count,version_,port)
+	      values
+	       ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`
+	queues := n.Queues
+	if queues == nil {
+		queues = make([]string, 0)
+	}
+	_, err := ds.exec(q, n.ID, n.Name, n.StartedAt, n.LastHeartbeatAt, n.CPUPercent, n.Queue, ds.dialect.Array(queues), n.Status, n.Hostname, n.TaskCount, n.Version, n.Port)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting node to the db")
+	}
+	return nil
+}
+
+func (ds *Datastore) UpdateNode(ctx context.Context, id string, modify func(u *tork.Node) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		nr := nodeRecord{}
+		if err := ptx.get(&nr, fmt.Sprintf(`SELECT * FROM nodes where id = $1 %s`, ptx.dialect.ForUpdate()), id); err != nil {
+			return errors.Wrapf(err, "error fetching node from db")
+		}
+		n := nr.toNode()
+		if err := modify(n); err != nil {
+			return err
+		}
+		q := `update nodes set 
+	        last_heartbeat_at = $1,
+			cpu_percent = $2,
+			status = $3,
+			task_count = $4
+		  where id = $5`
+		_, err := ptx.exec(q, n.LastHeartbeatAt, n.CPUPercent, n.Status, n.TaskCount, id)
+		if err != nil {
+			return errors.Wrapf(err, "error update node in db")
+		}
+		return nil
+	})
+}
+
+func (ds *Datastore) GetNodeByID(ctx context.Context, id string) (*tork.Node, error) {
+	nr := nodeRecord{}
+	if err := ds.get(&nr, `SELECT * FROM nodes where id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrNodeNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching task from db")
+	}
+	return nr.toNode(), nil
+}
+
+func (ds *Datastore) GetActiveNodes(ctx context.Context) ([]*tork.Node, error) {
+	nrs := []nodeRecord{}
+	q := `SELECT * 
+	      FROM nodes 
+		  where last_heartbeat_at > $1 
+		  ORDER BY name ASC, last_heartbeat_at DESC`
+	timeout := time.Now().UTC().Add(-tork.LAST_HEARTBEAT_TIMEOUT)
+	if err := ds.select_(&nrs, q, timeout); err != nil {
+		return nil, errors.Wrapf(err, "error getting active nodes from db")
+	}
+	ns := make([]*tork.Node, len(nrs))
+	for i, n := range nrs {
+
+		ns[i] = n.toNode()
+	}
+	return ns, nil
+}
+
+func (ds *Datastore) CreateJob(ctx context.Context, j *tork.Job) error {
+	if j.ID == "" {
+		return errors.Errorf("job id must not be empty")
+	}
+	if j.CreatedBy == nil {
+		guest, err := ds.GetUser(ctx, tork.USER_GUEST)
+		if err != nil {
+			return err
+		}
+		j.CreatedBy = guest
+	}
+	tasks, err := json.Marshal(j.Tasks)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize job.tasks")
+	}
+	c, err := json.Marshal(j.Context)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize tork.Context")
+	}
+	inputs, err := json.Marshal(j.Inputs)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize job.inputs")
+	}
+	var defaults *string
+	if j.Defaults != nil {
+		b, err := json.Marshal(j.Defaults)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize job.defaults")
+		}
+		s := string(b)
+		defaults = &s
+	}
+	var autoDelete *string
+	if j.AutoDelete != nil {
+		b, err := json.Marshal(j.AutoDelete)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize job.autoDelete")
+		}
+		s := string(b)
+		autoDelete = &s
+	}
+	webhooks, err := json.Marshal(j.Webhooks)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize job.webhooks")
+	}
+	if j.Tags == nil {
+		j.Tags = make([]string, 0)
+	}
+	var secrets *string
+	if j.Secrets != nil {
+		b, err := json.Marshal(j.Secrets)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize job.secrets")
+		}
+		s := string(b)
+		secrets = &s
+	}
+	var scheduledJobID *string
+	if j.Schedule != nil && j.Schedule.ID != "" {
+		scheduledJobID = &j.Schedule.ID
+	}
+	workspace, err := marshalWorkspace(j.Workspace)
+	if err != nil {
+		return err
+	}
+	var traceParent *string
+	if j.TraceParent != "" {
+		traceParent = &j.TraceParent
+	}
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		sql := `insert into jobs (id,name,description,state,created_at,started_at,tasks,position,
+					inputs,context,parent_id,task_count,output_,result,error_,defaults,webhooks,
+					created_by,tags,auto_delete,secrets,scheduled_job_id,timeout,deadline,timeout_at,
+					workspace,trace_parent) 
+				values
+					($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,$27)`
+		if _, err := ptx.exec(sql, j.ID, j.Name, j.Description, j.State, j.CreatedAt, j.StartedAt, tasks, j.Position,
+			inputs, c, j.ParentID, j.TaskCount, j.Output, j.Result, j.Error, defaults, webhooks, j.CreatedBy.ID,
+			ptx.dialect.Array(j.Tags), autoDelete, secrets, scheduledJobID, j.Timeout, j.Deadline, j.TimeoutAt, workspace, traceParent); err != nil {
+			return errors.Wrapf(err, "error inserting job to the db")
+		}
+		for _, perm := range j.Permissions {
+			var username *string
+			var roleSlug *string
+			if perm.Role != nil {
+				roleSlug = &perm.Role.Slug
+			} else {
+				username = &perm.User.Username
+			}
+			sql := `insert into jobs_perms 
+			          (id,job_id,user_id,role_id) 
+			        values 
+					  ($1,
+					   $2,
+					   case when cast($3 as varchar) is not null then coalesce((select id from users where username_ = $3),'') end,
+					   case when cast($4 as varchar) is not null then coalesce((select id from roles where slug = $4),'') end)`
+			if _, err := ptx.exec(sql, uuid.NewUUID(), j.ID, username, roleSlug); err != nil {
+				return errors.Wrapf(err, "error inserting job to the db")
+			}
+		}
+		return nil
+	})
+
+}
+func (ds *Datastore) UpdateJob(ctx context.Context, id string, modify func(u *tork.Job) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		r := jobRecord{}
+		if err := ptx.get(&r, fmt.Sprintf(`SELECT * FROM jobs where id = $1 %s`, ptx.dialect.ForUpdate()), id); err != nil {
+			return errors.Wrapf(err, "error fetching job from db")
+		}
+		tasks := make([]*tork.Task, 0)
+		if err := json.Unmarshal(r.Tasks, &tasks); err != nil {
+			return errors.Wrapf(err, "error desiralizing job.tasks")
+		}
+		createdBy, err := ds.GetUser(ctx, r.CreatedBy)
+		if err != nil {
+			return err
+		}
+		j, err := r.toJob(tasks, []*tork.Task{}, createdBy, []*tork.Permission{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to convert jobRecord")
+		}
+		if err := modify(j); err != nil {
+			return err
+		}
+		c, err := json.Marshal(j.Context)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize tork.Context")
+		}
+		q := `update jobs set 
+				state = $1,
+				started_at = $2,
+				completed_at = $3,
+				failed_at = $4,
+				position = $5,
+				context = $6,
+				result = $7,
+				error_ = $8,
+				delete_at = $9,
+				progress = $10,
+				timeout_at = $11,
+				workspace = $12
+			  where id = $13`
+		workspace, err := marshalWorkspace(j.Workspace)
+		if err != nil {
+			return err
+		}
+		_, err = ptx.exec(q, j.State, j.StartedAt, j.CompletedAt, j.FailedAt, j.Position, c, j.Result, j.Error, j.DeleteAt, j.Progress, j.TimeoutAt, workspace, j.ID)
+		return err
+	})
+}
+
+func (ds *Datastore) GetTimedOutJobs(ctx context.Context, before time.Time) ([]*tork.Job, error) {
+	ids := make([]string, 0)
+	q := `SELECT id 
+	      FROM jobs 
+		  where (state = 'SCHEDULED' OR state = 'RUNNING' OR state = 'PAUSED') 
+		  AND timeout_at <= $1
+		  ORDER BY timeout_at ASC`
+	if err := ds.select_(&ids, q, before.UTC()); err != nil {
+		return nil, errors.Wrapf(err, "error getting timed out jobs from db")
+	}
+	jobs := make([]*tork.Job, len(ids))
+	for i, id := range ids {
+		j, err := ds.GetJobByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		jobs[i] = j
+	}
+	return jobs, nil
+}
+
+func (ds *Datastore) GetJobByID(ctx context.Context, id string) (*tork.Job, error) {
+	r := jobRecord{}
+	if err := ds.get(&r, `SELECT * FROM jobs where id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrJobNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching job from db")
+	}
+	tasks := make([]*tork.Task, 0)
+	if err := json.Unmarshal(r.Tasks, &tasks); err != nil {
+		return nil, errors.Wrapf(err, "error desiralizing job.tasks")
+	}
+	rse := make([]taskRecord, 0)
+	q := `SELECT * 
+	      FROM tasks 
+		  where job_id = $1 
+		  ORDER BY position asc,started_at asc`
+	if err := ds.select_(&rse, q, id); err != nil {
+		return nil, errors.Wrapf(err, "error getting job execution from db")
+	}
+	exec := make([]*tork.Task, len(rse))
+	for i, r := range rse {
+		t, err := r.toTask()
+		if err != nil {
+			return nil, err
+		}
+		exec[i] = t
+	}
+	u, err := ds.GetUser(ctx, r.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	rsp := make([]jobPermRecord, 0)
+	q = `SELECT * 
+	      FROM jobs_perms
+		  where job_id = $1`
+	if err := ds.select_(&rsp, q, id); err != nil {
+		return nil, errors.Wrapf(err, "error getting job permissions from db")
+	}
+	perms := make([]*tork.Permission, len(rsp))
+	for i, rp := range rsp {
+		p := &tork.Permission{}
+		if rp.RoleID != nil {
+			role, err := ds.GetRole(ctx, *rp.RoleID)
+			if err != nil {
+				return nil, err
+			}
+			p.Role = role
+		} else {
+			user, err := ds.GetUser(ctx, *rp.UserID)
+			if err != nil {
+				return nil, err
+			}
+			p.User = user
+		}
+		perms[i] = p
+	}
+	return r.toJob(tasks, exec, u, perms)
+}
+
+func (ds *Datastore) GetActiveTasks(ctx context.Context, jobID string) ([]*tork.Task, error) {
+	rs := make([]taskRecord, 0)
+	q := fmt.Sprintf(`SELECT * 
+	      FROM tasks 
+		  where job_id = $1 
+		  AND %s
+		  ORDER BY position,created_at ASC`, ds.dialect.In("state", "$2"))
+	activeStates := slices.Map(tork.TaskStateActive, func(state tork.TaskState) string { return string(state) })
+	if err := ds.select_(&rs, q, jobID, ds.dialect.Array(activeStates)); err != nil {
+		return nil, errors.Wrapf(err, "error getting job execution from db")
+	}
+	actives := make([]*tork.Task, len(rs))
+	for i, r := range rs {
+		t, err := r.toTask()
+		if err != nil {
+			return nil, err
+		}
+		actives[i] = t
+	}
+
+	return actives, nil
+}
+
+func (ds *Datastore) GetNextTask(ctx context.Context, parentTaskID string) (*tork.Task, error) {
+	r := taskRecord{}
+	if err := ds.get(&r, `SELECT * FROM tasks where parent_id = $1 and state = 'CREATED' limit 1`, parentTaskID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrTaskNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching task from db")
+	}
+	return r.toTask()
+}
+
+func (ds *Datastore) GetRetryTasks(ctx context.Context, before time.Time) ([]*tork.Task, error) {
+	rs := make([]taskRecord, 0)
+	q := `SELECT t.* 
+	      FROM tasks t 
+		  JOIN jobs j ON t.job_id = j.id 
+		  where t.state = 'CREATED' 
+		  AND t.retry_at <= $1
+		  AND j.state != 'PAUSED'
+		  ORDER BY t.retry_at ASC`
+	if err := ds.select_(&rs, q, before.UTC()); err != nil {
+		return nil, errors.Wrapf(err, "error getting retry tasks from db")
+	}
+	tasks := make([]*tork.Task, len(rs))
+	for i, r := range rs {
+		t, err := r.toTask()
+		if err != nil {
+			return nil, err
+		}
+		tasks[i] = t
+	}
+	return tasks, nil
+}
+
+func (ds *Datastore) GetLostTasks(ctx context.Context, heartbeatBefore time.Time) ([]*tork.Task, error) {
+	rs := make([]taskRecord, 0)
+	q := `SELECT t.* 
+	      FROM tasks t 
+		  JOIN nodes n ON t.node_id = n.id 
+		  where (t.state = 'SCHEDULED' OR t.state = 'RUNNING') 
+		  AND n.last_heartbeat_at < $1
+		  ORDER BY t.created_at ASC`
+	if err := ds.select_(&rs, q, heartbeatBefore.UTC()); err != nil {
+		return nil, errors.Wrapf(err, "error getting lost tasks from db")
+	}
+	tasks := make([]*tork.Task, len(rs))
+	for i, r := range rs {
+		t, err := r.toTask()
+		if err != nil {
+			return nil, err
+		}
+		tasks[i] = t
+	}
+	return tasks, nil
+}
+
+func (ds *Datastore) CreateTaskLogPart(ctx context.Context, p *tork.TaskLogPart) error {
+	if p.TaskID == "" {
+		return errors.Errorf("must provide task id")
+	}
+	if p.Number < 1 {
+		return errors.Errorf("part number must be > 0")
+	}
+	q := `insert into tasks_log_parts 
+	       (id,number_,task_id,created_at,contents) 
+	      values
+	       ($1,$2,$3,$4,$5)`
+	_, err := ds.exec(q, uuid.NewUUID(), p.Number, p.TaskID, time.Now().UTC(), p.Contents)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting task log part to the db")
+	}
+	return nil
+}
+
+func (ds *Datastore) expungeExpiredTaskLogPart() (int, error) {
+	q := `delete from tasks_log_parts where id in ( 
+	        select id 
+		    from   tasks_log_parts 
+		    where  created_at < $1 
+		    limit  1000
+	      )`
+	res, err := ds.exec(q, time.Now().UTC().Add(-*ds.logsRetentionDuration))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deleting expired task log parts from the db")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting the number of deleted log parts")
+	}
+	return int(rows), nil
+}
+
+func (ds *Datastore) expungeExpiredJobs() (int, error) {
+	var n int
+	if err := ds.WithTx(context.Background(), func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		ids := []string{}
+		if err := ptx.select_(&ids, "select id from jobs where (delete_at < $1) OR (created_at < $2 AND (state = 'COMPLETED' or state = 'FAILED' or state = 'CANCELLED')) limit 1000", time.Now().UTC(), time.Now().UTC().Add(-*ds.jobsRetentionDuration)); err != nil {
+			return errors.Wrapf(err, "error getting list of expired job ids from the db")
+		}
+		res, err := ds.deleteJobs(ptx, ids)
+		if err != nil {
+			return err
+		}
+		n = res
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (ds *Datastore) deleteJobs(ptx *Datastore, ids []string) (int, error) {
+	var n int
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if _, err := ptx.exec(fmt.Sprintf(`delete from jobs_perms where %s;`, ptx.dialect.In("job_id", "$1")), ptx.dialect.Array(ids)); err != nil {
+		return 0, errors.Wrapf(err, "error deleting expired job perms from the db")
+	}
+	if _, err := ptx.exec(fmt.Sprintf(`delete from tasks_log_parts where task_id in (select id from tasks where %s);`, ptx.dialect.In("job_id", "$1")), ptx.dialect.Array(ids)); err != nil {
+		return 0, errors.Wrapf(err, "error deleting expired task log parts from the db")
+	}
+	if _, err := ptx.exec(fmt.Sprintf(`delete from tasks where %s;`, ptx.dialect.In("job_id", "$1")), ptx.dialect.Array(ids)); err != nil {
+		return 0, errors.Wrapf(err, "error deleting expired tasks from the db")
+	}
+	res, err := ptx.exec(fmt.Sprintf(`delete from jobs where %s;`, ptx.dialect.In("id", "$1")), ptx.dialect.Array(ids))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deleting expired jobs from the db")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting the number of deleted jobs from the db")
+	}
+	n = int(rows)
+	return n, nil
+}
+
+func (ds *Datastore) GetTaskLogParts(ctx context.Context, taskID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+	searchTerm, _ := parseQuery(q)
+	offset := (page - 1) * size
+	rs := []taskLogPartRecord{}
+	qry := fmt.Sprintf(`select * 
+	      from tasks_log_parts 
+		  where task_id = $1 and ($2 = '' OR %s)
+		  order by number_ DESC
+		  limit %d offset %d`, ds.dialect.Match("$2", "contents"), size, offset)
+
+	if err := ds.select_(&rs, qry, taskID, searchTerm); err != nil {
+		return nil, errors.Wrapf(err, "error task log parts from db")
+	}
+	items := make([]*tork.TaskLogPart, len(rs))
+	for i, r := range rs {
+		items[i] = r.toTaskLogPart()
+	}
+	var count *int
+	if err := ds.get(&count, `select count(*) from tasks_log_parts where task_id = $1`, taskID); err != nil {
+		return nil, errors.Wrapf(err, "error getting the task log parts count")
+	}
+	totalPages := *count / size
+	if *count%size != 0 {
+		totalPages = totalPages + 1
+	}
+	return &datastore.Page[*tork.TaskLogPart]{
+		Items:      items,
+		Number:     page,
+		Size:       len(items),
+		TotalPages: totalPages,
+		TotalItems: *count,
+	}, nil
+}
+
+func (ds *Datastore) GetJobLogParts(ctx context.Context, jobID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+	searchTerm, _ := parseQuery(q)
+	offset := (page - 1) * size
+	rs := []taskLogPartRecord{}
+	qry := fmt.Sprintf(`select tlp.* 
+	      from tasks_log_parts tlp
+		  join tasks t
+		  on t.id = tlp.task_id
+		  where t.job_id = $1 and ($2 = '' OR %s)
+		  order by t.position desc, t.created_at desc, tlp.number_ desc, tlp.created_at DESC
+		  limit %d offset %d`, ds.dialect.Match("$2", "contents"), size, offset)
+
+	if err := ds.select_(&rs, qry, jobID, searchTerm); err != nil {
+		return nil, errors.Wrapf(err, "error task log parts from db")
+	}
+	items := make([]*tork.TaskLogPart, len(rs))
+	for i, r := range rs {
+		items[i] = r.toTaskLogPart()
+	}
+	var count *int
+	if err := ds.get(&count, `select count(*) 
+	                          from   tasks_log_parts tlp
+							  join   tasks t
+		                      on     t.id = tlp.task_id
+							  where  t.job_id = $1`, jobID); err != nil {
+		return nil, errors.Wrapf(err, "error getting the task log parts count")
+	}
+	totalPages := *count / size
+	if *count%size != 0 {
+		totalPages = totalPages + 1
+	}
+	return &datastore.Page[*tork.TaskLogPart]{
+		Items:      items,
+		Number:     page,
+		Size:       len(items),
+		TotalPages: totalPages,
+		TotalItems: *count,
+	}, nil
+}
+
+func (ds *Datastore) GetJobs(ctx context.Context, currentUser, q string, page, size int) (*datastore.Page[*tork.JobSummary], error) {
+	searchTerm, tags := parseQuery(q)
+
+	offset := (page - 1) * size
+	rs := make([]jobRecord, 0)
+	jobsMatch := ds.dialect.Match("$1", "coalesce(j.description,'')", "coalesce(j.name,'')", "j.state")
+	jobsTags := ds.dialect.Overlaps("j.tags", "$2")
+	qry := fmt.Sprintf(`
+      WITH user_info AS (
+        SELECT id AS user_id
+        FROM users
+        WHERE username_ = $3
+      ),
+      role_info AS (
+        SELECT role_id
+        FROM users_roles ur
+        JOIN user_info ui ON ur.user_id = ui.user_id
+      ),
+      job_perms_info AS (
+        SELECT job_id
+        FROM jobs_perms jp
+        WHERE jp.user_id = (SELECT user_id FROM user_info)
+        OR jp.role_id IN (SELECT role_id FROM role_info)
+      ),
+      no_job_perms AS (
+        SELECT j.id as job_id
+        FROM jobs j
+        where not exists (
+		  select 1 from jobs_perms jp where j.id = jp.job_id
+		)
+      )
+      SELECT j.*
+      FROM jobs j
+      WHERE 
+        ($1 = '' OR %s)
+      AND 
+        %s
+      AND
+        ($3 = '' OR EXISTS (select 1 from no_job_perms njp where njp.job_id=j.id) OR EXISTS (
+           SELECT 1
+           FROM job_perms_info jpi
+           WHERE jpi.job_id = j.id
+        ))
+	  ORDER BY created_at DESC 
+	  LIMIT %d OFFSET %d`, jobsMatch, jobsTags, size, offset)
+	if err := ds.select_(&rs, qry, searchTerm, ds.dialect.Array(tags), currentUser); err != nil {
+		return nil, errors.Wrapf(err, "error getting a page of jobs")
+	}
+	result := make([]*tork.JobSummary, len(rs))
+	for i, r := range rs {
+		createdBy, err := ds.GetUser(ctx, r.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		j, err := r.toJob([]*tork.Task{}, []*tork.Task{}, createdBy, []*tork.Permission{})
+		if err != nil {
+			return nil, err
+		}
+		result[i] = tork.NewJobSummary(j)
+	}
+
+	var count *int
+	if err := ds.get(&count, fmt.Sprintf(`
+      WITH user_info AS (
+        SELECT id AS user_id
+        FROM users
+        WHERE username_ = $3
+      ),
+      role_info AS (
+        SELECT role_id
+        FROM users_roles ur
+        JOIN user_info ui ON ur.user_id = ui.user_id
+      ),
+      job_perms_info AS (
+        SELECT job_id
+        FROM jobs_perms jp
+        WHERE jp.user_id = (SELECT user_id FROM user_info)
+        OR jp.role_id IN (SELECT role_id FROM role_info)
+      ),
+      no_job_perms AS (
+        SELECT j.id as job_id
+        FROM jobs j
+        where not exists (
+		  select 1 from jobs_perms jp where j.id = jp.job_id
+		)
+      )
+      SELECT count(*)
+      FROM jobs j
+      WHERE 
+        ($1 = '' OR %s)
+      AND 
+        %s
+      AND
+        ($3 = '' OR EXISTS (select 1 from no_job_perms njp where njp.job_id=j.id) OR EXISTS (
+           SELECT 1
+           FROM job_perms_info jpi
+           WHERE jpi.job_id = j.id
+        ));
+	  `, jobsMatch, jobsTags), searchTerm, ds.dialect.Array(tags), currentUser); err != nil {
+		return nil, errors.Wrapf(err, "error getting the jobs count")
+	}
+
+	totalPages := *count / size
+	if *count%size != 0 {
+		totalPages = totalPages + 1
+	}
+
+	return &datastore.Page[*tork.JobSummary]{
+		Items:      result,
+		Number:     page,
+		Size:       len(result),
+		TotalPages: totalPages,
+		TotalItems: *count,
+	}, nil
+}
+
+func (ds *Datastore) GetUser(ctx context.Context, uid string) (*tork.User, error) {
+	r := userRecord{}
+	if err := ds.get(&r, `SELECT * FROM users where (username_ = $1 or id = $1)`, uid); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrUserNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching user from db")
+	}
+	return r.toUser(), nil
+}
+
+func (ds *Datastore) CreateUser(ctx context.Context, u *tork.User) error {
+	u.ID = uuid.NewUUID()
+	now := time.Now().UTC()
+	u.CreatedAt = &now
+	q := `insert into users 
+	       (id,name,username_,password_,created_at) 
+	      values
+	       ($1,$2,$3,$4,$5)`
+	_, err := ds.exec(q, u.ID, u.Name, u.Username, u.PasswordHash, u.CreatedAt)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting user to the db")
+	}
+	return nil
+}
+
+func (ds *Datastore) CreateRole(ctx context.Context, r *tork.Role) error {
+	r.ID = uuid.NewUUID()
+	now := time.Now().UTC()
+	r.CreatedAt = &now
+	q := `insert into roles 
+	       (id,slug,name,created_at) 
+	      values
+	       ($1,$2,$3,$4)`
+	_, err := ds.exec(q, r.ID, r.Slug, r.Name, r.CreatedAt)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting role to the db")
+	}
+	return nil
+}
+
+func (ds *Datastore) GetRole(ctx context.Context, id string) (*tork.Role, error) {
+	r := roleRecord{}
+	if err := ds.get(&r, `SELECT * FROM roles where id = $1 or slug = $1`, id); err != nil {
+		return nil, errors.Wrapf(err, "error fetching role from db")
+	}
+	return r.toRole(), nil
+}
+
+func (ds *Datastore) GetRoles(ctx context.Context) ([]*tork.Role, error) {
+	rs := []roleRecord{}
+	if err := ds.select_(&rs, `SELECT * FROM roles order by name`); err != nil {
+		return nil, errors.Wrapf(err, "error fetching roles from db")
+	}
+	result := make([]*tork.Role, len(rs))
+	for i, r := range rs {
+		result[i] = r.toRole()
+	}
+	return result, nil
+}
+
+func (ds *Datastore) GetUserRoles(ctx context.Context, userID string) ([]*tork.Role, error) {
+	rs := []roleRecord{}
+	if err := ds.select_(&rs, `SELECT r.* FROM roles r inner join users_roles ur on ur.role_id=r.id where ur.user_id = $1`, userID); err != nil {
+		return nil, errors.Wrapf(err, "error fetching user roles from db")
+	}
+	result := make([]*tork.Role, len(rs))
+	for i, r := range rs {
+		result[i] = r.toRole()
+	}
+	return result, nil
+}
+
+func (ds *Datastore) AssignRole(ctx context.Context, userID, roleID string) error {
+	q := `insert into users_roles 
+	       (id,user_id,role_id,created_at) 
+	      values
+	       ($1,$2,$3,$4)`
+	_, err := ds.exec(q, uuid.NewUUID(), userID, roleID, time.Now().UTC())
+	if err != nil {
+		return errors.Wrapf(err, "error inserting role to the db")
+	}
+	return nil
+}
+
+func (ds *Datastore) UnassignRole(ctx context.Context, userID, roleID string) error {
+	sql := `delete from users_roles where user_id = $1 and role_id = $2`
+	if _, err := ds.exec(sql, userID, roleID); err != nil {
+		return errors.Wrapf(err, "error deleting user role from db")
+	}
+	return nil
+}
+
+func (ds *Datastore) GetMetrics(ctx context.Context) (*tork.Metrics, error) {
+	s := &tork.Metrics{}
+
+	if err := ds.get(&s.Jobs.Running, "select count(*) from jobs where state = 'RUNNING'"); err != nil {
+		return nil, errors.Wrapf(err, "error getting the running jobs count")
+	}
+
+	if err := ds.get(&s.Tasks.Running, "select count(*) from tasks t join jobs j on t.job_id = j.id where t.state = 'RUNNING' and j.state = 'RUNNING'"); err != nil {
+		return nil, errors.Wrapf(err, "error getting the running tasks count")
+	}
+
+	if err := ds.get(&s.Nodes.Running, "select count(*) from nodes where last_heartbeat_at > $1", time.Now().UTC().Add(-time.Minute*5)); err != nil {
+		return nil, errors.Wrapf(err, "error getting the running tasks count")
+	}
+
+	if err := ds.get(&s.Nodes.CPUPercent, "select coalesce(avg(cpu_percent),0) from nodes where last_heartbeat_at > $1", time.Now().UTC().Add(-time.Minute*5)); err != nil {
+		return nil, errors.Wrapf(err, "error getting the running tasks count")
+	}
+
+	return s, nil
+}
+
+func (ds *Datastore) CreateScheduledJob(ctx context.Context, sj *tork.ScheduledJob) error {
+	if sj.ID == "" {
+		return errors.Errorf("scheduled job id must not be empty")
+	}
+	if sj.CreatedBy == nil {
+		guest, err := ds.GetUser(ctx, tork.USER_GUEST)
+		if err != nil {
+			return err
+		}
+		sj.CreatedBy = guest
+	}
+	tasks, err := json.Marshal(sj.Tasks)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize tasks")
+	}
+	inputs, err := json.Marshal(sj.Inputs)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize inputs")
+	}
+	var defaults *string
+	if sj.Defaults != nil {
+		b, err := json.Marshal(sj.Defaults)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize job.defaults")
+		}
+		s := string(b)
+		defaults = &s
+	}
+	var autoDelete *string
+	if sj.AutoDelete != nil {
+		b, err := json.Marshal(sj.AutoDelete)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize job.autoDelete")
+		}
+		s := string(b)
+		autoDelete = &s
+	}
+	webhooks, err := json.Marshal(sj.Webhooks)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize webhooks")
+	}
+	if sj.Tags == nil {
+		sj.Tags = make([]string, 0)
+	}
+	var secrets *string
+	if sj.Secrets != nil {
+		b, err := json.Marshal(sj.Secrets)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize secrets")
+		}
+		s := string(b)
+		secrets = &s
+	}
+	var catchUp *string
+	if sj.CatchUp != nil {
+		b, err := json.Marshal(sj.CatchUp)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize job.catchUp")
+		}
+		s := string(b)
+		catchUp = &s
+	}
+	var trigger *string
+	if sj.Trigger != nil {
+		b, err := json.Marshal(sj.Trigger)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize job.trigger")
+		}
+		s := string(b)
+		trigger = &s
+	}
+	var inputSchema *string
+	if sj.InputSchema != nil {
+		b, err := json.Marshal(sj.InputSchema)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize job.inputSchema")
+		}
+		s := string(b)
+		inputSchema = &s
+	}
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		sql := `insert into scheduled_jobs (id,name,description,created_at,tasks,inputs,output_,defaults,webhooks,
+					created_by,tags,auto_delete,secrets,cron_expr,state,timezone,overlap,catch_up,last_fired_at,trigger_,input_schema) 
+				values
+					($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21)`
+		if _, err := ptx.exec(sql, sj.ID, sj.Name, sj.Description, sj.CreatedAt, tasks,
+			inputs, sj.Output, defaults, webhooks, sj.CreatedBy.ID,
+			ptx.dialect.Array(sj.Tags), autoDelete, secrets, sj.Cron, sj.State,
+			sj.Timezone, sj.Overlap, catchUp, sj.LastFiredAt, trigger, inputSchema); err != nil {
+			return errors.Wrapf(err, "error inserting scheduled job to the db")
+		}
+		for _, perm := range sj.Permissions {
+			var username *string
+			var roleSlug *string
+			if perm.Role != nil {
+				roleSlug = &perm.Role.Slug
+			} else {
+				username = &perm.User.Username
+			}
+			sql := `insert into scheduled_jobs_perms 
+			          (id,scheduled_job_id,user_id,role_id) 
+			        values 
+					  ($1,
+					   $2,
+					   case when cast($3 as varchar) is not null then coalesce((select id from users where username_ = $3),'') end,
+					   case when cast($4 as varchar) is not null then coalesce((select id from roles where slug = $4),'') end)`
+			if _, err := ptx.exec(sql, uuid.NewUUID(), sj.ID, username, roleSlug); err != nil {
+				return errors.Wrapf(err, "error inserting job to the db")
+			}
+		}
+		return nil
+	})
+}
+
+func (ds *Datastore) GetActiveScheduledJobs(ctx context.Context) ([]*tork.ScheduledJob, error) {
+	sjrs := []scheduledJobRecord{}
+	q := `SELECT * FROM scheduled_jobs where state = 'ACTIVE'`
+	if err := ds.select_(&sjrs, q); err != nil {
+		return nil, errors.Wrapf(err, "error getting active scheduled jobs from db")
+	}
+	sjs := make([]*tork.ScheduledJob, len(sjrs))
+	for i, sjr := range sjrs {
+		tasks := make([]*tork.Task, 0)
+		if err := json.Unmarshal(sjr.Tasks, &tasks); err != nil {
+			return nil, errors.Wrapf(err, "error desiralizing scheduled job tasks")
+		}
+		u, err := ds.GetUser(ctx, sjr.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		sj, err := sjr.toScheduledJob(tasks, u, []*tork.Permission{})
+		if err != nil {
+			return nil, err
+		}
+		sjs[i] = sj
+	}
+	return sjs, nil
+}
+
+func (ds *Datastore) GetScheduledJobs(ctx context.Context, currentUser string, page, size int) (*datastore.Page[*tork.ScheduledJobSummary], error) {
+	offset := (page - 1) * size
+	rs := make([]scheduledJobRecord, 0)
+	qry := fmt.Sprintf(`
+      WITH user_info AS (
+        SELECT id AS user_id
+        FROM users
+        WHERE username_ = $1
+      ),
+      role_info AS (
+        SELECT role_id
+        FROM users_roles ur
+        JOIN user_info ui ON ur.user_id = ui.user_id
+      ),
+      job_perms_info AS (
+        SELECT scheduled_job_id
+        FROM scheduled_jobs_perms jp
+        WHERE jp.user_id = (SELECT user_id FROM user_info)
+        OR jp.role_id IN (SELECT role_id FROM role_info)
+      ),
+      no_job_perms AS (
+        SELECT j.id as scheduled_job_id
+        FROM scheduled_jobs j
+        where not exists (
+		  select 1 from scheduled_jobs_perms jp where j.id = jp.scheduled_job_id
+		)
+      )
+      SELECT j.*
+      FROM scheduled_jobs j
+      WHERE ($1 = '' OR EXISTS (select 1 from no_job_perms njp where njp.scheduled_job_id=j.id) OR EXISTS (
+           SELECT 1
+           FROM job_perms_info jpi
+           WHERE jpi.scheduled_job_id = j.id
+        ))
+	  ORDER BY created_at DESC 
+	  LIMIT %d OFFSET %d`, size, offset)
+	if err := ds.select_(&rs, qry, currentUser); err != nil {
+		return nil, errors.Wrapf(err, "error getting a page of scheduled jobs")
+	}
+	result := make([]*tork.ScheduledJobSummary, len(rs))
+	for i, r := range rs {
+		createdBy, err := ds.GetUser(ctx, r.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		j, err := r.toScheduledJob([]*tork.Task{}, createdBy, []*tork.Permission{})
+		if err != nil {
+			return nil, err
+		}
+		result[i] = tork.NewScheduledJobSummary(j)
+	}
+
+	var count *int
+	if err := ds.get(&count, `
+      WITH user_info AS (
+        SELECT id AS user_id
+        FROM users
+        WHERE username_ = $1
+      ),
+      role_info AS (
+        SELECT role_id
+        FROM users_roles ur
+        JOIN user_info ui ON ur.user_id = ui.user_id
+      ),
+      job_perms_info AS (
+        SELECT scheduled_job_id
+        FROM scheduled_jobs_perms jp
+        WHERE jp.user_id = (SELECT user_id FROM user_info)
+        OR jp.role_id IN (SELECT role_id FROM role_info)
+      ),
+      no_job_perms AS (
+        SELECT j.id as scheduled_job_id
+        FROM scheduled_jobs j
+        where not exists (
+		  select 1 from scheduled_jobs_perms jp where j.id = jp.scheduled_job_id
+		)
+      )
+      SELECT count(*)
+      FROM scheduled_jobs j
+      WHERE ($1 = '' OR EXISTS (select 1 from no_job_perms njp where njp.scheduled_job_id=j.id) OR EXISTS (
+           SELECT 1
+           FROM job_perms_info jpi
+           WHERE jpi.scheduled_job_id = j.id
+        ));
+	  `, currentUser); err != nil {
+		return nil, errors.Wrapf(err, "error getting the scheduled jobs count")
+	}
+
+	totalPages := *count / size
+	if *count%size != 0 {
+		totalPages = totalPages + 1
+	}
+
+	return &datastore.Page[*tork.ScheduledJobSummary]{
+		Items:      result,
+		Number:     page,
+		Size:       len(result),
+		TotalPages: totalPages,
+		TotalItems: *count,
+	}, nil
+}
+
+func (ds *Datastore) GetScheduledJobByID(ctx context.Context, id string) (*tork.ScheduledJob, error) {
+	r := scheduledJobRecord{}
+	if err := ds.get(&r, `SELECT * FROM scheduled_jobs where id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrScheduledJobNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching scheduled job from db")
+	}
+	tasks := make([]*tork.Task, 0)
+	if err := json.Unmarshal(r.Tasks, &tasks); err != nil {
+		return nil, errors.Wrapf(err, "error deserializing scheduled job tasks")
+	}
+	u, err := ds.GetUser(ctx, r.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	rsp := make([]scheduledPermRecord, 0)
+	q := `SELECT * 
+	      FROM scheduled_jobs_perms
+		  where scheduled_job_id = $1`
+	if err := ds.select_(&rsp, q, id); err != nil {
+		return nil, errors.Wrapf(err, "error getting scheduled job permissions from db")
+	}
+	perms := make([]*tork.Permission, len(rsp))
+	for i, rp := range rsp {
+		p := &tork.Permission{}
+		if rp.RoleID != nil {
+			role, err := ds.GetRole(ctx, *rp.RoleID)
+			if err != nil {
+				return nil, err
+			}
+			p.Role = role
+		} else {
+			user, err := ds.GetUser(ctx, *rp.UserID)
+			if err != nil {
+				return nil, err
+			}
+			p.User = user
+		}
+		perms[i] = p
+	}
+	return r.toScheduledJob(tasks, u, perms)
+}
+
+func (ds *Datastore) UpdateScheduledJob(ctx context.Context, id string, modify func(u *tork.ScheduledJob) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		r := scheduledJobRecord{}
+		if err := ptx.get(&r, fmt.Sprintf(`SELECT * FROM scheduled_jobs where id = $1 %s`, ptx.dialect.ForUpdate()), id); err != nil {
+			return errors.Wrapf(err, "error fetching scheduled job from db")
+		}
+		tasks := make([]*tork.Task, 0)
+		if err := json.Unmarshal(r.Tasks, &tasks); err != nil {
+			return errors.Wrapf(err, "error deserializing scheduled job tasks")
+		}
+		createdBy, err := ds.GetUser(ctx, r.CreatedBy)
+		if err != nil {
+			return err
+		}
+		j, err := r.toScheduledJob(tasks, createdBy, []*tork.Permission{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to convert jobRecord")
+		}
+		if err := modify(j); err != nil {
+			return err
+		}
+		serializedTasks, err := json.Marshal(j.Tasks)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize tasks")
+		}
+		inputs, err := json.Marshal(j.Inputs)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize inputs")
+		}
+		var defaults *string
+		if j.Defaults != nil {
+			b, err := json.Marshal(j.Defaults)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize job.defaults")
+			}
+			s := string(b)
+			defaults = &s
+		}
+		var autoDelete *string
+		if j.AutoDelete != nil {
+			b, err := json.Marshal(j.AutoDelete)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize job.autoDelete")
+			}
+			s := string(b)
+			autoDelete = &s
+		}
+		webhooks, err := json.Marshal(j.Webhooks)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize webhooks")
+		}
+		if j.Tags == nil {
+			j.Tags = make([]string, 0)
+		}
+		var secrets *string
+		if j.Secrets != nil {
+			b, err := json.Marshal(j.Secrets)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize secrets")
+			}
+			s := string(b)
+			secrets = &s
+		}
+		var catchUp *string
+		if j.CatchUp != nil {
+			b, err := json.Marshal(j.CatchUp)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize job.catchUp")
+			}
+			s := string(b)
+			catchUp = &s
+		}
+		var trigger *string
+		if j.Trigger != nil {
+			b, err := json.Marshal(j.Trigger)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize job.trigger")
+			}
+			s := string(b)
+			trigger = &s
+		}
+		var inputSchema *string
+		if j.InputSchema != nil {
+			b, err := json.Marshal(j.InputSchema)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize job.inputSchema")
+			}
+			s := string(b)
+			inputSchema = &s
+		}
+		q := `update scheduled_jobs set 
+				state = $1,
+				last_fired_at = $2,
+				name = $3,
+				description = $4,
+				tags = $5,
+				cron_expr = $6,
+				inputs = $7,
+				output_ = $8,
+				tasks = $9,
+				defaults = $10,
+				webhooks = $11,
+				auto_delete = $12,
+				secrets = $13,
+				timezone = $14,
+				overlap = $15,
+				catch_up = $16,
+				trigger_ = $17,
+				input_schema = $18
+			  where id = $19`
+		_, err = ptx.exec(q, j.State, j.LastFiredAt, j.Name, j.Description, ptx.dialect.Array(j.Tags), j.Cron,
+			inputs, j.Output, serializedTasks, defaults, webhooks, autoDelete, secrets, j.Timezone, j.Overlap, catchUp, trigger, inputSchema, id)
+		return err
+	})
+}
+
+func (ds *Datastore) DeleteScheduledJob(ctx context.Context, id string) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		ids := []string{}
+		if err := ptx.select_(&ids, "select id from jobs where scheduled_job_id = $1 ", id); err != nil {
+			return errors.Wrapf(err, "error getting list of scheduled job instance ids from the db")
+		}
+		if _, err := ds.deleteJobs(ptx, ids); err != nil {
+			return errors.Wrapf(err, "error deleting scheduled job instances from the db")
+		}
+		if _, err := ptx.exec(`delete from scheduled_jobs_perms where scheduled_job_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting scheduled job perms from the db")
+		}
+		if _, err := ptx.exec(`delete from scheduled_job_fires where scheduled_job_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting scheduled job fires from the db")
+		}
+		if _, err := ptx.exec(`delete from scheduled_jobs where id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting scheduled job from the db")
+		}
+		return nil
+	})
+}
+
+func (ds *Datastore) GetActiveScheduledJobInstances(ctx context.Context, scheduledJobID string) ([]*tork.Job, error) {
+	ids := make([]string, 0)
+	q := `SELECT id 
+	      FROM jobs 
+		  where scheduled_job_id = $1 
+		  AND state in ('PENDING','QUEUED','SCHEDULED','RUNNING','PAUSED') 
+		  ORDER BY created_at ASC`
+	if err := ds.select_(&ids, q, scheduledJobID); err != nil {
+		return nil, errors.Wrapf(err, "error getting active scheduled job instances from db")
+	}
+	jobs := make([]*tork.Job, len(ids))
+	for i, id := range ids {
+		j, err := ds.GetJobByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		jobs[i] = j
+	}
+	return jobs, nil
+}
+
+func (ds *Datastore) CreateScheduledJobFire(ctx context.Context, scheduledJobID, id string) error {
+	q := `insert into scheduled_job_fires (id,scheduled_job_id,created_at) 
+	      values ($1,$2,$3) 
+		  on conflict (id) do nothing`
+	res, err := ds.exec(q, id, scheduledJobID, time.Now().UTC())
+	if err != nil {
+		return errors.Wrapf(err, "error inserting scheduled job fire to the db")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "error inserting scheduled job fire to the db")
+	}
+	if n == 0 {
+		return datastore.ErrScheduledJobFired
+	}
+	return nil
+}
+
+func (ds *Datastore) CreateTrigger(ctx context.Context, t *tork.Trigger) error {
+	if t.ID == "" {
+		return errors.Errorf("trigger id must not be empty")
+	}
+	if t.CreatedBy == nil {
+		guest, err := ds.GetUser(ctx, tork.USER_GUEST)
+		if err != nil {
+			return err
+		}
+		t.CreatedBy = guest
+	}
+	inputs, err := json.Marshal(t.Inputs)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize inputs")
+	}
+	q := `insert into triggers 
+	       (id,name,description,secret,inputs,job_,created_at,created_by) 
+	      values
+	       ($1,$2,$3,$4,$5,$6,$7,$8)`
+	if _, err := ds.exec(q, t.ID, t.Name, t.Description, t.Secret, inputs, string(t.Job), t.CreatedAt, t.CreatedBy.ID); err != nil {
+		return errors.Wrapf(err, "error inserting trigger to the db")
+	}
+	return nil
+}
+
+func (ds *Datastore) GetTrigger(ctx context.Context, id string) (*tork.Trigger, error) {
+	r := triggerRecord{}
+	if err := ds.get(&r, `SELECT * FROM triggers where id = $1 or name = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrTriggerNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching trigger from db")
+	}
+	u, err := ds.GetUser(ctx, r.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return r.toTrigger(u)
+}
+
+func (ds *Datastore) GetTriggers(ctx context.Context) ([]*tork.Trigger, error) {
+	rs := []triggerRecord{}
+	if err := ds.select_(&rs, `SELECT * FROM triggers order by name`); err != nil {
+		return nil, errors.Wrapf(err, "error fetching triggers from db")
+	}
+	result := make([]*tork.Trigger, len(rs))
+	for i, r := range rs {
+		u, err := ds.GetUser(ctx, r.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		t, err := r.toTrigger(u)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = t
+	}
+	return result, nil
+}
+
+func (ds *Datastore) UpdateTrigger(ctx context.Context, id string, modify func(u *tork.Trigger) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*Datastore)
+		if !ok {
+			return errors.New("unable to cast to a sql datastore")
+		}
+		r := triggerRecord{}
+		if err := ptx.get(&r, fmt.Sprintf(`SELECT * FROM triggers where id = $1 %s`, ptx.dialect.ForUpdate()), id); err != nil {
+			if err == sql.ErrNoRows {
+				return datastore.ErrTriggerNotFound
+			}
+			return errors.Wrapf(err, "error fetching trigger from db")
+		}
+		createdBy, err := ptx.GetUser(ctx, r.CreatedBy)
+		if err != nil {
+			return err
+		}
+		t, err := r.toTrigger(createdBy)
+		if err != nil {
+			return err
+		}
+		if err := modify(t); err != nil {
+			return err
+		}
+		inputs, err := json.Marshal(t.Inputs)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize inputs")
+		}
+		q := `update triggers set 
+				name = $1,
+				description = $2,
+				secret = $3,
+				inputs = $4,
+				job_ = $5
+			  where id = $6`
+		if _, err := ptx.exec(q, t.Name, t.Description, t.Secret, inputs, string(t.Job), id); err != nil {
+			return errors.Wrapf(err, "error updating trigger in the db")
+		}
+		return nil
+	})
+}
+
+func (ds *Datastore) DeleteTrigger(ctx context.Context, id string) error {
+	res, err := ds.exec(`delete from triggers where id = $1`, id)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting trigger from the db")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrapf(err, "error deleting trigger from the db")
+	} else if n == 0 {
+		return datastore.ErrTriggerNotFound
+	}
+	return nil
+}
+
+func (ds *Datastore) CreateTemplate(ctx context.Context, t *tork.Template) error {
+	if t.ID == "" {
+		return errors.Errorf("template id must not be empty")
+	}
+	if t.CreatedBy == nil {
+		guest, err := ds.GetUser(ctx, tork.USER_GUEST)
+		if err != nil {
+			return err
+		}
+		t.CreatedBy = guest
+	}
+	params, err := json.Marshal(t.Parameters)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize parameters")
+	}
+	q := `insert into templates 
+	       (id,name,version,description,parameters,job_,created_at,created_by) 
+	      values
+	       ($1,$2,$3,$4,$5,$6,$7,$8)`
+	if _, err := ds.exec(q, t.ID, t.Name, t.Version, t.Description, params, string(t.Job), t.CreatedAt, t.CreatedBy.ID); err != nil {
+		return errors.Wrapf(err, "error inserting template to the db")
+	}
+	return nil
+}
+
+func (ds *Datastore) GetTemplate(ctx context.Context, name string, version int) (*tork.Template, error) {
+	r := templateRecord{}
+	var err error
+	if version == 0 {
+		err = ds.get(&r, `SELECT * FROM templates where name = $1 order by version desc limit 1`, name)
+	} else {
+		err = ds.get(&r, `SELECT * FROM templates where name = $1 and version = $2`, name, version)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrTemplateNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching template from db")
+	}
+	u, err := ds.GetUser(ctx, r.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return r.toTemplate(u)
+}
+
+func (ds *Datastore) GetTemplates(ctx context.Context) ([]*tork.Template, error) {
+	rs := []templateRecord{}
+	q := `SELECT * FROM templates t 
+	      where version = (SELECT max(version) FROM templates where name = t.name) 
+	      order by name`
+	if err := ds.select_(&rs, q); err != nil {
+		return nil, errors.Wrapf(err, "error fetching templates from db")
+	}
+	result := make([]*tork.Template, len(rs))
+	for i, r := range rs {
+		u, err := ds.GetUser(ctx, r.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		t, err := r.toTemplate(u)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = t
+	}
+	return result, nil
+}
+
+func (ds *Datastore) DeleteTemplate(ctx context.Context, name string, version int) error {
+	var res sql.Result
+	var err error
+	if version == 0 {
+		res, err = ds.exec(`delete from templates where name = $1`, name)
+	} else {
+		res, err = ds.exec(`delete from templates where name = $1 and version = $2`, name, version)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error deleting template from the db")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrapf(err, "error deleting template from the db")
+	} else if n == 0 {
+		return datastore.ErrTemplateNotFound
+	}
+	return nil
+}
+
+func (ds *Datastore) get(dest interface{}, query string, args ...interface{}) error {
+	query = ds.dialect.Rebind(query)
+	if ds.tx != nil {
+		return ds.tx.Get(dest, query, args...)
+	} else {
+		return ds.db.Get(dest, query, args...)
+	}
+}
+
+func (ds *Datastore) select_(dest interface{}, query string, args ...interface{}) error {
+	query = ds.dialect.Rebind(query)
+	if ds.tx != nil {
+		return ds.tx.Select(dest, query, args...)
+	} else {
+		return ds.db.Select(dest, query, args...)
+	}
+}
+
+func (ds *Datastore) exec(query string, args ...any) (sql.Result, error) {
+	query = ds.dialect.Rebind(query)
+	if ds.tx != nil {
+		return ds.tx.Exec(query, args...)
+	} else {
+		return ds.db.Exec(query, args...)
+	}
+}
+
+func (ds *Datastore) WithTx(ctx context.Context, f func(tx datastore.Datastore) error) error {
+	var tx *sqlx.Tx
+	var err error
+	var owner bool
+	if ds.tx != nil {
+		tx = ds.tx
+	} else {
+		owner = true
+		tx, err = ds.db.BeginTxx(ctx, &sql.TxOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "unable to begin tx")
+		}
+	}
+	dsx := &Datastore{
+		tx:      tx,
+		dialect: ds.dialect,
+	}
+	if err := f(dsx); err != nil {
+		if owner {
+			if err := tx.Rollback(); err != nil {
+				log.Error().
+					Err(err).
+					Msgf("error rolling back tx")
+			}
+		}
+		return err
+	}
+	if owner {
+		if err := tx.Commit(); err != nil {
+			return errors.Wrapf(err, "error committing transaction")
+		}
+	}
+	return nil
+}
+
+func (ds *Datastore) HealthCheck(ctx context.Context) error {
+	if _, err := ds.db.ExecContext(ctx, "select 1"); err != nil {
+		return errors.Wrapf(err, "error connecting to the database")
+	}
+	return nil
+}
+
+func (ds *Datastore) Close() error {
+	return ds.db.Close()
+}
+
+func parseQuery(query string) (string, []string) {
+	terms := []string{}
+	tags := []string{}
+	parts := strings.Fields(query)
+	for _, part := range parts {
+		if strings.HasPrefix(part, "tag:") {
+			tags = append(tags, strings.TrimPrefix(part, "tag:"))
+		} else if strings.HasPrefix(part, "tags:") {
+			tags = append(tags, strings.Split(strings.TrimPrefix(part, "tags:"), ",")...)
+		} else {
+			terms = append(terms, part)
+		}
+	}
+	return strings.Join(terms, " "), tags
+}
+
+// marshalWorkspace serializes the workspace of a job,
+// which is stored as NULL when the job has none.
+func marshalWorkspace(w *tork.JobWorkspace) (*string, error) {
+	if w == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(w)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize job.workspace")
+	}
+	s := string(b)
+	return &s, nil
+}
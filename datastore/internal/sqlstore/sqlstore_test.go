@@ -0,0 +1,241 @@
+package sqlstore_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore/internal/sqlstore"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/datastore/sqlite"
+	schema "github.com/runabol/tork/db/sqlite"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// backends creates a datastore on each of the supported databases.
+var backends = map[string]func(t *testing.T, opts ...sqlstore.Option) (*sqlstore.Datastore, error){
+	"postgres": func(t *testing.T, opts ...sqlstore.Option) (*sqlstore.Datastore, error) {
+		dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
+		ds, err := postgres.NewPostgresDataStore(dsn, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return ds.Datastore, nil
+	},
+	"sqlite": func(t *testing.T, opts ...sqlstore.Option) (*sqlstore.Datastore, error) {
+		opts = append([]sqlstore.Option{sqlstore.WithDisableCleanup(true)}, opts...)
+		ds, err := sqlite.NewSQLiteDatastore(fmt.Sprintf("%s/tork.db", t.TempDir()), opts...)
+		if err != nil {
+			return nil, err
+		}
+		t.Cleanup(func() {
+			assert.NoError(t, ds.Close())
+		})
+		return ds.Datastore, ds.ExecScript(schema.SCHEMA)
+	},
+}
+
+func TestCreateAndExpungeTaskLogs(t *testing.T) {
+	for name, newDS := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ds, err := newDS(t)
+			assert.NoError(t, err)
+			now := time.Now().UTC()
+			j1 := tork.Job{
+				ID: uuid.NewUUID(),
+			}
+			err = ds.CreateJob(ctx, &j1)
+			assert.NoError(t, err)
+			t1 := tork.Task{
+				ID:        uuid.NewUUID(),
+				CreatedAt: &now,
+				JobID:     j1.ID,
+			}
+			err = ds.CreateTask(ctx, &t1)
+			assert.NoError(t, err)
+
+			for i := 1; i <= 100; i++ {
+				err := ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+					Number:   i,
+					TaskID:   t1.ID,
+					Contents: fmt.Sprintf("line %d", i),
+				})
+				assert.NoError(t, err)
+			}
+
+			n, err := ds.ExpungeExpiredTaskLogPart()
+			assert.NoError(t, err)
+			assert.Equal(t, 0, n)
+
+			logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 100, logs.TotalItems)
+
+			retentionPeriod := time.Microsecond
+			ds.SetLogsRetentionDuration(retentionPeriod)
+
+			n, err = ds.ExpungeExpiredTaskLogPart()
+			assert.NoError(t, err)
+			assert.GreaterOrEqual(t, n, 100)
+
+			logs, err = ds.GetTaskLogParts(ctx, t1.ID, "", 1, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, logs.TotalItems)
+		})
+	}
+}
+
+func Test_cleanup(t *testing.T) {
+	for name, newDS := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ds, err := newDS(t, sqlstore.WithDisableCleanup(true))
+			assert.NoError(t, err)
+			now := time.Now().UTC()
+			j1 := tork.Job{
+				ID: uuid.NewUUID(),
+			}
+			err = ds.CreateJob(ctx, &j1)
+			assert.NoError(t, err)
+
+			j2 := tork.Job{
+				ID: uuid.NewUUID(),
+			}
+			err = ds.CreateJob(ctx, &j2)
+			assert.NoError(t, err)
+
+			past := time.Now().UTC().Add(-time.Minute)
+			err = ds.UpdateJob(ctx, j2.ID, func(u *tork.Job) error {
+				u.DeleteAt = &past
+				return nil
+			})
+			assert.NoError(t, err)
+
+			j3 := tork.Job{
+				ID: uuid.NewUUID(),
+			}
+			err = ds.CreateJob(ctx, &j3)
+			assert.NoError(t, err)
+
+			t1 := tork.Task{
+				ID:        uuid.NewUUID(),
+				CreatedAt: &now,
+				JobID:     j1.ID,
+			}
+			err = ds.CreateTask(ctx, &t1)
+			assert.NoError(t, err)
+
+			for i := 1; i <= 100; i++ {
+				err := ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+					Number:   i,
+					TaskID:   t1.ID,
+					Contents: fmt.Sprintf("line %d", i),
+				})
+				assert.NoError(t, err)
+			}
+
+			err = ds.Cleanup()
+			assert.NoError(t, err)
+			assert.Equal(t, time.Minute, ds.CleanupInterval())
+
+			logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 100, logs.TotalItems)
+
+			retentionPeriod := time.Microsecond
+			ds.SetLogsRetentionDuration(retentionPeriod)
+
+			err = ds.Cleanup()
+			assert.NoError(t, err)
+			assert.Equal(t, time.Minute, ds.CleanupInterval())
+
+			logs, err = ds.GetTaskLogParts(ctx, t1.ID, "", 1, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, logs.TotalItems)
+
+			_, err = ds.GetJobByID(ctx, j2.ID)
+			assert.Error(t, err)
+
+			_, err = ds.GetJobByID(ctx, j3.ID)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestExpungeExpiredJobs(t *testing.T) {
+	for name, newDS := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ds, err := newDS(t, sqlstore.WithJobsRetentionDuration(time.Hour*24*30))
+			assert.NoError(t, err)
+
+			now := time.Now().UTC()
+
+			// Create jobs with different states and delete_at times
+			jobs := []*tork.Job{
+				{
+					ID:        uuid.NewUUID(),
+					State:     tork.JobStateCompleted,
+					CreatedAt: now.Add(-time.Hour * 24 * 31), // older than default retention
+				},
+				{
+					ID:        uuid.NewUUID(),
+					State:     tork.JobStateFailed,
+					CreatedAt: now.Add(-time.Hour * 24 * 31), // older than default retention
+				},
+				{
+					ID:        uuid.NewUUID(),
+					State:     tork.JobStateCancelled,
+					CreatedAt: now.Add(-time.Hour * 24 * 31), // older than default retention
+				},
+				{
+					ID:        uuid.NewUUID(),
+					State:     tork.JobStateRunning,
+					CreatedAt: now.Add(-time.Hour * 24 * 31), // should not be deleted
+				},
+				{
+					ID:        uuid.NewUUID(),
+					State:     tork.JobStatePending,
+					CreatedAt: now.Add(-time.Hour * 24 * 31), // should not be deleted
+				},
+				{
+					ID:        uuid.NewUUID(),
+					State:     tork.JobStateCompleted,
+					CreatedAt: now,
+					DeleteAt:  &now, // should be deleted
+				},
+			}
+
+			for _, job := range jobs {
+				err = ds.CreateJob(ctx, job)
+				assert.NoError(t, err)
+				if job.DeleteAt != nil {
+					err = ds.UpdateJob(ctx, job.ID, func(u *tork.Job) error {
+						u.DeleteAt = job.DeleteAt
+						return nil
+					})
+					assert.NoError(t, err)
+				}
+			}
+
+			// Expunge expired jobs
+			n, err := ds.ExpungeExpiredJobs()
+			assert.NoError(t, err)
+			assert.Equal(t, 4, n) // 3 jobs older than retention + 1 job with delete_at
+
+			// Verify remaining jobs
+			for _, job := range jobs {
+				_, err := ds.GetJobByID(ctx, job.ID)
+				if job.State == tork.JobStateRunning || job.State == tork.JobStatePending {
+					assert.NoError(t, err)
+				} else if job.DeleteAt == nil || job.DeleteAt.Before(now) {
+					assert.Error(t, err)
+				}
+			}
+		})
+	}
+}
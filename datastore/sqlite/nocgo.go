@@ -0,0 +1,7 @@
+//go:build !cgo
+
+package sqlite
+
+// the sqlite driver is a cgo binding, so a binary built with
+// CGO_ENABLED=0 has no working sqlite datastore.
+const cgoEnabled = false
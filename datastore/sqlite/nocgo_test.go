@@ -0,0 +1,15 @@
+//go:build !cgo
+
+package sqlite
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteDatastoreNoCgo(t *testing.T) {
+	_, err := NewSQLiteDatastore(fmt.Sprintf("%s/tork.db", t.TempDir()))
+	assert.ErrorIs(t, err, ErrCgoDisabled)
+}
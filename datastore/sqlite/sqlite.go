@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"github.com/runabol/tork/datastore/internal/sqlstore"
+	schema "github.com/runabol/tork/db/sqlite"
+)
+
+const (
+	driverName = "sqlite3_tork"
+	// WAL lets readers proceed alongside the single writer, and immediate
+	// transactions acquire the write lock up front so that concurrent
+	// writers queue on the busy timeout instead of failing to upgrade.
+	dsnFormat = "file:%s?_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate&_loc=UTC&_foreign_keys=on"
+)
+
+// ErrCgoDisabled is returned when the binary was built without cgo,
+// which the sqlite driver requires.
+var ErrCgoDisabled = errors.New("the sqlite datastore requires a binary built with CGO_ENABLED=1")
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("tork_match", match, true)
+		},
+	})
+	sqlx.BindDriver(driverName, sqlx.QUESTION)
+}
+
+// match is registered as the tork_match SQL function and stands in
+// for Postgres' full-text search: every term in q must appear as a
+// word in at least one of the given fields.
+func match(q string, fields ...string) bool {
+	words := make(map[string]bool)
+	for _, f := range fields {
+		for _, w := range tokenize(f) {
+			words[w] = true
+		}
+	}
+	for _, t := range tokenize(q) {
+		if !words[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+type SQLiteDatastore struct {
+	*sqlstore.Datastore
+}
+
+type Option = sqlstore.Option
+
+var (
+	DefaultLogsRetentionDuration = sqlstore.DefaultLogsRetentionDuration
+	DefaultJobsRetentionDuration = sqlstore.DefaultJobsRetentionDuration
+	WithLogsRetentionDuration    = sqlstore.WithLogsRetentionDuration
+	WithJobsRetentionDuration    = sqlstore.WithJobsRetentionDuration
+	WithDisableCleanup           = sqlstore.WithDisableCleanup
+)
+
+func NewTestDatastore() (*SQLiteDatastore, error) {
+	f, err := os.CreateTemp("", "tork-*.db")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating temp db file")
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Wrapf(err, "error closing temp db file")
+	}
+	ds, err := NewSQLiteDatastore(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.ExecScript(schema.SCHEMA); err != nil {
+		return nil, errors.Wrapf(err, "error initializing schema")
+	}
+	return ds, nil
+}
+
+func NewSQLiteDatastore(path string, opts ...Option) (*SQLiteDatastore, error) {
+	if !cgoEnabled {
+		return nil, ErrCgoDisabled
+	}
+	db, err := sqlx.Connect(driverName, fmt.Sprintf(dsnFormat, path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open sqlite database %s", path)
+	}
+	ds, err := sqlstore.New(db, dialect{}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteDatastore{Datastore: ds}, nil
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// dialect stores string slices as JSON arrays, which are
+// queried with json_each, and searches with tork_match.
+type dialect struct{}
+
+func (dialect) Rebind(query string) string {
+	return placeholder.ReplaceAllString(query, "?$1")
+}
+
+func (dialect) Array(v []string) any {
+	if v == nil {
+		return "[]"
+	}
+	// a string slice always marshals
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// ForUpdate returns no clause since immediate transactions
+// already hold the database's write lock.
+func (dialect) ForUpdate() string {
+	return ""
+}
+
+func (dialect) In(col, param string) string {
+	return fmt.Sprintf("%s IN (select value from json_each(%s))", col, param)
+}
+
+func (dialect) Overlaps(col, param string) string {
+	return fmt.Sprintf("(json_array_length(%[2]s) = 0 OR exists (select 1 from json_each(%[1]s) t where t.value in (select value from json_each(%[2]s))))", col, param)
+}
+
+func (dialect) Match(param string, cols ...string) string {
+	return fmt.Sprintf("tork_match(%s, %s)", param, strings.Join(cols, ", "))
+}
@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/internal/datastoretest"
+	schema "github.com/runabol/tork/db/sqlite"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteDatastore(t *testing.T) {
+	if !cgoEnabled {
+		t.Skip("sqlite requires cgo")
+	}
+	datastoretest.Run(t, func(t *testing.T) datastore.Datastore {
+		ds, err := newTestDatastore(t)
+		assert.NoError(t, err)
+		return ds
+	})
+}
+
+func newTestDatastore(t *testing.T, opts ...Option) (*SQLiteDatastore, error) {
+	opts = append([]Option{WithDisableCleanup(true)}, opts...)
+	ds, err := NewSQLiteDatastore(fmt.Sprintf("%s/tork.db", t.TempDir()), opts...)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		assert.NoError(t, ds.Close())
+	})
+	return ds, ds.ExecScript(schema.SCHEMA)
+}
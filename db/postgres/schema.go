@@ -5,6 +5,7 @@ CREATE TABLE nodes (
     id                 varchar(32)  not null primary key,
     name               varchar(64)  not null,
     queue              varchar(64)  not null,
+    queues             text[]       not null default '{}',
     started_at         timestamp    not null,
     last_heartbeat_at  timestamp    not null,
     cpu_percent        float        not null,
@@ -63,7 +64,13 @@ CREATE TABLE scheduled_jobs (
   secrets        jsonb,
   created_at     timestamp   not null,
   created_by     varchar(32) not null references users(id),
-  state          varchar(10) not null
+  state          varchar(10) not null,
+  timezone       varchar(64) not null default '',
+  overlap        varchar(16) not null default '',
+  catch_up       jsonb,
+  last_fired_at  timestamp,
+  trigger_       jsonb,
+  input_schema   jsonb
 );
 
 CREATE TABLE scheduled_jobs_perms (
@@ -73,6 +80,36 @@ CREATE TABLE scheduled_jobs_perms (
     role_id          varchar(32)          references roles(id)
 );
 
+CREATE TABLE scheduled_job_fires (
+    id               varchar(32) not null primary key,
+    scheduled_job_id varchar(32) not null references scheduled_jobs(id),
+    created_at       timestamp   not null
+);
+
+CREATE TABLE triggers (
+    id          varchar(32) not null primary key,
+    name        varchar(64) not null unique,
+    description text        not null,
+    secret      text        not null,
+    inputs      jsonb       not null,
+    job_        jsonb       not null,
+    created_at  timestamp   not null,
+    created_by  varchar(32) not null references users(id)
+);
+
+CREATE TABLE templates (
+    id          varchar(32) not null primary key,
+    name        varchar(64) not null,
+    version     int         not null,
+    description text        not null,
+    parameters  jsonb       not null,
+    job_        jsonb       not null,
+    created_at  timestamp   not null,
+    created_by  varchar(32) not null references users(id)
+);
+
+CREATE UNIQUE INDEX idx_templates_name_version ON templates (name,version);
+
 CREATE TABLE jobs (
     id               varchar(32) not null primary key,
     name             varchar(256),
@@ -99,12 +136,18 @@ CREATE TABLE jobs (
     auto_delete      jsonb,
     secrets          jsonb,
     progress         numeric(5,2) default 0,
-    scheduled_job_id varchar(32) references scheduled_jobs(id)
+    scheduled_job_id varchar(32) references scheduled_jobs(id),
+    timeout          varchar(16),
+    deadline         timestamp,
+    timeout_at       timestamp,
+    workspace        jsonb,
+    trace_parent     varchar(55)
 );
 
 CREATE INDEX idx_jobs_state ON jobs (state);
 CREATE INDEX idx_jobs_delete_at ON jobs (delete_at);
 CREATE INDEX idx_jobs_created_at ON jobs (created_at);
+CREATE INDEX idx_jobs_state_and_timeout_at ON jobs (state,timeout_at);
 
 ALTER TABLE jobs ADD COLUMN ts tsvector NOT NULL
     GENERATED ALWAYS AS (
@@ -151,11 +194,13 @@ CREATE TABLE tasks (
     post_tasks    jsonb,
     sidecars      jsonb,
     mounts        jsonb,
+    artifacts     jsonb,
     node_id       varchar(32),
     retry         jsonb,
     limits        jsonb,
     timeout       varchar(8),
     result        text,
+    outputs       jsonb,
     var           varchar(64),
     parallel      jsonb,
     parent_id     varchar(32),
@@ -168,12 +213,22 @@ CREATE TABLE tasks (
     tags          text[],
     priority      int,
     workdir       varchar(256),
-    progress      numeric(5,2) default 0
+    progress      numeric(5,2) default 0,
+    retry_at      timestamp,
+    exit_code     int,
+    usage_wall_seconds double precision,
+    usage_cpu_seconds  double precision,
+    usage_memory_peak  bigint,
+    usage_disk_read    bigint,
+    usage_disk_write   bigint,
+    usage_network_rx   bigint,
+    usage_network_tx   bigint
 );
 
 CREATE INDEX idx_tasks_state ON tasks (state);
 CREATE INDEX idx_tasks_job_id ON tasks (job_id);
 CREATE INDEX idx_tasks_parent_and_state ON tasks (parent_id,state);
+CREATE INDEX idx_tasks_state_and_retry_at ON tasks (state,retry_at);
 
 CREATE TABLE tasks_log_parts (
     id         varchar(32) not null primary key,
@@ -0,0 +1,230 @@
+package sqlite
+
+const SCHEMA = `
+CREATE TABLE IF NOT EXISTS nodes (
+    id                 text      not null primary key,
+    name               text      not null,
+    queue              text      not null,
+    queues             text      not null default '[]',
+    started_at         timestamp not null,
+    last_heartbeat_at  timestamp not null,
+    cpu_percent        real      not null,
+    status             text      not null,
+    hostname           text      not null,
+    port               integer   not null,
+    task_count         integer   not null,
+    version_           text      not null
+);
+
+CREATE INDEX IF NOT EXISTS idx_nodes_heartbeat ON nodes (last_heartbeat_at);
+
+CREATE TABLE IF NOT EXISTS users (
+    id          text      not null primary key,
+    name        text      not null,
+    username_   text      not null unique,
+    password_   text      not null,
+    created_at  timestamp not null,
+    is_disabled boolean   not null default false
+);
+
+INSERT OR IGNORE INTO users (id,name,username_,password_,created_at,is_disabled) VALUES (lower(hex(randomblob(16))),'Guest','guest','',strftime('%Y-%m-%d %H:%M:%f+00:00','now'),true);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id          text      not null primary key,
+    name        text      not null,
+    slug        text      not null unique,
+    created_at  timestamp not null
+);
+
+INSERT OR IGNORE INTO roles (id,name,slug,created_at) VALUES (lower(hex(randomblob(16))),'Public','public',strftime('%Y-%m-%d %H:%M:%f+00:00','now'));
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    id         text      not null primary key,
+    user_id    text      not null references users(id),
+    role_id    text      not null references roles(id),
+    created_at timestamp not null
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_roles_uniq ON users_roles (user_id,role_id);
+
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+    id             text      not null primary key,
+    name           text      not null,
+    description    text      not null,
+    tags           text      not null default '[]',
+    cron_expr      text      not null,
+    inputs         text      not null,
+    output_        text      not null,
+    tasks          text      not null,
+    defaults       text,
+    webhooks       text,
+    auto_delete    text,
+    secrets        text,
+    created_at     timestamp not null,
+    created_by     text      not null references users(id),
+    state          text      not null check (length(state) <= 10),
+    timezone       text      not null default '',
+    overlap        text      not null default '',
+    catch_up       text,
+    last_fired_at  timestamp,
+    trigger_       text,
+    input_schema   text
+);
+
+CREATE TABLE IF NOT EXISTS scheduled_jobs_perms (
+    id               text not null primary key,
+    scheduled_job_id text not null references scheduled_jobs(id),
+    user_id          text          references users(id),
+    role_id          text          references roles(id)
+);
+
+CREATE TABLE IF NOT EXISTS scheduled_job_fires (
+    id               text      not null primary key,
+    scheduled_job_id text      not null references scheduled_jobs(id),
+    created_at       timestamp not null
+);
+
+CREATE TABLE IF NOT EXISTS triggers (
+    id          text      not null primary key,
+    name        text      not null unique,
+    description text      not null,
+    secret      text      not null,
+    inputs      text      not null,
+    job_        text      not null,
+    created_at  timestamp not null,
+    created_by  text      not null references users(id)
+);
+
+CREATE TABLE IF NOT EXISTS templates (
+    id          text      not null primary key,
+    name        text      not null,
+    version     integer   not null,
+    description text      not null,
+    parameters  text      not null,
+    job_        text      not null,
+    created_at  timestamp not null,
+    created_by  text      not null references users(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_templates_name_version ON templates (name,version);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id               text      not null primary key,
+    name             text,
+    tags             text      not null default '[]',
+    state            text      not null check (length(state) <= 10),
+    created_at       timestamp not null,
+    created_by       text      not null references users(id),
+    started_at       timestamp,
+    completed_at     timestamp,
+    delete_at        timestamp,
+    failed_at        timestamp,
+    tasks            text      not null,
+    position         integer   not null,
+    inputs           text      not null,
+    context          text      not null,
+    description      text,
+    parent_id        text,
+    task_count       integer   not null,
+    output_          text,
+    result           text,
+    error_           text,
+    defaults         text,
+    webhooks         text,
+    auto_delete      text,
+    secrets          text,
+    progress         real      default 0,
+    scheduled_job_id text      references scheduled_jobs(id),
+    timeout          text,
+    deadline         timestamp,
+    timeout_at       timestamp,
+    workspace        text,
+    trace_parent     text
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs (state);
+CREATE INDEX IF NOT EXISTS idx_jobs_delete_at ON jobs (delete_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs (created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_state_and_timeout_at ON jobs (state,timeout_at);
+
+CREATE TABLE IF NOT EXISTS jobs_perms (
+    id      text not null primary key,
+    job_id  text not null references jobs(id),
+    user_id text          references users(id),
+    role_id text          references roles(id)
+);
+
+CREATE INDEX IF NOT EXISTS jobs_perms_job_id_idx ON jobs_perms (job_id);
+CREATE INDEX IF NOT EXISTS jobs_perms_user_role_idx ON jobs_perms (user_id,role_id);
+
+CREATE TABLE IF NOT EXISTS tasks (
+    id            text      not null primary key,
+    job_id        text      not null references jobs(id),
+    position      integer   not null,
+    name          text,
+    state         text      not null check (length(state) <= 10),
+    created_at    timestamp not null,
+    scheduled_at  timestamp,
+    started_at    timestamp,
+    completed_at  timestamp,
+    failed_at     timestamp,
+    cmd           text,
+    entrypoint    text,
+    run_script    text,
+    image         text,
+    registry      text,
+    env           text,
+    files_        text,
+    queue         text,
+    error_        text,
+    pre_tasks     text,
+    post_tasks    text,
+    sidecars      text,
+    mounts        text,
+    artifacts     text,
+    node_id       text,
+    retry         text,
+    limits        text,
+    timeout       text,
+    result        text,
+    outputs       text,
+    var           text,
+    parallel      text,
+    parent_id     text,
+    each_         text,
+    description   text,
+    subjob        text,
+    networks      text,
+    gpus          text,
+    if_           text,
+    tags          text,
+    priority      integer,
+    workdir       text,
+    progress      real      default 0,
+    retry_at      timestamp,
+    exit_code     integer,
+    usage_wall_seconds real,
+    usage_cpu_seconds  real,
+    usage_memory_peak  integer,
+    usage_disk_read    integer,
+    usage_disk_write   integer,
+    usage_network_rx   integer,
+    usage_network_tx   integer
+);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_state ON tasks (state);
+CREATE INDEX IF NOT EXISTS idx_tasks_job_id ON tasks (job_id);
+CREATE INDEX IF NOT EXISTS idx_tasks_parent_and_state ON tasks (parent_id,state);
+CREATE INDEX IF NOT EXISTS idx_tasks_state_and_retry_at ON tasks (state,retry_at);
+
+CREATE TABLE IF NOT EXISTS tasks_log_parts (
+    id         text      not null primary key,
+    number_    integer   not null,
+    task_id    text      not null references tasks(id),
+    created_at timestamp not null,
+    contents   text      not null
+);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_log_parts_task_id ON tasks_log_parts (task_id);
+CREATE INDEX IF NOT EXISTS idx_tasks_log_parts_created_at ON tasks_log_parts (created_at);
+`
@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"github.com/pkg/errors"
+	"github.com/runabol/tork/artifact"
+	"github.com/runabol/tork/conf"
+)
+
+func (e *Engine) initArtifactStore() error {
+	if e.artifacts != nil {
+		return nil
+	}
+	stype := conf.String("artifacts.store.type")
+	if stype == "" {
+		return nil
+	}
+	store, err := e.createArtifactStore(stype)
+	if err != nil {
+		return err
+	}
+	e.artifacts = store
+	return nil
+}
+
+func (e *Engine) createArtifactStore(stype string) (artifact.Store, error) {
+	switch stype {
+	case artifact.STORE_LOCAL:
+		return artifact.NewLocalStore(conf.StringDefault("artifacts.local.dir", "/var/lib/tork/artifacts"))
+	case artifact.STORE_S3:
+		return artifact.NewS3Store(artifact.S3Config{
+			Endpoint:  conf.String("artifacts.s3.endpoint"),
+			Region:    conf.String("artifacts.s3.region"),
+			Bucket:    conf.String("artifacts.s3.bucket"),
+			AccessKey: conf.String("artifacts.s3.accesskey"),
+			SecretKey: conf.String("artifacts.s3.secretkey"),
+			Prefix:    conf.String("artifacts.s3.prefix"),
+			PathStyle: conf.Bool("artifacts.s3.pathstyle"),
+		})
+	default:
+		return nil, errors.Errorf("unknown artifact store type: %s", stype)
+	}
+}
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/runabol/tork/artifact"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_createArtifactStore(t *testing.T) {
+	eng := New(Config{Mode: ModeStandalone})
+
+	_, err := eng.createArtifactStore(artifact.STORE_S3)
+	assert.Error(t, err) // bucket is required
+
+	_, err = eng.createArtifactStore("unknown")
+	assert.ErrorContains(t, err, "unknown artifact store type")
+}
+
+func Test_registerArtifactStore(t *testing.T) {
+	eng := New(Config{Mode: ModeStandalone})
+	store, err := artifact.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	eng.RegisterArtifactStore(store)
+	assert.NoError(t, eng.initArtifactStore())
+	assert.Equal(t, store, eng.artifacts)
+	assert.Panics(t, func() {
+		eng.RegisterArtifactStore(store)
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"github.com/pkg/errors"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/broker/nats"
 	"github.com/runabol/tork/conf"
+	"github.com/runabol/tork/internal/metrics"
 )
 
 type brokerProxy struct {
@@ -17,7 +19,7 @@ func (b *brokerProxy) PublishTask(ctx context.Context, qname string, t *tork.Tas
 	if err := b.checkInit(); err != nil {
 		return err
 	}
-	return b.broker.PublishTask(ctx, qname, t)
+	return b.publishErr("task", b.broker.PublishTask(ctx, qname, t))
 }
 
 func (b *brokerProxy) SubscribeForTasks(qname string, handler func(t *tork.Task) error) error {
@@ -31,7 +33,7 @@ func (b *brokerProxy) PublishTaskProgress(ctx context.Context, t *tork.Task) err
 	if err := b.checkInit(); err != nil {
 		return err
 	}
-	return b.broker.PublishTaskProgress(ctx, t)
+	return b.publishErr("task_progress", b.broker.PublishTaskProgress(ctx, t))
 }
 
 func (b *brokerProxy) SubscribeForTaskProgress(handler func(t *tork.Task) error) error {
@@ -45,7 +47,7 @@ func (b *brokerProxy) PublishHeartbeat(ctx context.Context, n *tork.Node) error
 	if err := b.checkInit(); err != nil {
 		return err
 	}
-	return b.broker.PublishHeartbeat(ctx, n)
+	return b.publishErr("heartbeat", b.broker.PublishHeartbeat(ctx, n))
 }
 
 func (b *brokerProxy) SubscribeForHeartbeats(handler func(n *tork.Node) error) error {
@@ -59,7 +61,7 @@ func (b *brokerProxy) PublishJob(ctx context.Context, j *tork.Job) error {
 	if err := b.checkInit(); err != nil {
 		return err
 	}
-	return b.broker.PublishJob(ctx, j)
+	return b.publishErr("job", b.broker.PublishJob(ctx, j))
 }
 
 func (b *brokerProxy) SubscribeForJobs(handler func(j *tork.Job) error) error {
@@ -73,7 +75,7 @@ func (b *brokerProxy) PublishEvent(ctx context.Context, topic string, event inte
 	if err := b.checkInit(); err != nil {
 		return err
 	}
-	return b.broker.PublishEvent(ctx, topic, event)
+	return b.publishErr("event", b.broker.PublishEvent(ctx, topic, event))
 }
 
 func (b *brokerProxy) SubscribeForEvents(ctx context.Context, pattern string, handler func(event interface{})) error {
@@ -87,7 +89,7 @@ func (b *brokerProxy) PublishTaskLogPart(ctx context.Context, p *tork.TaskLogPar
 	if err := b.checkInit(); err != nil {
 		return err
 	}
-	return b.broker.PublishTaskLogPart(ctx, p)
+	return b.publishErr("task_log_part", b.broker.PublishTaskLogPart(ctx, p))
 }
 
 func (b *brokerProxy) SubscribeForTaskLogPart(handler func(p *tork.TaskLogPart)) error {
@@ -118,6 +120,15 @@ func (b *brokerProxy) Shutdown(ctx context.Context) error {
 	return b.broker.Shutdown(ctx)
 }
 
+// publishErr counts the messages which
+// failed to be published to the broker.
+func (b *brokerProxy) publishErr(kind string, err error) error {
+	if err != nil {
+		metrics.BrokerPublishErrorsTotal.Inc(kind)
+	}
+	return err
+}
+
 func (b *brokerProxy) checkInit() error {
 	if b.broker == nil {
 		return errors.New("Broker not initialized. You must call engine.Start() first")
@@ -155,6 +166,26 @@ func (e *Engine) createBroker(btype string) (broker.Broker, error) {
 			return nil, errors.Wrapf(err, "unable to connect to RabbitMQ")
 		}
 		return rb, nil
+	case "postgres":
+		pb, err := broker.NewPostgresBroker(
+			conf.StringDefault("broker.postgres.dsn", "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"),
+			broker.WithPostgresConsumerTimeout(conf.DurationDefault("broker.postgres.consumer.timeout", broker.POSTGRES_DEFAULT_CONSUMER_TIMEOUT)),
+			broker.WithPostgresPollInterval(conf.DurationDefault("broker.postgres.poll.interval", broker.POSTGRES_DEFAULT_POLL_INTERVAL)),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to connect to Postgres")
+		}
+		return pb, nil
+	case "nats":
+		nb, err := nats.NewNATSBroker(
+			conf.StringDefault("broker.nats.url", "nats://localhost:4222"),
+			nats.WithConsumerTimeout(conf.DurationDefault("broker.nats.consumer.timeout", nats.DefaultConsumerTimeout)),
+			nats.WithHeartbeatTTL(conf.DurationDefault("broker.nats.heartbeat.ttl", nats.DefaultHeartbeatTTL)),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to connect to NATS")
+		}
+		return nb, nil
 	default:
 		return nil, errors.Errorf("invalid broker type: %s", btype)
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/subtle"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
@@ -15,6 +16,7 @@ import (
 	"github.com/runabol/tork/conf"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/coordinator"
+	"github.com/runabol/tork/internal/coordinator/api"
 	"github.com/runabol/tork/internal/hash"
 	"github.com/runabol/tork/internal/redact"
 	"github.com/runabol/tork/internal/uuid"
@@ -28,12 +30,13 @@ func (e *Engine) initCoordinator() error {
 	queues := conf.IntMap("coordinator.queues")
 
 	cfg := coordinator.Config{
-		Name:      conf.StringDefault("coordinator.name", "Coordinator"),
-		Broker:    e.brokerRef,
-		DataStore: e.datastoreRef,
-		Locker:    e.locker,
-		Queues:    queues,
-		Address:   conf.String("coordinator.address"),
+		Name:          conf.StringDefault("coordinator.name", "Coordinator"),
+		Broker:        e.brokerRef,
+		DataStore:     e.datastoreRef,
+		Locker:        e.locker,
+		ArtifactStore: e.artifacts,
+		Queues:        queues,
+		Address:       conf.String("coordinator.address"),
 		Middleware: coordinator.Middleware{
 			Web:  e.cfg.Middleware.Web,
 			Task: e.cfg.Middleware.Task,
@@ -41,8 +44,9 @@ func (e *Engine) initCoordinator() error {
 			Node: e.cfg.Middleware.Node,
 			Echo: echoMiddleware(e.datastoreRef),
 		},
-		Endpoints: e.cfg.Endpoints,
-		Enabled:   conf.BoolMap("coordinator.api.endpoints"),
+		Endpoints:     e.cfg.Endpoints,
+		Enabled:       conf.BoolMap("coordinator.api.endpoints"),
+		HookBodyLimit: int64(conf.IntDefault("coordinator.api.hooks.bodylimit", api.DefaultHookBodyLimit)),
 	}
 
 	// redact
@@ -93,7 +97,7 @@ func echoMiddleware(ds datastore.Datastore) []echo.MiddlewareFunc {
 	keyAuthEnabled := conf.Bool("middleware.web.keyauth.enabled")
 	if keyAuthEnabled {
 		key := conf.StringDefault("middleware.web.keyauth.key", "")
-		mw = append(mw, keyAuth(key))
+		mw = append(mw, keyAuth(ds, key))
 	}
 
 	// rate limit
@@ -120,28 +124,32 @@ func rateLimit(rps int) echo.MiddlewareFunc {
 }
 
 func basicAuth(ds datastore.Datastore) echo.MiddlewareFunc {
-	return middleware.BasicAuth(func(user, pass string, ctx echo.Context) (bool, error) {
-		u, err := ds.GetUser(ctx.Request().Context(), user)
-		if err != nil {
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper: signedHook(ds),
+		Validator: func(user, pass string, ctx echo.Context) (bool, error) {
+			u, err := ds.GetUser(ctx.Request().Context(), user)
+			if err != nil {
+				return false, nil
+			}
+			if subtle.ConstantTimeCompare([]byte(user), []byte(u.Username)) == 1 &&
+				hash.CheckPasswordHash(pass, u.PasswordHash) {
+				ctx.SetRequest(ctx.Request().WithContext(context.WithValue(ctx.Request().Context(), tork.USERNAME, user)))
+				return true, nil
+			}
 			return false, nil
-		}
-		if subtle.ConstantTimeCompare([]byte(user), []byte(u.Username)) == 1 &&
-			hash.CheckPasswordHash(pass, u.PasswordHash) {
-			ctx.SetRequest(ctx.Request().WithContext(context.WithValue(ctx.Request().Context(), tork.USERNAME, user)))
-			return true, nil
-		}
-		return false, nil
+		},
 	})
 }
 
-func keyAuth(key string) echo.MiddlewareFunc {
+func keyAuth(ds datastore.Datastore, key string) echo.MiddlewareFunc {
 	if key == "" {
 		key = uuid.NewUUID()
 		log.Debug().Msgf("Key Auth Key: %s", key)
 	}
 	cfg := middleware.DefaultKeyAuthConfig
+	isSignedHook := signedHook(ds)
 	cfg.Skipper = func(c echo.Context) bool {
-		return c.Request().URL.Path == "/health"
+		return c.Request().URL.Path == "/health" || isSignedHook(c)
 	}
 	cfg.Validator = func(ukey string, c echo.Context) (bool, error) {
 		return ukey == key, nil
@@ -149,6 +157,24 @@ func keyAuth(key string) echo.MiddlewareFunc {
 	return middleware.KeyAuthWithConfig(cfg)
 }
 
+// signedHook returns a skipper which matches the requests to the
+// inbound webhook of a trigger which has a secret. These requests
+// are authenticated through their signature instead, since the
+// systems calling webhooks can't usually provide API credentials.
+func signedHook(ds datastore.Datastore) middleware.Skipper {
+	return func(c echo.Context) bool {
+		if c.Request().Method != http.MethodPost {
+			return false
+		}
+		name, ok := strings.CutPrefix(c.Request().URL.Path, "/hooks/")
+		if !ok {
+			return false
+		}
+		t, err := ds.GetTrigger(c.Request().Context(), name)
+		return err == nil && t.Secret != ""
+	}
+}
+
 func logger() echo.MiddlewareFunc {
 	levelStr := conf.StringDefault("middleware.web.logger.level", "DEBUG")
 	level, err := zerolog.ParseLevel(strings.ToLower(levelStr))
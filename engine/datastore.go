@@ -2,12 +2,15 @@ package engine
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/conf"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/inmemory"
 	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/datastore/sqlite"
 )
 
 type datastoreProxy struct {
@@ -49,6 +52,20 @@ func (ds *datastoreProxy) GetNextTask(ctx context.Context, parentTaskID string)
 	return ds.ds.GetNextTask(ctx, parentTaskID)
 }
 
+func (ds *datastoreProxy) GetRetryTasks(ctx context.Context, before time.Time) ([]*tork.Task, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	return ds.ds.GetRetryTasks(ctx, before)
+}
+
+func (ds *datastoreProxy) GetLostTasks(ctx context.Context, heartbeatBefore time.Time) ([]*tork.Task, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	return ds.ds.GetLostTasks(ctx, heartbeatBefore)
+}
+
 func (ds *datastoreProxy) CreateTaskLogPart(ctx context.Context, p *tork.TaskLogPart) error {
 	if err := ds.checkInit(); err != nil {
 		return err
@@ -112,6 +129,13 @@ func (ds *datastoreProxy) GetJobByID(ctx context.Context, id string) (*tork.Job,
 	return ds.ds.GetJobByID(ctx, id)
 }
 
+func (ds *datastoreProxy) GetTimedOutJobs(ctx context.Context, before time.Time) ([]*tork.Job, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	return ds.ds.GetTimedOutJobs(ctx, before)
+}
+
 func (ds *datastoreProxy) GetJobLogParts(ctx context.Context, jobID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
@@ -168,6 +192,83 @@ func (ds *datastoreProxy) DeleteScheduledJob(ctx context.Context, id string) err
 	return ds.ds.DeleteScheduledJob(ctx, id)
 }
 
+func (ds *datastoreProxy) GetActiveScheduledJobInstances(ctx context.Context, scheduledJobID string) ([]*tork.Job, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	return ds.ds.GetActiveScheduledJobInstances(ctx, scheduledJobID)
+}
+
+func (ds *datastoreProxy) CreateScheduledJobFire(ctx context.Context, scheduledJobID, id string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	return ds.ds.CreateScheduledJobFire(ctx, scheduledJobID, id)
+}
+
+func (ds *datastoreProxy) CreateTrigger(ctx context.Context, t *tork.Trigger) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	return ds.ds.CreateTrigger(ctx, t)
+}
+
+func (ds *datastoreProxy) GetTrigger(ctx context.Context, id string) (*tork.Trigger, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	return ds.ds.GetTrigger(ctx, id)
+}
+
+func (ds *datastoreProxy) GetTriggers(ctx context.Context) ([]*tork.Trigger, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	return ds.ds.GetTriggers(ctx)
+}
+
+func (ds *datastoreProxy) UpdateTrigger(ctx context.Context, id string, modify func(u *tork.Trigger) error) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	return ds.ds.UpdateTrigger(ctx, id, modify)
+}
+
+func (ds *datastoreProxy) DeleteTrigger(ctx context.Context, id string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	return ds.ds.DeleteTrigger(ctx, id)
+}
+
+func (ds *datastoreProxy) CreateTemplate(ctx context.Context, t *tork.Template) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	return ds.ds.CreateTemplate(ctx, t)
+}
+
+func (ds *datastoreProxy) GetTemplate(ctx context.Context, name string, version int) (*tork.Template, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	return ds.ds.GetTemplate(ctx, name, version)
+}
+
+func (ds *datastoreProxy) GetTemplates(ctx context.Context) ([]*tork.Template, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	return ds.ds.GetTemplates(ctx)
+}
+
+func (ds *datastoreProxy) DeleteTemplate(ctx context.Context, name string, version int) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	return ds.ds.DeleteTemplate(ctx, name, version)
+}
+
 func (ds *datastoreProxy) CreateUser(ctx context.Context, u *tork.User) error {
 	if err := ds.checkInit(); err != nil {
 		return err
@@ -277,6 +378,16 @@ func (e *Engine) createDatastore(dstype string) (datastore.Datastore, error) {
 			postgres.WithLogsRetentionDuration(conf.DurationDefault("datastore.retention.logs.duration", postgres.DefaultLogsRetentionDuration)),
 			postgres.WithJobsRetentionDuration(conf.DurationDefault("datastore.retention.jobs.duration", postgres.DefaultJobsRetentionDuration)),
 		)
+	case datastore.DATASTORE_INMEMORY:
+		return inmemory.NewInMemoryDatastore(
+			inmemory.WithLogsRetentionDuration(conf.DurationDefault("datastore.retention.logs.duration", inmemory.DefaultLogsRetentionDuration)),
+			inmemory.WithJobsRetentionDuration(conf.DurationDefault("datastore.retention.jobs.duration", inmemory.DefaultJobsRetentionDuration)),
+		), nil
+	case datastore.DATASTORE_SQLITE:
+		return sqlite.NewSQLiteDatastore(conf.StringDefault("datastore.sqlite.path", "tork.db"),
+			sqlite.WithLogsRetentionDuration(conf.DurationDefault("datastore.retention.logs.duration", sqlite.DefaultLogsRetentionDuration)),
+			sqlite.WithJobsRetentionDuration(conf.DurationDefault("datastore.retention.jobs.duration", sqlite.DefaultJobsRetentionDuration)),
+		)
 	default:
 		return nil, errors.Errorf("unknown datastore type: %s", dstype)
 	}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/inmemory"
 	"github.com/runabol/tork/datastore/postgres"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,6 +20,17 @@ func Test_createDatastore(t *testing.T) {
 	assert.NoError(t, dsp.Close())
 }
 
+func Test_createInMemoryDatastore(t *testing.T) {
+	eng := New(Config{Mode: ModeStandalone})
+	assert.Equal(t, StateIdle, eng.state)
+	ds, err := eng.createDatastore(datastore.DATASTORE_INMEMORY)
+	assert.NoError(t, err)
+	assert.IsType(t, &inmemory.InMemoryDatastore{}, ds)
+	dsi, ok := ds.(*inmemory.InMemoryDatastore)
+	assert.True(t, ok)
+	assert.NoError(t, dsi.Close())
+}
+
 func Test_createDatastoreProvider(t *testing.T) {
 	eng := New(Config{Mode: ModeStandalone})
 	assert.Equal(t, StateIdle, eng.state)
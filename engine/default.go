@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/input"
@@ -40,6 +41,10 @@ func RegisterRuntime(rt runtime.Runtime) {
 	defaultEngine.RegisterRuntime(rt)
 }
 
+func RegisterArtifactStore(store artifact.Store) {
+	defaultEngine.RegisterArtifactStore(store)
+}
+
 func RegisterDatastoreProvider(name string, provider datastore.Provider) {
 	defaultEngine.RegisterDatastoreProvider(name, provider)
 }
@@ -52,6 +57,10 @@ func RegisterEndpoint(method, path string, handler web.HandlerFunc) {
 	defaultEngine.RegisterEndpoint(method, path, handler)
 }
 
+func RegisterExprFunction(name string, fn any) {
+	defaultEngine.RegisterExprFunction(name, fn)
+}
+
 func SubmitJob(ctx context.Context, ij *input.Job, listeners ...JobListener) (*tork.Job, error) {
 	return defaultEngine.SubmitJob(ctx, ij, listeners...)
 }
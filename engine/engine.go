@@ -12,10 +12,12 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/input"
 	"github.com/runabol/tork/internal/coordinator"
+	"github.com/runabol/tork/internal/eval"
 	"github.com/runabol/tork/internal/worker"
 	"github.com/runabol/tork/locker"
 	"github.com/runabol/tork/middleware/job"
@@ -50,12 +52,15 @@ type Engine struct {
 	brokerRef    *brokerProxy
 	datastoreRef *datastoreProxy
 	locker       locker.Locker
+	artifacts    artifact.Store
 	mounters     map[string]*runtime.MultiMounter
+	workspaces   *runtime.WorkspaceMounter
 	runtime      runtime.Runtime
 	coordinator  *coordinator.Coordinator
 	worker       *worker.Worker
 	dsProviders  map[string]datastore.Provider
 	mqProviders  map[string]broker.Provider
+	tracing      func(ctx context.Context) error
 }
 
 type Config struct {
@@ -146,6 +151,10 @@ func (e *Engine) SetMode(mode Mode) {
 }
 
 func (e *Engine) runCoordinator() error {
+	if err := e.initTracing(); err != nil {
+		return err
+	}
+
 	if err := e.initBroker(); err != nil {
 		return err
 	}
@@ -158,6 +167,10 @@ func (e *Engine) runCoordinator() error {
 		return err
 	}
 
+	if err := e.initArtifactStore(); err != nil {
+		return err
+	}
+
 	if err := e.initCoordinator(); err != nil {
 		return err
 	}
@@ -171,6 +184,7 @@ func (e *Engine) runCoordinator() error {
 				log.Error().Err(err).Msg("error stopping coordinator")
 			}
 		}
+		e.stopTracing()
 		close(e.terminated)
 	}()
 
@@ -178,10 +192,18 @@ func (e *Engine) runCoordinator() error {
 }
 
 func (e *Engine) runWorker() error {
+	if err := e.initTracing(); err != nil {
+		return err
+	}
+
 	if err := e.initBroker(); err != nil {
 		return err
 	}
 
+	if err := e.initArtifactStore(); err != nil {
+		return err
+	}
+
 	if err := e.initWorker(); err != nil {
 		return err
 	}
@@ -195,6 +217,7 @@ func (e *Engine) runWorker() error {
 				log.Error().Err(err).Msg("error stopping worker")
 			}
 		}
+		e.stopTracing()
 		close(e.terminated)
 	}()
 
@@ -202,6 +225,10 @@ func (e *Engine) runWorker() error {
 }
 
 func (e *Engine) runStandalone() error {
+	if err := e.initTracing(); err != nil {
+		return err
+	}
+
 	if err := e.initBroker(); err != nil {
 		return err
 	}
@@ -214,6 +241,10 @@ func (e *Engine) runStandalone() error {
 		return err
 	}
 
+	if err := e.initArtifactStore(); err != nil {
+		return err
+	}
+
 	if err := e.initWorker(); err != nil {
 		return err
 	}
@@ -236,6 +267,7 @@ func (e *Engine) runStandalone() error {
 				log.Error().Err(err).Msg("error stopping coordinator")
 			}
 		}
+		e.stopTracing()
 		close(e.terminated)
 	}()
 
@@ -305,6 +337,19 @@ func (e *Engine) RegisterRuntime(rt runtime.Runtime) {
 	e.runtime = rt
 }
 
+// RegisterArtifactStore sets the store used to pass artifacts
+// between tasks, instead of the one configured through
+// artifacts.store.type.
+func (e *Engine) RegisterArtifactStore(store artifact.Store) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mustState(StateIdle)
+	if e.artifacts != nil {
+		panic("engine: RegisterArtifactStore called twice")
+	}
+	e.artifacts = store
+}
+
 func (e *Engine) RegisterDatastoreProvider(name string, provider datastore.Provider) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -325,6 +370,18 @@ func (e *Engine) RegisterBrokerProvider(name string, provider broker.Provider) {
 	e.mqProviders[name] = provider
 }
 
+// RegisterExprFunction makes a custom function available to
+// every expression (e.g. {{ myFunc(inputs.x) }}). Functions are
+// registered for the whole process.
+func (e *Engine) RegisterExprFunction(name string, fn any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mustState(StateIdle)
+	if err := eval.RegisterFunction(name, fn); err != nil {
+		panic("engine: RegisterExprFunction: " + err.Error())
+	}
+}
+
 func (e *Engine) SubmitJob(ctx context.Context, ij *input.Job, listeners ...JobListener) (*tork.Job, error) {
 	e.mustState(StateRunning)
 	if e.cfg.Mode != ModeStandalone && e.cfg.Mode != ModeCoordinator {
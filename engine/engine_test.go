@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/runabol/tork"
@@ -12,6 +13,7 @@ import (
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/datastore/postgres"
 	"github.com/runabol/tork/input"
+	"github.com/runabol/tork/internal/eval"
 	"github.com/runabol/tork/internal/hash"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime/docker"
@@ -325,6 +327,25 @@ func TestRegisterRuntime(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func TestRegisterExprFunction(t *testing.T) {
+	eng := New(Config{Mode: ModeStandalone})
+	eng.RegisterExprFunction("engineTestDouble", func(i int) int { return i * 2 })
+
+	v, err := eval.EvaluateExpr("{{ engineTestDouble(21) }}", map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+
+	assert.Panics(t, func() {
+		eng.RegisterExprFunction("engineTestDouble", func(i int) int { return i * 2 })
+	})
+	assert.Panics(t, func() {
+		eng.RegisterExprFunction("upper", func(s string) string { return s })
+	})
+	assert.Panics(t, func() {
+		eng.RegisterExprFunction("notAFunc", "hello")
+	})
+}
+
 func TestOnBrokerInit(t *testing.T) {
 	eng := New(Config{Mode: ModeStandalone})
 	assert.Equal(t, StateIdle, eng.state)
@@ -375,3 +396,39 @@ func TestOnDatastoreInit(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, ds.Close())
 }
+
+func Test_basicAuthSignedHook(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	signed := &tork.Trigger{
+		ID:        uuid.NewUUID(),
+		Name:      "signed-" + uuid.NewShortUUID(),
+		Secret:    "s3cr3t",
+		Job:       []byte(`{}`),
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, ds.CreateTrigger(ctx, signed))
+	unsigned := &tork.Trigger{
+		ID:        uuid.NewUUID(),
+		Name:      "unsigned-" + uuid.NewShortUUID(),
+		Job:       []byte(`{}`),
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, ds.CreateTrigger(ctx, unsigned))
+	mw := basicAuth(ds)
+	h := func(c echo.Context) error {
+		return nil
+	}
+	// hooks with a secret are authenticated by their signature
+	req, err := http.NewRequest("POST", "/hooks/"+signed.Name, nil)
+	assert.NoError(t, err)
+	err = mw(h)(echo.New().NewContext(req, httptest.NewRecorder()))
+	assert.NoError(t, err)
+	// hooks without a secret still require credentials
+	req, err = http.NewRequest("POST", "/hooks/"+unsigned.Name, nil)
+	assert.NoError(t, err)
+	err = mw(h)(echo.New().NewContext(req, httptest.NewRecorder()))
+	assert.Error(t, err)
+	assert.NoError(t, ds.Close())
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork/conf"
+	"github.com/runabol/tork/internal/tracing"
+)
+
+func (e *Engine) initTracing() error {
+	if e.tracing != nil {
+		return nil
+	}
+	ttype := conf.StringDefault("tracing.type", tracing.TRACING_NONE)
+	switch ttype {
+	case tracing.TRACING_NONE:
+		return nil
+	case tracing.TRACING_OTLP:
+		shutdown, err := tracing.InitOTLP(context.Background(), tracing.OTLPConfig{
+			Endpoint:    conf.StringDefault("tracing.otlp.endpoint", "localhost:4318"),
+			Insecure:    conf.Bool("tracing.otlp.insecure"),
+			ServiceName: conf.StringDefault("tracing.service.name", "tork"),
+			SampleRatio: conf.Float64Default("tracing.sample.ratio", 1),
+		})
+		if err != nil {
+			return err
+		}
+		e.tracing = shutdown
+		return nil
+	default:
+		return errors.Errorf("unknown tracing type: %s", ttype)
+	}
+}
+
+// stopTracing flushes the spans which were not exported yet.
+func (e *Engine) stopTracing() {
+	if e.tracing == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.tracing(ctx); err != nil {
+		log.Error().Err(err).Msg("error shutting down tracing")
+	}
+}
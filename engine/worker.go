@@ -2,6 +2,7 @@ package engine
 
 import (
 	"github.com/pkg/errors"
+	"github.com/runabol/tork"
 	"github.com/runabol/tork/conf"
 	"github.com/runabol/tork/internal/worker"
 	"github.com/runabol/tork/middleware/task"
@@ -33,9 +34,11 @@ func (e *Engine) initWorker() error {
 			DefaultCPUsLimit:   conf.String("worker.limits.cpus"),
 			DefaultMemoryLimit: conf.String("worker.limits.memory"),
 			DefaultTimeout:     conf.String("worker.limits.timeout"),
+			MaxOutputsSize:     conf.IntDefault("worker.limits.outputs", runtime.DefaultMaxOutputsSize),
 		},
 		Address:    conf.String("worker.address"),
 		Middleware: e.cfg.Middleware.Task,
+		Workspaces: e.workspaces,
 	})
 	if err != nil {
 		return errors.Wrapf(err, "error creating worker")
@@ -72,6 +75,9 @@ func (e *Engine) initRuntime() (runtime.Runtime, error) {
 		mounter.RegisterMounter("volume", vm)
 		// register tmpfs mounter
 		mounter.RegisterMounter("tmpfs", docker.NewTmpfsMounter())
+		// register the jobs' workspaces mounter
+		e.workspaces = runtime.NewWorkspaceMounter(vm)
+		mounter.RegisterMounter(tork.MountTypeWorkspace, e.workspaces)
 		return docker.NewDockerRuntime(
 			docker.WithMounter(mounter),
 			docker.WithConfig(conf.String("runtime.docker.config")),
@@ -79,13 +85,17 @@ func (e *Engine) initRuntime() (runtime.Runtime, error) {
 			docker.WithPrivileged(conf.Bool("runtime.docker.privileged")),
 			docker.WithImageTTL(conf.DurationDefault("runtime.docker.image.ttl", docker.DefaultImageTTL)),
 			docker.WithImageVerify(conf.Bool("runtime.docker.image.verify")),
+			docker.WithArtifactStore(e.artifacts),
+			docker.WithMaxOutputsSize(conf.IntDefault("worker.limits.outputs", runtime.DefaultMaxOutputsSize)),
 		)
 	case runtime.Shell:
 		return shell.NewShellRuntime(shell.Config{
-			CMD:    conf.Strings("runtime.shell.cmd"),
-			UID:    conf.StringDefault("runtime.shell.uid", shell.DEFAULT_UID),
-			GID:    conf.StringDefault("runtime.shell.gid", shell.DEFAULT_GID),
-			Broker: e.brokerRef,
+			CMD:            conf.Strings("runtime.shell.cmd"),
+			UID:            conf.StringDefault("runtime.shell.uid", shell.DEFAULT_UID),
+			GID:            conf.StringDefault("runtime.shell.gid", shell.DEFAULT_GID),
+			Broker:         e.brokerRef,
+			ArtifactStore:  e.artifacts,
+			MaxOutputsSize: conf.IntDefault("worker.limits.outputs", runtime.DefaultMaxOutputsSize),
 		}), nil
 	case runtime.Podman:
 		mounter, ok := e.mounters[runtime.Podman]
@@ -98,11 +108,17 @@ func (e *Engine) initRuntime() (runtime.Runtime, error) {
 			Sources: conf.Strings("mounts.bind.sources"),
 		})
 		mounter.RegisterMounter("bind", bm)
-		mounter.RegisterMounter("volume", podman.NewVolumeMounter())
+		vm := podman.NewVolumeMounter()
+		mounter.RegisterMounter("volume", vm)
+		// register the jobs' workspaces mounter
+		e.workspaces = runtime.NewWorkspaceMounter(vm)
+		mounter.RegisterMounter(tork.MountTypeWorkspace, e.workspaces)
 		return podman.NewPodmanRuntime(
 			podman.WithBroker(e.brokerRef),
 			podman.WithMounter(mounter),
 			podman.WithPrivileged(conf.Bool("runtime.podman.privileged")),
+			podman.WithArtifactStore(e.artifacts),
+			podman.WithMaxOutputsSize(conf.IntDefault("worker.limits.outputs", runtime.DefaultMaxOutputsSize)),
 		), nil
 	default:
 		return nil, errors.Errorf("unknown runtime type: %s", runtimeType)
@@ -15,13 +15,38 @@ type Job struct {
 	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
 	Tasks       []Task            `json:"tasks,omitempty" yaml:"tasks,omitempty" validate:"required,min=1,dive"`
 	Inputs      map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	InputSchema map[string]Input  `json:"inputSchema,omitempty" yaml:"inputSchema,omitempty" validate:"dive"`
 	Secrets     map[string]string `json:"secrets,omitempty" yaml:"secrets,omitempty"`
 	Output      string            `json:"output,omitempty" yaml:"output,omitempty" validate:"expr"`
 	Defaults    *Defaults         `json:"defaults,omitempty" yaml:"defaults,omitempty"`
+	Workspace   *Workspace        `json:"workspace,omitempty" yaml:"workspace,omitempty"`
 	Webhooks    []Webhook         `json:"webhooks,omitempty" yaml:"webhooks,omitempty" validate:"dive"`
 	Permissions []Permission      `json:"permissions,omitempty" yaml:"permissions,omitempty" validate:"dive"`
 	AutoDelete  *AutoDelete       `json:"autoDelete,omitempty" yaml:"autoDelete,omitempty"`
 	Wait        *Wait             `json:"wait,omitempty" yaml:"wait,omitempty"`
+	Timeout     string            `json:"timeout,omitempty" yaml:"timeout,omitempty" validate:"duration"`
+	Deadline    *time.Time        `json:"deadline,omitempty" yaml:"deadline,omitempty"`
+}
+
+// Input declares the type and the constraints
+// of one of the job's inputs.
+type Input struct {
+	Type     string   `json:"type,omitempty" yaml:"type,omitempty" validate:"omitempty,oneof=string int bool list json"`
+	Required bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	Default  string   `json:"default,omitempty" yaml:"default,omitempty"`
+	Enum     []string `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Pattern  string   `json:"pattern,omitempty" yaml:"pattern,omitempty" validate:"regexp"`
+}
+
+// Workspace is a volume which is shared by
+// all the tasks of the job.
+type Workspace struct {
+	// Size limits the size of the workspace. Only in-memory
+	// (tmpfs) workspaces can be size-limited.
+	Size   string `json:"size,omitempty" yaml:"size,omitempty"`
+	Target string `json:"target,omitempty" yaml:"target,omitempty" validate:"required"`
+	// Tmpfs keeps the workspace in the memory of the node.
+	Tmpfs bool `json:"tmpfs,omitempty" yaml:"tmpfs,omitempty"`
 }
 
 type Wait struct {
@@ -33,8 +58,10 @@ type ScheduledJob struct {
 	Name        string            `json:"name,omitempty" yaml:"name,omitempty" validate:"required"`
 	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
 	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Template    string            `json:"template,omitempty" yaml:"template,omitempty"`
 	Tasks       []Task            `json:"tasks,omitempty" yaml:"tasks,omitempty" validate:"required,min=1,dive"`
 	Inputs      map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	InputSchema map[string]Input  `json:"inputSchema,omitempty" yaml:"inputSchema,omitempty" validate:"dive"`
 	Secrets     map[string]string `json:"secrets,omitempty" yaml:"secrets,omitempty"`
 	Output      string            `json:"output,omitempty" yaml:"output,omitempty" validate:"expr"`
 	Defaults    *Defaults         `json:"defaults,omitempty" yaml:"defaults,omitempty"`
@@ -50,10 +77,28 @@ type Defaults struct {
 	Timeout  string  `json:"timeout,omitempty" yaml:"timeout,omitempty" validate:"duration"`
 	Queue    string  `json:"queue,omitempty" yaml:"queue,omitempty" validate:"queue"`
 	Priority int     `json:"priority,omitempty" yaml:"priority,omitempty" validate:"min=0,max=9"`
+	// JobTimeout is the timeout of the job itself, unless it sets its own
+	JobTimeout string `json:"jobTimeout,omitempty" yaml:"jobTimeout,omitempty" validate:"duration"`
 }
 
 type Schedule struct {
-	Cron string `json:"cron" yaml:"cron" validate:"required,cron"`
+	Cron     string      `json:"cron,omitempty" yaml:"cron,omitempty" validate:"required_without=Trigger,excluded_with=Trigger,omitempty,cron"`
+	Timezone string      `json:"timezone,omitempty" yaml:"timezone,omitempty" validate:"omitempty,timezone"`
+	Overlap  string      `json:"overlap,omitempty" yaml:"overlap,omitempty" validate:"omitempty,oneof=allow skip cancel-previous queue"`
+	CatchUp  *CatchUp    `json:"catchUp,omitempty" yaml:"catchUp,omitempty"`
+	Trigger  *JobTrigger `json:"trigger,omitempty" yaml:"trigger,omitempty"`
+}
+
+type JobTrigger struct {
+	On   []string `json:"on,omitempty" yaml:"on,omitempty" validate:"dive,oneof=COMPLETED FAILED"`
+	Name string   `json:"name,omitempty" yaml:"name,omitempty" validate:"required_without=Tags"`
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	If   string   `json:"if,omitempty" yaml:"if,omitempty" validate:"expr"`
+}
+
+type CatchUp struct {
+	Policy string `json:"policy,omitempty" yaml:"policy,omitempty" validate:"omitempty,oneof=none last all"`
+	Window string `json:"window,omitempty" yaml:"window,omitempty" validate:"duration"`
 }
 
 type AutoDelete struct {
@@ -91,7 +136,7 @@ func (ji *Job) ToJob() *tork.Job {
 	j := &tork.Job{}
 	j.ID = ji.ID()
 	j.Description = ji.Description
-	j.Inputs = ji.Inputs
+	j.Inputs = ji.inputs()
 	j.Secrets = ji.Secrets
 	j.Tags = ji.Tags
 	j.Name = ji.Name
@@ -103,8 +148,17 @@ func (ji *Job) ToJob() *tork.Job {
 	j.State = tork.JobStatePending
 	j.CreatedAt = n
 	j.Context = tork.JobContext{}
-	j.Context.Inputs = ji.Inputs
+	j.Context.Inputs = j.Inputs
 	j.Context.Secrets = ji.Secrets
+	for name, in := range ji.InputSchema {
+		if in.Type == "" || in.Type == tork.InputTypeString {
+			continue
+		}
+		if j.Context.InputTypes == nil {
+			j.Context.InputTypes = make(map[string]string)
+		}
+		j.Context.InputTypes[name] = in.Type
+	}
 	j.Context.Job = map[string]string{
 		"id":   j.ID,
 		"name": j.Name,
@@ -114,6 +168,13 @@ func (ji *Job) ToJob() *tork.Job {
 	if ji.Defaults != nil {
 		j.Defaults = ji.Defaults.ToJobDefaults()
 	}
+	if ji.Workspace != nil {
+		j.Workspace = &tork.JobWorkspace{
+			Size:   ji.Workspace.Size,
+			Target: ji.Workspace.Target,
+			Tmpfs:  ji.Workspace.Tmpfs,
+		}
+	}
 	webhooks := make([]*tork.Webhook, len(ji.Webhooks))
 	for i, wh := range ji.Webhooks {
 		webhooks[i] = wh.toWebhook()
@@ -129,15 +190,60 @@ func (ji *Job) ToJob() *tork.Job {
 			After: ji.AutoDelete.After,
 		}
 	}
+	j.Timeout = ji.Timeout
+	if ji.Deadline != nil {
+		deadline := ji.Deadline.UTC()
+		j.Deadline = &deadline
+	}
 	return j
 }
 
+// inputs returns the job's inputs along with the default
+// value of the declared inputs which were not supplied.
+func (ji *Job) inputs() map[string]string {
+	return withDefaults(ji.InputSchema, ji.Inputs)
+}
+
+func withDefaults(schema map[string]Input, inputs map[string]string) map[string]string {
+	if len(schema) == 0 {
+		return inputs
+	}
+	result := maps.Clone(inputs)
+	if result == nil {
+		result = make(map[string]string)
+	}
+	for name, in := range schema {
+		if _, ok := result[name]; !ok && in.Default != "" {
+			result[name] = in.Default
+		}
+	}
+	return result
+}
+
+func toInputSchema(schema map[string]Input) map[string]tork.Input {
+	if schema == nil {
+		return nil
+	}
+	result := make(map[string]tork.Input, len(schema))
+	for name, in := range schema {
+		result[name] = tork.Input{
+			Type:     in.Type,
+			Required: in.Required,
+			Default:  in.Default,
+			Enum:     in.Enum,
+			Pattern:  in.Pattern,
+		}
+	}
+	return result
+}
+
 func (ji *ScheduledJob) ToScheduledJob() *tork.ScheduledJob {
 	n := time.Now().UTC()
 	j := &tork.ScheduledJob{}
 	j.ID = ji.ID()
 	j.Description = ji.Description
-	j.Inputs = ji.Inputs
+	j.Inputs = withDefaults(ji.InputSchema, ji.Inputs)
+	j.InputSchema = toInputSchema(ji.InputSchema)
 	j.Secrets = ji.Secrets
 	j.Tags = ji.Tags
 	j.Name = ji.Name
@@ -168,6 +274,22 @@ func (ji *ScheduledJob) ToScheduledJob() *tork.ScheduledJob {
 		}
 	}
 	j.Cron = ji.Schedule.Cron
+	j.Timezone = ji.Schedule.Timezone
+	j.Overlap = ji.Schedule.Overlap
+	if ji.Schedule.CatchUp != nil {
+		j.CatchUp = &tork.ScheduleCatchUp{
+			Policy: ji.Schedule.CatchUp.Policy,
+			Window: ji.Schedule.CatchUp.Window,
+		}
+	}
+	if ji.Schedule.Trigger != nil {
+		j.Trigger = &tork.JobTrigger{
+			On:   ji.Schedule.Trigger.On,
+			Name: ji.Schedule.Trigger.Name,
+			Tags: ji.Schedule.Trigger.Tags,
+			If:   ji.Schedule.Trigger.If,
+		}
+	}
 	return j
 }
 
@@ -182,6 +304,7 @@ func (d Defaults) ToJobDefaults() *tork.JobDefaults {
 	jd.Timeout = d.Timeout
 	jd.Queue = d.Queue
 	jd.Priority = d.Priority
+	jd.JobTimeout = d.JobTimeout
 	return &jd
 }
 
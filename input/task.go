@@ -20,6 +20,7 @@ type Task struct {
 	Post        []AuxTask         `json:"post,omitempty" yaml:"post,omitempty" validate:"dive"`
 	Sidecars    []SidecarTask     `json:"sidecars,omitempty" yaml:"sidecars,omitempty" validate:"dive"`
 	Mounts      []Mount           `json:"mounts,omitempty" yaml:"mounts,omitempty" validate:"dive"`
+	Artifacts   *Artifacts        `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
 	Networks    []string          `json:"networks,omitempty" yaml:"networks,omitempty"`
 	Retry       *Retry            `json:"retry,omitempty" yaml:"retry,omitempty"`
 	Limits      *Limits           `json:"limits,omitempty" yaml:"limits,omitempty"`
@@ -33,13 +34,15 @@ type Task struct {
 	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
 	Workdir     string            `json:"workdir,omitempty" yaml:"workdir,omitempty" validate:"max=256"`
 	Priority    int               `json:"priority,omitempty" yaml:"priority,omitempty" validate:"min=0,max=9"`
+	DependsOn   []string          `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
 }
 
 type SubJob struct {
 	ID          string            `json:"id,omitempty"`
-	Name        string            `json:"name,omitempty" yaml:"name,omitempty" validate:"required"`
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty" validate:"required_without=Template"`
 	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
-	Tasks       []Task            `json:"tasks,omitempty" yaml:"tasks,omitempty" validate:"required"`
+	Template    string            `json:"template,omitempty" yaml:"template,omitempty" validate:"excluded_with=Tasks"`
+	Tasks       []Task            `json:"tasks,omitempty" yaml:"tasks,omitempty" validate:"required_without=Template"`
 	Inputs      map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
 	Secrets     map[string]string `json:"secrets,omitempty" yaml:"secrets,omitempty"`
 	AutoDelete  *AutoDelete       `json:"autoDelete,omitempty" yaml:"autoDelete,omitempty"`
@@ -60,7 +63,18 @@ type Parallel struct {
 }
 
 type Retry struct {
-	Limit int `json:"limit,omitempty" yaml:"limit,omitempty" validate:"required,min=1,max=10"`
+	Limit        int      `json:"limit,omitempty" yaml:"limit,omitempty" validate:"required,min=1,max=10"`
+	InitialDelay string   `json:"initialDelay,omitempty" yaml:"initialDelay,omitempty" validate:"duration"`
+	Scaling      string   `json:"scaling,omitempty" yaml:"scaling,omitempty" validate:"omitempty,oneof=fixed exponential"`
+	MaxDelay     string   `json:"maxDelay,omitempty" yaml:"maxDelay,omitempty" validate:"duration"`
+	Jitter       bool     `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	On           *RetryOn `json:"on,omitempty" yaml:"on,omitempty"`
+}
+
+type RetryOn struct {
+	ExitCodes []int    `json:"exitCodes,omitempty" yaml:"exitCodes,omitempty" validate:"dive,min=0,max=255"`
+	Errors    []string `json:"errors,omitempty" yaml:"errors,omitempty" validate:"dive,regexp"`
+	If        string   `json:"if,omitempty" yaml:"if,omitempty" validate:"expr"`
 }
 
 type Limits struct {
@@ -79,6 +93,16 @@ type Mount struct {
 	Target string `json:"target,omitempty" yaml:"target,omitempty"`
 }
 
+type Artifacts struct {
+	Inputs  []Artifact `json:"inputs,omitempty" yaml:"inputs,omitempty" validate:"dive"`
+	Outputs []Artifact `json:"outputs,omitempty" yaml:"outputs,omitempty" validate:"dive"`
+}
+
+type Artifact struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty" validate:"required,artifactname"`
+	Path string `json:"path,omitempty" yaml:"path,omitempty" validate:"required,max=256"`
+}
+
 type AuxTask struct {
 	Name        string            `json:"name,omitempty" yaml:"name,omitempty" validate:"required"`
 	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
@@ -120,6 +144,30 @@ func (m Mount) toMount() tork.Mount {
 	}
 }
 
+func (a *Artifacts) toArtifacts() *tork.TaskArtifacts {
+	if a == nil {
+		return nil
+	}
+	return &tork.TaskArtifacts{
+		Inputs:  toArtifacts(a.Inputs),
+		Outputs: toArtifacts(a.Outputs),
+	}
+}
+
+func toArtifacts(as []Artifact) []*tork.TaskArtifact {
+	if len(as) == 0 {
+		return nil
+	}
+	result := make([]*tork.TaskArtifact, len(as))
+	for i, a := range as {
+		result[i] = &tork.TaskArtifact{
+			Name: a.Name,
+			Path: a.Path,
+		}
+	}
+	return result
+}
+
 func (i AuxTask) toTask() *tork.Task {
 	var registry *tork.Registry
 	if i.Registry != nil {
@@ -244,6 +292,7 @@ func (i Task) toTask() *tork.Task {
 		Post:        post,
 		Sidecars:    sidecars,
 		Mounts:      toMounts(i.Mounts),
+		Artifacts:   i.Artifacts.toArtifacts(),
 		Networks:    i.Networks,
 		Retry:       retry,
 		Limits:      limits,
@@ -257,6 +306,7 @@ func (i Task) toTask() *tork.Task {
 		Tags:        i.Tags,
 		Workdir:     i.Workdir,
 		Priority:    i.Priority,
+		DependsOn:   i.DependsOn,
 	}
 }
 
@@ -299,7 +349,20 @@ func (l *Limits) toTaskLimits() *tork.TaskLimits {
 }
 
 func (r *Retry) toTaskRetry() *tork.TaskRetry {
+	var on *tork.RetryOn
+	if r.On != nil {
+		on = &tork.RetryOn{
+			ExitCodes: r.On.ExitCodes,
+			Errors:    r.On.Errors,
+			If:        r.On.If,
+		}
+	}
 	return &tork.TaskRetry{
-		Limit: r.Limit,
+		Limit:        r.Limit,
+		InitialDelay: r.InitialDelay,
+		Scaling:      r.Scaling,
+		MaxDelay:     r.MaxDelay,
+		Jitter:       r.Jitter,
+		On:           on,
 	}
 }
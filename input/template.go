@@ -0,0 +1,238 @@
+package input
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/uuid"
+	"golang.org/x/exp/maps"
+)
+
+// maxTemplateDepth limits the nesting of templates which
+// reference other templates through their sub-jobs.
+const maxTemplateDepth = 10
+
+type Template struct {
+	Name        string              `json:"name,omitempty" yaml:"name,omitempty" validate:"required,max=64,templatename"`
+	Description string              `json:"description,omitempty" yaml:"description,omitempty"`
+	Parameters  []TemplateParameter `json:"parameters,omitempty" yaml:"parameters,omitempty" validate:"dive"`
+	Job         *Job                `json:"job,omitempty" yaml:"job,omitempty" validate:"-"`
+}
+
+// TemplateParameter declares an input of the template with
+// the same types and checks as the inputSchema of a job.
+type TemplateParameter struct {
+	Name  string `json:"name,omitempty" yaml:"name,omitempty" validate:"required"`
+	Input `yaml:",inline"`
+}
+
+func (ti *Template) ToTemplate() (*tork.Template, error) {
+	job, err := json.Marshal(ti.Job)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize template.job")
+	}
+	params := make([]*tork.TemplateParameter, len(ti.Parameters))
+	for i, p := range ti.Parameters {
+		params[i] = p.toTemplateParameter()
+	}
+	return &tork.Template{
+		ID:          uuid.NewUUID(),
+		Name:        ti.Name,
+		Description: ti.Description,
+		Parameters:  params,
+		Job:         job,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+func (p TemplateParameter) toTemplateParameter() *tork.TemplateParameter {
+	return &tork.TemplateParameter{
+		Name:     p.Name,
+		Type:     p.Type,
+		Required: p.Required,
+		Default:  p.Default,
+		Enum:     p.Enum,
+		Pattern:  p.Pattern,
+	}
+}
+
+// NewTemplateJob returns the job definition of the template,
+// with the supplied inputs validated against the template's
+// parameters.
+func NewTemplateJob(t *tork.Template, inputs map[string]string) (*Job, error) {
+	ji := &Job{}
+	if err := json.Unmarshal(t.Job, ji); err != nil {
+		return nil, errors.Wrapf(err, "error deserializing template.job")
+	}
+	resolved, err := t.ResolveInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	if ji.Inputs == nil {
+		ji.Inputs = make(map[string]string)
+	}
+	maps.Copy(ji.Inputs, resolved)
+	// the parameters are exposed to expressions
+	// just like the job's own inputSchema
+	for _, p := range t.Parameters {
+		if _, ok := ji.InputSchema[p.Name]; ok {
+			continue
+		}
+		if ji.InputSchema == nil {
+			ji.InputSchema = make(map[string]Input)
+		}
+		ji.InputSchema[p.Name] = Input{
+			Type:     p.Type,
+			Required: p.Required,
+			Default:  p.Default,
+			Enum:     p.Enum,
+			Pattern:  p.Pattern,
+		}
+	}
+	return ji, nil
+}
+
+// ResolveTemplates replaces the sub-jobs which reference
+// a template with the template's definition.
+func (ji *Job) ResolveTemplates(ctx context.Context, ds datastore.Datastore) error {
+	return resolveTaskTemplates(ctx, ds, ji.Tasks, 0)
+}
+
+// ResolveTemplates fills the scheduled job's tasks from the
+// template it references, if any, and replaces the sub-jobs
+// which reference a template with the template's definition.
+//
+// Templates are resolved when the scheduled job is created so
+// its instances are not affected by newer versions of the template.
+func (ji *ScheduledJob) ResolveTemplates(ctx context.Context, ds datastore.Datastore) error {
+	if ji.Template != "" {
+		if len(ji.Tasks) > 0 {
+			return errors.Errorf("scheduled job can't declare both a template and tasks")
+		}
+		j, err := loadTemplateJob(ctx, ds, ji.Template, ji.Inputs)
+		if err != nil {
+			return err
+		}
+		ji.Tasks = j.Tasks
+		ji.Inputs = j.Inputs
+		ji.InputSchema = mergeInputSchema(j.InputSchema, ji.InputSchema)
+		ji.Secrets = mergeSecrets(j.Secrets, ji.Secrets)
+		if ji.Name == "" {
+			ji.Name = j.Name
+		}
+		if ji.Description == "" {
+			ji.Description = j.Description
+		}
+		if len(ji.Tags) == 0 {
+			ji.Tags = j.Tags
+		}
+		if ji.Output == "" {
+			ji.Output = j.Output
+		}
+		if ji.Defaults == nil {
+			ji.Defaults = j.Defaults
+		}
+		if len(ji.Webhooks) == 0 {
+			ji.Webhooks = j.Webhooks
+		}
+		if ji.AutoDelete == nil {
+			ji.AutoDelete = j.AutoDelete
+		}
+		ji.Template = ""
+		return resolveTaskTemplates(ctx, ds, ji.Tasks, 1)
+	}
+	return resolveTaskTemplates(ctx, ds, ji.Tasks, 0)
+}
+
+func resolveTaskTemplates(ctx context.Context, ds datastore.Datastore, tasks []Task, depth int) error {
+	for i := range tasks {
+		if err := resolveTaskTemplate(ctx, ds, &tasks[i], depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveTaskTemplate(ctx context.Context, ds datastore.Datastore, t *Task, depth int) error {
+	switch {
+	case t.Parallel != nil:
+		return resolveTaskTemplates(ctx, ds, t.Parallel.Tasks, depth)
+	case t.Each != nil:
+		return resolveTaskTemplate(ctx, ds, &t.Each.Task, depth)
+	case t.SubJob == nil:
+		return nil
+	}
+	sj := t.SubJob
+	if sj.Template != "" {
+		if depth >= maxTemplateDepth {
+			return errors.Errorf("template %s exceeds the maximum nesting depth of %d", sj.Template, maxTemplateDepth)
+		}
+		if len(sj.Tasks) > 0 {
+			return errors.Errorf("sub-job can't declare both a template and tasks")
+		}
+		j, err := loadTemplateJob(ctx, ds, sj.Template, sj.Inputs)
+		if err != nil {
+			return err
+		}
+		sj.Tasks = j.Tasks
+		sj.Inputs = j.Inputs
+		sj.Secrets = mergeSecrets(j.Secrets, sj.Secrets)
+		if sj.Name == "" {
+			sj.Name = j.Name
+		}
+		if sj.Description == "" {
+			sj.Description = j.Description
+		}
+		if sj.Output == "" {
+			sj.Output = j.Output
+		}
+		if len(sj.Webhooks) == 0 {
+			sj.Webhooks = j.Webhooks
+		}
+		if sj.AutoDelete == nil {
+			sj.AutoDelete = j.AutoDelete
+		}
+		sj.Template = ""
+		depth = depth + 1
+	}
+	return resolveTaskTemplates(ctx, ds, sj.Tasks, depth)
+}
+
+// loadTemplateJob fetches the template referenced by ref
+// (name@version) and returns its job definition.
+func loadTemplateJob(ctx context.Context, ds datastore.Datastore, ref string, inputs map[string]string) (*Job, error) {
+	name, version, err := tork.ParseTemplateRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	t, err := ds.GetTemplate(ctx, name, version)
+	if err != nil {
+		if errors.Is(err, datastore.ErrTemplateNotFound) {
+			return nil, errors.Errorf("unknown template: %s", ref)
+		}
+		return nil, err
+	}
+	return NewTemplateJob(t, inputs)
+}
+
+func mergeSecrets(base, secrets map[string]string) map[string]string {
+	if len(base) == 0 {
+		return secrets
+	}
+	result := maps.Clone(base)
+	maps.Copy(result, secrets)
+	return result
+}
+
+func mergeInputSchema(base, schema map[string]Input) map[string]Input {
+	if len(base) == 0 {
+		return schema
+	}
+	result := maps.Clone(base)
+	maps.Copy(result, schema)
+	return result
+}
@@ -0,0 +1,151 @@
+package input
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestResolveTemplates(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	name := "transcode-" + uuid.NewShortUUID()
+	job, err := json.Marshal(Job{
+		Name:    "transcode video",
+		Inputs:  map[string]string{"codec": "h264"},
+		Secrets: map[string]string{"token": "t0k3n"},
+		Output:  "{{ tasks.url }}",
+		Tasks: []Task{
+			{
+				Name:  "transcode",
+				Image: "jrottenberg/ffmpeg:3.4-alpine",
+			},
+		},
+	})
+	assert.NoError(t, err)
+	err = ds.CreateTemplate(ctx, &tork.Template{
+		ID:      uuid.NewUUID(),
+		Name:    name,
+		Version: 1,
+		Parameters: []*tork.TemplateParameter{
+			{Name: "source", Required: true},
+			{Name: "width", Type: tork.InputTypeInt, Default: "1280"},
+		},
+		Job:       job,
+		CreatedAt: time.Now().UTC(),
+	})
+	assert.NoError(t, err)
+
+	ji := &Job{
+		Name: "test job",
+		Tasks: []Task{
+			{
+				Name: "parallel",
+				Parallel: &Parallel{
+					Tasks: []Task{
+						{
+							Name: "sub",
+							SubJob: &SubJob{
+								Template: name + "@1",
+								Inputs:   map[string]string{"source": "{{ inputs.source }}"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	assert.NoError(t, ji.ResolveTemplates(ctx, ds))
+	sj := ji.Tasks[0].Parallel.Tasks[0].SubJob
+	assert.Empty(t, sj.Template)
+	assert.Equal(t, "transcode video", sj.Name)
+	assert.Equal(t, "{{ tasks.url }}", sj.Output)
+	assert.Equal(t, "t0k3n", sj.Secrets["token"])
+	assert.Equal(t, map[string]string{
+		"codec":  "h264",
+		"source": "{{ inputs.source }}",
+		"width":  "1280",
+	}, sj.Inputs)
+	assert.Len(t, sj.Tasks, 1)
+	assert.Equal(t, "transcode", sj.Tasks[0].Name)
+	assert.NoError(t, ji.Validate(ds))
+
+	// missing required parameter
+	ji.Tasks[0].Parallel.Tasks[0].SubJob = &SubJob{Template: name}
+	assert.ErrorContains(t, ji.ResolveTemplates(ctx, ds), "missing required parameter")
+
+	// unknown template version
+	ji.Tasks[0].Parallel.Tasks[0].SubJob = &SubJob{Template: name + "@2"}
+	assert.ErrorContains(t, ji.ResolveTemplates(ctx, ds), "unknown template")
+
+	sji := &ScheduledJob{
+		Template: name,
+		Inputs:   map[string]string{"source": "s3://bucket/video.mov", "width": "640"},
+		Schedule: &Schedule{Cron: "0 0 * * *"},
+	}
+	assert.NoError(t, sji.ResolveTemplates(ctx, ds))
+	assert.Equal(t, "transcode video", sji.Name)
+	assert.Equal(t, "640", sji.Inputs["width"])
+	assert.Len(t, sji.Tasks, 1)
+	assert.NoError(t, sji.Validate(ds))
+	// the template's parameters become the scheduled job's input schema
+	assert.Equal(t, tork.InputTypeInt, sji.InputSchema["width"].Type)
+	tsj := sji.ToScheduledJob()
+	assert.Equal(t, map[string]tork.Input{
+		"source": {Required: true},
+		"width":  {Type: tork.InputTypeInt, Default: "1280"},
+	}, tsj.InputSchema)
+	assert.Equal(t, 640, tork.NewScheduledJobInstance(tsj).Context.AsMap()["inputs"].(map[string]any)["width"])
+
+	// template and tasks are mutually exclusive
+	sji = &ScheduledJob{
+		Template: name,
+		Inputs:   map[string]string{"source": "s3://bucket/video.mov"},
+		Tasks:    []Task{{Name: "some task", Image: "some:image"}},
+		Schedule: &Schedule{Cron: "0 0 * * *"},
+	}
+	assert.Error(t, sji.ResolveTemplates(ctx, ds))
+	assert.NoError(t, ds.Close())
+}
+
+func TestNewTemplateJob(t *testing.T) {
+	ti := Template{}
+	err := yaml.Unmarshal([]byte(`
+name: resize
+parameters:
+  - name: files
+    type: list
+    required: true
+  - name: width
+    type: int
+    default: "800"
+job:
+  name: resize
+  tasks:
+    - name: resize
+      image: alpine
+`), &ti)
+	assert.NoError(t, err)
+	assert.Equal(t, TemplateParameter{Name: "files", Input: Input{Type: tork.InputTypeList, Required: true}}, ti.Parameters[0])
+	tmpl, err := ti.ToTemplate()
+	assert.NoError(t, err)
+
+	ji, err := NewTemplateJob(tmpl, map[string]string{"files": `["a.jpg","b.jpg"]`})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"files": `["a.jpg","b.jpg"]`, "width": "800"}, ji.Inputs)
+	j := ji.ToJob()
+	assert.Equal(t, []any{"a.jpg", "b.jpg"}, j.Context.AsMap()["inputs"].(map[string]any)["files"])
+	assert.Equal(t, 800, j.Context.AsMap()["inputs"].(map[string]any)["width"])
+
+	_, err = NewTemplateJob(tmpl, map[string]string{"files": "a.jpg"})
+	assert.ErrorContains(t, err, `invalid parameter files: "a.jpg" is not a valid list`)
+}
@@ -0,0 +1,37 @@
+package input
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/uuid"
+)
+
+type Trigger struct {
+	Name        string `json:"name,omitempty" yaml:"name,omitempty" validate:"required,max=64,triggername"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Secret      string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// ClearSecret removes the secret of an existing trigger when
+	// it is updated. Updates which omit the secret keep it as is.
+	ClearSecret bool              `json:"clearSecret,omitempty" yaml:"clearSecret,omitempty"`
+	Inputs      map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Job         *Job              `json:"job,omitempty" yaml:"job,omitempty" validate:"-"`
+}
+
+func (ti *Trigger) ToTrigger() (*tork.Trigger, error) {
+	job, err := json.Marshal(ti.Job)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize trigger.job")
+	}
+	return &tork.Trigger{
+		ID:          uuid.NewUUID(),
+		Name:        ti.Name,
+		Description: ti.Description,
+		Secret:      ti.Secret,
+		Inputs:      ti.Inputs,
+		Job:         job,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
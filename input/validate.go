@@ -3,22 +3,41 @@ package input
 import (
 	"context"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
 	"github.com/robfig/cron/v3"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/eval"
+	"golang.org/x/exp/maps"
 )
 
 var (
-	mountPattern = regexp.MustCompile(`^[-/\.0-9a-zA-Z_/= ]+$`)
+	mountPattern       = regexp.MustCompile(`^[-/\.0-9a-zA-Z_/= ]+$`)
+	triggerNamePattern = regexp.MustCompile(`^[-0-9a-zA-Z_]+$`)
+	// template names can't contain '@' which separates
+	// the name from the version in template references
+	templateNamePattern = regexp.MustCompile(`^[-0-9a-zA-Z_.]+$`)
 )
 
 func (ji Job) Validate(ds datastore.Datastore) error {
+	if err := ji.validateDefinition(ds); err != nil {
+		return err
+	}
+	return validateInputs(ji.InputSchema, ji.Inputs)
+}
+
+// validateDefinition validates the job without checking its
+// inputs, which are only supplied when the job is launched
+// (e.g. by a trigger or from a template).
+func (ji Job) validateDefinition(ds datastore.Datastore) error {
 	validate := validator.New()
 	if err := validate.RegisterValidation("duration", validateDuration); err != nil {
 		return err
@@ -29,10 +48,24 @@ func (ji Job) Validate(ds datastore.Datastore) error {
 	if err := validate.RegisterValidation("expr", validateExpr); err != nil {
 		return err
 	}
+	if err := validate.RegisterValidation("regexp", validateRegexp); err != nil {
+		return err
+	}
+	if err := validate.RegisterValidation("artifactname", validateArtifactName); err != nil {
+		return err
+	}
 	validate.RegisterStructValidation(validateMount, Mount{})
+	validate.RegisterStructValidation(validateWorkspace, Workspace{})
 	validate.RegisterStructValidation(taskInputValidation, Task{})
 	validate.RegisterStructValidation(validatePermission(ds), Permission{})
-	return validate.Struct(ji)
+	validate.RegisterStructValidation(validateJobDependencies, Job{})
+	validate.RegisterStructValidation(validateSubJobDependencies, SubJob{})
+	validate.RegisterStructValidation(validateParallelDependencies, Parallel{})
+	validate.RegisterStructValidation(validateEachDependencies, Each{})
+	if err := validate.Struct(ji); err != nil {
+		return err
+	}
+	return validateInputSchema(ji.InputSchema)
 }
 
 func (ji ScheduledJob) Validate(ds datastore.Datastore) error {
@@ -46,10 +79,110 @@ func (ji ScheduledJob) Validate(ds datastore.Datastore) error {
 	if err := validate.RegisterValidation("expr", validateExpr); err != nil {
 		return err
 	}
+	if err := validate.RegisterValidation("regexp", validateRegexp); err != nil {
+		return err
+	}
+	if err := validate.RegisterValidation("artifactname", validateArtifactName); err != nil {
+		return err
+	}
 	validate.RegisterStructValidation(validateMount, Mount{})
 	validate.RegisterStructValidation(taskInputValidation, Task{})
 	validate.RegisterStructValidation(validatePermission(ds), Permission{})
-	return validate.Struct(ji)
+	validate.RegisterStructValidation(validateScheduledJobDependencies, ScheduledJob{})
+	validate.RegisterStructValidation(validateSubJobDependencies, SubJob{})
+	validate.RegisterStructValidation(validateParallelDependencies, Parallel{})
+	validate.RegisterStructValidation(validateEachDependencies, Each{})
+	if err := validate.Struct(ji); err != nil {
+		return err
+	}
+	if err := validateInputSchema(ji.InputSchema); err != nil {
+		return err
+	}
+	if ji.Schedule.Trigger != nil {
+		// the inputs of triggered instances are only
+		// known when the trigger fires
+		return nil
+	}
+	return validateInputs(ji.InputSchema, ji.Inputs)
+}
+
+func (ti Trigger) Validate(ds datastore.Datastore) error {
+	validate := validator.New()
+	if err := validate.RegisterValidation("triggername", validateTriggerName); err != nil {
+		return err
+	}
+	if err := validate.Struct(ti); err != nil {
+		return err
+	}
+	if ti.Job == nil {
+		return errors.New("trigger job is required")
+	}
+	return ti.Job.validateDefinition(ds)
+}
+
+func validateTriggerName(fl validator.FieldLevel) bool {
+	return triggerNamePattern.MatchString(fl.Field().String())
+}
+
+func (ti Template) Validate(ds datastore.Datastore) error {
+	validate := validator.New()
+	if err := validate.RegisterValidation("templatename", validateTemplateName); err != nil {
+		return err
+	}
+	if err := validate.RegisterValidation("regexp", validateRegexp); err != nil {
+		return err
+	}
+	if err := validate.Struct(ti); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, p := range ti.Parameters {
+		if names[p.Name] {
+			return errors.Errorf("duplicate parameter: %s", p.Name)
+		}
+		names[p.Name] = true
+		if p.Default == "" {
+			continue
+		}
+		if err := p.check(p.Default); err != nil {
+			return errors.Wrapf(err, "invalid default value for parameter %s", p.Name)
+		}
+	}
+	if ti.Job == nil {
+		return errors.New("template job is required")
+	}
+	return ti.Job.validateDefinition(ds)
+}
+
+func validateTemplateName(fl validator.FieldLevel) bool {
+	return templateNamePattern.MatchString(fl.Field().String())
+}
+
+// validateInputSchema checks the default values
+// of the input schema against the schema.
+func validateInputSchema(schema map[string]Input) error {
+	names := maps.Keys(schema)
+	slices.Sort(names)
+	for _, name := range names {
+		in := schema[name]
+		if in.Default == "" {
+			continue
+		}
+		if err := in.check(in.Default); err != nil {
+			return errors.Wrapf(err, "invalid default value for input %s", name)
+		}
+	}
+	return nil
+}
+
+// validateInputs checks the supplied inputs against the
+// schema. Inputs which are not declared are not checked.
+func validateInputs(schema map[string]Input, inputs map[string]string) error {
+	return tork.CheckInputs(toInputSchema(schema), inputs)
+}
+
+func (in Input) check(v string) error {
+	return tork.CheckInput(in.Type, in.Enum, in.Pattern, v)
 }
 
 func validateExpr(fl validator.FieldLevel) bool {
@@ -60,10 +193,29 @@ func validateExpr(fl validator.FieldLevel) bool {
 	return eval.ValidExpr(v)
 }
 
+func validateRegexp(fl validator.FieldLevel) bool {
+	_, err := regexp.Compile(fl.Field().String())
+	return err == nil
+}
+
+// validateArtifactName accepts names which are only known at
+// runtime (e.g. {{ item.index }}) as they are checked again by
+// the artifact store.
+func validateArtifactName(fl validator.FieldLevel) bool {
+	name := fl.Field().String()
+	if strings.Contains(name, "{{") {
+		return true
+	}
+	return artifact.ValidName(name)
+}
+
 func validateMount(sl validator.StructLevel) {
 	mnt := sl.Current().Interface().(Mount)
 	if mnt.Type == "" {
 		sl.ReportError(mnt, "mount", "Mount", "typerequired", "")
+	} else if mnt.Type == tork.MountTypeWorkspace {
+		// the workspace is declared on the job
+		sl.ReportError(mnt, "mount", "Mount", "invalidtype", "")
 	} else if mnt.Type == tork.MountTypeVolume && mnt.Source != "" {
 		sl.ReportError(mnt, "mount", "Mount", "sourcenotempty", "")
 	} else if mnt.Type == tork.MountTypeVolume && mnt.Target == "" {
@@ -79,6 +231,21 @@ func validateMount(sl validator.StructLevel) {
 	}
 }
 
+func validateWorkspace(sl validator.StructLevel) {
+	ws := sl.Current().Interface().(Workspace)
+	if ws.Target != "" && (!mountPattern.MatchString(ws.Target) || ws.Target == "/tork") {
+		sl.ReportError(ws.Target, "target", "Target", "invalidtarget", "")
+	}
+	if ws.Size != "" {
+		if _, err := units.RAMInBytes(ws.Size); err != nil {
+			sl.ReportError(ws.Size, "size", "Size", "invalidsize", "")
+		} else if !ws.Tmpfs {
+			// the size of a disk-backed volume can't be limited
+			sl.ReportError(ws.Size, "size", "Size", "sizerequirestmpfs", "")
+		}
+	}
+}
+
 func validateCron(fl validator.FieldLevel) bool {
 	v := fl.Field().String()
 	_, err := cron.ParseStandard(v)
@@ -187,6 +354,9 @@ func compositeTaskValidation(sl validator.StructLevel) {
 	if len(t.Mounts) > 0 {
 		sl.ReportError(t.Mounts, "mounts", "Mounts", "invalidcompositetask", "")
 	}
+	if t.Artifacts != nil {
+		sl.ReportError(t.Artifacts, "artifacts", "Artifacts", "invalidcompositetask", "")
+	}
 	if t.Retry != nil {
 		sl.ReportError(t.Retry, "retry", "Retry", "invalidcompositetask", "")
 	}
@@ -197,3 +367,104 @@ func compositeTaskValidation(sl validator.StructLevel) {
 		sl.ReportError(t.Timeout, "timeout", "Timeout", "invalidcompositetask", "")
 	}
 }
+
+func validateJobDependencies(sl validator.StructLevel) {
+	ji := sl.Current().Interface().(Job)
+	dependenciesValidation(sl, ji.Tasks)
+}
+
+func validateScheduledJobDependencies(sl validator.StructLevel) {
+	ji := sl.Current().Interface().(ScheduledJob)
+	dependenciesValidation(sl, ji.Tasks)
+}
+
+func validateSubJobDependencies(sl validator.StructLevel) {
+	sj := sl.Current().Interface().(SubJob)
+	dependenciesValidation(sl, sj.Tasks)
+}
+
+func validateParallelDependencies(sl validator.StructLevel) {
+	p := sl.Current().Interface().(Parallel)
+	for _, t := range p.Tasks {
+		if len(t.DependsOn) > 0 {
+			sl.ReportError(t.DependsOn, "dependsOn", "DependsOn", "invaliddependency", "")
+		}
+	}
+}
+
+func validateEachDependencies(sl validator.StructLevel) {
+	e := sl.Current().Interface().(Each)
+	if len(e.Task.DependsOn) > 0 {
+		sl.ReportError(e.Task.DependsOn, "dependsOn", "DependsOn", "invaliddependency", "")
+	}
+}
+
+// dependenciesValidation verifies that the dependsOn
+// declarations of a list of sibling tasks form a valid
+// DAG: every dependency must refer to exactly one sibling
+// task by name and the graph must not contain cycles.
+func dependenciesValidation(sl validator.StructLevel, tasks []Task) {
+	hasDeps := false
+	for _, t := range tasks {
+		if len(t.DependsOn) > 0 {
+			hasDeps = true
+			break
+		}
+	}
+	if !hasDeps {
+		return
+	}
+	names := make(map[string]int)
+	for i, t := range tasks {
+		if _, ok := names[t.Name]; ok {
+			sl.ReportError(t.Name, "name", "Name", "duplicatename", t.Name)
+			return
+		}
+		names[t.Name] = i
+	}
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			if _, ok := names[dep]; !ok {
+				sl.ReportError(t.DependsOn, "dependsOn", "DependsOn", "unknowndependency", dep)
+				return
+			}
+		}
+	}
+	// Kahn's algorithm: if we can't visit every
+	// task in topological order there is a cycle
+	indegree := make([]int, len(tasks))
+	dependents := make([][]int, len(tasks))
+	for i, t := range tasks {
+		for _, dep := range t.DependsOn {
+			d := names[dep]
+			indegree[i] = indegree[i] + 1
+			dependents[d] = append(dependents[d], i)
+		}
+	}
+	queue := make([]int, 0)
+	for i, n := range indegree {
+		if n == 0 {
+			queue = append(queue, i)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		visited = visited + 1
+		for _, d := range dependents[i] {
+			indegree[d] = indegree[d] - 1
+			if indegree[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+	if visited < len(tasks) {
+		for i, n := range indegree {
+			if n > 0 {
+				sl.ReportError(tasks[i].DependsOn, "dependsOn", "DependsOn", "cyclicdependency", tasks[i].Name)
+				return
+			}
+		}
+	}
+}
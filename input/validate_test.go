@@ -3,6 +3,7 @@ package input
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/runabol/tork"
@@ -231,6 +232,84 @@ func TestValidateJobTaskRetry(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func TestValidateJobTaskRetryBackoff(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	tests := []struct {
+		name  string
+		retry Retry
+		valid bool
+	}{
+		{"exponential", Retry{Limit: 5, InitialDelay: "1s", Scaling: "exponential", MaxDelay: "1m", Jitter: true}, true},
+		{"fixed", Retry{Limit: 5, InitialDelay: "10s", Scaling: "fixed"}, true},
+		{"bad scaling", Retry{Limit: 5, InitialDelay: "1s", Scaling: "linear"}, false},
+		{"bad initial delay", Retry{Limit: 5, InitialDelay: "1 second"}, false},
+		{"bad max delay", Retry{Limit: 5, MaxDelay: "xyz"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry := tt.retry
+			j := Job{
+				Name: "test job",
+				Tasks: []Task{
+					{
+						Name:  "test task",
+						Image: "some:image",
+						Retry: &retry,
+					},
+				},
+			}
+			err := j.Validate(ds)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func TestValidateJobTaskRetryOn(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	tests := []struct {
+		name  string
+		on    RetryOn
+		valid bool
+	}{
+		{"exit codes", RetryOn{ExitCodes: []int{1, 137}}, true},
+		{"errors", RetryOn{Errors: []string{"^connection (refused|reset)"}}, true},
+		{"if", RetryOn{If: "{{ task.ExitCode == 137 }}"}, true},
+		{"bad exit code", RetryOn{ExitCodes: []int{256}}, false},
+		{"negative exit code", RetryOn{ExitCodes: []int{-1}}, false},
+		{"bad error pattern", RetryOn{Errors: []string{"(unclosed"}}, false},
+		{"bad if", RetryOn{If: "{{ task.ExitCode == }}"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			on := tt.on
+			j := Job{
+				Name: "test job",
+				Tasks: []Task{
+					{
+						Name:  "test task",
+						Image: "some:image",
+						Retry: &Retry{Limit: 3, On: &on},
+					},
+				},
+			}
+			err := j.Validate(ds)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+	assert.NoError(t, ds.Close())
+}
+
 func TestValidateJobTaskTimeout(t *testing.T) {
 	j := Job{
 		Name: "test job",
@@ -249,6 +328,30 @@ func TestValidateJobTaskTimeout(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func TestValidateJobTimeout(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	deadline := time.Now().Add(time.Hour)
+	j := Job{
+		Name:     "test job",
+		Timeout:  "2h",
+		Deadline: &deadline,
+		Tasks: []Task{
+			{
+				Name:  "test task",
+				Image: "some:image",
+			},
+		},
+	}
+	err = j.Validate(ds)
+	assert.NoError(t, err)
+
+	j.Timeout = "2 hours"
+	err = j.Validate(ds)
+	assert.Error(t, err)
+	assert.NoError(t, ds.Close())
+}
+
 func TestValidateSubJob(t *testing.T) {
 	j := Job{
 		Name: "test job",
@@ -663,6 +766,103 @@ func TestValidateMounts(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func TestValidateArtifacts(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	newJob := func(a Artifact) Job {
+		return Job{
+			Name: "test job",
+			Tasks: []Task{
+				{
+					Name:  "test task",
+					Image: "some:image",
+					Run:   "some script",
+					Artifacts: &Artifacts{
+						Outputs: []Artifact{a},
+					},
+				},
+			},
+		}
+	}
+
+	err = newJob(Artifact{Name: "video", Path: "/out/video.mp4"}).Validate(ds)
+	assert.NoError(t, err)
+	err = newJob(Artifact{Name: "video-{{ item.index }}", Path: "out"}).Validate(ds)
+	assert.NoError(t, err)
+	err = newJob(Artifact{Name: "", Path: "/out"}).Validate(ds)
+	assert.Error(t, err)
+	err = newJob(Artifact{Name: "../video", Path: "/out"}).Validate(ds)
+	assert.Error(t, err)
+	err = newJob(Artifact{Name: "video", Path: ""}).Validate(ds)
+	assert.Error(t, err)
+
+	j := Job{
+		Name: "test job",
+		Tasks: []Task{
+			{
+				Name: "test task",
+				Parallel: &Parallel{
+					Tasks: []Task{{Name: "some task", Image: "some:image"}},
+				},
+				Artifacts: &Artifacts{
+					Inputs: []Artifact{{Name: "video", Path: "/in"}},
+				},
+			},
+		},
+	}
+	err = j.Validate(ds)
+	assert.Error(t, err)
+
+	tk := newJob(Artifact{Name: "video", Path: "/out"}).Tasks[0].toTask()
+	assert.Equal(t, &tork.TaskArtifacts{
+		Outputs: []*tork.TaskArtifact{{Name: "video", Path: "/out"}},
+	}, tk.Artifacts)
+	assert.NoError(t, ds.Close())
+}
+
+func TestValidateWorkspace(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	newJob := func(ws *Workspace) Job {
+		return Job{
+			Name:      "test job",
+			Workspace: ws,
+			Tasks: []Task{
+				{
+					Name:  "test task",
+					Image: "some:image",
+				},
+			},
+		}
+	}
+
+	err = newJob(&Workspace{Target: "/workspace"}).Validate(ds)
+	assert.NoError(t, err)
+	err = newJob(&Workspace{Target: "/workspace", Size: "1GB", Tmpfs: true}).Validate(ds)
+	assert.NoError(t, err)
+	err = newJob(&Workspace{Target: "/workspace", Tmpfs: true}).Validate(ds)
+	assert.NoError(t, err)
+	// only in-memory workspaces can be size-limited
+	err = newJob(&Workspace{Target: "/workspace", Size: "1GB"}).Validate(ds)
+	assert.Error(t, err)
+	err = newJob(&Workspace{}).Validate(ds)
+	assert.Error(t, err)
+	err = newJob(&Workspace{Target: "/tork"}).Validate(ds)
+	assert.Error(t, err)
+	err = newJob(&Workspace{Target: "/workspace", Size: "lots", Tmpfs: true}).Validate(ds)
+	assert.Error(t, err)
+
+	j := newJob(nil)
+	j.Tasks[0].Mounts = []Mount{{Type: tork.MountTypeWorkspace, Target: "/workspace"}}
+	err = j.Validate(ds)
+	assert.Error(t, err)
+
+	ji := newJob(&Workspace{Target: "/workspace", Size: "1GB", Tmpfs: true})
+	tj := ji.ToJob()
+	assert.Equal(t, &tork.JobWorkspace{Target: "/workspace", Size: "1GB", Tmpfs: true}, tj.Workspace)
+	assert.NoError(t, ds.Close())
+}
+
 func TestValidateWebhook(t *testing.T) {
 	j := Job{
 		Name: "test job",
@@ -727,3 +927,395 @@ func TestValidateCron(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSchedule(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		schedule  Schedule
+		shouldErr bool
+	}{
+		{"Cron only", Schedule{Cron: "0 0 * * *"}, false},
+		{"Valid timezone", Schedule{Cron: "0 0 * * *", Timezone: "America/New_York"}, false},
+		{"Invalid timezone", Schedule{Cron: "0 0 * * *", Timezone: "Mars/Olympus"}, true},
+		{"Valid overlap", Schedule{Cron: "0 0 * * *", Overlap: "cancel-previous"}, false},
+		{"Invalid overlap", Schedule{Cron: "0 0 * * *", Overlap: "stomp"}, true},
+		{"Valid catch-up", Schedule{Cron: "0 0 * * *", CatchUp: &CatchUp{Policy: "all", Window: "12h"}}, false},
+		{"Invalid catch-up policy", Schedule{Cron: "0 0 * * *", CatchUp: &CatchUp{Policy: "some"}}, true},
+		{"Invalid catch-up window", Schedule{Cron: "0 0 * * *", CatchUp: &CatchUp{Policy: "last", Window: "a while"}}, true},
+		{"No cron nor trigger", Schedule{}, true},
+		{"Trigger only", Schedule{Trigger: &JobTrigger{Name: "ingest-*", On: []string{"COMPLETED", "FAILED"}}}, false},
+		{"Trigger on tags", Schedule{Trigger: &JobTrigger{Tags: []string{"etl"}, If: "{{ job.Result != '' }}"}}, false},
+		{"Cron and trigger", Schedule{Cron: "0 0 * * *", Trigger: &JobTrigger{Name: "ingest"}}, true},
+		{"Trigger without criteria", Schedule{Trigger: &JobTrigger{On: []string{"COMPLETED"}}}, true},
+		{"Invalid trigger state", Schedule{Trigger: &JobTrigger{Name: "ingest", On: []string{"RUNNING"}}}, true},
+		{"Invalid trigger expression", Schedule{Trigger: &JobTrigger{Name: "ingest", If: "{{ job.Result == }}"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := tt.schedule
+			j := ScheduledJob{
+				Name:     "test job",
+				Schedule: &sched,
+				Tasks: []Task{
+					{
+						Name:  "test task",
+						Image: "some:image",
+					},
+				},
+			}
+			err := j.Validate(ds)
+			if tt.shouldErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func TestValidateScheduledJobInputs(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	tests := []struct {
+		name      string
+		schedule  Schedule
+		inputs    map[string]string
+		shouldErr bool
+	}{
+		{"Valid inputs", Schedule{Cron: "0 0 * * *"}, map[string]string{"count": "1"}, false},
+		{"Invalid input", Schedule{Cron: "0 0 * * *"}, map[string]string{"count": "many"}, true},
+		{"Missing required input", Schedule{Cron: "0 0 * * *"}, nil, true},
+		// supplied when the trigger fires
+		{"Triggered", Schedule{Trigger: &JobTrigger{Name: "ingest"}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := tt.schedule
+			j := ScheduledJob{
+				Name:        "test job",
+				Schedule:    &sched,
+				Inputs:      tt.inputs,
+				InputSchema: map[string]Input{"count": {Type: "int", Required: true}},
+				Tasks: []Task{
+					{
+						Name:  "test task",
+						Image: "some:image",
+					},
+				},
+			}
+			err := j.Validate(ds)
+			if tt.shouldErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func TestValidateDependsOn(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	// diamond
+	j := Job{
+		Name: "test job",
+		Tasks: []Task{
+			{Name: "a", Image: "some:image"},
+			{Name: "b", Image: "some:image", DependsOn: []string{"a"}},
+			{Name: "c", Image: "some:image", DependsOn: []string{"a"}},
+			{Name: "d", Image: "some:image", DependsOn: []string{"b", "c"}},
+		},
+	}
+	err = j.Validate(ds)
+	assert.NoError(t, err)
+
+	// unknown dependency
+	j = Job{
+		Name: "test job",
+		Tasks: []Task{
+			{Name: "a", Image: "some:image"},
+			{Name: "b", Image: "some:image", DependsOn: []string{"x"}},
+		},
+	}
+	err = j.Validate(ds)
+	assert.Error(t, err)
+
+	// cycle
+	j = Job{
+		Name: "test job",
+		Tasks: []Task{
+			{Name: "a", Image: "some:image", DependsOn: []string{"c"}},
+			{Name: "b", Image: "some:image", DependsOn: []string{"a"}},
+			{Name: "c", Image: "some:image", DependsOn: []string{"b"}},
+		},
+	}
+	err = j.Validate(ds)
+	assert.Error(t, err)
+
+	// self-dependency
+	j = Job{
+		Name: "test job",
+		Tasks: []Task{
+			{Name: "a", Image: "some:image", DependsOn: []string{"a"}},
+		},
+	}
+	err = j.Validate(ds)
+	assert.Error(t, err)
+
+	// ambiguous task name
+	j = Job{
+		Name: "test job",
+		Tasks: []Task{
+			{Name: "a", Image: "some:image"},
+			{Name: "a", Image: "some:image"},
+			{Name: "b", Image: "some:image", DependsOn: []string{"a"}},
+		},
+	}
+	err = j.Validate(ds)
+	assert.Error(t, err)
+
+	// dependencies are not supported within a parallel task
+	j = Job{
+		Name: "test job",
+		Tasks: []Task{
+			{
+				Name: "a",
+				Parallel: &Parallel{
+					Tasks: []Task{
+						{Name: "b", Image: "some:image"},
+						{Name: "c", Image: "some:image", DependsOn: []string{"b"}},
+					},
+				},
+			},
+		},
+	}
+	err = j.Validate(ds)
+	assert.Error(t, err)
+
+	// sub-job cycle
+	j = Job{
+		Name: "test job",
+		Tasks: []Task{
+			{
+				Name: "a",
+				SubJob: &SubJob{
+					Name: "sub job",
+					Tasks: []Task{
+						{Name: "b", Image: "some:image", DependsOn: []string{"c"}},
+						{Name: "c", Image: "some:image", DependsOn: []string{"b"}},
+					},
+				},
+			},
+		},
+	}
+	err = j.Validate(ds)
+	assert.Error(t, err)
+	assert.NoError(t, ds.Close())
+}
+
+func TestValidateTrigger(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	job := &Job{
+		Name: "test job",
+		Tasks: []Task{
+			{
+				Name:  "test task",
+				Image: "some:image",
+			},
+		},
+	}
+	tests := []struct {
+		name      string
+		trigger   Trigger
+		shouldErr bool
+	}{
+		{"Valid", Trigger{Name: "git-push", Job: job}, false},
+		{"Missing name", Trigger{Job: job}, true},
+		{"Invalid name", Trigger{Name: "git push/main", Job: job}, true},
+		{"Missing job", Trigger{Name: "git-push"}, true},
+		{"Invalid job", Trigger{Name: "git-push", Job: &Job{Name: "test job"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.trigger.Validate(ds)
+			if tt.shouldErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func TestValidateTemplate(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	job := &Job{
+		Name: "test job",
+		Tasks: []Task{
+			{
+				Name:  "test task",
+				Image: "some:image",
+			},
+		},
+	}
+	tests := []struct {
+		name      string
+		template  Template
+		shouldErr bool
+	}{
+		{"Valid", Template{Name: "transcode", Job: job}, false},
+		{"Valid parameters", Template{Name: "transcode", Job: job, Parameters: []TemplateParameter{
+			{Name: "width", Input: Input{Type: "int", Default: "1280"}},
+			{Name: "quality", Input: Input{Enum: []string{"low", "high"}, Default: "low"}},
+			{Name: "files", Input: Input{Type: "list", Default: `["a.jpg"]`}},
+		}}, false},
+		{"Missing name", Template{Job: job}, true},
+		{"Invalid name", Template{Name: "transcode@1", Job: job}, true},
+		{"Missing job", Template{Name: "transcode"}, true},
+		{"Invalid job", Template{Name: "transcode", Job: &Job{Name: "test job"}}, true},
+		{"Missing parameter name", Template{Name: "transcode", Job: job, Parameters: []TemplateParameter{{Input: Input{Type: "int"}}}}, true},
+		{"Invalid parameter type", Template{Name: "transcode", Job: job, Parameters: []TemplateParameter{{Name: "width", Input: Input{Type: "number"}}}}, true},
+		{"Invalid parameter pattern", Template{Name: "transcode", Job: job, Parameters: []TemplateParameter{{Name: "prefix", Input: Input{Pattern: "(("}}}}, true},
+		{"Default not matching pattern", Template{Name: "transcode", Job: job, Parameters: []TemplateParameter{{Name: "prefix", Input: Input{Pattern: "^out/", Default: "tmp/"}}}}, true},
+		{"Duplicate parameter", Template{Name: "transcode", Job: job, Parameters: []TemplateParameter{{Name: "width"}, {Name: "width"}}}, true},
+		{"Invalid default", Template{Name: "transcode", Job: job, Parameters: []TemplateParameter{{Name: "width", Input: Input{Type: "int", Default: "wide"}}}}, true},
+		{"Default not in enum", Template{Name: "transcode", Job: job, Parameters: []TemplateParameter{{Name: "quality", Input: Input{Enum: []string{"low", "high"}, Default: "medium"}}}}, true},
+		{"Sub-job template", Template{Name: "transcode", Job: &Job{
+			Name: "test job",
+			Tasks: []Task{
+				{
+					Name:   "test task",
+					SubJob: &SubJob{Template: "other@1"},
+				},
+			},
+		}}, false},
+		{"Sub-job template and tasks", Template{Name: "transcode", Job: &Job{
+			Name: "test job",
+			Tasks: []Task{
+				{
+					Name: "test task",
+					SubJob: &SubJob{
+						Template: "other@1",
+						Tasks:    []Task{{Name: "test task", Image: "some:image"}},
+					},
+				},
+			},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.template.Validate(ds)
+			if tt.shouldErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func TestValidateInputSchema(t *testing.T) {
+	schema := map[string]Input{
+		"width":  {Type: "int", Required: true},
+		"dryRun": {Type: "bool", Default: "false"},
+		"files":  {Type: "list"},
+		"opts":   {Type: "json"},
+		"format": {Enum: []string{"jpg", "png"}, Default: "jpg"},
+		"bucket": {Pattern: "^s3://"},
+	}
+	tests := []struct {
+		name      string
+		inputs    map[string]string
+		shouldErr bool
+	}{
+		{"Valid", map[string]string{"width": "800"}, false},
+		{"All", map[string]string{
+			"width":  "800",
+			"dryRun": "true",
+			"files":  `["a.jpg","b.jpg"]`,
+			"opts":   `{"quality":90}`,
+			"format": "png",
+			"bucket": "s3://images",
+			"other":  "not declared",
+		}, false},
+		{"Missing required", map[string]string{}, true},
+		{"Invalid int", map[string]string{"width": "wide"}, true},
+		{"Invalid bool", map[string]string{"width": "800", "dryRun": "maybe"}, true},
+		{"Invalid list", map[string]string{"width": "800", "files": "a.jpg,b.jpg"}, true},
+		{"Invalid json", map[string]string{"width": "800", "opts": "{quality"}, true},
+		{"Not in enum", map[string]string{"width": "800", "format": "gif"}, true},
+		{"Pattern mismatch", map[string]string{"width": "800", "bucket": "gs://images"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := Job{
+				Name:        "test job",
+				Inputs:      tt.inputs,
+				InputSchema: schema,
+				Tasks: []Task{
+					{
+						Name:  "test task",
+						Image: "some:image",
+					},
+				},
+			}
+			err := j.Validate(nil)
+			if tt.shouldErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	j := Job{
+		Name:        "test job",
+		InputSchema: map[string]Input{"width": {Type: "int", Default: "wide"}},
+		Tasks:       []Task{{Name: "test task", Image: "some:image"}},
+	}
+	assert.Error(t, j.Validate(nil))
+	j.InputSchema = map[string]Input{"width": {Type: "float"}}
+	assert.Error(t, j.Validate(nil))
+	j.InputSchema = map[string]Input{"width": {Pattern: "[0-9"}}
+	assert.Error(t, j.Validate(nil))
+
+	// the inputs of a template are supplied when it's launched
+	tmpl := Template{
+		Name: "resize",
+		Job: &Job{
+			Name:        "test job",
+			InputSchema: map[string]Input{"width": {Type: "int", Required: true}},
+			Tasks:       []Task{{Name: "test task", Image: "some:image"}},
+		},
+	}
+	assert.NoError(t, tmpl.Validate(nil))
+
+	ji := Job{
+		Name:   "test job",
+		Inputs: map[string]string{"width": "800"},
+		InputSchema: map[string]Input{
+			"width":  {Type: "int"},
+			"dryRun": {Type: "bool", Default: "false"},
+			"name":   {Default: "image"},
+		},
+		Tasks: []Task{{Name: "test task", Image: "some:image"}},
+	}
+	j2 := ji.ToJob()
+	assert.Equal(t, map[string]string{"width": "800", "dryRun": "false", "name": "image"}, j2.Inputs)
+	assert.Equal(t, j2.Inputs, j2.Context.Inputs)
+	assert.Equal(t, map[string]string{"width": "int", "dryRun": "bool"}, j2.Context.InputTypes)
+	assert.Equal(t, map[string]string{"width": "800"}, ji.Inputs)
+}
@@ -2,6 +2,9 @@ package api
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,19 +19,27 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/health"
 
 	"github.com/runabol/tork/input"
+	"github.com/runabol/tork/internal/coordinator/handlers"
+	"github.com/runabol/tork/internal/eval"
 	"github.com/runabol/tork/internal/hash"
 	"github.com/runabol/tork/internal/httpx"
+	"github.com/runabol/tork/internal/metrics"
+	"github.com/runabol/tork/internal/tracing"
+	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
 	"github.com/runabol/tork/middleware/web"
 
 	"github.com/runabol/tork"
 
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/exp/maps"
 	"gopkg.in/yaml.v3"
 )
 
@@ -46,20 +57,30 @@ type API struct {
 	server     *http.Server
 	broker     broker.Broker
 	ds         datastore.Datastore
+	artifacts  artifact.Store
 	terminate  chan any
 	onReadJob  job.HandlerFunc
 	onReadTask task.HandlerFunc
+	hookLimit  int64
 }
 
 type Config struct {
-	Broker     broker.Broker
-	DataStore  datastore.Datastore
-	Address    string
-	Middleware Middleware
-	Endpoints  map[string]web.HandlerFunc
-	Enabled    map[string]bool
+	Broker        broker.Broker
+	DataStore     datastore.Datastore
+	ArtifactStore artifact.Store
+	Address       string
+	Middleware    Middleware
+	Endpoints     map[string]web.HandlerFunc
+	Enabled       map[string]bool
+	// HookBodyLimit is the maximum size, in bytes, of the body
+	// of an inbound webhook. Defaults to DefaultHookBodyLimit.
+	HookBodyLimit int64
 }
 
+// DefaultHookBodyLimit is the default maximum size,
+// in bytes, of the body of an inbound webhook.
+const DefaultHookBodyLimit = 4 * 1024 * 1024
+
 type Middleware struct {
 	Web  []web.MiddlewareFunc
 	Job  []job.MiddlewareFunc
@@ -90,6 +111,7 @@ func NewAPI(cfg Config) (*API, error) {
 			Handler: r,
 		},
 		ds:        cfg.DataStore,
+		artifacts: cfg.ArtifactStore,
 		terminate: make(chan any),
 		onReadJob: job.ApplyMiddleware(
 			job.NoOpHandlerFunc,
@@ -99,6 +121,10 @@ func NewAPI(cfg Config) (*API, error) {
 			task.NoOpHandlerFunc,
 			cfg.Middleware.Task,
 		),
+		hookLimit: cfg.HookBodyLimit,
+	}
+	if s.hookLimit <= 0 {
+		s.hookLimit = DefaultHookBodyLimit
 	}
 
 	// registering custom middleware
@@ -118,6 +144,7 @@ func NewAPI(cfg Config) (*API, error) {
 	if v, ok := cfg.Enabled["tasks"]; !ok || v {
 		r.GET("/tasks/:id", s.getTask)
 		r.GET("/tasks/:id/log", s.getTaskLog)
+		r.GET("/tasks/:id/log/stream", s.streamTaskLog)
 	}
 	if v, ok := cfg.Enabled["queues"]; !ok || v {
 		r.GET("/queues", s.listQueues)
@@ -129,16 +156,44 @@ func NewAPI(cfg Config) (*API, error) {
 		r.POST("/jobs", s.createJob)
 		r.GET("/jobs/:id", s.getJob)
 		r.GET("/jobs/:id/log", s.getJobLog)
+		r.GET("/jobs/:id/log/stream", s.streamJobLog)
+		r.GET("/jobs/:id/usage", s.getJobUsage)
+		r.GET("/events", s.streamEvents)
 		r.GET("/jobs", s.listJobs)
 		r.PUT("/jobs/:id/cancel", s.cancelJob)
 		r.PUT("/jobs/:id/restart", s.restartJob)
+		r.PUT("/jobs/:id/pause", s.pauseJob)
+		r.PUT("/jobs/:id/resume", s.resumeJob)
+		if s.artifacts != nil {
+			r.GET("/jobs/:id/artifacts", s.listJobArtifacts)
+			r.GET("/jobs/:id/artifacts/:name", s.getJobArtifact)
+		}
 
 		r.POST("/scheduled-jobs", s.createScheduledJob)
 		r.GET("/scheduled-jobs", s.listScheduledJobs)
+		r.GET("/scheduled-jobs/:id", s.getScheduledJob)
+		r.PUT("/scheduled-jobs/:id", s.updateScheduledJob)
+		r.POST("/scheduled-jobs/:id/trigger", s.triggerScheduledJob)
 		r.PUT("/scheduled-jobs/:id/pause", s.pauseScheduledJob)
 		r.PUT("/scheduled-jobs/:id/resume", s.resumeScheduledJob)
 		r.DELETE("/scheduled-jobs/:id", s.deleteScheduledJob)
 	}
+	if v, ok := cfg.Enabled["triggers"]; !ok || v {
+		r.POST("/triggers", s.createTrigger)
+		r.GET("/triggers", s.listTriggers)
+		r.GET("/triggers/:id", s.getTrigger)
+		r.PUT("/triggers/:id", s.updateTrigger)
+		r.DELETE("/triggers/:id", s.deleteTrigger)
+		r.POST("/hooks/:name", s.handleHook)
+	}
+	if v, ok := cfg.Enabled["templates"]; !ok || v {
+		r.POST("/templates", s.createTemplate)
+		r.GET("/templates", s.listTemplates)
+		r.GET("/templates/:name", s.getTemplate)
+		r.PUT("/templates/:name", s.updateTemplate)
+		r.DELETE("/templates/:name", s.deleteTemplate)
+		r.POST("/templates/:name/run", s.runTemplate)
+	}
 	if v, ok := cfg.Enabled["metrics"]; !ok || v {
 		r.GET("/metrics", s.getMetrics)
 	}
@@ -252,6 +307,9 @@ func (s *API) listActiveNodes(c echo.Context) error {
 // @Router /jobs [post]
 // @Param request body input.Job true "body"
 func (s *API) createJob(c echo.Context) error {
+	// join the trace of the caller, if any
+	ctx := tracing.Extract(c.Request().Context(), c.Request().Header.Get("traceparent"))
+	c.SetRequest(c.Request().WithContext(ctx))
 	contentType := c.Request().Header.Get("content-type")
 	var ji input.Job
 	switch contentType {
@@ -314,6 +372,20 @@ func (s *API) createJob(c echo.Context) error {
 }
 
 func (s *API) SubmitJob(ctx context.Context, ji *input.Job) (*tork.Job, error) {
+	// the span of the submission is the root of the job's trace
+	ctx, span := tracing.Start(ctx, "job.submit")
+	j, err := s.submitJob(ctx, ji)
+	if j != nil {
+		span.SetAttributes(attribute.String("tork.job.id", j.ID))
+	}
+	tracing.End(span, err)
+	return j, err
+}
+
+func (s *API) submitJob(ctx context.Context, ji *input.Job) (*tork.Job, error) {
+	if err := ji.ResolveTemplates(ctx, s.ds); err != nil {
+		return nil, err
+	}
 	if err := ji.Validate(s.ds); err != nil {
 		return nil, err
 	}
@@ -330,6 +402,7 @@ func (s *API) SubmitJob(ctx context.Context, ji *input.Job) (*tork.Job, error) {
 		}
 		j.CreatedBy = u
 	}
+	j.TraceParent = tracing.TraceParent(ctx)
 	if err := s.ds.CreateJob(ctx, j); err != nil {
 		return nil, err
 	}
@@ -383,6 +456,7 @@ func (s *API) getJob(c echo.Context) error {
 	if err := s.onReadJob(ctx, job.Read, j); err != nil {
 		return err
 	}
+	j.Usage = tork.NewJobUsage(j.Execution)
 	return c.JSON(http.StatusOK, j)
 }
 
@@ -434,6 +508,58 @@ func (s *API) getJobLog(c echo.Context) error {
 	return c.JSON(http.StatusOK, l)
 }
 
+// listJobArtifacts
+// @Summary Get the artifacts produced by a job's tasks
+// @Tags jobs
+// @Produce application/json
+// @Success 200 {object} []tork.Artifact
+// @Failure 404 {object} echo.HTTPError
+// @Router /jobs/{id}/artifacts [get]
+// @Param id path string true "Job ID"
+func (s *API) listJobArtifacts(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if _, err := s.ds.GetJobByID(ctx, id); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	artifacts, err := s.artifacts.List(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, artifacts)
+}
+
+// getJobArtifact
+// @Summary Download an artifact produced by a job's task, as a tar archive
+// @Tags jobs
+// @Produce application/x-tar
+// @Success 200
+// @Failure 404 {object} echo.HTTPError
+// @Router /jobs/{id}/artifacts/{name} [get]
+// @Param id path string true "Job ID"
+// @Param name path string true "Artifact name"
+func (s *API) getJobArtifact(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	name := c.Param("name")
+	if _, err := s.ds.GetJobByID(ctx, id); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if !artifact.ValidName(name) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid artifact name: %s", name))
+	}
+	r, err := s.artifacts.Get(ctx, id, name)
+	if err != nil {
+		if errors.Is(err, artifact.ErrArtifactNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return err
+	}
+	defer r.Close()
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name+".tar"))
+	return c.Stream(http.StatusOK, "application/x-tar", r)
+}
+
 // listJobs
 // @Summary Show a list of jobs
 // @Tags jobs
@@ -515,6 +641,9 @@ func (s *API) createScheduledJob(c echo.Context) error {
 }
 
 func (s *API) submitScheduledJob(ctx context.Context, ji *input.ScheduledJob) (*tork.ScheduledJob, error) {
+	if err := ji.ResolveTemplates(ctx, s.ds); err != nil {
+		return nil, err
+	}
 	if err := ji.Validate(s.ds); err != nil {
 		return nil, err
 	}
@@ -587,6 +716,141 @@ func (s *API) listScheduledJobs(c echo.Context) error {
 	})
 }
 
+func (s *API) getScheduledJob(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	sj, err := s.ds.GetScheduledJobByID(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	// run the scheduled job's definition through the
+	// job read middleware so secrets get redacted
+	view := &tork.Job{
+		ID:       sj.ID,
+		Name:     sj.Name,
+		Inputs:   sj.Inputs,
+		Secrets:  sj.Secrets,
+		Tasks:    sj.Tasks,
+		Webhooks: sj.Webhooks,
+		Schedule: &tork.JobSchedule{
+			ID:   sj.ID,
+			Cron: sj.Cron,
+		},
+	}
+	if err := s.onReadJob(ctx, job.Read, view); err != nil {
+		return err
+	}
+	sj.Inputs = view.Inputs
+	sj.Secrets = view.Secrets
+	sj.Tasks = view.Tasks
+	sj.Webhooks = view.Webhooks
+	return c.JSON(http.StatusOK, sj)
+}
+
+func (s *API) updateScheduledJob(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if _, err := s.ds.GetScheduledJobByID(ctx, id); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	contentType := c.Request().Header.Get("content-type")
+	var ji input.ScheduledJob
+	switch contentType {
+	case "application/json":
+		if err := bindInputJSON(&ji, c.Request().Body); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	case "text/yaml":
+		if err := bindInputYAML(&ji, c.Request().Body); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown content type: %s", contentType))
+	}
+	if err := ji.ResolveTemplates(ctx, s.ds); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := ji.Validate(s.ds); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if len(ji.Permissions) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "the permissions of a scheduled job can not be updated")
+	}
+	sj := ji.ToScheduledJob()
+	if err := s.ds.UpdateScheduledJob(ctx, id, func(u *tork.ScheduledJob) error {
+		u.Name = sj.Name
+		u.Description = sj.Description
+		u.Tags = sj.Tags
+		u.Cron = sj.Cron
+		u.Timezone = sj.Timezone
+		u.Overlap = sj.Overlap
+		u.CatchUp = sj.CatchUp
+		u.Trigger = sj.Trigger
+		u.Inputs = sj.Inputs
+		u.InputSchema = sj.InputSchema
+		u.Secrets = sj.Secrets
+		u.Tasks = sj.Tasks
+		u.Output = sj.Output
+		u.Defaults = sj.Defaults
+		u.Webhooks = sj.Webhooks
+		u.AutoDelete = sj.AutoDelete
+		return nil
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	updated, err := s.ds.GetScheduledJobByID(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	// reschedule the job on all the coordinators
+	if updated.State == tork.ScheduledJobStateActive {
+		if err := s.broker.PublishEvent(ctx, broker.TOPIC_SCHEDULED_JOB, updated); err != nil {
+			return err
+		}
+	}
+	return c.JSON(http.StatusOK, tork.NewScheduledJobSummary(updated))
+}
+
+type triggerScheduledJobRequest struct {
+	Inputs map[string]string `json:"inputs,omitempty"`
+}
+
+func (s *API) triggerScheduledJob(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	sj, err := s.ds.GetScheduledJobByID(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	req := triggerScheduledJobRequest{}
+	if c.Request().ContentLength != 0 {
+		if err := bindInputJSON(&req, c.Request().Body); err != nil && err != io.EOF {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	j := tork.NewScheduledJobInstance(sj)
+	j.ID = uuid.NewUUID()
+	if len(req.Inputs) > 0 {
+		inputs := maps.Clone(sj.Inputs)
+		if inputs == nil {
+			inputs = make(map[string]string)
+		}
+		maps.Copy(inputs, req.Inputs)
+		j.Inputs = inputs
+		j.Context.Inputs = inputs
+	}
+	if err := tork.CheckInputs(sj.InputSchema, j.Inputs); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := handlers.StartScheduledJobInstance(ctx, s.ds, s.broker, sj, j); err != nil {
+		if errors.Is(err, handlers.ErrInstanceSkipped) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, tork.NewJobSummary(j))
+}
+
 func (s *API) pauseScheduledJob(c echo.Context) error {
 	id := c.Param("id")
 	j, err := s.ds.GetScheduledJobByID(c.Request().Context(), id)
@@ -651,6 +915,474 @@ func (s *API) deleteScheduledJob(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
 }
 
+func (s *API) createTrigger(c echo.Context) error {
+	ctx := c.Request().Context()
+	ti, err := bindTrigger(c)
+	if err != nil {
+		return err
+	}
+	if err := ti.Validate(s.ds); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if _, err := s.ds.GetTrigger(ctx, ti.Name); err == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("trigger %s already exists", ti.Name))
+	} else if !errors.Is(err, datastore.ErrTriggerNotFound) {
+		return err
+	}
+	t, err := ti.ToTrigger()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	currentUser := ctx.Value(tork.USERNAME)
+	if currentUser != nil {
+		cu, ok := currentUser.(string)
+		if !ok {
+			return errors.Errorf("error casting current user")
+		}
+		u, err := s.ds.GetUser(ctx, cu)
+		if err != nil {
+			return err
+		}
+		t.CreatedBy = u
+	}
+	if err := s.ds.CreateTrigger(ctx, t); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := redactTrigger(t); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+func (s *API) listTriggers(c echo.Context) error {
+	ts, err := s.ds.GetTriggers(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	for _, t := range ts {
+		if err := redactTrigger(t); err != nil {
+			return err
+		}
+	}
+	return c.JSON(http.StatusOK, ts)
+}
+
+func (s *API) getTrigger(c echo.Context) error {
+	t, err := s.ds.GetTrigger(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := redactTrigger(t); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+func (s *API) updateTrigger(c echo.Context) error {
+	ctx := c.Request().Context()
+	existing, err := s.ds.GetTrigger(ctx, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	ti, err := bindTrigger(c)
+	if err != nil {
+		return err
+	}
+	if err := ti.Validate(s.ds); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if ti.ClearSecret && ti.Secret != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "secret and clearSecret are mutually exclusive")
+	}
+	if other, err := s.ds.GetTrigger(ctx, ti.Name); err == nil && other.ID != existing.ID {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("trigger %s already exists", ti.Name))
+	}
+	t, err := ti.ToTrigger()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := s.ds.UpdateTrigger(ctx, existing.ID, func(u *tork.Trigger) error {
+		u.Name = t.Name
+		u.Description = t.Description
+		// the secret is never returned by the API so an update
+		// which omits it keeps the current one
+		if t.Secret != "" {
+			u.Secret = t.Secret
+		} else if ti.ClearSecret {
+			u.Secret = ""
+		}
+		u.Inputs = t.Inputs
+		u.Job = t.Job
+		return nil
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	updated, err := s.ds.GetTrigger(ctx, existing.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := redactTrigger(updated); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, updated)
+}
+
+func (s *API) deleteTrigger(c echo.Context) error {
+	ctx := c.Request().Context()
+	t, err := s.ds.GetTrigger(ctx, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := s.ds.DeleteTrigger(ctx, t.ID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// handleHook
+// @Summary Launch the job of a trigger from an inbound webhook
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.JobSummary
+// @Router /hooks/{name} [post]
+// @Param name path string true "Trigger name"
+func (s *API) handleHook(c echo.Context) error {
+	ctx := c.Request().Context()
+	t, err := s.ds.GetTrigger(ctx, c.Param("name"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	// the hook can be called by anyone, so its body
+	// is capped before its signature is checked
+	body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, s.hookLimit))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("the body exceeds the limit of %d bytes", s.hookLimit))
+		}
+		return err
+	}
+	if t.Secret != "" && !validSignature(t.Secret, body, c.Request().Header) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid signature")
+	}
+	var payload any
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	headers := make(map[string]string)
+	for k := range c.Request().Header {
+		headers[strings.ToLower(k)] = c.Request().Header.Get(k)
+	}
+	var ji input.Job
+	if err := json.Unmarshal(t.Job, &ji); err != nil {
+		return errors.Wrapf(err, "error deserializing the job of trigger %s", t.Name)
+	}
+	inputs := maps.Clone(ji.Inputs)
+	if inputs == nil {
+		inputs = make(map[string]string)
+	}
+	for k, ex := range t.Inputs {
+		v, err := eval.EvaluateTemplate(ex, map[string]any{
+			"body":    payload,
+			"headers": headers,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		inputs[k] = v
+	}
+	ji.Inputs = inputs
+	// the job is launched on behalf of the trigger's creator
+	if t.CreatedBy != nil {
+		ctx = context.WithValue(ctx, tork.USERNAME, t.CreatedBy.Username)
+	}
+	j, err := s.SubmitJob(ctx, &ji)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, tork.NewJobSummary(j))
+}
+
+func bindTrigger(c echo.Context) (*input.Trigger, error) {
+	contentType := c.Request().Header.Get("content-type")
+	var ti input.Trigger
+	switch contentType {
+	case "application/json":
+		if err := bindInputJSON(&ti, c.Request().Body); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	case "text/yaml", "application/x-yaml":
+		if err := bindInputYAML(&ti, c.Request().Body); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	default:
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown content type: %s", contentType))
+	}
+	return &ti, nil
+}
+
+// validSignature verifies the HMAC-SHA256 signature of an inbound
+// webhook's payload. The signature is expected as a hex digest
+// prefixed with "sha256=" in either the X-Tork-Signature-256 or
+// the X-Hub-Signature-256 (GitHub) header.
+func validSignature(secret string, body []byte, h http.Header) bool {
+	sig := h.Get("X-Tork-Signature-256")
+	if sig == "" {
+		sig = h.Get("X-Hub-Signature-256")
+	}
+	digest, ok := strings.CutPrefix(sig, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// createTemplate
+// @Summary Create the first version of a job template
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.Template
+// @Router /templates [post]
+func (s *API) createTemplate(c echo.Context) error {
+	ctx := c.Request().Context()
+	ti, err := bindTemplate(c)
+	if err != nil {
+		return err
+	}
+	if _, err := s.ds.GetTemplate(ctx, ti.Name, 0); err == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("template %s already exists", ti.Name))
+	} else if !errors.Is(err, datastore.ErrTemplateNotFound) {
+		return err
+	}
+	t, err := s.createTemplateVersion(ctx, ti, 1)
+	if err != nil {
+		return err
+	}
+	if err := redactTemplate(t); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+func (s *API) listTemplates(c echo.Context) error {
+	ts, err := s.ds.GetTemplates(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	for _, t := range ts {
+		if err := redactTemplate(t); err != nil {
+			return err
+		}
+	}
+	return c.JSON(http.StatusOK, ts)
+}
+
+// getTemplate
+// @Summary Get a job template by name
+// @Tags templates
+// @Produce json
+// @Success 200 {object} tork.Template
+// @Router /templates/{name} [get]
+// @Param name path string true "Template name, optionally followed by @version"
+func (s *API) getTemplate(c echo.Context) error {
+	t, err := s.lookupTemplate(c)
+	if err != nil {
+		return err
+	}
+	if err := redactTemplate(t); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+// updateTemplate
+// @Summary Create a new version of a job template
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.Template
+// @Router /templates/{name} [put]
+// @Param name path string true "Template name"
+func (s *API) updateTemplate(c echo.Context) error {
+	ctx := c.Request().Context()
+	latest, err := s.ds.GetTemplate(ctx, c.Param("name"), 0)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	ti, err := bindTemplate(c)
+	if err != nil {
+		return err
+	}
+	if ti.Name != latest.Name {
+		return echo.NewHTTPError(http.StatusBadRequest, "the name of a template can not be updated")
+	}
+	t, err := s.createTemplateVersion(ctx, ti, latest.Version+1)
+	if err != nil {
+		return err
+	}
+	if err := redactTemplate(t); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+// deleteTemplate
+// @Summary Delete a job template or one of its versions
+// @Tags templates
+// @Produce json
+// @Router /templates/{name} [delete]
+// @Param name path string true "Template name, optionally followed by @version"
+func (s *API) deleteTemplate(c echo.Context) error {
+	name, version, err := tork.ParseTemplateRef(c.Param("name"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := s.ds.DeleteTemplate(c.Request().Context(), name, version); err != nil {
+		if errors.Is(err, datastore.ErrTemplateNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// runTemplate
+// @Summary Launch a job from a template
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.JobSummary
+// @Router /templates/{name}/run [post]
+// @Param name path string true "Template name, optionally followed by @version"
+func (s *API) runTemplate(c echo.Context) error {
+	t, err := s.lookupTemplate(c)
+	if err != nil {
+		return err
+	}
+	req := struct {
+		Inputs map[string]string `json:"inputs,omitempty"`
+	}{}
+	if c.Request().ContentLength != 0 {
+		if err := bindInputJSON(&req, c.Request().Body); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	ji, err := input.NewTemplateJob(t, req.Inputs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	j, err := s.SubmitJob(c.Request().Context(), ji)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, tork.NewJobSummary(j))
+}
+
+// lookupTemplate returns the template referenced by
+// the name path param (name or name@version).
+func (s *API) lookupTemplate(c echo.Context) (*tork.Template, error) {
+	name, version, err := tork.ParseTemplateRef(c.Param("name"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	t, err := s.ds.GetTemplate(c.Request().Context(), name, version)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return t, nil
+}
+
+func (s *API) createTemplateVersion(ctx context.Context, ti *input.Template, version int) (*tork.Template, error) {
+	if err := ti.Validate(s.ds); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	t, err := ti.ToTemplate()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	t.Version = version
+	currentUser := ctx.Value(tork.USERNAME)
+	if currentUser != nil {
+		cu, ok := currentUser.(string)
+		if !ok {
+			return nil, errors.Errorf("error casting current user")
+		}
+		u, err := s.ds.GetUser(ctx, cu)
+		if err != nil {
+			return nil, err
+		}
+		t.CreatedBy = u
+	}
+	if err := s.ds.CreateTemplate(ctx, t); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return t, nil
+}
+
+func bindTemplate(c echo.Context) (*input.Template, error) {
+	contentType := c.Request().Header.Get("content-type")
+	var ti input.Template
+	switch contentType {
+	case "application/json":
+		if err := bindInputJSON(&ti, c.Request().Body); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	case "text/yaml", "application/x-yaml":
+		if err := bindInputYAML(&ti, c.Request().Body); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	default:
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown content type: %s", contentType))
+	}
+	return &ti, nil
+}
+
+// redactTrigger redacts the secrets of the trigger's
+// job definition.
+func redactTrigger(t *tork.Trigger) error {
+	job, err := redactJobDefinition(t.Job)
+	if err != nil {
+		return errors.Wrapf(err, "error redacting the job of trigger %s", t.Name)
+	}
+	t.Job = job
+	return nil
+}
+
+// redactTemplate redacts the secrets of the template's
+// job definition.
+func redactTemplate(t *tork.Template) error {
+	job, err := redactJobDefinition(t.Job)
+	if err != nil {
+		return errors.Wrapf(err, "error redacting the job of template %s", t.Name)
+	}
+	t.Job = job
+	return nil
+}
+
+func redactJobDefinition(def json.RawMessage) (json.RawMessage, error) {
+	var ji input.Job
+	if err := json.Unmarshal(def, &ji); err != nil {
+		return nil, err
+	}
+	if len(ji.Secrets) == 0 {
+		return def, nil
+	}
+	for k := range ji.Secrets {
+		ji.Secrets[k] = "[REDACTED]"
+	}
+	return json.Marshal(ji)
+}
+
 // getTask
 // @Summary Get a task by id
 // @Tags tasks
@@ -718,12 +1450,41 @@ func (s *API) getTaskLog(c echo.Context) error {
 	return c.JSON(http.StatusOK, l)
 }
 
+// getMetrics
+// @Summary Get the metrics
+// @Description Returns a summary of the running jobs, tasks and nodes. Clients which
+// @Description accept text/plain (e.g. Prometheus) get all the metrics in the Prometheus text format.
+// @Produce application/json
+// @Produce text/plain
+// @Success 200 {object} tork.Metrics
+// @Router /metrics [get]
 func (s *API) getMetrics(c echo.Context) error {
-	metrics, err := s.ds.GetMetrics(c.Request().Context())
+	m, err := s.ds.GetMetrics(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	if !strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/openmetrics-text") {
+		return c.JSON(http.StatusOK, m)
+	}
+	nodes, err := s.ds.GetActiveNodes(c.Request().Context())
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-	return c.JSON(http.StatusOK, metrics)
+	metrics.NodeRunningTasks.ReplaceAll(func(set func(v float64, labelValues ...string)) {
+		for _, n := range nodes {
+			if n.Status == tork.NodeStatusUP {
+				set(float64(n.TaskCount), n.ID)
+			}
+		}
+	})
+	metrics.JobsRunning.Set(float64(m.Jobs.Running))
+	metrics.TasksRunning.Set(float64(m.Tasks.Running))
+	metrics.NodesOnline.Set(float64(m.Nodes.Running))
+	metrics.NodesCPUPercent.Set(m.Nodes.CPUPercent)
+	c.Response().Header().Set(echo.HeaderContentType, metrics.ContentType)
+	c.Response().WriteHeader(http.StatusOK)
+	return metrics.Write(c.Response())
 }
 
 // Job
@@ -771,7 +1532,10 @@ func (s *API) cancelJob(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
-	if j.State != tork.JobStateRunning && j.State != tork.JobStateScheduled {
+	if j.State != tork.JobStateRunning &&
+		j.State != tork.JobStateScheduled &&
+		j.State != tork.JobStatePaused &&
+		j.State != tork.JobStateQueued {
 		return echo.NewHTTPError(http.StatusBadRequest, "job is not running")
 	}
 	j.State = tork.JobStateCancelled
@@ -782,6 +1546,60 @@ func (s *API) cancelJob(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
 }
 
+// Job
+// @Summary Pause a running job
+// @Tags jobs
+// @Produce application/json
+// @Success 200 {string} string "OK"
+// @Router /jobs/{id}/pause [put]
+// @Param id path string true "Job ID"
+// @Failure 404 {object} echo.HTTPError
+// @Failure 400 {object} echo.HTTPError
+func (s *API) pauseJob(c echo.Context) error {
+	id := c.Param("id")
+	log.Debug().Msgf("pause job %s", id)
+	j, err := s.ds.GetJobByID(c.Request().Context(), id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if j.State != tork.JobStateRunning && j.State != tork.JobStateScheduled {
+		return echo.NewHTTPError(http.StatusBadRequest, "job is not running")
+	}
+	j.State = tork.JobStatePaused
+	if err := s.broker.PublishJob(c.Request().Context(), j); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// Job
+// @Summary Resume a paused job
+// @Tags jobs
+// @Produce application/json
+// @Success 200 {string} string "OK"
+// @Router /jobs/{id}/resume [put]
+// @Param id path string true "Job ID"
+// @Failure 404 {object} echo.HTTPError
+// @Failure 400 {object} echo.HTTPError
+func (s *API) resumeJob(c echo.Context) error {
+	id := c.Param("id")
+	log.Debug().Msgf("resume job %s", id)
+	j, err := s.ds.GetJobByID(c.Request().Context(), id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if j.State != tork.JobStatePaused {
+		return echo.NewHTTPError(http.StatusBadRequest, "job is not paused")
+	}
+	j.State = tork.JobStateResume
+	if err := s.broker.PublishJob(c.Request().Context(), j); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
 // createUser
 // @Summary Create a new user
 // @Tags users
@@ -2,6 +2,9 @@ package api
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,8 +18,12 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/redact"
+	"github.com/runabol/tork/middleware/job"
+	"github.com/runabol/tork/middleware/task"
 	"github.com/runabol/tork/middleware/web"
 
 	"github.com/runabol/tork/broker"
@@ -163,6 +170,48 @@ func Test_getActiveNodes(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_getMetrics(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	n := &tork.Node{
+		ID:              uuid.NewShortUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC(),
+		TaskCount:       3,
+	}
+	err = ds.CreateNode(context.Background(), n)
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	m := tork.Metrics{}
+	err = json.Unmarshal(w.Body.Bytes(), &m)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, m.Nodes.Running, 1)
+
+	req, err = http.NewRequest("GET", "/metrics", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "text/plain;version=0.0.4;q=0.3,*/*;q=0.2")
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE tork_jobs_total counter\n")
+	assert.Contains(t, body, "# TYPE tork_task_run_seconds histogram\n")
+	assert.Contains(t, body, fmt.Sprintf("tork_node_running_tasks{node=\"%s\"} 3\n", n.ID))
+	assert.Contains(t, body, "tork_nodes_online ")
+	assert.NoError(t, ds.Close())
+}
+
 func Test_healthOK(t *testing.T) {
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
@@ -313,6 +362,33 @@ func Test_createJob(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_createJobInvalidInputs(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("POST", "/jobs", strings.NewReader(`{
+		"name":"test job",
+		"inputs":{"width":"wide"},
+		"inputSchema":{"width":{"type":"int"}},
+		"tasks":[{
+			"name":"test task",
+			"image":"some:image"
+		}]
+	}`))
+	req.Header.Add("Content-Type", "application/json")
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid input width")
+	assert.NoError(t, ds.Close())
+}
+
 func Test_createJobInvalidProperty(t *testing.T) {
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
@@ -366,7 +442,7 @@ func Test_getJob(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
-func Test_cancelRunningJob(t *testing.T) {
+func Test_getJobUsage(t *testing.T) {
 	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
@@ -377,462 +453,630 @@ func Test_cancelRunningJob(t *testing.T) {
 	}
 	err = ds.CreateJob(ctx, &j1)
 	assert.NoError(t, err)
-
 	now := time.Now().UTC()
-
-	tasks := []tork.Task{{
-		ID:        uuid.NewUUID(),
-		State:     tork.TaskStatePending,
-		CreatedAt: &now,
-		JobID:     j1.ID,
-	}, {
+	tasks := []*tork.Task{{
 		ID:        uuid.NewUUID(),
-		State:     tork.TaskStateScheduled,
-		CreatedAt: &now,
 		JobID:     j1.ID,
-	}, {
-		ID:        uuid.NewUUID(),
-		State:     tork.TaskStateRunning,
+		Name:      "attempt 1",
+		State:     tork.TaskStateFailed,
 		CreatedAt: &now,
-		JobID:     j1.ID,
+		StartedAt: &now,
+		Usage: &tork.TaskUsage{
+			WallSeconds: 2,
+			CPUSeconds:  1,
+			MemoryPeak:  2048,
+			DiskRead:    100,
+		},
 	}, {
 		ID:        uuid.NewUUID(),
-		State:     tork.TaskStateCancelled,
-		CreatedAt: &now,
 		JobID:     j1.ID,
-	}, {
-		ID:        uuid.NewUUID(),
+		Name:      "attempt 2",
 		State:     tork.TaskStateCompleted,
 		CreatedAt: &now,
-		JobID:     j1.ID,
+		StartedAt: &now,
+		Limits:    &tork.TaskLimits{Memory: "10MB"},
+		Usage: &tork.TaskUsage{
+			WallSeconds: 3,
+			CPUSeconds:  2.5,
+			MemoryPeak:  1024,
+			DiskRead:    50,
+			NetworkTx:   10,
+		},
 	}, {
 		ID:        uuid.NewUUID(),
-		State:     tork.TaskStateFailed,
-		CreatedAt: &now,
 		JobID:     j1.ID,
+		Name:      "not started yet",
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
 	}}
-
-	for _, ta := range tasks {
-		err := ds.CreateTask(ctx, &ta)
+	for _, tk := range tasks {
+		err := ds.CreateTask(ctx, tk)
 		assert.NoError(t, err)
 	}
-
 	api, err := NewAPI(Config{
 		DataStore: ds,
 		Broker:    broker.NewInMemoryBroker(),
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/cancel", j1.ID), nil)
+
+	expected := tork.JobUsage{
+		TaskUsage: tork.TaskUsage{
+			WallSeconds: 5,
+			CPUSeconds:  3.5,
+			MemoryPeak:  2048,
+			DiskRead:    150,
+			NetworkTx:   10,
+		},
+		Tasks: 2,
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("/jobs/%s", j1.ID), nil)
 	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	j := tork.Job{}
+	err = json.Unmarshal(w.Body.Bytes(), &j)
 	assert.NoError(t, err)
+	assert.NotNil(t, j.Usage)
+	assert.Equal(t, expected, *j.Usage)
 
+	req, err = http.NewRequest("GET", fmt.Sprintf("/jobs/%s/usage", j1.ID), nil)
 	assert.NoError(t, err)
-	assert.Equal(t, "{\"status\":\"OK\"}\n", string(body))
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
+	u := jobUsage{}
+	err = json.Unmarshal(w.Body.Bytes(), &u)
+	assert.NoError(t, err)
+	assert.Equal(t, j1.ID, u.JobID)
+	assert.Equal(t, expected, *u.Total)
+	assert.Len(t, u.Tasks, 3)
+	usages := make(map[string]*taskUsage)
+	for _, tu := range u.Tasks {
+		usages[tu.ID] = tu
+	}
+	assert.Equal(t, tasks[1].Usage, usages[tasks[1].ID].Usage)
+	assert.Equal(t, "10MB", usages[tasks[1].ID].Limits.Memory)
+	assert.Nil(t, usages[tasks[2].ID].Usage)
+
+	req, err = http.NewRequest("GET", "/jobs/no-such-job/usage", nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.NoError(t, ds.Close())
 }
 
-func Test_cancelScheduledJob(t *testing.T) {
+func Test_streamTaskLog(t *testing.T) {
 	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+	logStreamCheckInterval = time.Millisecond * 50
+
 	j1 := tork.Job{
 		ID:        uuid.NewUUID(),
-		State:     tork.JobStateScheduled,
+		State:     tork.JobStateRunning,
 		CreatedAt: time.Now().UTC(),
 	}
 	err = ds.CreateJob(ctx, &j1)
 	assert.NoError(t, err)
-
 	now := time.Now().UTC()
-
-	tasks := []tork.Task{{
+	tk := tork.Task{
 		ID:        uuid.NewUUID(),
-		State:     tork.TaskStatePending,
-		CreatedAt: &now,
-		JobID:     j1.ID,
-	}, {
-		ID:        uuid.NewUUID(),
-		State:     tork.TaskStateScheduled,
-		CreatedAt: &now,
 		JobID:     j1.ID,
-	}, {
-		ID:        uuid.NewUUID(),
 		State:     tork.TaskStateRunning,
 		CreatedAt: &now,
-		JobID:     j1.ID,
-	}, {
-		ID:        uuid.NewUUID(),
-		State:     tork.TaskStateCancelled,
-		CreatedAt: &now,
-		JobID:     j1.ID,
-	}, {
-		ID:        uuid.NewUUID(),
-		State:     tork.TaskStateCompleted,
-		CreatedAt: &now,
-		JobID:     j1.ID,
-	}, {
-		ID:        uuid.NewUUID(),
-		State:     tork.TaskStateFailed,
-		CreatedAt: &now,
-		JobID:     j1.ID,
-	}}
-
-	for _, ta := range tasks {
-		err := ds.CreateTask(ctx, &ta)
-		assert.NoError(t, err)
 	}
+	err = ds.CreateTask(ctx, &tk)
+	assert.NoError(t, err)
+	err = ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{TaskID: tk.ID, Number: 1, Contents: "line 1"})
+	assert.NoError(t, err)
 
 	api, err := NewAPI(Config{
 		DataStore: ds,
-		Broker:    broker.NewInMemoryBroker(),
+		Broker:    b,
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/cancel", j1.ID), nil)
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		// a part of another task
+		err := b.PublishEvent(ctx, broker.TOPIC_LOG_PART, &tork.TaskLogPart{TaskID: uuid.NewUUID(), Number: 1, Contents: "other"})
+		assert.NoError(t, err)
+		p2 := &tork.TaskLogPart{TaskID: tk.ID, Number: 2, Contents: "line 2"}
+		err = b.PublishEvent(ctx, broker.TOPIC_LOG_PART, p2)
+		assert.NoError(t, err)
+		time.Sleep(time.Millisecond * 100)
+		err = ds.UpdateTask(ctx, tk.ID, func(u *tork.Task) error {
+			u.State = tork.TaskStateCompleted
+			return nil
+		})
+		assert.NoError(t, err)
+	}()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("/tasks/%s/log/stream", tk.ID), nil)
 	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
-	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Equal(t, 2, strings.Count(body, "event: log\n"))
+	assert.Less(t, strings.Index(body, `"line 1"`), strings.Index(body, `"line 2"`))
+	assert.NotContains(t, body, "other")
+	assert.True(t, strings.HasSuffix(body, "event: end\ndata: {\"state\":\"COMPLETED\"}\n\n"))
 
+	req, err = http.NewRequest("GET", "/tasks/no-such-task/log/stream", nil)
 	assert.NoError(t, err)
-	assert.Equal(t, "{\"status\":\"OK\"}\n", string(body))
-	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.NoError(t, ds.Close())
 }
 
-func Test_restartJob(t *testing.T) {
+func Test_streamTaskLogSlowClient(t *testing.T) {
 	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
 	j1 := tork.Job{
 		ID:        uuid.NewUUID(),
-		State:     tork.JobStateCancelled,
+		State:     tork.JobStateRunning,
 		CreatedAt: time.Now().UTC(),
-		Position:  1,
-		Tasks: []*tork.Task{
-			{
-				Name: "some fake task",
-			},
-		},
 	}
 	err = ds.CreateJob(ctx, &j1)
 	assert.NoError(t, err)
-
 	now := time.Now().UTC()
-
-	tasks := []tork.Task{{
+	tk := tork.Task{
 		ID:        uuid.NewUUID(),
-		State:     tork.TaskStatePending,
-		CreatedAt: &now,
 		JobID:     j1.ID,
-	}}
-
-	for _, ta := range tasks {
-		err := ds.CreateTask(ctx, &ta)
-		assert.NoError(t, err)
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
 	}
-
+	err = ds.CreateTask(ctx, &tk)
+	assert.NoError(t, err)
 	api, err := NewAPI(Config{
 		DataStore: ds,
-		Broker:    broker.NewInMemoryBroker(),
+		Broker:    b,
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/restart", j1.ID), nil)
-	assert.NoError(t, err)
-	w := httptest.NewRecorder()
-	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
-	assert.NoError(t, err)
 
+	req, err := http.NewRequest("GET", fmt.Sprintf("/tasks/%s/log/stream", tk.ID), nil)
 	assert.NoError(t, err)
-	assert.Equal(t, "{\"status\":\"OK\"}\n", string(body))
-	assert.Equal(t, http.StatusOK, w.Code)
+	w := &stalledWriter{ResponseRecorder: httptest.NewRecorder(), release: make(chan any)}
+	served := make(chan any)
+	go func() {
+		api.server.Handler.ServeHTTP(w, req)
+		close(served)
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	// a stalled client must not hold up the log pipeline
+	published := make(chan any)
+	go func() {
+		for i := 1; i <= logStreamBufferSize*2; i++ {
+			p := &tork.TaskLogPart{TaskID: tk.ID, Number: i, Contents: fmt.Sprintf("line %d", i)}
+			assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_LOG_PART, p))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second * 5):
+		t.Fatal("publishing log parts was blocked by a stalled client")
+	}
+
+	// and its stream is closed once it gets going again
+	close(w.release)
+	select {
+	case <-served:
+	case <-time.After(time.Second * 5):
+		t.Fatal("the log stream of the stalled client was not closed")
+	}
+	assert.Less(t, strings.Count(w.Body.String(), "event: log\n"), logStreamBufferSize*2)
 	assert.NoError(t, ds.Close())
 }
 
-func Test_restartRunningJob(t *testing.T) {
+func Test_streamJobLog(t *testing.T) {
 	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+	logStreamCheckInterval = time.Millisecond * 50
+
 	j1 := tork.Job{
 		ID:        uuid.NewUUID(),
 		State:     tork.JobStateRunning,
 		CreatedAt: time.Now().UTC(),
-		Position:  1,
-		Tasks: []*tork.Task{
-			{
-				Name: "some fake task",
-			},
-		},
 	}
 	err = ds.CreateJob(ctx, &j1)
 	assert.NoError(t, err)
-
 	now := time.Now().UTC()
-
-	tasks := []tork.Task{{
+	tk := tork.Task{
 		ID:        uuid.NewUUID(),
-		State:     tork.TaskStatePending,
-		CreatedAt: &now,
 		JobID:     j1.ID,
-	}}
-
-	for _, ta := range tasks {
-		err := ds.CreateTask(ctx, &ta)
-		assert.NoError(t, err)
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
 	}
+	err = ds.CreateTask(ctx, &tk)
+	assert.NoError(t, err)
 
 	api, err := NewAPI(Config{
 		DataStore: ds,
-		Broker:    broker.NewInMemoryBroker(),
+		Broker:    b,
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/restart", j1.ID), nil)
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		p1 := &tork.TaskLogPart{TaskID: tk.ID, Number: 1, Contents: "line 1"}
+		err := ds.CreateTaskLogPart(ctx, p1)
+		assert.NoError(t, err)
+		err = b.PublishEvent(ctx, broker.TOPIC_LOG_PART, p1)
+		assert.NoError(t, err)
+		time.Sleep(time.Millisecond * 100)
+		// parts persisted right before the job finished are sent too
+		err = ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{TaskID: tk.ID, Number: 2, Contents: "line 2"})
+		assert.NoError(t, err)
+		err = ds.UpdateJob(ctx, j1.ID, func(u *tork.Job) error {
+			u.State = tork.JobStateFailed
+			return nil
+		})
+		assert.NoError(t, err)
+	}()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("/jobs/%s/log/stream", j1.ID), nil)
 	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Equal(t, 2, strings.Count(body, "event: log\n"))
+	assert.Contains(t, body, `"line 1"`)
+	assert.Contains(t, body, `"line 2"`)
+	assert.True(t, strings.HasSuffix(body, "event: end\ndata: {\"state\":\"FAILED\"}\n\n"))
 	assert.NoError(t, ds.Close())
 }
 
-func Test_restartRunningNoMoreTasksJob(t *testing.T) {
+func Test_streamEvents(t *testing.T) {
 	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
-	j1 := tork.Job{
+	b := broker.NewInMemoryBroker()
+	now := time.Now().UTC()
+	owner := &tork.User{
 		ID:        uuid.NewUUID(),
-		State:     tork.JobStateFailed,
-		CreatedAt: time.Now().UTC(),
-		Position:  2,
-		Tasks: []*tork.Task{
-			{
-				Name: "some fake task",
-			},
-		},
+		Username:  uuid.NewShortUUID(),
+		Name:      "Owner",
+		CreatedAt: &now,
 	}
-	err = ds.CreateJob(ctx, &j1)
+	err = ds.CreateUser(ctx, owner)
 	assert.NoError(t, err)
-
-	now := time.Now().UTC()
-
-	tasks := []tork.Task{{
+	other := &tork.User{
 		ID:        uuid.NewUUID(),
-		State:     tork.TaskStatePending,
+		Username:  uuid.NewShortUUID(),
+		Name:      "Other",
 		CreatedAt: &now,
-		JobID:     j1.ID,
-	}}
-
-	for _, ta := range tasks {
-		err := ds.CreateTask(ctx, &ta)
-		assert.NoError(t, err)
 	}
+	err = ds.CreateUser(ctx, other)
+	assert.NoError(t, err)
+	// only visible to its owner
+	j1 := tork.Job{
+		ID:          uuid.NewUUID(),
+		State:       tork.JobStateRunning,
+		CreatedAt:   now,
+		Permissions: []*tork.Permission{{User: owner}},
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	// visible to everyone
+	j2 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: now,
+	}
+	err = ds.CreateJob(ctx, &j2)
+	assert.NoError(t, err)
 
 	api, err := NewAPI(Config{
 		DataStore: ds,
-		Broker:    broker.NewInMemoryBroker(),
+		Broker:    b,
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/restart", j1.ID), nil)
-	assert.NoError(t, err)
-	w := httptest.NewRecorder()
-	api.server.Handler.ServeHTTP(w, req)
 
-	assert.NoError(t, err)
+	stream := func(username, query string) *httptest.ResponseRecorder {
+		rctx, cancel := context.WithCancel(context.WithValue(ctx, tork.USERNAME, username))
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_JOB_COMPLETED, &tork.Job{ID: j1.ID, State: tork.JobStateCompleted}))
+			assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_TASK_PROGRESS, &tork.Task{ID: "t1", JobID: j1.ID, State: tork.TaskStateRunning}))
+			assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_JOB_COMPLETED, &tork.Job{ID: j2.ID, State: tork.JobStateCompleted}))
+			assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_TASK_PROGRESS, &tork.Task{ID: "t2", JobID: j2.ID, State: tork.TaskStateRunning}))
+			time.Sleep(time.Millisecond * 100)
+			cancel()
+		}()
+		req, err := http.NewRequestWithContext(rctx, "GET", "/events"+query, nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := stream(owner.Username, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Equal(t, 2, strings.Count(body, "event: job.completed\n"))
+	assert.Equal(t, 2, strings.Count(body, "event: task.progress\n"))
+
+	w = stream(other.Username, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body = w.Body.String()
+	assert.Equal(t, 1, strings.Count(body, "event: job.completed\n"))
+	assert.Equal(t, 1, strings.Count(body, "event: task.progress\n"))
+	assert.NotContains(t, body, j1.ID)
+
+	w = stream(owner.Username, fmt.Sprintf("?jobId=%s&topic=task.*", j1.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body = w.Body.String()
+	assert.Equal(t, 0, strings.Count(body, "event: job.completed\n"))
+	assert.Equal(t, 1, strings.Count(body, "event: task.progress\n"))
+	assert.NotContains(t, body, j2.ID)
+
+	w = stream(other.Username, fmt.Sprintf("?jobId=%s", j1.ID))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = stream(owner.Username, "?topic=scheduled.job")
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.NoError(t, ds.Close())
 }
 
-func Test_middleware(t *testing.T) {
-	mw := func(next web.HandlerFunc) web.HandlerFunc {
-		return func(c web.Context) error {
-			if strings.HasPrefix(c.Request().URL.Path, "/middleware") {
-				return c.String(http.StatusOK, "OK")
-			}
-			return next(c)
-		}
-	}
-	b := broker.NewInMemoryBroker()
+func Test_streamEventsRedacted(t *testing.T) {
+	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: time.Now().UTC(),
+		Secrets:   map[string]string{"password": "s3cret"},
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	redacter := redact.NewRedacter(ds)
 	api, err := NewAPI(Config{
 		DataStore: ds,
 		Broker:    b,
 		Middleware: Middleware{
-			Web: []web.MiddlewareFunc{mw},
+			Job:  []job.MiddlewareFunc{job.Redact(redacter)},
+			Task: []task.MiddlewareFunc{task.Redact(redacter)},
 		},
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("GET", "/middleware", nil)
+
+	ev := j1.Clone()
+	ev.State = tork.JobStateCompleted
+	ev.Inputs = map[string]string{"db": "s3cret"}
+	ev.Context = tork.JobContext{Secrets: map[string]string{"password": "s3cret"}}
+	rctx, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_JOB_COMPLETED, ev))
+		assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_TASK_RUNNING, &tork.Task{
+			ID:       uuid.NewUUID(),
+			JobID:    j1.ID,
+			State:    tork.TaskStateRunning,
+			Env:      map[string]string{"DB_PASS": "s3cret"},
+			Registry: &tork.Registry{Username: "me", Password: "registry-pass"},
+		}))
+		time.Sleep(time.Millisecond * 100)
+		cancel()
+	}()
+	req, err := http.NewRequestWithContext(rctx, "GET", fmt.Sprintf("/events?jobId=%s", j1.ID), nil)
 	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
-	assert.NoError(t, err)
-
-	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "OK", string(body))
+	body := w.Body.String()
+	assert.Equal(t, 1, strings.Count(body, "event: job.completed\n"))
+	assert.Equal(t, 1, strings.Count(body, "event: task.running\n"))
+	assert.Contains(t, body, "[REDACTED]")
+	assert.NotContains(t, body, "s3cret")
+	assert.NotContains(t, body, "registry-pass")
+	// the published event itself is left untouched
+	assert.Equal(t, "s3cret", ev.Secrets["password"])
 	assert.NoError(t, ds.Close())
 }
 
-func Test_echoMiddleware(t *testing.T) {
-	b := broker.NewInMemoryBroker()
+// stalledWriter is a client which stops reading its stream
+// until it is released.
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	release chan any
+}
+
+func (w *stalledWriter) Write(b []byte) (int, error) {
+	<-w.release
+	return w.ResponseRecorder.Write(b)
+}
+
+func Test_streamEventsSlowClient(t *testing.T) {
+	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
 	api, err := NewAPI(Config{
 		DataStore: ds,
 		Broker:    b,
-		Middleware: Middleware{
-			Echo: []echo.MiddlewareFunc{
-				func(next echo.HandlerFunc) echo.HandlerFunc {
-					return func(c echo.Context) error {
-						return c.String(http.StatusOK, "OK")
-					}
-				},
-			},
-		},
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("GET", "/middleware", nil)
-	assert.NoError(t, err)
-	w := httptest.NewRecorder()
-	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
-	assert.NoError(t, err)
 
+	req, err := http.NewRequest("GET", "/events?topic=job.completed", nil)
 	assert.NoError(t, err)
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "OK", string(body))
-	assert.NoError(t, ds.Close())
-}
+	w := &stalledWriter{ResponseRecorder: httptest.NewRecorder(), release: make(chan any)}
+	served := make(chan any)
+	go func() {
+		api.server.Handler.ServeHTTP(w, req)
+		close(served)
+	}()
+	time.Sleep(time.Millisecond * 100)
 
-func Test_middlewareMultiple(t *testing.T) {
-	mw1 := func(next web.HandlerFunc) web.HandlerFunc {
-		return func(c web.Context) error {
-			if strings.HasPrefix(c.Request().URL.Path, "/middleware1") {
-				return c.String(http.StatusOK, "OK1")
-			}
-			return next(c)
+	// a stalled client must not hold up the publishers
+	published := make(chan any)
+	go func() {
+		for i := 0; i < eventsBufferSize*2; i++ {
+			assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_JOB_COMPLETED, &tork.Job{ID: uuid.NewUUID()}))
 		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second * 5):
+		t.Fatal("publishing events was blocked by a stalled client")
 	}
-	mw2 := func(next web.HandlerFunc) web.HandlerFunc {
-		return func(c web.Context) error {
-			if strings.HasPrefix(c.Request().URL.Path, "/middleware2") {
-				return c.String(http.StatusOK, "OK2")
-			}
-			return next(c)
-		}
+
+	// and its stream is closed once it gets going again
+	close(w.release)
+	select {
+	case <-served:
+	case <-time.After(time.Second * 5):
+		t.Fatal("the stream of the stalled client was not closed")
 	}
-	b := broker.NewInMemoryBroker()
+	assert.Less(t, strings.Count(w.Body.String(), "event: job.completed\n"), eventsBufferSize*2)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_jobArtifacts(t *testing.T) {
+	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateCompleted,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	store, err := artifact.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	err = store.Put(ctx, j1.ID, "report", strings.NewReader("some tar"))
+	assert.NoError(t, err)
+
 	api, err := NewAPI(Config{
-		DataStore: ds,
-		Broker:    b,
-		Middleware: Middleware{
-			Web: []web.MiddlewareFunc{mw1, mw2},
-		},
+		DataStore:     ds,
+		ArtifactStore: store,
+		Broker:        broker.NewInMemoryBroker(),
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
 
-	req, err := http.NewRequest("GET", "/middleware1", nil)
+	req, err := http.NewRequest("GET", fmt.Sprintf("/jobs/%s/artifacts", j1.ID), nil)
 	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	artifacts := []*tork.Artifact{}
+	err = json.Unmarshal(w.Body.Bytes(), &artifacts)
 	assert.NoError(t, err)
+	assert.Len(t, artifacts, 1)
+	assert.Equal(t, "report", artifacts[0].Name)
+	assert.Equal(t, int64(8), artifacts[0].Size)
 
+	req, err = http.NewRequest("GET", fmt.Sprintf("/jobs/%s/artifacts/report", j1.ID), nil)
 	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "OK1", string(body))
+	assert.Equal(t, "application/x-tar", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="report.tar"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "some tar", w.Body.String())
 
-	req, err = http.NewRequest("GET", "/middleware2", nil)
+	req, err = http.NewRequest("GET", fmt.Sprintf("/jobs/%s/artifacts/nothing", j1.ID), nil)
 	assert.NoError(t, err)
 	w = httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	body, err = io.ReadAll(w.Body)
-	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 
+	req, err = http.NewRequest("GET", "/jobs/no-such-job/artifacts", nil)
 	assert.NoError(t, err)
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "OK2", string(body))
-	assert.NoError(t, ds.Close())
-}
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 
-func Test_2CustomEndpoints(t *testing.T) {
-	h := func(c web.Context) error {
-		return c.String(http.StatusOK, "OK")
-	}
-	h2 := func(c web.Context) error {
-		return c.String(http.StatusOK, "OK 2")
-	}
-	b := broker.NewInMemoryBroker()
-	ds, err := postgres.NewTestDatastore()
-	assert.NoError(t, err)
-	api, err := NewAPI(Config{
+	// the endpoints are not available without a store
+	api, err = NewAPI(Config{
 		DataStore: ds,
-		Broker:    b,
-		Endpoints: map[string]web.HandlerFunc{
-			"GET /myendpoint":       h,
-			"POST /myotherendpoint": h2,
-		},
+		Broker:    broker.NewInMemoryBroker(),
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("GET", "/myendpoint", nil)
+	req, err = http.NewRequest("GET", fmt.Sprintf("/jobs/%s/artifacts", j1.ID), nil)
 	assert.NoError(t, err)
-	w := httptest.NewRecorder()
+	w = httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
-	assert.NoError(t, err)
-
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "OK", string(body))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, ds.Close())
+}
 
-	req, err = http.NewRequest("POST", "/myotherendpoint", nil)
+func Test_cancelRunningJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
-	api.server.Handler.ServeHTTP(w, req)
-	body, err = io.ReadAll(w.Body)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = ds.CreateJob(ctx, &j1)
 	assert.NoError(t, err)
 
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "OK 2", string(body))
-	assert.NoError(t, ds.Close())
-}
+	now := time.Now().UTC()
 
-func Test_customEndpoint(t *testing.T) {
-	h := func(c web.Context) error {
-		return c.String(http.StatusOK, "OK")
+	tasks := []tork.Task{{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateScheduled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCancelled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCompleted,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateFailed,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, &ta)
+		assert.NoError(t, err)
 	}
-	b := broker.NewInMemoryBroker()
-	ds, err := postgres.NewTestDatastore()
-	assert.NoError(t, err)
+
 	api, err := NewAPI(Config{
 		DataStore: ds,
-		Broker:    b,
-		Endpoints: map[string]web.HandlerFunc{
-			"GET /myendpoint": h,
-		},
+		Broker:    broker.NewInMemoryBroker(),
 	})
 	assert.NoError(t, err)
 	assert.NotNil(t, api)
-	req, err := http.NewRequest("GET", "/myendpoint", nil)
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/cancel", j1.ID), nil)
 	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
@@ -840,216 +1084,1298 @@ func Test_customEndpoint(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.NoError(t, err)
+	assert.Equal(t, "{\"status\":\"OK\"}\n", string(body))
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "OK", string(body))
 	assert.NoError(t, ds.Close())
 }
 
-func Test_customEndpointInvalidSpec(t *testing.T) {
-	h := func(c web.Context) error {
-		return c.String(http.StatusOK, "OK")
-	}
-	b := broker.NewInMemoryBroker()
+func Test_cancelScheduledJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateScheduled,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	tasks := []tork.Task{{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateScheduled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCancelled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCompleted,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateFailed,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, &ta)
+		assert.NoError(t, err)
+	}
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/cancel", j1.ID), nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"status\":\"OK\"}\n", string(body))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_restartJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateCancelled,
+		CreatedAt: time.Now().UTC(),
+		Position:  1,
+		Tasks: []*tork.Task{
+			{
+				Name: "some fake task",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	tasks := []tork.Task{{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, &ta)
+		assert.NoError(t, err)
+	}
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/restart", j1.ID), nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"status\":\"OK\"}\n", string(body))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_pauseAndResumeJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: time.Now().UTC(),
+		Position:  1,
+		Tasks: []*tork.Task{
+			{
+				Name: "some fake task",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	b := broker.NewInMemoryBroker()
+	published := make(chan tork.JobState, 1)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		published <- j.State
+		return nil
+	})
+	assert.NoError(t, err)
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+
+	put := func(path string) int {
+		req, err := http.NewRequest("PUT", path, nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// a running job can't be resumed
+	assert.Equal(t, http.StatusBadRequest, put(fmt.Sprintf("/jobs/%s/resume", j1.ID)))
+
+	assert.Equal(t, http.StatusOK, put(fmt.Sprintf("/jobs/%s/pause", j1.ID)))
+	assert.Equal(t, tork.JobStatePaused, <-published)
+
+	err = ds.UpdateJob(ctx, j1.ID, func(u *tork.Job) error {
+		u.State = tork.JobStatePaused
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// a paused job can't be paused again
+	assert.Equal(t, http.StatusBadRequest, put(fmt.Sprintf("/jobs/%s/pause", j1.ID)))
+
+	assert.Equal(t, http.StatusOK, put(fmt.Sprintf("/jobs/%s/resume", j1.ID)))
+	assert.Equal(t, tork.JobStateResume, <-published)
+
+	assert.Equal(t, http.StatusNotFound, put(fmt.Sprintf("/jobs/%s/pause", uuid.NewUUID())))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_restartRunningJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: time.Now().UTC(),
+		Position:  1,
+		Tasks: []*tork.Task{
+			{
+				Name: "some fake task",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	tasks := []tork.Task{{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, &ta)
+		assert.NoError(t, err)
+	}
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/restart", j1.ID), nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_restartRunningNoMoreTasksJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateFailed,
+		CreatedAt: time.Now().UTC(),
+		Position:  2,
+		Tasks: []*tork.Task{
+			{
+				Name: "some fake task",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	tasks := []tork.Task{{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStatePending,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}}
+
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, &ta)
+		assert.NoError(t, err)
+	}
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/jobs/%s/restart", j1.ID), nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_middleware(t *testing.T) {
+	mw := func(next web.HandlerFunc) web.HandlerFunc {
+		return func(c web.Context) error {
+			if strings.HasPrefix(c.Request().URL.Path, "/middleware") {
+				return c.String(http.StatusOK, "OK")
+			}
+			return next(c)
+		}
+	}
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+		Middleware: Middleware{
+			Web: []web.MiddlewareFunc{mw},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("GET", "/middleware", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK", string(body))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_echoMiddleware(t *testing.T) {
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+		Middleware: Middleware{
+			Echo: []echo.MiddlewareFunc{
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						return c.String(http.StatusOK, "OK")
+					}
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("GET", "/middleware", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK", string(body))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_middlewareMultiple(t *testing.T) {
+	mw1 := func(next web.HandlerFunc) web.HandlerFunc {
+		return func(c web.Context) error {
+			if strings.HasPrefix(c.Request().URL.Path, "/middleware1") {
+				return c.String(http.StatusOK, "OK1")
+			}
+			return next(c)
+		}
+	}
+	mw2 := func(next web.HandlerFunc) web.HandlerFunc {
+		return func(c web.Context) error {
+			if strings.HasPrefix(c.Request().URL.Path, "/middleware2") {
+				return c.String(http.StatusOK, "OK2")
+			}
+			return next(c)
+		}
+	}
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+		Middleware: Middleware{
+			Web: []web.MiddlewareFunc{mw1, mw2},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+
+	req, err := http.NewRequest("GET", "/middleware1", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK1", string(body))
+
+	req, err = http.NewRequest("GET", "/middleware2", nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err = io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK2", string(body))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_2CustomEndpoints(t *testing.T) {
+	h := func(c web.Context) error {
+		return c.String(http.StatusOK, "OK")
+	}
+	h2 := func(c web.Context) error {
+		return c.String(http.StatusOK, "OK 2")
+	}
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+		Endpoints: map[string]web.HandlerFunc{
+			"GET /myendpoint":       h,
+			"POST /myotherendpoint": h2,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("GET", "/myendpoint", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK", string(body))
+
+	req, err = http.NewRequest("POST", "/myotherendpoint", nil)
+	assert.NoError(t, err)
+	api.server.Handler.ServeHTTP(w, req)
+	body, err = io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK 2", string(body))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_customEndpoint(t *testing.T) {
+	h := func(c web.Context) error {
+		return c.String(http.StatusOK, "OK")
+	}
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+		Endpoints: map[string]web.HandlerFunc{
+			"GET /myendpoint": h,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("GET", "/myendpoint", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK", string(body))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_customEndpointInvalidSpec(t *testing.T) {
+	h := func(c web.Context) error {
+		return c.String(http.StatusOK, "OK")
+	}
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	_, err = NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+		Endpoints: map[string]web.HandlerFunc{
+			"xyz": h,
+		},
+	})
+	assert.Error(t, err)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_customEndpointError(t *testing.T) {
+	h := func(c web.Context) error {
+		c.Error(http.StatusBadRequest, errors.Errorf("bad stuff happened"))
+		return nil
+	}
+	b := broker.NewInMemoryBroker()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
-	_, err = NewAPI(Config{
+	api, err := NewAPI(Config{
 		DataStore: ds,
 		Broker:    b,
 		Endpoints: map[string]web.HandlerFunc{
-			"xyz": h,
+			"GET /myendpoint": h,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("GET", "/myendpoint", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"message":"bad stuff happened"}`, strings.TrimSpace(string(body)))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_customEndpointBind(t *testing.T) {
+	h := func(c web.Context) error {
+		type MyStruct struct {
+			Name string `json:"name"`
+		}
+		s := MyStruct{}
+		if err := c.Bind(&s); err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, s.Name)
+	}
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+		Endpoints: map[string]web.HandlerFunc{
+			"POST /myendpoint": h,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("POST", "/myendpoint", strings.NewReader(`{"name":"Me"}`))
+	req.Header.Add("content-type", "application/json")
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Me", string(body))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_disableEndpoint(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Enabled:   map[string]bool{"health": false},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("GET", "/health", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	_, err = io.ReadAll(w.Body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
+func TestShutdown(t *testing.T) {
+	mw := func(next web.HandlerFunc) web.HandlerFunc {
+		return func(c web.Context) error {
+			select {
+			case <-time.After(time.Hour):
+			case <-c.Done():
+			}
+			return next(c)
+		}
+	}
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Middleware: Middleware{
+			Web: []web.MiddlewareFunc{mw},
+		},
+	})
+	assert.NoError(t, err)
+
+	go func() {
+		time.Sleep(time.Second)
+		assert.NoError(t, api.Shutdown(context.Background()))
+	}()
+
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("GET", "/middleware", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_createJobAndWait(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+	req, err := http.NewRequest("POST", "/jobs", strings.NewReader(`{
+		"name":"test job",
+		"wait": {
+			"timeout": "1s"
 		},
+		"tasks":[{
+			"name":"test task",
+			"image":"some:image"
+		}]
+	}`))
+	req.Header.Add("Content-Type", "application/json")
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_deleteScheduledJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	// Create a scheduled job
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		State:     tork.ScheduledJobStateActive,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
 	})
+	assert.NoError(t, err)
+	assert.NotNil(t, api)
+
+	// Send DELETE request to delete the scheduled job
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/scheduled-jobs/%s", sj.ID), nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	// Verify response
+	assert.Equal(t, "{\"status\":\"OK\"}\n", string(body))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Verify the job state is updated to paused
+	_, err = ds.GetScheduledJobByID(ctx, sj.ID)
 	assert.Error(t, err)
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_getScheduledJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "test scheduled job",
+		Cron:      "0 0 * * *",
+		State:     tork.ScheduledJobStateActive,
+		CreatedAt: time.Now().UTC(),
+		Timezone:  "America/New_York",
+		Secrets:   map[string]string{"password": "secret"},
+		Inputs:    map[string]string{"db": "secret"},
+		Tasks: []*tork.Task{{
+			Name:  "some task",
+			Image: "ubuntu:mantic",
+		}},
+	}
+	err = ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Middleware: Middleware{
+			Job: []job.MiddlewareFunc{job.Redact(redact.NewRedacter(ds))},
+		},
+	})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("/scheduled-jobs/%s", sj.ID), nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	sj2 := tork.ScheduledJob{}
+	err = json.Unmarshal(w.Body.Bytes(), &sj2)
+	assert.NoError(t, err)
+	assert.Equal(t, sj.ID, sj2.ID)
+	assert.Equal(t, "0 0 * * *", sj2.Cron)
+	assert.Equal(t, "America/New_York", sj2.Timezone)
+	assert.Len(t, sj2.Tasks, 1)
+	assert.Equal(t, "[REDACTED]", sj2.Secrets["password"])
+	assert.Equal(t, "[REDACTED]", sj2.Inputs["db"])
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("/scheduled-jobs/%s", uuid.NewUUID()), nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_updateScheduledJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "test scheduled job",
+		Cron:      "0 0 * * *",
+		State:     tork.ScheduledJobStateActive,
+		CreatedAt: time.Now().UTC(),
+		Tasks: []*tork.Task{{
+			Name:  "some task",
+			Image: "ubuntu:mantic",
+		}},
+	}
+	err = ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
+	b := broker.NewInMemoryBroker()
+	rescheduled := make(chan *tork.ScheduledJob, 1)
+	err = b.SubscribeForEvents(ctx, broker.TOPIC_SCHEDULED_JOB, func(ev any) {
+		rescheduled <- ev.(*tork.ScheduledJob)
+	})
+	assert.NoError(t, err)
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+	})
+	assert.NoError(t, err)
+
+	body := `{
+		"name":"updated scheduled job",
+		"inputs": {"var1":"val1"},
+		"schedule": {"cron":"0 1 * * *","overlap":"skip"},
+		"tasks":[{"name":"other task","image":"ubuntu:mantic"}]
+	}`
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/scheduled-jobs/%s", sj.ID), strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Add("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	updated, err := ds.GetScheduledJobByID(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "updated scheduled job", updated.Name)
+	assert.Equal(t, "0 1 * * *", updated.Cron)
+	assert.Equal(t, tork.ScheduleOverlapSkip, updated.Overlap)
+	assert.Equal(t, "val1", updated.Inputs["var1"])
+	assert.Len(t, updated.Tasks, 1)
+	assert.Equal(t, "other task", updated.Tasks[0].Name)
+	assert.Equal(t, tork.ScheduledJobStateActive, updated.State)
+	assert.Equal(t, sj.CreatedAt.Unix(), updated.CreatedAt.Unix())
+
+	ev := <-rescheduled
+	assert.Equal(t, sj.ID, ev.ID)
+	assert.Equal(t, "0 1 * * *", ev.Cron)
+
+	// invalid cron
+	body = `{"name":"bad","schedule":{"cron":"every day"},"tasks":[{"name":"x","image":"ubuntu:mantic"}]}`
+	req, err = http.NewRequest("PUT", fmt.Sprintf("/scheduled-jobs/%s", sj.ID), strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Add("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// unknown scheduled job
+	req, err = http.NewRequest("PUT", fmt.Sprintf("/scheduled-jobs/%s", uuid.NewUUID()), strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Add("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.NoError(t, ds.Close())
 }
 
-func Test_customEndpointError(t *testing.T) {
-	h := func(c web.Context) error {
-		c.Error(http.StatusBadRequest, errors.Errorf("bad stuff happened"))
-		return nil
+func Test_triggerScheduledJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "test scheduled job",
+		Cron:      "0 0 * * *",
+		State:     tork.ScheduledJobStatePaused,
+		CreatedAt: time.Now().UTC(),
+		Inputs:    map[string]string{"var1": "val1", "var2": "val2"},
+		Tasks: []*tork.Task{{
+			Name:  "some task",
+			Image: "ubuntu:mantic",
+		}},
 	}
+	err = ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
 	b := broker.NewInMemoryBroker()
-	ds, err := postgres.NewTestDatastore()
+	published := make(chan *tork.Job, 2)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		published <- j
+		return nil
+	})
 	assert.NoError(t, err)
+
 	api, err := NewAPI(Config{
 		DataStore: ds,
 		Broker:    b,
-		Endpoints: map[string]web.HandlerFunc{
-			"GET /myendpoint": h,
-		},
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("GET", "/myendpoint", nil)
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/scheduled-jobs/%s/trigger", sj.ID), strings.NewReader(`{"inputs":{"var2":"override"}}`))
 	assert.NoError(t, err)
+	req.Header.Add("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	js := tork.JobSummary{}
+	err = json.Unmarshal(w.Body.Bytes(), &js)
+	assert.NoError(t, err)
+
+	j := <-published
+	assert.Equal(t, js.ID, j.ID)
+	assert.Equal(t, tork.JobStatePending, j.State)
+
+	j2, err := ds.GetJobByID(ctx, js.ID)
 	assert.NoError(t, err)
+	assert.Equal(t, sj.ID, j2.Schedule.ID)
+	assert.Equal(t, "val1", j2.Inputs["var1"])
+	assert.Equal(t, "override", j2.Inputs["var2"])
+	assert.Equal(t, "override", j2.Context.Inputs["var2"])
 
+	// no overrides
+	req, err = http.NewRequest("POST", fmt.Sprintf("/scheduled-jobs/%s/trigger", sj.ID), nil)
 	assert.NoError(t, err)
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Equal(t, `{"message":"bad stuff happened"}`, strings.TrimSpace(string(body)))
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	j = <-published
+	assert.Equal(t, "val2", j.Inputs["var2"])
+
+	// the scheduled job's own inputs are untouched
+	sj2, err := ds.GetScheduledJobByID(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "val2", sj2.Inputs["var2"])
 	assert.NoError(t, ds.Close())
 }
 
-func Test_customEndpointBind(t *testing.T) {
-	h := func(c web.Context) error {
-		type MyStruct struct {
-			Name string `json:"name"`
-		}
-		s := MyStruct{}
-		if err := c.Bind(&s); err != nil {
-			return err
-		}
-		return c.String(http.StatusOK, s.Name)
-	}
-	b := broker.NewInMemoryBroker()
+func Test_triggerScheduledJobSchemaAndOverlap(t *testing.T) {
+	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
+
+	sj := tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "test scheduled job",
+		Cron:      "0 0 * * *",
+		State:     tork.ScheduledJobStatePaused,
+		CreatedAt: time.Now().UTC(),
+		Overlap:   tork.ScheduleOverlapSkip,
+		Inputs:    map[string]string{"count": "1"},
+		InputSchema: map[string]tork.Input{
+			"count": {Type: tork.InputTypeInt, Required: true},
+		},
+		Tasks: []*tork.Task{{
+			Name:  "some task",
+			Image: "ubuntu:mantic",
+		}},
+	}
+	err = ds.CreateScheduledJob(ctx, &sj)
+	assert.NoError(t, err)
+
 	api, err := NewAPI(Config{
 		DataStore: ds,
-		Broker:    b,
-		Endpoints: map[string]web.HandlerFunc{
-			"POST /myendpoint": h,
-		},
+		Broker:    broker.NewInMemoryBroker(),
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("POST", "/myendpoint", strings.NewReader(`{"name":"Me"}`))
-	req.Header.Add("content-type", "application/json")
+
+	trigger := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", fmt.Sprintf("/scheduled-jobs/%s/trigger", sj.ID), strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// the merged inputs are checked against the schema
+	w := trigger(`{"inputs":{"count":"many"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = trigger(`{"inputs":{"count":"2"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	js := tork.JobSummary{}
+	err = json.Unmarshal(w.Body.Bytes(), &js)
 	assert.NoError(t, err)
-	w := httptest.NewRecorder()
-	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
+	j, err := ds.GetJobByID(ctx, js.ID)
 	assert.NoError(t, err)
+	assert.Equal(t, 2, j.Context.AsMap()["inputs"].(map[string]any)["count"])
 
+	// the previous instance is still active
+	w = trigger(`{"inputs":{"count":"3"}}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	instances, err := ds.GetActiveScheduledJobInstances(ctx, sj.ID)
 	assert.NoError(t, err)
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "Me", string(body))
+	assert.Len(t, instances, 1)
 	assert.NoError(t, ds.Close())
 }
 
-func Test_disableEndpoint(t *testing.T) {
+func Test_createTrigger(t *testing.T) {
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
 	api, err := NewAPI(Config{
 		DataStore: ds,
 		Broker:    broker.NewInMemoryBroker(),
-		Enabled:   map[string]bool{"health": false},
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("GET", "/health", nil)
+
+	name := "test-trigger-" + uuid.NewShortUUID()
+	body := fmt.Sprintf(`{
+		"name":"%s",
+		"secret":"s3cr3t",
+		"inputs":{"ref":"{{ body.ref }}"},
+		"job":{
+			"name":"test job",
+			"secrets":{"token":"s3cr3t-t0k3n"},
+			"tasks":[{"name":"test task","image":"some:image"}]
+		}
+	}`, name)
+	req, err := http.NewRequest("POST", "/triggers", strings.NewReader(body))
 	assert.NoError(t, err)
+	req.Header.Add("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	_, err = io.ReadAll(w.Body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "s3cr3t")
+	assert.NotContains(t, w.Body.String(), "s3cr3t-t0k3n")
 
+	tr := tork.Trigger{}
+	err = json.Unmarshal(w.Body.Bytes(), &tr)
 	assert.NoError(t, err)
-	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, name, tr.Name)
+
+	// the name is taken
+	req, err = http.NewRequest("POST", "/triggers", strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Add("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the job definition is validated
+	req, err = http.NewRequest("POST", "/triggers", strings.NewReader(`{"name":"no-tasks","job":{"name":"test job"}}`))
+	assert.NoError(t, err)
+	req.Header.Add("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, err = http.NewRequest("GET", "/triggers/"+name, nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), tr.ID)
+	assert.NotContains(t, w.Body.String(), "s3cr3t-t0k3n")
+
+	req, err = http.NewRequest("GET", "/triggers", nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), tr.ID)
+
+	req, err = http.NewRequest("DELETE", "/triggers/"+tr.ID, nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	_, err = ds.GetTrigger(context.Background(), tr.ID)
+	assert.ErrorIs(t, err, datastore.ErrTriggerNotFound)
 	assert.NoError(t, ds.Close())
 }
 
-func TestShutdown(t *testing.T) {
-	mw := func(next web.HandlerFunc) web.HandlerFunc {
-		return func(c web.Context) error {
-			select {
-			case <-time.After(time.Hour):
-			case <-c.Done():
-			}
-			return next(c)
-		}
-	}
-
+func Test_updateTrigger(t *testing.T) {
+	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
 	api, err := NewAPI(Config{
 		DataStore: ds,
 		Broker:    broker.NewInMemoryBroker(),
-		Middleware: Middleware{
-			Web: []web.MiddlewareFunc{mw},
-		},
 	})
 	assert.NoError(t, err)
 
-	go func() {
-		time.Sleep(time.Second)
-		assert.NoError(t, api.Shutdown(context.Background()))
-	}()
+	tr := &tork.Trigger{
+		ID:        uuid.NewUUID(),
+		Name:      "test-trigger-" + uuid.NewShortUUID(),
+		Secret:    "s3cr3t",
+		Job:       []byte(`{"name":"test job","tasks":[{"name":"test task","image":"some:image"}]}`),
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, ds.CreateTrigger(ctx, tr))
 
+	update := func(body string) int {
+		req, err := http.NewRequest("PUT", "/triggers/"+tr.ID, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		assert.NotContains(t, w.Body.String(), "s3cr3t")
+		return w.Code
+	}
+	job := `{"name":"test job","tasks":[{"name":"test task","image":"some:image"}]}`
+
+	// omitting the secret keeps it
+	code := update(fmt.Sprintf(`{"name":"%s","description":"updated","job":%s}`, tr.Name, job))
+	assert.Equal(t, http.StatusOK, code)
+	u, err := ds.GetTrigger(ctx, tr.ID)
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("GET", "/middleware", nil)
+	assert.Equal(t, "updated", u.Description)
+	assert.Equal(t, "s3cr3t", u.Secret)
+
+	// rotate the secret
+	code = update(fmt.Sprintf(`{"name":"%s","secret":"n3w-s3cr3t","job":%s}`, tr.Name, job))
+	assert.Equal(t, http.StatusOK, code)
+	u, err = ds.GetTrigger(ctx, tr.ID)
 	assert.NoError(t, err)
-	w := httptest.NewRecorder()
-	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, "n3w-s3cr3t", u.Secret)
+
+	code = update(fmt.Sprintf(`{"name":"%s","secret":"other","clearSecret":true,"job":%s}`, tr.Name, job))
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// clear the secret
+	code = update(fmt.Sprintf(`{"name":"%s","clearSecret":true,"job":%s}`, tr.Name, job))
+	assert.Equal(t, http.StatusOK, code)
+	u, err = ds.GetTrigger(ctx, tr.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "", u.Secret)
 	assert.NoError(t, ds.Close())
 }
 
-func Test_createJobAndWait(t *testing.T) {
+func Test_handleHook(t *testing.T) {
+	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+	published := make(chan *tork.Job, 1)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		published <- j
+		return nil
+	})
+	assert.NoError(t, err)
 	api, err := NewAPI(Config{
 		DataStore: ds,
-		Broker:    broker.NewInMemoryBroker(),
+		Broker:    b,
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
-	req, err := http.NewRequest("POST", "/jobs", strings.NewReader(`{
-		"name":"test job",
-		"wait": {
-			"timeout": "1s"
+
+	tr := &tork.Trigger{
+		ID:     uuid.NewUUID(),
+		Name:   "test-hook-" + uuid.NewShortUUID(),
+		Secret: "s3cr3t",
+		Inputs: map[string]string{
+			"ref":   "{{ body.ref }}",
+			"event": "{{ headers['x-github-event'] }}",
 		},
-		"tasks":[{
-			"name":"test task",
-			"image":"some:image"
-		}]
-	}`))
-	req.Header.Add("Content-Type", "application/json")
+		Job:       []byte(`{"name":"build","inputs":{"ref":"main","env":"prod"},"tasks":[{"name":"build","image":"some:image"}]}`),
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, ds.CreateTrigger(ctx, tr))
+
+	payload := `{"ref":"refs/heads/feature"}`
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write([]byte(payload))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	// unsigned
+	req, err := http.NewRequest("POST", "/hooks/"+tr.Name, strings.NewReader(payload))
 	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	api.server.Handler.ServeHTTP(w, req)
-	assert.Equal(t, http.StatusRequestTimeout, w.Code)
-	assert.NoError(t, ds.Close())
-}
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
 
-func Test_deleteScheduledJob(t *testing.T) {
-	ctx := context.Background()
-	ds, err := postgres.NewTestDatastore()
+	// wrong signature
+	req, err = http.NewRequest("POST", "/hooks/"+tr.Name, strings.NewReader(payload))
 	assert.NoError(t, err)
+	req.Header.Set("X-Tork-Signature-256", "sha256=00ff")
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
 
-	// Create a scheduled job
-	sj := tork.ScheduledJob{
-		ID:        uuid.NewUUID(),
-		State:     tork.ScheduledJobStateActive,
-		CreatedAt: time.Now().UTC(),
-	}
-	err = ds.CreateScheduledJob(ctx, &sj)
+	// unknown hook
+	req, err = http.NewRequest("POST", "/hooks/no-such-hook", strings.NewReader(payload))
 	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 
-	api, err := NewAPI(Config{
-		DataStore: ds,
-		Broker:    broker.NewInMemoryBroker(),
+	req, err = http.NewRequest("POST", "/hooks/"+tr.Name, strings.NewReader(payload))
+	assert.NoError(t, err)
+	req.Header.Set("X-Hub-Signature-256", signature)
+	req.Header.Set("X-GitHub-Event", "push")
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	js := tork.JobSummary{}
+	err = json.Unmarshal(w.Body.Bytes(), &js)
+	assert.NoError(t, err)
+
+	j := <-published
+	assert.Equal(t, js.ID, j.ID)
+	assert.Equal(t, "build", j.Name)
+	assert.Equal(t, "refs/heads/feature", j.Inputs["ref"])
+	assert.Equal(t, "push", j.Inputs["event"])
+	assert.Equal(t, "prod", j.Inputs["env"])
+	assert.Equal(t, tork.USER_GUEST, j.CreatedBy.Username)
+
+	// too large
+	small, err := NewAPI(Config{
+		DataStore:     ds,
+		Broker:        b,
+		HookBodyLimit: int64(len(payload) - 1),
 	})
 	assert.NoError(t, err)
-	assert.NotNil(t, api)
+	req, err = http.NewRequest("POST", "/hooks/"+tr.Name, strings.NewReader(payload))
+	assert.NoError(t, err)
+	req.Header.Set("X-Hub-Signature-256", signature)
+	w = httptest.NewRecorder()
+	small.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.NoError(t, ds.Close())
+}
 
-	// Send DELETE request to delete the scheduled job
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("/scheduled-jobs/%s", sj.ID), nil)
+func Test_templates(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
-	w := httptest.NewRecorder()
-	api.server.Handler.ServeHTTP(w, req)
-	body, err := io.ReadAll(w.Body)
+	b := broker.NewInMemoryBroker()
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+	})
 	assert.NoError(t, err)
 
-	// Verify response
-	assert.Equal(t, "{\"status\":\"OK\"}\n", string(body))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req, err := http.NewRequest(method, path, r)
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	name := "test-template-" + uuid.NewShortUUID()
+	body := fmt.Sprintf(`{
+		"name":"%s",
+		"parameters":[
+			{"name":"source","required":true},
+			{"name":"quality","enum":["low","high"],"default":"low"}
+		],
+		"job":{
+			"name":"transcode",
+			"secrets":{"token":"s3cr3t-t0k3n"},
+			"tasks":[{"name":"test task","image":"some:image"}]
+		}
+	}`, name)
+	w := do("POST", "/templates", body)
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "s3cr3t-t0k3n")
+	tmpl := tork.Template{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tmpl))
+	assert.Equal(t, 1, tmpl.Version)
 
-	// Verify the job state is updated to paused
-	_, err = ds.GetScheduledJobByID(ctx, sj.ID)
-	assert.Error(t, err)
+	// the name is taken
+	w = do("POST", "/templates", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// updating creates a new version
+	w = do("PUT", "/templates/"+name, strings.Replace(body, `"high"]`, `"high","best"]`, 1))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tmpl))
+	assert.Equal(t, 2, tmpl.Version)
+
+	w = do("GET", "/templates/"+name, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tmpl))
+	assert.Equal(t, 2, tmpl.Version)
+	w = do("GET", "/templates/"+name+"@1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tmpl))
+	assert.Equal(t, 1, tmpl.Version)
+	w = do("GET", "/templates/"+name+"@3", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do("GET", "/templates", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), name)
+
+	w = do("POST", "/templates/"+name+"/run", `{"inputs":{"source":"s3://bucket/video.mov","quality":"best"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	js := tork.JobSummary{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &js))
+	assert.Equal(t, "transcode", js.Name)
+	assert.Equal(t, "best", js.Inputs["quality"])
+	j, err := ds.GetJobByID(context.Background(), js.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t-t0k3n", j.Secrets["token"])
+
+	// the inputs are validated against the parameters
+	w = do("POST", "/templates/"+name+"@1/run", `{"inputs":{"source":"s3://bucket/video.mov","quality":"best"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do("POST", "/templates/"+name+"/run", `{"inputs":{}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// sub-jobs can reference a template
+	w = do("POST", "/jobs", fmt.Sprintf(`{
+		"name":"test job",
+		"tasks":[{"name":"sub","subjob":{"template":"%s@1","inputs":{"source":"s3://bucket/other.mov"}}}]
+	}`, name))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &js))
+	j, err = ds.GetJobByID(context.Background(), js.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "transcode", j.Tasks[0].SubJob.Name)
+	assert.Equal(t, "low", j.Tasks[0].SubJob.Inputs["quality"])
+	assert.Len(t, j.Tasks[0].SubJob.Tasks, 1)
+
+	// scheduled jobs can reference a template
+	w = do("POST", "/scheduled-jobs", fmt.Sprintf(`{
+		"template":"%s",
+		"inputs":{"source":"s3://bucket/video.mov"},
+		"schedule":{"cron":"0 0 * * *"}
+	}`, name))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"transcode"`)
 
+	w = do("DELETE", "/templates/"+name+"@2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("GET", "/templates/"+name, "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tmpl))
+	assert.Equal(t, 1, tmpl.Version)
+	w = do("DELETE", "/templates/"+name, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("DELETE", "/templates/"+name, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.NoError(t, ds.Close())
 }
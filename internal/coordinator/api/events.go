@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/internal/wildcard"
+	"github.com/runabol/tork/middleware/job"
+	"github.com/runabol/tork/middleware/task"
+)
+
+// eventsBufferSize is the number of events which can be
+// waiting to be sent to an events stream.
+const eventsBufferSize = 100
+
+// eventTopics maps the name of each event which can be
+// streamed to the broker topic it is published on.
+var eventTopics = []struct {
+	name  string
+	topic string
+}{
+	{"job.scheduled", broker.TOPIC_JOB_SCHEDULED},
+	{"job.running", broker.TOPIC_JOB_RUNNING},
+	{"job.paused", broker.TOPIC_JOB_PAUSED},
+	{"job.progress", broker.TOPIC_JOB_PROGRESS},
+	{"job.completed", broker.TOPIC_JOB_COMPLETED},
+	{"job.failed", broker.TOPIC_JOB_FAILED},
+	{"job.cancelled", broker.TOPIC_JOB_CANCELLED},
+	{"task.scheduled", broker.TOPIC_TASK_SCHEDULED},
+	{"task.running", broker.TOPIC_TASK_RUNNING},
+	{"task.progress", broker.TOPIC_TASK_PROGRESS},
+	{"task.completed", broker.TOPIC_TASK_COMPLETED},
+	{"task.skipped", broker.TOPIC_TASK_SKIPPED},
+	{"task.failed", broker.TOPIC_TASK_FAILED},
+	{"task.cancelled", broker.TOPIC_TASK_CANCELLED},
+}
+
+// event is a job/task event which is sent to an events stream.
+type event struct {
+	name  string
+	jobID string
+	job   *tork.Job
+	task  *tork.Task
+}
+
+// eventsFilter decides which of the events the current user
+// is allowed to see, based on the permissions of their jobs.
+type eventsFilter struct {
+	s        *API
+	username string
+	user     *tork.User
+	roles    []string
+	// visible caches whether the user can see a job's events
+	visible map[string]bool
+}
+
+// streamEvents
+// @Summary Stream job and task events
+// @Description Sends the state changes and progress updates of the jobs and their tasks
+// @Description as Server-Sent Events, as they happen. The name of each event is its topic
+// @Description (e.g. job.completed, task.running) and its data is the job or the task.
+// @Tags jobs
+// @Produce text/event-stream
+// @Success 200 {object} tork.Job
+// @Router /events [get]
+// @Param jobId query string false "Only stream the events of this job"
+// @Param topic query string false "Topic pattern (e.g. job.*, task.completed). Defaults to all job and task events"
+func (s *API) streamEvents(c echo.Context) error {
+	ctx := c.Request().Context()
+	jobID := c.QueryParam("jobId")
+	pattern := c.QueryParam("topic")
+	topics := make(map[string]string)
+	for _, et := range eventTopics {
+		if pattern == "" || wildcard.Match(pattern, et.name) {
+			topics[et.topic] = et.name
+		}
+	}
+	if len(topics) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid topic: %s", pattern))
+	}
+	f := &eventsFilter{s: s, visible: make(map[string]bool)}
+	if currentUser := ctx.Value(tork.USERNAME); currentUser != nil {
+		cu, ok := currentUser.(string)
+		if !ok {
+			return errors.Errorf("error casting current user")
+		}
+		f.username = cu
+	}
+	if jobID != "" {
+		j, err := s.ds.GetJobByID(ctx, jobID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		ok, err := f.canSee(ctx, j)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return echo.NewHTTPError(http.StatusForbidden, "access denied")
+		}
+	}
+	events := make(chan event, eventsBufferSize)
+	// the broker's callbacks must never block, so a client which
+	// falls too far behind has its stream closed instead.
+	slow := make(chan any)
+	var once sync.Once
+	for topic, name := range topics {
+		if err := s.broker.SubscribeForEvents(ctx, topic, func(ev any) {
+			e := event{name: name}
+			switch v := ev.(type) {
+			case *tork.Job:
+				e.jobID, e.job = v.ID, v
+			case *tork.Task:
+				e.jobID, e.task = v.JobID, v
+			default:
+				log.Error().Msgf("unknown event type: %T", ev)
+				return
+			}
+			if jobID != "" && e.jobID != jobID {
+				return
+			}
+			select {
+			case events <- e:
+			default:
+				once.Do(func() { close(slow) })
+			}
+		}); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error subscribing for events")
+		}
+	}
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.terminate:
+			return nil
+		case <-slow:
+			log.Warn().Msg("closing the events stream of a slow client")
+			return nil
+		case e := <-events:
+			ok, err := f.canSeeJob(ctx, e.jobID)
+			if err != nil {
+				log.Error().Err(err).Msgf("error checking access to job %s", e.jobID)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			data, err := s.redactEvent(ctx, e)
+			if err != nil {
+				log.Error().Err(err).Msgf("error redacting %s event of job %s", e.name, e.jobID)
+				continue
+			}
+			b, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", e.name, b); err != nil {
+				return err
+			}
+			res.Flush()
+		}
+	}
+}
+
+// redactEvent runs the event's job or task through the same read
+// middleware as the jobs API so that secrets are never streamed.
+// The event is copied first as it may be shared with other
+// subscribers.
+func (s *API) redactEvent(ctx context.Context, e event) (any, error) {
+	if e.job != nil {
+		j := e.job.Clone()
+		if err := s.onReadJob(ctx, job.Read, j); err != nil {
+			return nil, err
+		}
+		return j, nil
+	}
+	t := e.task.Clone()
+	if err := s.onReadTask(ctx, task.Read, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (f *eventsFilter) canSeeJob(ctx context.Context, jobID string) (bool, error) {
+	if f.username == "" {
+		return true, nil
+	}
+	if ok, cached := f.visible[jobID]; cached {
+		return ok, nil
+	}
+	j, err := f.s.ds.GetJobByID(ctx, jobID)
+	if err != nil {
+		return false, err
+	}
+	return f.canSee(ctx, j)
+}
+
+func (f *eventsFilter) canSee(ctx context.Context, j *tork.Job) (bool, error) {
+	if f.username == "" || len(j.Permissions) == 0 {
+		f.visible[j.ID] = true
+		return true, nil
+	}
+	if f.user == nil {
+		u, err := f.s.ds.GetUser(ctx, f.username)
+		if err != nil {
+			return false, err
+		}
+		roles, err := f.s.ds.GetUserRoles(ctx, u.ID)
+		if err != nil {
+			return false, err
+		}
+		for _, r := range roles {
+			f.roles = append(f.roles, r.ID)
+		}
+		f.user = u
+	}
+	ok := false
+	for _, p := range j.Permissions {
+		if p.User != nil && p.User.Username == f.username {
+			ok = true
+			break
+		}
+		if p.Role != nil && slices.Contains(f.roles, p.Role.ID) {
+			ok = true
+			break
+		}
+	}
+	f.visible[j.ID] = ok
+	return ok, nil
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/middleware/job"
+	"github.com/runabol/tork/middleware/task"
+)
+
+// logStreamCheckInterval is the interval at which a log
+// stream checks whether its task/job has finished.
+var logStreamCheckInterval = time.Second
+
+// logStreamBufferSize is the number of live log parts
+// which can be waiting to be sent to a log stream.
+const logStreamBufferSize = 100
+
+// logStream streams the log parts of a task or a job
+// as Server-Sent Events.
+type logStream struct {
+	c echo.Context
+	// fetch returns a page of the log parts which were
+	// already persisted, in descending order.
+	fetch func(ctx context.Context, page int) (*datastore.Page[*tork.TaskLogPart], error)
+	// accept reports whether a live log part belongs to the stream.
+	accept func(ctx context.Context, p *tork.TaskLogPart) bool
+	// finished reports whether the task/job reached a terminal state.
+	finished func(ctx context.Context) (string, bool, error)
+	// seen holds the number of the last part sent for each task.
+	seen map[string]int
+}
+
+// streamTaskLog
+// @Summary Stream a task's log
+// @Description Sends the existing log parts of the task and then the new ones as they
+// @Description are received, as Server-Sent Events. The stream is closed when the task finishes.
+// @Tags tasks
+// @Produce text/event-stream
+// @Success 200 {object} tork.TaskLogPart
+// @Router /tasks/{id}/log/stream [get]
+// @Param id path string true "Task ID"
+func (s *API) streamTaskLog(c echo.Context) error {
+	id := c.Param("id")
+	ctx := c.Request().Context()
+	t, err := s.ds.GetTaskByID(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := s.onReadTask(ctx, task.Read, t); err != nil {
+		return err
+	}
+	ls := &logStream{
+		c: c,
+		fetch: func(ctx context.Context, page int) (*datastore.Page[*tork.TaskLogPart], error) {
+			return s.ds.GetTaskLogParts(ctx, id, "", page, MAX_LOG_PAGE_SIZE)
+		},
+		accept: func(_ context.Context, p *tork.TaskLogPart) bool {
+			return p.TaskID == id
+		},
+		finished: func(ctx context.Context) (string, bool, error) {
+			t, err := s.ds.GetTaskByID(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return t.State, !t.IsActive(), nil
+		},
+	}
+	return s.streamLog(ls)
+}
+
+// streamJobLog
+// @Summary Stream a job's log
+// @Description Sends the existing log parts of the job's tasks and then the new ones as they
+// @Description are received, as Server-Sent Events. The stream is closed when the job finishes.
+// @Tags jobs
+// @Produce text/event-stream
+// @Success 200 {object} tork.TaskLogPart
+// @Router /jobs/{id}/log/stream [get]
+// @Param id path string true "Job ID"
+func (s *API) streamJobLog(c echo.Context) error {
+	id := c.Param("id")
+	ctx := c.Request().Context()
+	j, err := s.ds.GetJobByID(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := s.onReadJob(ctx, job.Read, j); err != nil {
+		return err
+	}
+	// whether the tasks which sent log parts belong to the job
+	tasks := make(map[string]bool)
+	ls := &logStream{
+		c: c,
+		fetch: func(ctx context.Context, page int) (*datastore.Page[*tork.TaskLogPart], error) {
+			return s.ds.GetJobLogParts(ctx, id, "", page, MAX_LOG_PAGE_SIZE)
+		},
+		accept: func(ctx context.Context, p *tork.TaskLogPart) bool {
+			ok, known := tasks[p.TaskID]
+			if !known {
+				t, err := s.ds.GetTaskByID(ctx, p.TaskID)
+				if err != nil {
+					log.Error().Err(err).Msgf("error getting task %s", p.TaskID)
+					return false
+				}
+				ok = t.JobID == id
+				tasks[p.TaskID] = ok
+			}
+			return ok
+		},
+		finished: func(ctx context.Context) (string, bool, error) {
+			j, err := s.ds.GetJobByID(ctx, id)
+			if err != nil {
+				return "", false, err
+			}
+			return j.State, j.State == tork.JobStateCompleted ||
+				j.State == tork.JobStateFailed ||
+				j.State == tork.JobStateCancelled, nil
+		},
+	}
+	return s.streamLog(ls)
+}
+
+func (s *API) streamLog(ls *logStream) error {
+	ctx := ls.c.Request().Context()
+	ls.seen = make(map[string]int)
+	// subscribe before reading the existing parts
+	// so no part is missed in between
+	live := make(chan *tork.TaskLogPart, logStreamBufferSize)
+	// the broker's callbacks must never block, so a client which
+	// falls too far behind has its stream closed instead.
+	slow := make(chan any)
+	var once sync.Once
+	if err := s.broker.SubscribeForEvents(ctx, broker.TOPIC_LOG_PART, func(ev any) {
+		p, ok := ev.(*tork.TaskLogPart)
+		if !ok {
+			log.Error().Msgf("error casting log part: %v", ev)
+			return
+		}
+		select {
+		case live <- p:
+		default:
+			once.Do(func() { close(slow) })
+		}
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error subscribing for log parts")
+	}
+	res := ls.c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	if err := ls.sendExisting(ctx); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(logStreamCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.terminate:
+			return nil
+		case <-slow:
+			log.Warn().Msg("closing the log stream of a slow client")
+			return nil
+		case p := <-live:
+			if !ls.accept(ctx, p) {
+				continue
+			}
+			if err := ls.send(p); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			state, done, err := ls.finished(ctx)
+			if err != nil {
+				return err
+			}
+			if !done {
+				continue
+			}
+			// send the parts which were persisted
+			// right before the task/job finished
+			if err := ls.sendExisting(ctx); err != nil {
+				return err
+			}
+			for len(live) > 0 {
+				if p := <-live; ls.accept(ctx, p) {
+					if err := ls.send(p); err != nil {
+						return err
+					}
+				}
+			}
+			return ls.event("end", map[string]string{"state": state})
+		}
+	}
+}
+
+// sendExisting sends the persisted log parts
+// which were not sent yet, oldest first.
+func (ls *logStream) sendExisting(ctx context.Context) error {
+	var parts []*tork.TaskLogPart
+	for page := 1; ; page++ {
+		p, err := ls.fetch(ctx, page)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, p.Items...)
+		if page >= p.TotalPages {
+			break
+		}
+	}
+	slices.Reverse(parts)
+	for _, p := range parts {
+		if err := ls.send(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ls *logStream) send(p *tork.TaskLogPart) error {
+	if n, ok := ls.seen[p.TaskID]; ok && p.Number <= n {
+		return nil
+	}
+	ls.seen[p.TaskID] = p.Number
+	return ls.event("log", p)
+}
+
+func (ls *logStream) event(name string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	res := ls.c.Response()
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", name, b); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
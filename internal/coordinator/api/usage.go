@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/middleware/job"
+)
+
+// jobUsage is the resource usage of a job and of each of its task attempts.
+type jobUsage struct {
+	JobID string         `json:"jobId"`
+	Total *tork.JobUsage `json:"total"`
+	Tasks []*taskUsage   `json:"tasks"`
+}
+
+type taskUsage struct {
+	ID     string           `json:"id"`
+	Name   string           `json:"name,omitempty"`
+	State  tork.TaskState   `json:"state"`
+	Queue  string           `json:"queue,omitempty"`
+	NodeID string           `json:"nodeId,omitempty"`
+	Limits *tork.TaskLimits `json:"limits,omitempty"`
+	Usage  *tork.TaskUsage  `json:"usage,omitempty"`
+}
+
+// getJobUsage
+// @Summary Get the resource usage of a job
+// @Description Returns the wall time, CPU time, peak memory and IO of the job's
+// @Description task attempts, along with their total.
+// @Tags jobs
+// @Produce application/json
+// @Success 200 {object} jobUsage
+// @Failure 404 {object} echo.HTTPError
+// @Router /jobs/{id}/usage [get]
+// @Param id path string true "Job ID"
+func (s *API) getJobUsage(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	j, err := s.ds.GetJobByID(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+	if err := s.onReadJob(ctx, job.Read, j); err != nil {
+		return err
+	}
+	tasks := make([]*taskUsage, 0, len(j.Execution))
+	for _, t := range j.Execution {
+		tasks = append(tasks, &taskUsage{
+			ID:     t.ID,
+			Name:   t.Name,
+			State:  t.State,
+			Queue:  t.Queue,
+			NodeID: t.NodeID,
+			Limits: t.Limits,
+			Usage:  t.Usage,
+		})
+	}
+	return c.JSON(http.StatusOK, jobUsage{
+		JobID: j.ID,
+		Total: tork.NewJobUsage(j.Execution),
+		Tasks: tasks,
+	})
+}
@@ -2,6 +2,7 @@ package coordinator
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"time"
 
@@ -14,6 +15,8 @@ import (
 	"github.com/runabol/tork/internal/coordinator/api"
 	"github.com/runabol/tork/internal/coordinator/handlers"
 	"github.com/runabol/tork/internal/host"
+	"github.com/runabol/tork/internal/metrics"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/locker"
 
 	"github.com/runabol/tork/input"
@@ -22,11 +25,30 @@ import (
 	"github.com/runabol/tork/middleware/task"
 	"github.com/runabol/tork/middleware/web"
 
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 
 	"github.com/runabol/tork/internal/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// retryPollInterval is the frequency at which the coordinator
+// checks for retry tasks whose backoff delay has elapsed
+const retryPollInterval = time.Second
+
+// timeoutPollInterval is the frequency at which the coordinator
+// checks for running jobs which exceeded their timeout or deadline
+const timeoutPollInterval = time.Second
+
+// reaperInterval is the frequency at which the coordinator
+// checks for tasks assigned to nodes which stopped sending
+// heartbeats
+const reaperInterval = time.Minute
+
+// reaperLockKey guards the reaper so that only one
+// coordinator in the cluster runs it at a time
+const reaperLockKey = "coordinator.reaper"
+
 // Coordinator is responsible for accepting tasks from
 // clients, scheduling tasks for workers to execute and for
 // exposing the cluster's state to the outside world.
@@ -37,6 +59,7 @@ type Coordinator struct {
 	broker         broker.Broker
 	api            *api.API
 	ds             datastore.Datastore
+	locker         locker.Locker
 	queues         map[string]int
 	onPending      task.HandlerFunc
 	onStarted      task.HandlerFunc
@@ -47,19 +70,26 @@ type Coordinator struct {
 	onLogPart      func(*tork.TaskLogPart)
 	onProgress     task.HandlerFunc
 	onScheduledJob func(ctx context.Context, s *tork.ScheduledJob) error
+	onJobTrigger   func(ctx context.Context, j *tork.Job) error
 	stop           chan any
 }
 
 type Config struct {
-	Name       string
-	Broker     broker.Broker
-	DataStore  datastore.Datastore
-	Locker     locker.Locker
-	Address    string
-	Queues     map[string]int
-	Endpoints  map[string]web.HandlerFunc
-	Enabled    map[string]bool
-	Middleware Middleware
+	Name      string
+	Broker    broker.Broker
+	DataStore datastore.Datastore
+	Locker    locker.Locker
+	// ArtifactStore is the store used to pass artifacts between
+	// tasks. Artifacts are not served by the API when nil.
+	ArtifactStore artifact.Store
+	Address       string
+	Queues        map[string]int
+	Endpoints     map[string]web.HandlerFunc
+	Enabled       map[string]bool
+	Middleware    Middleware
+	// HookBodyLimit is the maximum size, in bytes,
+	// of the body of an inbound webhook.
+	HookBodyLimit int64
 }
 
 type Middleware struct {
@@ -114,17 +144,19 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 		cfg.Queues[broker.QUEUE_PROGRESS] = 1
 	}
 	api, err := api.NewAPI(api.Config{
-		Broker:    cfg.Broker,
-		DataStore: cfg.DataStore,
-		Address:   cfg.Address,
+		Broker:        cfg.Broker,
+		DataStore:     cfg.DataStore,
+		ArtifactStore: cfg.ArtifactStore,
+		Address:       cfg.Address,
 		Middleware: api.Middleware{
 			Web:  cfg.Middleware.Web,
 			Echo: cfg.Middleware.Echo,
 			Job:  cfg.Middleware.Job,
 			Task: cfg.Middleware.Task,
 		},
-		Endpoints: cfg.Endpoints,
-		Enabled:   cfg.Enabled,
+		Endpoints:     cfg.Endpoints,
+		Enabled:       cfg.Enabled,
+		HookBodyLimit: cfg.HookBodyLimit,
 	})
 	if err != nil {
 		return nil, err
@@ -176,11 +208,12 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 		cfg.Middleware.Node,
 	)
 
-	onLogPart := handlers.NewLogHandler(cfg.DataStore)
+	onLogPart := handlers.NewLogHandler(cfg.DataStore, cfg.Broker)
 
 	onProgress := task.ApplyMiddleware(
 		handlers.NewProgressHandler(
 			cfg.DataStore,
+			cfg.Broker,
 			onJob,
 		),
 		cfg.Middleware.Task,
@@ -198,6 +231,7 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 		api:            api,
 		broker:         cfg.Broker,
 		ds:             cfg.DataStore,
+		locker:         cfg.Locker,
 		queues:         cfg.Queues,
 		onPending:      onPending,
 		onStarted:      onStarted,
@@ -208,6 +242,7 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 		onLogPart:      onLogPart,
 		onProgress:     onProgress,
 		onScheduledJob: onScheduledJob,
+		onJobTrigger:   handlers.NewJobTriggerHandler(cfg.DataStore, cfg.Broker),
 		stop:           make(chan any),
 	}, nil
 }
@@ -231,22 +266,22 @@ func (c *Coordinator) Start() error {
 			var err error
 			switch qname {
 			case broker.QUEUE_PENDING:
-				pendingHandler := c.taskHandler(c.onPending)
+				pendingHandler := c.taskHandler(c.traceTask(qname, c.onPending))
 				err = c.broker.SubscribeForTasks(qname, func(t *tork.Task) error {
 					return pendingHandler(context.Background(), task.StateChange, t)
 				})
 			case broker.QUEUE_COMPLETED:
-				completedHandler := c.taskHandler(c.onCompleted)
+				completedHandler := c.taskHandler(c.traceTask(qname, c.onCompleted))
 				err = c.broker.SubscribeForTasks(qname, func(t *tork.Task) error {
 					return completedHandler(context.Background(), task.StateChange, t)
 				})
 			case broker.QUEUE_STARTED:
-				startedHandler := c.taskHandler(c.onStarted)
+				startedHandler := c.taskHandler(c.traceTask(qname, c.onStarted))
 				err = c.broker.SubscribeForTasks(qname, func(t *tork.Task) error {
 					return startedHandler(context.Background(), task.StateChange, t)
 				})
 			case broker.QUEUE_ERROR:
-				errorHandler := c.taskHandler(c.onError)
+				errorHandler := c.taskHandler(c.traceTask(qname, c.onError))
 				err = c.broker.SubscribeForTasks(qname, func(t *tork.Task) error {
 					return errorHandler(context.Background(), task.StateChange, t)
 				})
@@ -255,7 +290,7 @@ func (c *Coordinator) Start() error {
 					return c.onHeartbeat(context.Background(), n)
 				})
 			case broker.QUEUE_JOBS:
-				jobHandler := c.jobHandler(c.onJob)
+				jobHandler := c.jobHandler(c.traceJob(c.onJob))
 				err = c.broker.SubscribeForJobs(func(j *tork.Job) error {
 					return jobHandler(context.Background(), job.StateChange, j)
 				})
@@ -286,7 +321,25 @@ func (c *Coordinator) Start() error {
 	}); err != nil {
 		return err
 	}
+	// start the scheduled jobs triggered by finished jobs
+	for _, topic := range []string{broker.TOPIC_JOB_COMPLETED, broker.TOPIC_JOB_FAILED} {
+		if err := c.broker.SubscribeForEvents(context.Background(), topic, func(ev any) {
+			j, ok := ev.(*tork.Job)
+			if !ok {
+				log.Error().Msgf("error casting job: %v", ev)
+				return
+			}
+			if err := c.onJobTrigger(context.Background(), j); err != nil {
+				log.Error().Err(err).Msgf("error handling job triggers: %s", j.ID)
+			}
+		}); err != nil {
+			return err
+		}
+	}
 	go c.sendHeartbeats()
+	go c.releaseRetryTasks()
+	go c.timeoutJobs()
+	go c.reapLostTasks()
 	return nil
 }
 
@@ -319,6 +372,42 @@ func (c *Coordinator) jobHandler(handler job.HandlerFunc) job.HandlerFunc {
 	}
 }
 
+// traceTask runs the handler of a task message in a span which is
+// part of the trace of the task's job. Tasks which aren't scheduled
+// yet have no trace.
+func (c *Coordinator) traceTask(qname string, handler task.HandlerFunc) task.HandlerFunc {
+	return func(ctx context.Context, et task.EventType, t *tork.Task) error {
+		if t.TraceParent == "" {
+			return handler(ctx, et, t)
+		}
+		ctx, span := tracing.Start(tracing.Extract(ctx, t.TraceParent), "coordinator."+qname,
+			attribute.String("tork.job.id", t.JobID),
+			attribute.String("tork.task.id", t.ID),
+			attribute.String("tork.task.state", string(t.State)),
+		)
+		err := handler(ctx, et, t)
+		tracing.End(span, err)
+		return err
+	}
+}
+
+// traceJob runs the handler of a job message
+// in a span which is part of the job's trace.
+func (c *Coordinator) traceJob(handler job.HandlerFunc) job.HandlerFunc {
+	return func(ctx context.Context, et job.EventType, j *tork.Job) error {
+		if j.TraceParent == "" {
+			return handler(ctx, et, j)
+		}
+		ctx, span := tracing.Start(tracing.Extract(ctx, j.TraceParent), "coordinator."+broker.QUEUE_JOBS,
+			attribute.String("tork.job.id", j.ID),
+			attribute.String("tork.job.state", string(j.State)),
+		)
+		err := handler(ctx, et, j)
+		tracing.End(span, err)
+		return err
+	}
+}
+
 func (c *Coordinator) Stop() error {
 	log.Debug().Msgf("shutting down %s", c.Name)
 	close(c.stop)
@@ -366,3 +455,198 @@ func (c *Coordinator) sendHeartbeats() {
 		}
 	}
 }
+
+// releaseRetryTasks periodically publishes retry tasks
+// whose backoff delay has elapsed to the pending queue.
+func (c *Coordinator) releaseRetryTasks() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(retryPollInterval):
+		}
+		ctx := context.Background()
+		tasks, err := c.ds.GetRetryTasks(ctx, time.Now().UTC())
+		if err != nil {
+			log.Error().Err(err).Msg("error getting retry tasks")
+			continue
+		}
+		for _, t := range tasks {
+			if err := c.releaseRetryTask(ctx, t); err != nil {
+				log.Error().Err(err).Msgf("error releasing retry task %s", t.ID)
+			}
+		}
+	}
+}
+
+func (c *Coordinator) releaseRetryTask(ctx context.Context, t *tork.Task) error {
+	// another coordinator may have already released the task
+	// so we only proceed if we were the ones to change its state.
+	released := false
+	if err := c.ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		// locking the job keeps it from being paused while the
+		// task is released. The retries of a paused job are held
+		// until it is resumed.
+		paused := false
+		if err := tx.UpdateJob(ctx, t.JobID, func(u *tork.Job) error {
+			paused = u.State == tork.JobStatePaused
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "error locking job in datastore")
+		}
+		if paused {
+			return nil
+		}
+		return tx.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
+			if u.State != tork.TaskStateCreated {
+				return nil
+			}
+			u.State = tork.TaskStatePending
+			released = true
+			return nil
+		})
+	}); err != nil {
+		return errors.Wrapf(err, "error updating task in datastore")
+	}
+	if !released {
+		return nil
+	}
+	t.State = tork.TaskStatePending
+	return c.broker.PublishTask(ctx, broker.QUEUE_PENDING, t)
+}
+
+// timeoutJobs periodically fails unfinished jobs, paused
+// ones included, which exceeded their timeout or deadline.
+func (c *Coordinator) timeoutJobs() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(timeoutPollInterval):
+		}
+		ctx := context.Background()
+		jobs, err := c.ds.GetTimedOutJobs(ctx, time.Now().UTC())
+		if err != nil {
+			log.Error().Err(err).Msg("error getting timed out jobs")
+			continue
+		}
+		for _, j := range jobs {
+			if err := c.timeoutJob(ctx, j); err != nil {
+				log.Error().Err(err).Msgf("error timing out job %s", j.ID)
+			}
+		}
+	}
+}
+
+func (c *Coordinator) timeoutJob(ctx context.Context, j *tork.Job) error {
+	now := time.Now().UTC()
+	var errMsg string
+	if j.Deadline != nil && j.TimeoutAt.Equal(*j.Deadline) {
+		errMsg = fmt.Sprintf("job exceeded its deadline of %s", j.Deadline.Format(time.RFC3339))
+	} else {
+		errMsg = fmt.Sprintf("job exceeded its timeout of %s", handlers.JobTimeout(j))
+	}
+	// another coordinator may have already timed out the job
+	// so we only proceed if we were the ones to change its state.
+	timedOut := false
+	if err := c.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
+		if u.State != tork.JobStateRunning && u.State != tork.JobStateScheduled && u.State != tork.JobStatePaused {
+			return nil
+		}
+		u.State = tork.JobStateFailed
+		u.FailedAt = &now
+		u.Error = errMsg
+		timedOut = true
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "error updating job in datastore")
+	}
+	if !timedOut {
+		return nil
+	}
+	log.Debug().Msgf("job %s timed out: %s", j.ID, errMsg)
+	// the job handler won't count the job
+	// as it finds it already FAILED
+	metrics.JobsTotal.Inc(string(tork.JobStateFailed))
+	// let the job handler cancel the job's
+	// active tasks and notify any parent job
+	j.State = tork.JobStateFailed
+	j.FailedAt = &now
+	j.Error = errMsg
+	return c.broker.PublishJob(ctx, j)
+}
+
+// reapLostTasks periodically fails tasks which are assigned
+// to nodes that stopped sending heartbeats, so they can go
+// through the normal retry/failure path.
+func (c *Coordinator) reapLostTasks() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(reaperInterval):
+		}
+		if err := c.reap(context.Background()); err != nil {
+			log.Error().Err(err).Msg("error reaping lost tasks")
+		}
+	}
+}
+
+func (c *Coordinator) reap(ctx context.Context) error {
+	lock, err := c.locker.AcquireLock(ctx, reaperLockKey)
+	if err != nil {
+		// another coordinator is currently reaping
+		log.Debug().Err(err).Msg("unable to acquire the reaper lock")
+		return nil
+	}
+	defer func() {
+		if err := lock.ReleaseLock(ctx); err != nil {
+			log.Error().Err(err).Msg("error releasing the reaper lock")
+		}
+	}()
+	tasks, err := c.ds.GetLostTasks(ctx, time.Now().UTC().Add(-tork.LAST_HEARTBEAT_TIMEOUT))
+	if err != nil {
+		return errors.Wrapf(err, "error getting lost tasks")
+	}
+	for _, t := range tasks {
+		if err := c.reapLostTask(ctx, t); err != nil {
+			log.Error().Err(err).Msgf("error reaping lost task %s", t.ID)
+		}
+	}
+	return nil
+}
+
+func (c *Coordinator) reapLostTask(ctx context.Context, t *tork.Task) error {
+	now := time.Now().UTC()
+	errMsg := fmt.Sprintf("node %s lost: no heartbeat received for over %s", t.NodeID, tork.LAST_HEARTBEAT_TIMEOUT)
+	// the task may have completed or failed since
+	// it was fetched, so we only proceed if it's
+	// still active on the lost node.
+	reaped := false
+	if err := c.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
+		if !u.IsActive() || u.NodeID != t.NodeID {
+			return nil
+		}
+		u.State = tork.TaskStateFailed
+		u.FailedAt = &now
+		u.Error = errMsg
+		reaped = true
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "error updating task in datastore")
+	}
+	if !reaped {
+		return nil
+	}
+	log.Warn().
+		Str("task-id", t.ID).
+		Str("node-id", t.NodeID).
+		Msg("reaped task assigned to a lost node")
+	t.State = tork.TaskStateFailed
+	t.FailedAt = &now
+	t.Error = errMsg
+	// hand the task over to the error handler
+	// which decides whether to retry it or
+	// fail the job.
+	return c.broker.PublishTask(ctx, broker.QUEUE_ERROR, t)
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 	"github.com/runabol/tork/middleware/node"
 	"github.com/runabol/tork/middleware/task"
 
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/internal/worker"
 	"github.com/runabol/tork/runtime/docker"
@@ -399,6 +402,359 @@ func Test_sendHeartbeat(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_releaseRetryTasks(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	processed := make(chan string, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(tk *tork.Task) error {
+		processed <- tk.ID
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	c, err := NewCoordinator(Config{
+		Broker:    b,
+		DataStore: ds,
+		Locker:    locker.NewInMemoryLocker(),
+		Address:   fmt.Sprintf(":%d", rand.Int31n(60000)+5000),
+	})
+	assert.NoError(t, err)
+
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateRunning,
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	retryAt := now.Add(-time.Second)
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		State:     tork.TaskStateCreated,
+		CreatedAt: &now,
+		RetryAt:   &retryAt,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	go c.releaseRetryTasks()
+
+	assert.Equal(t, t1.ID, <-processed)
+
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStatePending, t2.State)
+
+	// the task should only be released once
+	err = c.releaseRetryTask(ctx, t1)
+	assert.NoError(t, err)
+	select {
+	case <-processed:
+		t.Fatal("expected the task to be released only once")
+	case <-time.After(time.Millisecond * 100):
+	}
+	close(c.stop)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_releaseRetryTaskOfPausedJob(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	processed := make(chan string, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(tk *tork.Task) error {
+		processed <- tk.ID
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	c, err := NewCoordinator(Config{
+		Broker:    b,
+		DataStore: ds,
+		Locker:    locker.NewInMemoryLocker(),
+		Address:   fmt.Sprintf(":%d", rand.Int31n(60000)+5000),
+	})
+	assert.NoError(t, err)
+
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStatePaused,
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	retryAt := now.Add(-time.Second)
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		State:     tork.TaskStateCreated,
+		CreatedAt: &now,
+		RetryAt:   &retryAt,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	retries, err := ds.GetRetryTasks(ctx, now)
+	assert.NoError(t, err)
+	for _, r := range retries {
+		assert.NotEqual(t, t1.ID, r.ID)
+	}
+
+	err = c.releaseRetryTask(ctx, t1)
+	assert.NoError(t, err)
+	select {
+	case <-processed:
+		t.Fatal("expected the retry of a paused job to be held")
+	case <-time.After(time.Millisecond * 100):
+	}
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateCreated, t2.State)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_timeoutJobs(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	processed := make(chan *tork.Job, 1)
+	err := b.SubscribeForJobs(func(j *tork.Job) error {
+		processed <- j
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	c, err := NewCoordinator(Config{
+		Broker:    b,
+		DataStore: ds,
+		Locker:    locker.NewInMemoryLocker(),
+		Address:   fmt.Sprintf(":%d", rand.Int31n(60000)+5000),
+	})
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	timeoutAt := now.Add(-time.Second)
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		Timeout:   "5m",
+		TimeoutAt: &timeoutAt,
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+	failed := jobsFailed(t)
+
+	go c.timeoutJobs()
+
+	j2 := <-processed
+	assert.Equal(t, j1.ID, j2.ID)
+	assert.Equal(t, tork.JobStateFailed, j2.State)
+	assert.Equal(t, "job exceeded its timeout of 5m", j2.Error)
+	assert.Equal(t, failed+1, jobsFailed(t))
+
+	j3, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateFailed, j3.State)
+	assert.Equal(t, "job exceeded its timeout of 5m", j3.Error)
+	assert.NotNil(t, j3.FailedAt)
+
+	// the job should only be timed out once
+	err = c.timeoutJob(ctx, j1)
+	assert.NoError(t, err)
+	select {
+	case <-processed:
+		t.Fatal("expected the job to be timed out only once")
+	case <-time.After(time.Millisecond * 100):
+	}
+	close(c.stop)
+	assert.NoError(t, ds.Close())
+}
+
+// jobsFailed returns the number of jobs counted as FAILED.
+func jobsFailed(t *testing.T) float64 {
+	var sb strings.Builder
+	assert.NoError(t, metrics.Write(&sb))
+	for _, line := range strings.Split(sb.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, `tork_jobs_total{state="FAILED"} `); ok {
+			n, err := strconv.ParseFloat(v, 64)
+			assert.NoError(t, err)
+			return n
+		}
+	}
+	return 0
+}
+
+func Test_timeoutJobWithDefaults(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	c, err := NewCoordinator(Config{
+		Broker:    b,
+		DataStore: ds,
+		Locker:    locker.NewInMemoryLocker(),
+		Address:   fmt.Sprintf(":%d", rand.Int31n(60000)+5000),
+	})
+	assert.NoError(t, err)
+
+	timeoutAt := time.Now().UTC().Add(-time.Second)
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		Defaults:  &tork.JobDefaults{Timeout: "1m", JobTimeout: "10m"},
+		TimeoutAt: &timeoutAt,
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+	err = c.timeoutJob(ctx, j1)
+	assert.NoError(t, err)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateFailed, j2.State)
+	assert.Equal(t, "job exceeded its timeout of 10m", j2.Error)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_timeoutPausedJob(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	processed := make(chan *tork.Job, 1)
+	err := b.SubscribeForJobs(func(j *tork.Job) error {
+		processed <- j
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	c, err := NewCoordinator(Config{
+		Broker:    b,
+		DataStore: ds,
+		Locker:    locker.NewInMemoryLocker(),
+		Address:   fmt.Sprintf(":%d", rand.Int31n(60000)+5000),
+	})
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	deadline := now.Add(-time.Second)
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStatePaused,
+		Deadline:  &deadline,
+		TimeoutAt: &deadline,
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	go c.timeoutJobs()
+
+	j2 := <-processed
+	assert.Equal(t, j1.ID, j2.ID)
+	assert.Equal(t, tork.JobStateFailed, j2.State)
+	assert.Contains(t, j2.Error, "job exceeded its deadline")
+
+	j3, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateFailed, j3.State)
+	close(c.stop)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_reapLostTasks(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	processed := make(chan *tork.Task, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_ERROR, func(tk *tork.Task) error {
+		processed <- tk
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	l := locker.NewInMemoryLocker()
+	c, err := NewCoordinator(Config{
+		Broker:    b,
+		DataStore: ds,
+		Locker:    l,
+		Address:   fmt.Sprintf(":%d", rand.Int31n(60000)+5000),
+	})
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	n1 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: now.Add(-tork.LAST_HEARTBEAT_TIMEOUT * 2),
+	}
+	err = ds.CreateNode(ctx, n1)
+	assert.NoError(t, err)
+
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateRunning,
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+		NodeID:    n1.ID,
+		Retry: &tork.TaskRetry{
+			Limit: 1,
+		},
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	// another coordinator holds the lock
+	lock, err := l.AcquireLock(ctx, reaperLockKey)
+	assert.NoError(t, err)
+	err = c.reap(ctx)
+	assert.NoError(t, err)
+	select {
+	case <-processed:
+		t.Fatal("expected the task not to be reaped")
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.NoError(t, lock.ReleaseLock(ctx))
+
+	err = c.reap(ctx)
+	assert.NoError(t, err)
+
+	t2 := <-processed
+	assert.Equal(t, t1.ID, t2.ID)
+	assert.Equal(t, tork.TaskStateFailed, t2.State)
+	assert.Contains(t, t2.Error, "lost")
+	assert.NotNil(t, t2.Retry)
+
+	t3, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateFailed, t3.State)
+	assert.Equal(t, t2.Error, t3.Error)
+
+	// the task should only be reaped once
+	err = c.reap(ctx)
+	assert.NoError(t, err)
+	select {
+	case <-processed:
+		t.Fatal("expected the task to be reaped only once")
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.NoError(t, ds.Close())
+}
+
 func TestRunHelloWorldJob(t *testing.T) {
 	j1 := doRunJob(t, "../../examples/hello.yaml")
 	assert.Equal(t, tork.JobStateCompleted, j1.State)
@@ -8,6 +8,7 @@ import (
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/middleware/job"
 )
 
@@ -26,16 +27,24 @@ func NewCancelHandler(ds datastore.Datastore, b broker.Broker) job.HandlerFunc {
 
 func (h *cancelHandler) handle(ctx context.Context, _ job.EventType, j *tork.Job) error {
 	// mark the job as cancelled
+	cancelled := false
 	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
-		if u.State != tork.JobStateRunning && u.State != tork.JobStateScheduled {
+		if u.State != tork.JobStateRunning &&
+			u.State != tork.JobStateScheduled &&
+			u.State != tork.JobStatePaused &&
+			u.State != tork.JobStateQueued {
 			// job is not running -- nothing to cancel
 			return nil
 		}
 		u.State = tork.JobStateCancelled
+		cancelled = true
 		return nil
 	}); err != nil {
 		return err
 	}
+	if cancelled {
+		metrics.JobsTotal.Inc(string(tork.JobStateCancelled))
+	}
 	// if there's a parent task notify the parent job to cancel as well
 	if j.ParentID != "" {
 		pt, err := h.ds.GetTaskByID(ctx, j.ParentID)
@@ -55,7 +64,15 @@ func (h *cancelHandler) handle(ctx context.Context, _ job.EventType, j *tork.Job
 	if err := cancelActiveTasks(ctx, h.ds, h.broker, j.ID); err != nil {
 		return err
 	}
-
+	// start the next queued instance of the scheduled job
+	if j.Schedule != nil {
+		if err := releaseQueuedJob(ctx, h.ds, h.broker, j.Schedule.ID); err != nil {
+			return err
+		}
+	}
+	if cancelled {
+		return h.broker.PublishEvent(ctx, broker.TOPIC_JOB_CANCELLED, j)
+	}
 	return nil
 }
 
@@ -74,6 +91,8 @@ func cancelActiveTasks(ctx context.Context, ds datastore.Datastore, b broker.Bro
 		}); err != nil {
 			return errors.Wrapf(err, "error cancelling task: %s", t.ID)
 		}
+		metrics.TasksTotal.Inc(string(tork.TaskStateCancelled), t.Queue)
+		publishTaskEvent(ctx, b, broker.TOPIC_TASK_CANCELLED, t)
 		// if this task is a sub-job, notify the sub-job to cancel
 		if t.SubJob != nil {
 			// cancel the sub-job
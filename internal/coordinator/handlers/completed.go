@@ -38,7 +38,12 @@ func (h *completedHandler) handle(ctx context.Context, et task.EventType, t *tor
 		return errors.Errorf("invalid completion state: %s", t.State)
 	}
 	t.CompletedAt = &now
-	return h.completeTask(ctx, t)
+	if err := h.completeTask(ctx, t); err != nil {
+		return err
+	}
+	recordTaskEnd(t, t.State, t.CompletedAt)
+	publishTaskEvent(ctx, h.broker, taskStateTopic(t.State), t)
+	return nil
 }
 
 func (h *completedHandler) completeTask(ctx context.Context, t *tork.Task) error {
@@ -72,21 +77,31 @@ func (h *completedHandler) completeEachTask(ctx context.Context, t *tork.Task) e
 			u.State = t.State
 			u.CompletedAt = t.CompletedAt
 			u.Result = t.Result
+			u.Outputs = t.Outputs
+			u.Usage = t.Usage
 			return nil
 		}); err != nil {
 			return errors.Wrapf(err, "error updating task in datastore")
 		}
+		// the next item is held back while the job is paused
+		paused, err := isJobPaused(ctx, tx, t.JobID)
+		if err != nil {
+			return err
+		}
 		// update parent task
 		if err := tx.UpdateTask(ctx, t.ParentID, func(u *tork.Task) error {
 			u.Each.Completions = u.Each.Completions + 1
 			isLast = u.Each.Completions >= u.Each.Size
+			if paused {
+				return nil
+			}
 			if !isLast && u.Each.Concurrency > 0 && u.Each.Index < u.Each.Size {
-				next, err := h.ds.GetNextTask(ctx, u.ID)
+				next, err := tx.GetNextTask(ctx, u.ID)
 				if err != nil {
 					return err
 				}
 				next.State = tork.TaskStatePending
-				if err := h.ds.UpdateTask(ctx, next.ID, func(nu *tork.Task) error {
+				if err := tx.UpdateTask(ctx, next.ID, func(nu *tork.Task) error {
 					nu.State = tork.TaskStatePending
 					return nil
 				}); err != nil {
@@ -102,12 +117,9 @@ func (h *completedHandler) completeEachTask(ctx context.Context, t *tork.Task) e
 			return errors.Wrapf(err, "error updating task in datastore")
 		}
 		// update job context
-		if t.Result != "" && t.Var != "" {
+		if hasTaskValue(t) {
 			if err := tx.UpdateJob(ctx, t.JobID, func(u *tork.Job) error {
-				if u.Context.Tasks == nil {
-					u.Context.Tasks = make(map[string]string)
-				}
-				u.Context.Tasks[t.Var] = t.Result
+				u.Context.SetTask(t)
 				return nil
 			}); err != nil {
 				return errors.Wrapf(err, "error updating job in datastore")
@@ -145,6 +157,8 @@ func (h *completedHandler) completeParallelTask(ctx context.Context, t *tork.Tas
 			u.State = t.State
 			u.CompletedAt = t.CompletedAt
 			u.Result = t.Result
+			u.Outputs = t.Outputs
+			u.Usage = t.Usage
 			return nil
 		}); err != nil {
 			return errors.Wrapf(err, "error updating task in datastore")
@@ -158,12 +172,9 @@ func (h *completedHandler) completeParallelTask(ctx context.Context, t *tork.Tas
 			return errors.Wrapf(err, "error updating task in datastore")
 		}
 		// update job context
-		if t.Result != "" && t.Var != "" {
+		if hasTaskValue(t) {
 			if err := tx.UpdateJob(ctx, t.JobID, func(u *tork.Job) error {
-				if u.Context.Tasks == nil {
-					u.Context.Tasks = make(map[string]string)
-				}
-				u.Context.Tasks[t.Var] = t.Result
+				u.Context.SetTask(t)
 				return nil
 			}); err != nil {
 				return errors.Wrapf(err, "error updating job in datastore")
@@ -190,6 +201,8 @@ func (h *completedHandler) completeParallelTask(ctx context.Context, t *tork.Tas
 
 func (c *completedHandler) completeTopLevelTask(ctx context.Context, t *tork.Task) error {
 	log.Debug().Str("task-id", t.ID).Msg("received task completion")
+	var ready []*tork.Task
+	var paused bool
 	err := c.ds.WithTx(ctx, func(tx datastore.Datastore) error {
 		// update task in DB
 		if err := tx.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
@@ -201,6 +214,8 @@ func (c *completedHandler) completeTopLevelTask(ctx context.Context, t *tork.Tas
 			u.State = t.State
 			u.CompletedAt = t.CompletedAt
 			u.Result = t.Result
+			u.Outputs = t.Outputs
+			u.Usage = t.Usage
 			return nil
 		}); err != nil {
 			return errors.Wrapf(err, "error updating task in datastore")
@@ -212,16 +227,42 @@ func (c *completedHandler) completeTopLevelTask(ctx context.Context, t *tork.Tas
 			progress = math.Round(progress*100) / 100
 			u.Progress = progress
 			u.Position = u.Position + 1
-			if t.Result != "" && t.Var != "" {
-				if u.Context.Tasks == nil {
-					u.Context.Tasks = make(map[string]string)
-				}
-				u.Context.Tasks[t.Var] = t.Result
-			}
+			paused = u.State == tork.JobStatePaused
+			u.Context.SetTask(t)
 			return nil
 		}); err != nil {
 			return errors.Wrapf(err, "error updating job in datastore")
 		}
+		// create any tasks whose dependencies are now satisfied.
+		// this is done while holding the job's lock so that two
+		// concurrently completing dependencies can't both schedule
+		// the same downstream task.
+		j, err := tx.GetJobByID(ctx, t.JobID)
+		if err != nil {
+			return errors.Wrapf(err, "error getting job from datatstore")
+		}
+		if !hasDependencies(j) {
+			return nil
+		}
+		if j.State != tork.JobStateRunning && j.State != tork.JobStateScheduled {
+			return nil
+		}
+		now := time.Now().UTC()
+		for _, next := range readyTasks(j, false) {
+			next.ID = uuid.NewUUID()
+			next.JobID = j.ID
+			next.State = tork.TaskStatePending
+			next.CreatedAt = &now
+			if err := eval.EvaluateTask(next, j.Context.AsMap()); err != nil {
+				next.Error = err.Error()
+				next.State = tork.TaskStateFailed
+				next.FailedAt = &now
+			}
+			if err := tx.CreateTask(ctx, next); err != nil {
+				return err
+			}
+			ready = append(ready, next)
+		}
 		return nil
 	})
 	if err != nil {
@@ -235,7 +276,25 @@ func (c *completedHandler) completeTopLevelTask(ctx context.Context, t *tork.Tas
 	if err := c.onJob(ctx, job.Progress, j); err != nil {
 		return err
 	}
+	// the job will pick up from here once resumed
+	if paused {
+		log.Debug().Str("job-id", j.ID).Msg("job is paused. holding off scheduling")
+		return nil
+	}
 	now := time.Now().UTC()
+	if hasDependencies(j) {
+		if j.Position > len(j.Tasks) {
+			j.State = tork.JobStateCompleted
+			j.CompletedAt = &now
+			return c.onJob(ctx, job.StateChange, j)
+		}
+		for _, next := range ready {
+			if err := c.broker.PublishTask(ctx, broker.QUEUE_PENDING, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	if j.Position <= len(j.Tasks) {
 		next := j.Tasks[j.Position-1]
 		next.ID = uuid.NewUUID()
@@ -259,3 +318,22 @@ func (c *completedHandler) completeTopLevelTask(ctx context.Context, t *tork.Tas
 	}
 
 }
+
+// isJobPaused locks the job for the remainder of the
+// transaction and reports whether it is paused.
+func isJobPaused(ctx context.Context, tx datastore.Datastore, jobID string) (bool, error) {
+	var paused bool
+	if err := tx.UpdateJob(ctx, jobID, func(u *tork.Job) error {
+		paused = u.State == tork.JobStatePaused
+		return nil
+	}); err != nil {
+		return false, errors.Wrapf(err, "error getting job state from datastore")
+	}
+	return paused, nil
+}
+
+// hasTaskValue returns true if the task produced a
+// value which needs to be recorded in the job's context.
+func hasTaskValue(t *tork.Task) bool {
+	return t.Var != "" && (t.Result != "" || len(t.Outputs) > 0)
+}
@@ -288,6 +288,68 @@ func Test_handleCompletedFirstTask(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_handleCompletedTaskOutputs(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	handler := NewCompletedHandler(ds, b)
+
+	now := time.Now().UTC()
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		Position:  1,
+		TaskCount: 2,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+				Var:  "upload",
+			},
+			{
+				Name: "task-2",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:          uuid.NewUUID(),
+		State:       tork.TaskStateRunning,
+		StartedAt:   &now,
+		CompletedAt: &now,
+		NodeID:      uuid.NewUUID(),
+		JobID:       j1.ID,
+		Position:    1,
+		CreatedAt:   &now,
+		Var:         "upload",
+	}
+
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	t1.State = tork.TaskStateCompleted
+	t1.Outputs = map[string]any{"url": "s3://bucket/a.mp4", "size": float64(1024)}
+	t1.Usage = &tork.TaskUsage{WallSeconds: 2, CPUSeconds: 1.5, MemoryPeak: 4096}
+
+	err = handler(ctx, task.StateChange, t1)
+	assert.NoError(t, err)
+
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, t1.Outputs, t2.Outputs)
+	assert.Equal(t, t1.Usage, t2.Usage)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, t1.Outputs, j2.Context.TaskOutputs["upload"])
+	assert.Empty(t, j2.Context.Tasks["upload"])
+	assert.NoError(t, ds.Close())
+}
+
 func Test_handleCompletedScheduledTask(t *testing.T) {
 	ctx := context.Background()
 	b := broker.NewInMemoryBroker()
@@ -892,3 +954,96 @@ func Test_handleCompletedEachTaskWithNextTask(t *testing.T) {
 	assert.Equal(t, tork.TaskStateRunning, pt1.State)
 	assert.NoError(t, ds.Close())
 }
+
+func Test_handleCompletedDAGTask(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	handler := NewCompletedHandler(ds, b)
+
+	now := time.Now().UTC()
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		Position:  1,
+		TaskCount: 4,
+		Tasks: []*tork.Task{
+			{
+				Name: "a",
+			},
+			{
+				Name:      "b",
+				DependsOn: []string{"a"},
+			},
+			{
+				Name:      "c",
+				DependsOn: []string{"a"},
+			},
+			{
+				Name:      "d",
+				DependsOn: []string{"b", "c"},
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	ta := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		Name:      "a",
+		State:     tork.TaskStateRunning,
+		StartedAt: &now,
+		CreatedAt: &now,
+		Position:  1,
+	}
+	err = ds.CreateTask(ctx, ta)
+	assert.NoError(t, err)
+
+	// completes the given position and returns the job
+	complete := func(pos int) *tork.Job {
+		j, err := ds.GetJobByID(ctx, j1.ID)
+		assert.NoError(t, err)
+		var tk *tork.Task
+		for _, et := range j.Execution {
+			if et.Position == pos {
+				tk = et
+			}
+		}
+		assert.NotNil(t, tk)
+		err = ds.UpdateTask(ctx, tk.ID, func(u *tork.Task) error {
+			u.State = tork.TaskStateRunning
+			return nil
+		})
+		assert.NoError(t, err)
+		tk.State = tork.TaskStateCompleted
+		err = handler(ctx, task.StateChange, tk)
+		assert.NoError(t, err)
+		j, err = ds.GetJobByID(ctx, j1.ID)
+		assert.NoError(t, err)
+		return j
+	}
+
+	// completing "a" schedules both "b" and "c"
+	j2 := complete(1)
+	assert.Len(t, j2.Execution, 3)
+	assert.Equal(t, "b", j2.Execution[1].Name)
+	assert.Equal(t, "c", j2.Execution[2].Name)
+
+	// "d" has to wait for "c"
+	j2 = complete(2)
+	assert.Len(t, j2.Execution, 3)
+
+	j2 = complete(3)
+	assert.Len(t, j2.Execution, 4)
+	assert.Equal(t, "d", j2.Execution[3].Name)
+	assert.Equal(t, tork.JobStateRunning, j2.State)
+
+	j2 = complete(4)
+	assert.Equal(t, tork.JobStateCompleted, j2.State)
+	assert.Equal(t, float64(100), j2.Progress)
+	assert.NoError(t, ds.Close())
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"slices"
+
+	"github.com/runabol/tork"
+)
+
+// hasDependencies returns true if any of the job's
+// top-level tasks declares a dependency on another
+// task, in which case the job's tasks are scheduled
+// as a DAG rather than sequentially.
+func hasDependencies(j *tork.Job) bool {
+	for _, t := range j.Tasks {
+		if len(t.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// readyTasks returns the top-level tasks of a DAG job
+// which are ready to be scheduled: all their dependencies
+// have completed (or were skipped) and they were not already
+// scheduled. When retry is true, tasks whose previous execution
+// failed or was cancelled are considered as not scheduled.
+//
+// The returned tasks have their Position set to their index
+// in the job's task list (1-based).
+func readyTasks(j *tork.Job, retry bool) []*tork.Task {
+	done := make(map[int]bool)
+	scheduled := make(map[int]bool)
+	for _, t := range j.Execution {
+		if t.ParentID != "" {
+			continue
+		}
+		switch {
+		case t.State == tork.TaskStateCompleted || t.State == tork.TaskStateSkipped:
+			done[t.Position] = true
+			scheduled[t.Position] = true
+		case !retry:
+			scheduled[t.Position] = true
+		case slices.Contains(tork.TaskStateActive, t.State):
+			scheduled[t.Position] = true
+		}
+	}
+	positions := make(map[string]int)
+	for i, t := range j.Tasks {
+		positions[t.Name] = i + 1
+	}
+	ready := make([]*tork.Task, 0)
+	for i, t := range j.Tasks {
+		pos := i + 1
+		if scheduled[pos] {
+			continue
+		}
+		satisfied := true
+		for _, dep := range t.DependsOn {
+			if !done[positions[dep]] {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			t.Position = pos
+			ready = append(ready, t)
+		}
+	}
+	return ready
+}
@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"context"
+	"math/rand"
+	"regexp"
+	"slices"
 	"time"
 
 	"github.com/pkg/errors"
@@ -10,6 +13,7 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/eval"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
@@ -45,20 +49,31 @@ func (h *errorHandler) handle(ctx context.Context, et task.EventType, t *tork.Ta
 	t.FailedAt = &now
 
 	// mark the task as FAILED
+	failed := false
 	if err := h.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
 		if u.IsActive() {
 			u.State = tork.TaskStateFailed
 			u.FailedAt = t.FailedAt
 			u.Error = t.Error
+			u.ExitCode = t.ExitCode
+			u.Usage = t.Usage
+			failed = true
 		}
 		return nil
 	}); err != nil {
 		return errors.Wrapf(err, "error marking task %s as FAILED", t.ID)
 	}
+	if failed {
+		recordTaskEnd(t, tork.TaskStateFailed, t.FailedAt)
+		ft := t.Clone()
+		ft.State = tork.TaskStateFailed
+		publishTaskEvent(ctx, h.broker, broker.TOPIC_TASK_FAILED, ft)
+	}
 	// eligible for retry?
-	if (j.State == tork.JobStateRunning || j.State == tork.JobStateScheduled) &&
+	if (j.State == tork.JobStateRunning || j.State == tork.JobStateScheduled || j.State == tork.JobStatePaused) &&
 		t.Retry != nil &&
-		t.Retry.Attempts < t.Retry.Limit {
+		t.Retry.Attempts < t.Retry.Limit &&
+		shouldRetry(t, j) {
 		// create a new retry task
 		now := time.Now().UTC()
 		rt := t.Clone()
@@ -67,13 +82,35 @@ func (h *errorHandler) handle(ctx context.Context, et task.EventType, t *tork.Ta
 		rt.Retry.Attempts = rt.Retry.Attempts + 1
 		rt.State = tork.TaskStatePending
 		rt.Error = ""
+		rt.ExitCode = nil
+		rt.Usage = nil
 		rt.FailedAt = nil
+		rt.RetryAt = nil
 		if err := eval.EvaluateTask(rt, j.Context.AsMap()); err != nil {
 			return errors.Wrapf(err, "error evaluating task")
 		}
+		// hold the retry task until its backoff elapses. The
+		// coordinator releases it to the pending queue once due.
+		// The retries of a paused job are held until it resumes.
+		delay, err := retryDelay(rt.Retry)
+		if err != nil {
+			return errors.Wrapf(err, "error calculating retry delay")
+		}
+		if delay > 0 || j.State == tork.JobStatePaused {
+			retryAt := now.Add(delay)
+			rt.State = tork.TaskStateCreated
+			rt.RetryAt = &retryAt
+		}
 		if err := h.ds.CreateTask(ctx, rt); err != nil {
 			return errors.Wrapf(err, "error creating a retry task")
 		}
+		metrics.TaskRetriesTotal.Inc(t.Queue)
+		if rt.RetryAt != nil {
+			log.Debug().
+				Str("task-id", rt.ID).
+				Msgf("retrying task in %s", delay)
+			return nil
+		}
 		if err := h.broker.PublishTask(ctx, broker.QUEUE_PENDING, rt); err != nil {
 			log.Error().Err(err).Msg("error publishing retry task")
 		}
@@ -85,3 +122,77 @@ func (h *errorHandler) handle(ctx context.Context, et task.EventType, t *tork.Ta
 	}
 	return nil
 }
+
+// shouldRetry checks whether the task's failure
+// matches its retry conditions, if any were specified.
+func shouldRetry(t *tork.Task, j *tork.Job) bool {
+	on := t.Retry.On
+	if on == nil {
+		return true
+	}
+	if t.ExitCode != nil && slices.Contains(on.ExitCodes, *t.ExitCode) {
+		return true
+	}
+	for _, pattern := range on.Errors {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Error().Err(err).Msgf("invalid retry error pattern: %s", pattern)
+			continue
+		}
+		if re.MatchString(t.Error) {
+			return true
+		}
+	}
+	if on.If != "" {
+		val, err := eval.EvaluateExpr(on.If, map[string]any{
+			"task": tork.NewTaskSummary(t),
+			"job":  tork.NewJobSummary(j),
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("error evaluating retry expression %s", on.If)
+			return false
+		}
+		ifResult, ok := val.(bool)
+		if !ok {
+			log.Error().Msgf("retry expression %s did not evaluate to a boolean", on.If)
+			return false
+		}
+		return ifResult
+	}
+	return false
+}
+
+// retryDelay calculates how long to wait before the
+// given retry attempt is executed.
+func retryDelay(r *tork.TaskRetry) (time.Duration, error) {
+	if r.InitialDelay == "" {
+		return 0, nil
+	}
+	delay, err := time.ParseDuration(r.InitialDelay)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid initial delay: %s", r.InitialDelay)
+	}
+	var maxDelay time.Duration
+	if r.MaxDelay != "" {
+		maxDelay, err = time.ParseDuration(r.MaxDelay)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid max delay: %s", r.MaxDelay)
+		}
+	}
+	if r.Scaling == tork.RetryScalingExponential {
+		for i := 1; i < r.Attempts; i++ {
+			delay = delay * 2
+			if maxDelay > 0 && delay >= maxDelay {
+				break
+			}
+		}
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	if r.Jitter && delay > 1 {
+		// randomize the delay within [delay/2,delay)
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+	}
+	return delay, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore/postgres"
 	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
 	"github.com/stretchr/testify/assert"
 )
@@ -119,6 +120,7 @@ func Test_handleFailedTaskRetry(t *testing.T) {
 	processed := make(chan any)
 	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(tk *tork.Task) error {
 		assert.Nil(t, tk.FailedAt)
+		assert.Nil(t, tk.Usage)
 		close(processed)
 		return nil
 	})
@@ -158,6 +160,9 @@ func Test_handleFailedTaskRetry(t *testing.T) {
 			Limit: 1,
 		},
 		CreatedAt: &now,
+		Usage: &tork.TaskUsage{
+			WallSeconds: 1,
+		},
 	}
 
 	err = ds.CreateTask(ctx, t1)
@@ -172,6 +177,7 @@ func Test_handleFailedTaskRetry(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, tork.TaskStateFailed, t2.State)
 	assert.Equal(t, t1.CompletedAt.Unix(), t2.CompletedAt.Unix())
+	assert.Equal(t, t1.Usage, t2.Usage)
 
 	// verify that the job was
 	// NOT marked as FAILED
@@ -181,3 +187,286 @@ func Test_handleFailedTaskRetry(t *testing.T) {
 	assert.Equal(t, tork.JobStateRunning, j2.State)
 	assert.NoError(t, ds.Close())
 }
+
+func Test_handleFailedTaskRetryOfPausedJob(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	processed := make(chan string, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(tk *tork.Task) error {
+		processed <- tk.ID
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	handler := NewErrorHandler(ds, b)
+	now := time.Now().UTC()
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStatePaused,
+		Position:  1,
+		TaskCount: 1,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		StartedAt: &now,
+		JobID:     j1.ID,
+		Position:  1,
+		Retry: &tork.TaskRetry{
+			Limit: 1,
+		},
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	err = handler(ctx, task.StateChange, t1)
+	assert.NoError(t, err)
+
+	// the retry is held while the job is paused
+	select {
+	case <-processed:
+		t.Fatal("expected the retry to be held while the job is paused")
+	case <-time.After(time.Millisecond * 100):
+	}
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStatePaused, j2.State)
+	var retry *tork.Task
+	for _, et := range j2.Execution {
+		if et.ID != t1.ID {
+			retry = et
+		}
+	}
+	assert.NotNil(t, retry)
+	assert.Equal(t, tork.TaskStateCreated, retry.State)
+	assert.Equal(t, 1, retry.Retry.Attempts)
+
+	// and released once the job is resumed
+	j1.State = tork.JobStateResume
+	err = NewJobHandler(ds, b)(ctx, job.StateChange, j1)
+	assert.NoError(t, err)
+	assert.Equal(t, retry.ID, <-processed)
+
+	t2, err := ds.GetTaskByID(ctx, retry.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStatePending, t2.State)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_handleFailedTaskRetryOnMismatch(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	handler := NewErrorHandler(ds, b)
+	assert.NotNil(t, handler)
+
+	now := time.Now().UTC()
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		Position:  1,
+		TaskCount: 1,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	exitCode := 1
+	t1 := &tork.Task{
+		ID:          uuid.NewUUID(),
+		State:       tork.TaskStateRunning,
+		StartedAt:   &now,
+		CompletedAt: &now,
+		NodeID:      uuid.NewUUID(),
+		JobID:       j1.ID,
+		Position:    1,
+		Error:       "exit code 1",
+		ExitCode:    &exitCode,
+		Retry: &tork.TaskRetry{
+			Limit: 1,
+			On: &tork.RetryOn{
+				ExitCodes: []int{137},
+			},
+		},
+		CreatedAt: &now,
+	}
+
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	err = handler(ctx, task.StateChange, t1)
+	assert.NoError(t, err)
+
+	t2, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateFailed, t2.State)
+	assert.NotNil(t, t2.ExitCode)
+	assert.Equal(t, 1, *t2.ExitCode)
+
+	// the exit code does not match
+	// so the job should fail
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateFailed, j2.State)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_handleFailedTaskRetryWithDelay(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	processed := make(chan any, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(tk *tork.Task) error {
+		processed <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	handler := NewErrorHandler(ds, b)
+	assert.NotNil(t, handler)
+
+	now := time.Now().UTC()
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		Position:  1,
+		TaskCount: 1,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		StartedAt: &now,
+		NodeID:    uuid.NewUUID(),
+		JobID:     j1.ID,
+		Position:  1,
+		Retry: &tork.TaskRetry{
+			Limit:        2,
+			InitialDelay: "1m",
+		},
+		CreatedAt: &now,
+	}
+
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	err = handler(ctx, task.StateChange, t1)
+	assert.NoError(t, err)
+
+	// the retry task should be held
+	// until its delay has elapsed
+	select {
+	case <-processed:
+		t.Fatal("expected the retry task to be delayed")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateRunning, j2.State)
+	assert.Len(t, j2.Execution, 2)
+
+	var rt *tork.Task
+	for _, et := range j2.Execution {
+		if et.ID != t1.ID {
+			rt = et
+		}
+	}
+	assert.NotNil(t, rt)
+	assert.Equal(t, tork.TaskStateCreated, rt.State)
+	assert.Equal(t, 1, rt.Retry.Attempts)
+	assert.NotNil(t, rt.RetryAt)
+	assert.Equal(t, now.Add(time.Minute).Unix(), rt.RetryAt.Unix())
+	assert.NoError(t, ds.Close())
+}
+
+func Test_retryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		retry    *tork.TaskRetry
+		expected time.Duration
+	}{
+		{"no delay", &tork.TaskRetry{Attempts: 1}, 0},
+		{"fixed", &tork.TaskRetry{Attempts: 3, InitialDelay: "5s"}, time.Second * 5},
+		{"fixed explicit", &tork.TaskRetry{Attempts: 3, InitialDelay: "5s", Scaling: tork.RetryScalingFixed}, time.Second * 5},
+		{"exponential first attempt", &tork.TaskRetry{Attempts: 1, InitialDelay: "5s", Scaling: tork.RetryScalingExponential}, time.Second * 5},
+		{"exponential third attempt", &tork.TaskRetry{Attempts: 3, InitialDelay: "5s", Scaling: tork.RetryScalingExponential}, time.Second * 20},
+		{"exponential max delay", &tork.TaskRetry{Attempts: 10, InitialDelay: "5s", Scaling: tork.RetryScalingExponential, MaxDelay: "1m"}, time.Minute},
+		{"fixed max delay", &tork.TaskRetry{Attempts: 1, InitialDelay: "5m", MaxDelay: "1m"}, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := retryDelay(tt.retry)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, d)
+		})
+	}
+	// jitter
+	for i := 0; i < 100; i++ {
+		d, err := retryDelay(&tork.TaskRetry{Attempts: 1, InitialDelay: "10s", Jitter: true})
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, d, time.Second*5)
+		assert.Less(t, d, time.Second*10)
+	}
+	// bad delay
+	_, err := retryDelay(&tork.TaskRetry{Attempts: 1, InitialDelay: "bad"})
+	assert.Error(t, err)
+}
+
+func Test_shouldRetry(t *testing.T) {
+	exitCode := 137
+	j := &tork.Job{ID: uuid.NewUUID(), State: tork.JobStateRunning}
+	tests := []struct {
+		name     string
+		task     *tork.Task
+		expected bool
+	}{
+		{"no conditions", &tork.Task{Retry: &tork.TaskRetry{Limit: 1}}, true},
+		{"exit code match", &tork.Task{ExitCode: &exitCode, Retry: &tork.TaskRetry{Limit: 1, On: &tork.RetryOn{ExitCodes: []int{1, 137}}}}, true},
+		{"exit code mismatch", &tork.Task{ExitCode: &exitCode, Retry: &tork.TaskRetry{Limit: 1, On: &tork.RetryOn{ExitCodes: []int{1}}}}, false},
+		{"no exit code", &tork.Task{Retry: &tork.TaskRetry{Limit: 1, On: &tork.RetryOn{ExitCodes: []int{1}}}}, false},
+		{"error match", &tork.Task{Error: "connection refused", Retry: &tork.TaskRetry{Limit: 1, On: &tork.RetryOn{Errors: []string{"^connection (refused|reset)"}}}}, true},
+		{"error mismatch", &tork.Task{Error: "out of memory", Retry: &tork.TaskRetry{Limit: 1, On: &tork.RetryOn{Errors: []string{"^connection"}}}}, false},
+		{"expr match", &tork.Task{ExitCode: &exitCode, Retry: &tork.TaskRetry{Limit: 1, On: &tork.RetryOn{If: "{{ task.ExitCode == 137 && job.State == 'RUNNING' }}"}}}, true},
+		{"expr mismatch", &tork.Task{ExitCode: &exitCode, Retry: &tork.TaskRetry{Limit: 1, On: &tork.RetryOn{If: "{{ task.ExitCode == 1 }}"}}}, false},
+		{"expr not bool", &tork.Task{Retry: &tork.TaskRetry{Limit: 1, On: &tork.RetryOn{If: "{{ 'yes' }}"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, shouldRetry(tt.task, j))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+)
+
+// publishTaskEvent notifies the event subscribers (e.g. the
+// events API) about a change to a task. Failing to publish
+// the event doesn't fail the task.
+func publishTaskEvent(ctx context.Context, b broker.Broker, topic string, t *tork.Task) {
+	if err := b.PublishEvent(ctx, topic, t.Clone()); err != nil {
+		log.Error().Err(err).Msgf("error publishing %s event for task %s", topic, t.ID)
+	}
+}
+
+// publishJobEvent notifies the event subscribers about a change
+// to a job which isn't finished yet. Failing to publish the event
+// doesn't fail the job.
+func publishJobEvent(ctx context.Context, b broker.Broker, topic string, j *tork.Job) {
+	if err := b.PublishEvent(ctx, topic, j.Clone()); err != nil {
+		log.Error().Err(err).Msgf("error publishing %s event for job %s", topic, j.ID)
+	}
+}
+
+// taskStateTopic returns the topic of the event
+// published when a task reaches the given state.
+func taskStateTopic(state tork.TaskState) string {
+	switch state {
+	case tork.TaskStateScheduled:
+		return broker.TOPIC_TASK_SCHEDULED
+	case tork.TaskStateRunning:
+		return broker.TOPIC_TASK_RUNNING
+	case tork.TaskStateSkipped:
+		return broker.TOPIC_TASK_SKIPPED
+	case tork.TaskStateFailed:
+		return broker.TOPIC_TASK_FAILED
+	case tork.TaskStateCancelled:
+		return broker.TOPIC_TASK_CANCELLED
+	default:
+		return broker.TOPIC_TASK_COMPLETED
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/eval"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
@@ -49,6 +50,10 @@ func (h *jobHandler) handle(ctx context.Context, et job.EventType, j *tork.Job)
 		return h.failJob(ctx, j)
 	case tork.JobStateRunning:
 		return h.markJobAsRunning(ctx, j)
+	case tork.JobStatePaused:
+		return h.pauseJob(ctx, j)
+	case tork.JobStateResume:
+		return h.resumeJob(ctx, j)
 	default:
 		return errors.Errorf("invalid job state: %s", j.State)
 	}
@@ -56,6 +61,9 @@ func (h *jobHandler) handle(ctx context.Context, et job.EventType, j *tork.Job)
 
 func (h *jobHandler) startJob(ctx context.Context, j *tork.Job) error {
 	log.Debug().Msgf("starting job %s", j.ID)
+	if hasDependencies(j) {
+		return h.startDAGJob(ctx, j)
+	}
 	now := time.Now().UTC()
 	t := j.Tasks[0]
 	t.ID = uuid.NewUUID()
@@ -73,13 +81,19 @@ func (h *jobHandler) startJob(ctx context.Context, j *tork.Job) error {
 	}
 	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
 		n := time.Now().UTC()
+		timeoutAt, err := jobTimeoutAt(u, n)
+		if err != nil {
+			return err
+		}
 		u.State = tork.JobStateScheduled
 		u.StartedAt = &n
 		u.Position = 1
+		u.TimeoutAt = timeoutAt
 		return nil
 	}); err != nil {
 		return err
 	}
+	h.publishStateChange(ctx, j, tork.JobStateScheduled)
 	if t.State == tork.TaskStateFailed {
 		n := time.Now().UTC()
 		j.FailedAt = &n
@@ -90,6 +104,56 @@ func (h *jobHandler) startJob(ctx context.Context, j *tork.Job) error {
 	return h.onPending(ctx, task.StateChange, t)
 }
 
+func (h *jobHandler) startDAGJob(ctx context.Context, j *tork.Job) error {
+	now := time.Now().UTC()
+	// start all the tasks which don't depend on any other task
+	roots := readyTasks(j, false)
+	for _, t := range roots {
+		t.ID = uuid.NewUUID()
+		t.JobID = j.ID
+		t.State = tork.TaskStatePending
+		t.CreatedAt = &now
+		if err := eval.EvaluateTask(t, j.Context.AsMap()); err != nil {
+			t.Error = err.Error()
+			t.State = tork.TaskStateFailed
+			t.FailedAt = &now
+		}
+		if err := h.ds.CreateTask(ctx, t); err != nil {
+			return err
+		}
+	}
+	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
+		n := time.Now().UTC()
+		timeoutAt, err := jobTimeoutAt(u, n)
+		if err != nil {
+			return err
+		}
+		u.State = tork.JobStateScheduled
+		u.StartedAt = &n
+		u.Position = 1
+		u.TimeoutAt = timeoutAt
+		return nil
+	}); err != nil {
+		return err
+	}
+	h.publishStateChange(ctx, j, tork.JobStateScheduled)
+	for _, t := range roots {
+		if t.State == tork.TaskStateFailed {
+			n := time.Now().UTC()
+			j.FailedAt = &n
+			j.State = tork.JobStateFailed
+			j.Error = t.Error
+			return h.handle(ctx, job.StateChange, j)
+		}
+	}
+	for _, t := range roots {
+		if err := h.onPending(ctx, task.StateChange, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (h *jobHandler) completeJob(ctx context.Context, j *tork.Job) error {
 	// mark the job as completed
 	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
@@ -127,6 +191,7 @@ func (h *jobHandler) completeJob(ctx context.Context, j *tork.Job) error {
 	}); err != nil {
 		return errors.Wrapf(err, "error updating job in datastore")
 	}
+	metrics.JobsTotal.Inc(string(j.State))
 	// if this is a sub-job -- complete/fail the parent task
 	if j.ParentID != "" {
 		parent, err := h.ds.GetTaskByID(ctx, j.ParentID)
@@ -145,6 +210,12 @@ func (h *jobHandler) completeJob(ctx context.Context, j *tork.Job) error {
 		}
 		return h.broker.PublishTask(ctx, broker.QUEUE_COMPLETED, parent)
 	}
+	// start the next queued instance of the scheduled job
+	if j.Schedule != nil {
+		if err := releaseQueuedJob(ctx, h.ds, h.broker, j.Schedule.ID); err != nil {
+			return err
+		}
+	}
 	// publish job completd/failed event
 	if j.State == tork.JobStateFailed {
 		return h.broker.PublishEvent(ctx, broker.TOPIC_JOB_FAILED, j)
@@ -154,14 +225,231 @@ func (h *jobHandler) completeJob(ctx context.Context, j *tork.Job) error {
 }
 
 func (h *jobHandler) markJobAsRunning(ctx context.Context, j *tork.Job) error {
-	return h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
+	running := false
+	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
 		if u.State != tork.JobStateScheduled {
 			return nil
 		}
 		u.State = tork.JobStateRunning
 		u.FailedAt = nil
+		running = true
+		return nil
+	}); err != nil {
+		return err
+	}
+	if running {
+		h.publishStateChange(ctx, j, tork.JobStateRunning)
+	}
+	return nil
+}
+
+func (h *jobHandler) pauseJob(ctx context.Context, j *tork.Job) error {
+	paused := false
+	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
+		if u.State != tork.JobStateRunning && u.State != tork.JobStateScheduled {
+			// job is not running -- nothing to pause
+			return nil
+		}
+		u.State = tork.JobStatePaused
+		paused = true
+		return nil
+	}); err != nil {
+		return err
+	}
+	if paused {
+		h.publishStateChange(ctx, j, tork.JobStatePaused)
+	}
+	return nil
+}
+
+// publishStateChange notifies the event subscribers
+// that the job moved to a non-terminal state.
+func (h *jobHandler) publishStateChange(ctx context.Context, j *tork.Job, state tork.JobState) {
+	topic := broker.TOPIC_JOB_RUNNING
+	switch state {
+	case tork.JobStateScheduled:
+		topic = broker.TOPIC_JOB_SCHEDULED
+	case tork.JobStatePaused:
+		topic = broker.TOPIC_JOB_PAUSED
+	}
+	ev := j.Clone()
+	ev.State = state
+	publishJobEvent(ctx, h.broker, topic, ev)
+}
+
+func (h *jobHandler) resumeJob(ctx context.Context, j *tork.Job) error {
+	var pending []*tork.Task
+	var resumed *tork.Job
+	if err := h.ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		// holding the job's lock for the remainder of the
+		// transaction prevents concurrent task completions
+		// from scheduling work while we're resuming.
+		paused := false
+		if err := tx.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
+			if u.State != tork.JobStatePaused {
+				return nil
+			}
+			paused = true
+			u.State = tork.JobStateRunning
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "error updating job in datastore")
+		}
+		if !paused {
+			// job is not paused -- nothing to resume
+			return nil
+		}
+		rj, err := tx.GetJobByID(ctx, j.ID)
+		if err != nil {
+			return errors.Wrapf(err, "error getting job from datastore")
+		}
+		resumed = rj
+		// release any retries which were held back
+		retries, err := releaseRetryTasks(ctx, tx, rj)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, retries...)
+		// release any each-task items which were held back
+		held, err := releaseEachTasks(ctx, tx, rj)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, held...)
+		// schedule the next top-level task(s)
+		if rj.Position > len(rj.Tasks) {
+			return nil
+		}
+		next, err := createNextTasks(ctx, tx, rj)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, next...)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if resumed == nil {
 		return nil
-	})
+	}
+	h.publishStateChange(ctx, resumed, tork.JobStateRunning)
+	// the job's last task completed while it was paused
+	if resumed.Position > len(resumed.Tasks) {
+		now := time.Now().UTC()
+		resumed.State = tork.JobStateCompleted
+		resumed.CompletedAt = &now
+		return h.handle(ctx, job.StateChange, resumed)
+	}
+	for _, t := range pending {
+		if err := h.broker.PublishTask(ctx, broker.QUEUE_PENDING, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createNextTasks creates the top-level task(s) of a resumed
+// job whose scheduling was held back while it was paused.
+func createNextTasks(ctx context.Context, tx datastore.Datastore, j *tork.Job) ([]*tork.Task, error) {
+	var next []*tork.Task
+	if hasDependencies(j) {
+		next = readyTasks(j, false)
+	} else {
+		for _, t := range j.Execution {
+			if t.ParentID == "" && t.Position == j.Position {
+				// the current task was already scheduled
+				return nil, nil
+			}
+		}
+		t := j.Tasks[j.Position-1]
+		t.Position = j.Position
+		next = []*tork.Task{t}
+	}
+	now := time.Now().UTC()
+	for _, t := range next {
+		t.ID = uuid.NewUUID()
+		t.JobID = j.ID
+		t.State = tork.TaskStatePending
+		t.CreatedAt = &now
+		if err := eval.EvaluateTask(t, j.Context.AsMap()); err != nil {
+			t.Error = err.Error()
+			t.State = tork.TaskStateFailed
+			t.FailedAt = &now
+		}
+		if err := tx.CreateTask(ctx, t); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// releaseRetryTasks releases the retries of a resumed job which
+// were held back while it was paused. Retries whose backoff has
+// not elapsed yet are left for the coordinator to release.
+func releaseRetryTasks(ctx context.Context, tx datastore.Datastore, j *tork.Job) ([]*tork.Task, error) {
+	now := time.Now().UTC()
+	released := make([]*tork.Task, 0)
+	for _, t := range j.Execution {
+		if t.State != tork.TaskStateCreated || t.RetryAt == nil || t.RetryAt.After(now) {
+			continue
+		}
+		ok := false
+		if err := tx.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
+			if u.State != tork.TaskStateCreated {
+				return nil
+			}
+			u.State = tork.TaskStatePending
+			ok = true
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "error releasing retry task: %s", t.ID)
+		}
+		if ok {
+			t.State = tork.TaskStatePending
+			released = append(released, t)
+		}
+	}
+	return released, nil
+}
+
+// releaseEachTasks fires the items of a resumed job's running
+// each tasks, up to their concurrency level, which were held
+// back while the job was paused.
+func releaseEachTasks(ctx context.Context, tx datastore.Datastore, j *tork.Job) ([]*tork.Task, error) {
+	active := make(map[string]int)
+	for _, t := range j.Execution {
+		// retries take the place of the item they retry
+		if t.ParentID != "" && t.IsActive() && (t.State != tork.TaskStateCreated || t.RetryAt != nil) {
+			active[t.ParentID] = active[t.ParentID] + 1
+		}
+	}
+	released := make([]*tork.Task, 0)
+	for _, t := range j.Execution {
+		if t.Each == nil || t.Each.Concurrency == 0 || t.State != tork.TaskStateRunning {
+			continue
+		}
+		if err := tx.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
+			for i := active[u.ID]; i < u.Each.Concurrency && u.Each.Index < u.Each.Size; i++ {
+				next, err := tx.GetNextTask(ctx, u.ID)
+				if err != nil {
+					return err
+				}
+				if err := tx.UpdateTask(ctx, next.ID, func(nu *tork.Task) error {
+					nu.State = tork.TaskStatePending
+					return nil
+				}); err != nil {
+					return err
+				}
+				next.State = tork.TaskStatePending
+				released = append(released, next)
+				u.Each.Index = u.Each.Index + 1
+			}
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "error releasing each task items: %s", t.ID)
+		}
+	}
+	return released, nil
 }
 
 func (h *jobHandler) restartJob(ctx context.Context, j *tork.Job) error {
@@ -170,12 +458,22 @@ func (h *jobHandler) restartJob(ctx context.Context, j *tork.Job) error {
 		if u.State != tork.JobStateFailed && u.State != tork.JobStateCancelled {
 			return errors.Errorf("job %s is in %s state and can't be restarted", j.ID, j.State)
 		}
+		// the timeout is measured from the moment the job is restarted
+		timeoutAt, err := jobTimeoutAt(u, time.Now().UTC())
+		if err != nil {
+			return err
+		}
 		u.State = tork.JobStateRunning
 		u.FailedAt = nil
+		u.TimeoutAt = timeoutAt
 		return nil
 	}); err != nil {
 		return err
 	}
+	h.publishStateChange(ctx, j, tork.JobStateRunning)
+	if hasDependencies(j) {
+		return h.restartDAGJob(ctx, j)
+	}
 	// retry the current top level task
 	now := time.Now().UTC()
 	t := j.Tasks[j.Position-1]
@@ -195,21 +493,60 @@ func (h *jobHandler) restartJob(ctx context.Context, j *tork.Job) error {
 	return h.broker.PublishTask(ctx, broker.QUEUE_PENDING, t)
 }
 
+func (h *jobHandler) restartDAGJob(ctx context.Context, j *tork.Job) error {
+	j, err := h.ds.GetJobByID(ctx, j.ID)
+	if err != nil {
+		return errors.Wrapf(err, "error getting job from datastore")
+	}
+	// retry every top level task which failed or was
+	// cancelled and whose dependencies are completed
+	now := time.Now().UTC()
+	for _, t := range readyTasks(j, true) {
+		t.ID = uuid.NewUUID()
+		t.JobID = j.ID
+		t.State = tork.TaskStatePending
+		t.CreatedAt = &now
+		if err := eval.EvaluateTask(t, j.Context.AsMap()); err != nil {
+			t.Error = err.Error()
+			t.State = tork.TaskStateFailed
+			t.FailedAt = &now
+		}
+		if err := h.ds.CreateTask(ctx, t); err != nil {
+			return err
+		}
+		if err := h.broker.PublishTask(ctx, broker.QUEUE_PENDING, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (h *jobHandler) failJob(ctx context.Context, j *tork.Job) error {
 	log.Debug().Msgf("job %s failed: %s", j.ID, j.Error)
 	// mark the job as FAILED
+	failed := false
 	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
 		// we only want to make the job as FAILED
 		// if it's actually running as opposed to
 		// possibly being CANCELLED
-		if u.State == tork.JobStateRunning || u.State == tork.JobStateScheduled {
+		if u.State == tork.JobStateRunning ||
+			u.State == tork.JobStateScheduled ||
+			u.State == tork.JobStatePaused {
 			u.State = tork.JobStateFailed
 			u.FailedAt = j.FailedAt
+			failed = true
 		}
 		return nil
 	}); err != nil {
 		return errors.Wrapf(err, "error marking the job as failed in the datastore")
 	}
+	if failed {
+		metrics.JobsTotal.Inc(string(tork.JobStateFailed))
+	}
+	// cancel all currently running tasks
+	if err := cancelActiveTasks(ctx, h.ds, h.broker, j.ID); err != nil {
+		return err
+	}
 	// if this is a sub-job -- FAIL the parent task
 	if j.ParentID != "" {
 		parent, err := h.ds.GetTaskByID(ctx, j.ParentID)
@@ -221,16 +558,45 @@ func (h *jobHandler) failJob(ctx context.Context, j *tork.Job) error {
 		parent.Error = j.Error
 		return h.broker.PublishTask(ctx, broker.QUEUE_ERROR, parent)
 	}
-	// cancel all currently running tasks
-	if err := cancelActiveTasks(ctx, h.ds, h.broker, j.ID); err != nil {
-		return err
-	}
 	j, err := h.ds.GetJobByID(ctx, j.ID)
 	if err != nil {
 		return errors.Wrapf(err, "unknown job: %s", j.ID)
 	}
+	// start the next queued instance of the scheduled job
+	if j.Schedule != nil {
+		if err := releaseQueuedJob(ctx, h.ds, h.broker, j.Schedule.ID); err != nil {
+			return err
+		}
+	}
 	if j.State == tork.JobStateFailed {
 		return h.broker.PublishEvent(ctx, broker.TOPIC_JOB_FAILED, j)
 	}
 	return nil
 }
+
+// JobTimeout returns the timeout of the job, which
+// defaults to the job timeout of its defaults.
+func JobTimeout(j *tork.Job) string {
+	if j.Timeout == "" && j.Defaults != nil {
+		return j.Defaults.JobTimeout
+	}
+	return j.Timeout
+}
+
+// jobTimeoutAt calculates the time at which a job started
+// at the given time exceeds its timeout or deadline --
+// whichever comes first. Returns nil if the job has neither.
+func jobTimeoutAt(j *tork.Job, startedAt time.Time) (*time.Time, error) {
+	timeoutAt := j.Deadline
+	if timeout := JobTimeout(j); timeout != "" {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid job timeout: %s", timeout)
+		}
+		t := startedAt.Add(dur)
+		if timeoutAt == nil || t.Before(*timeoutAt) {
+			timeoutAt = &t
+		}
+	}
+	return timeoutAt, nil
+}
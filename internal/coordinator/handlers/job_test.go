@@ -10,6 +10,7 @@ import (
 	"github.com/runabol/tork/datastore/postgres"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/job"
+	"github.com/runabol/tork/middleware/task"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,6 +23,12 @@ func Test_handleJobs(t *testing.T) {
 	handler := NewJobHandler(ds, b)
 	assert.NotNil(t, handler)
 
+	events := make(chan *tork.Job, 1)
+	err = b.SubscribeForEvents(ctx, broker.TOPIC_JOB_SCHEDULED, func(ev any) {
+		events <- ev.(*tork.Job)
+	})
+	assert.NoError(t, err)
+
 	j1 := &tork.Job{
 		ID:    uuid.NewUUID(),
 		State: tork.JobStatePending,
@@ -41,6 +48,44 @@ func Test_handleJobs(t *testing.T) {
 	j2, err := ds.GetJobByID(ctx, j1.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, tork.JobStateScheduled, j2.State)
+
+	ev := <-events
+	assert.Equal(t, j1.ID, ev.ID)
+	assert.Equal(t, tork.JobStateScheduled, ev.State)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_handleStartJobWithTimeout(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	handler := NewJobHandler(ds, b)
+	assert.NotNil(t, handler)
+
+	j1 := &tork.Job{
+		ID:      uuid.NewUUID(),
+		State:   tork.JobStatePending,
+		Timeout: "10m",
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+		},
+	}
+
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	err = handler(ctx, job.StateChange, j1)
+	assert.NoError(t, err)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateScheduled, j2.State)
+	assert.NotNil(t, j2.TimeoutAt)
+	assert.Equal(t, j2.StartedAt.Add(time.Minute*10).Unix(), j2.TimeoutAt.Unix())
 	assert.NoError(t, ds.Close())
 }
 
@@ -178,6 +223,129 @@ func Test_handleRestartJob(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_handleStartDAGJob(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	handler := NewJobHandler(ds, b)
+	assert.NotNil(t, handler)
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStatePending,
+		TaskCount: 3,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+			{
+				Name:      "task-2",
+				DependsOn: []string{"task-1", "task-3"},
+			},
+			{
+				Name: "task-3",
+			},
+		},
+	}
+
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	err = handler(ctx, job.StateChange, j1)
+	assert.NoError(t, err)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateScheduled, j2.State)
+	assert.Len(t, j2.Execution, 2)
+	assert.Equal(t, "task-1", j2.Execution[0].Name)
+	assert.Equal(t, 1, j2.Execution[0].Position)
+	assert.Equal(t, "task-3", j2.Execution[1].Name)
+	assert.Equal(t, 3, j2.Execution[1].Position)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_handleRestartDAGJob(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	handler := NewJobHandler(ds, b)
+	assert.NotNil(t, handler)
+
+	now := time.Now().UTC()
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateFailed,
+		CreatedAt: now,
+		Position:  2,
+		TaskCount: 3,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+			{
+				Name: "task-2",
+			},
+			{
+				Name:      "task-3",
+				DependsOn: []string{"task-1", "task-2"},
+			},
+		},
+	}
+
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:          uuid.NewUUID(),
+		JobID:       j1.ID,
+		Name:        "task-1",
+		Position:    1,
+		State:       tork.TaskStateCompleted,
+		CreatedAt:   &now,
+		CompletedAt: &now,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	t2 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		Name:      "task-2",
+		Position:  2,
+		State:     tork.TaskStateFailed,
+		CreatedAt: &now,
+		FailedAt:  &now,
+	}
+	err = ds.CreateTask(ctx, t2)
+	assert.NoError(t, err)
+
+	j1.State = tork.JobStateRestart
+	err = handler(ctx, job.StateChange, j1)
+	assert.NoError(t, err)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateRunning, j2.State)
+	// only the failed task should be retried
+	assert.Len(t, j2.Execution, 3)
+	pending := 0
+	for _, et := range j2.Execution {
+		if et.State == tork.TaskStatePending {
+			assert.Equal(t, "task-2", et.Name)
+			assert.Equal(t, 2, et.Position)
+			pending = pending + 1
+		}
+	}
+	assert.Equal(t, 1, pending)
+	assert.NoError(t, ds.Close())
+}
+
 func Test_handleJobWithTaskEvalFailure(t *testing.T) {
 	ctx := context.Background()
 	b := broker.NewInMemoryBroker()
@@ -399,3 +567,303 @@ func Test_handleJobProgress(t *testing.T) {
 	assert.Nil(t, j1.DeleteAt)
 	assert.NoError(t, ds.Close())
 }
+
+func Test_jobTimeoutAt(t *testing.T) {
+	now := time.Now().UTC()
+	soon := now.Add(time.Minute)
+	later := now.Add(time.Hour)
+
+	timeoutAt, err := jobTimeoutAt(&tork.Job{}, now)
+	assert.NoError(t, err)
+	assert.Nil(t, timeoutAt)
+
+	timeoutAt, err = jobTimeoutAt(&tork.Job{Timeout: "10m"}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute*10), *timeoutAt)
+
+	timeoutAt, err = jobTimeoutAt(&tork.Job{Deadline: &later}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, later, *timeoutAt)
+
+	// whichever comes first
+	timeoutAt, err = jobTimeoutAt(&tork.Job{Timeout: "10m", Deadline: &later}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute*10), *timeoutAt)
+
+	timeoutAt, err = jobTimeoutAt(&tork.Job{Timeout: "10m", Deadline: &soon}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, soon, *timeoutAt)
+
+	// the job timeout of the defaults applies
+	// unless the job sets its own
+	timeoutAt, err = jobTimeoutAt(&tork.Job{Defaults: &tork.JobDefaults{Timeout: "1m", JobTimeout: "20m"}}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute*20), *timeoutAt)
+
+	timeoutAt, err = jobTimeoutAt(&tork.Job{Timeout: "10m", Defaults: &tork.JobDefaults{JobTimeout: "20m"}}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute*10), *timeoutAt)
+
+	_, err = jobTimeoutAt(&tork.Job{Timeout: "bad"}, now)
+	assert.Error(t, err)
+}
+
+func Test_handlePauseAndResumeJob(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	pending := make(chan *tork.Task, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(tk *tork.Task) error {
+		pending <- tk
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	handler := NewJobHandler(ds, b)
+	onCompleted := NewCompletedHandler(ds, b)
+
+	now := time.Now().UTC()
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		Position:  1,
+		TaskCount: 2,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+			{
+				Name: "task-2",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		StartedAt: &now,
+		JobID:     j1.ID,
+		Position:  1,
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	j1.State = tork.JobStatePaused
+	err = handler(ctx, job.StateChange, j1)
+	assert.NoError(t, err)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStatePaused, j2.State)
+
+	// the running task is allowed to finish
+	t1.State = tork.TaskStateCompleted
+	err = onCompleted(ctx, task.StateChange, t1)
+	assert.NoError(t, err)
+
+	select {
+	case <-pending:
+		t.Fatal("expected the next task to be held while the job is paused")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	j3, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStatePaused, j3.State)
+	assert.Equal(t, 2, j3.Position)
+	assert.Len(t, j3.Execution, 1)
+
+	j3.State = tork.JobStateResume
+	err = handler(ctx, job.StateChange, j3)
+	assert.NoError(t, err)
+
+	t2 := <-pending
+	assert.Equal(t, "task-2", t2.Name)
+	assert.Equal(t, 2, t2.Position)
+
+	j4, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateRunning, j4.State)
+	assert.Len(t, j4.Execution, 2)
+
+	// resuming a running job is a no-op
+	j4.State = tork.JobStateResume
+	err = handler(ctx, job.StateChange, j4)
+	assert.NoError(t, err)
+	select {
+	case <-pending:
+		t.Fatal("expected no task to be scheduled")
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func Test_handleResumeJobWithNoMoreTasks(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	handler := NewJobHandler(ds, b)
+
+	now := time.Now().UTC()
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStatePaused,
+		Position:  2,
+		TaskCount: 1,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	err = ds.CreateTask(ctx, &tork.Task{
+		ID:          uuid.NewUUID(),
+		State:       tork.TaskStateCompleted,
+		CompletedAt: &now,
+		JobID:       j1.ID,
+		Position:    1,
+		CreatedAt:   &now,
+	})
+	assert.NoError(t, err)
+
+	j1.State = tork.JobStateResume
+	err = handler(ctx, job.StateChange, j1)
+	assert.NoError(t, err)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateCompleted, j2.State)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_handleResumeJobWithEachTask(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	pending := make(chan *tork.Task, 2)
+	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(tk *tork.Task) error {
+		pending <- tk
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	handler := NewJobHandler(ds, b)
+	onCompleted := NewCompletedHandler(ds, b)
+
+	now := time.Now().UTC()
+
+	each := &tork.EachTask{
+		Size:        3,
+		Concurrency: 1,
+		Index:       1,
+		List:        "some expression",
+		Task: &tork.Task{
+			Name: "some task",
+		},
+	}
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStatePaused,
+		Position:  1,
+		TaskCount: 1,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+				Each: each,
+			},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	pt := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		Position:  1,
+		Name:      "parent task",
+		Each:      each,
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, pt)
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		StartedAt: &now,
+		JobID:     j1.ID,
+		Position:  1,
+		ParentID:  pt.ID,
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	created := make([]string, 2)
+	for i := range created {
+		ct := &tork.Task{
+			ID:        uuid.NewUUID(),
+			State:     tork.TaskStateCreated,
+			JobID:     j1.ID,
+			Position:  1,
+			ParentID:  pt.ID,
+			CreatedAt: &now,
+		}
+		err = ds.CreateTask(ctx, ct)
+		assert.NoError(t, err)
+		created[i] = ct.ID
+	}
+
+	t1.State = tork.TaskStateCompleted
+	err = onCompleted(ctx, task.StateChange, t1)
+	assert.NoError(t, err)
+
+	select {
+	case <-pending:
+		t.Fatal("expected the next item to be held while the job is paused")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	pt1, err := ds.GetTaskByID(ctx, pt.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pt1.Each.Completions)
+	assert.Equal(t, 1, pt1.Each.Index)
+
+	j1.State = tork.JobStateResume
+	err = handler(ctx, job.StateChange, j1)
+	assert.NoError(t, err)
+
+	next := <-pending
+	assert.Contains(t, created, next.ID)
+	assert.Equal(t, tork.TaskStatePending, next.State)
+
+	select {
+	case <-pending:
+		t.Fatal("expected only one item to be released")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	pt2, err := ds.GetTaskByID(ctx, pt.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pt2.Each.Index)
+
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStateRunning, j2.State)
+	assert.NoError(t, ds.Close())
+}
@@ -5,16 +5,19 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 )
 
 type logHandler struct {
-	ds datastore.Datastore
+	ds     datastore.Datastore
+	broker broker.Broker
 }
 
-func NewLogHandler(ds datastore.Datastore) func(p *tork.TaskLogPart) {
+func NewLogHandler(ds datastore.Datastore, b broker.Broker) func(p *tork.TaskLogPart) {
 	h := &logHandler{
-		ds: ds,
+		ds:     ds,
+		broker: b,
 	}
 	return h.handle
 }
@@ -23,5 +26,11 @@ func (h *logHandler) handle(p *tork.TaskLogPart) {
 	ctx := context.Background()
 	if err := h.ds.CreateTaskLogPart(ctx, p); err != nil {
 		log.Error().Err(err).Msgf("error writing task log: %s", err.Error())
+		return
+	}
+	// notify the log streams of every coordinator,
+	// not only the one which received the part
+	if err := h.broker.PublishEvent(ctx, broker.TOPIC_LOG_PART, p); err != nil {
+		log.Error().Err(err).Msgf("error publishing task log part: %s", err.Error())
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore/postgres"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/stretchr/testify/assert"
@@ -16,9 +17,18 @@ func Test_handleLog(t *testing.T) {
 
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
-	handler := NewLogHandler(ds)
+	b := broker.NewInMemoryBroker()
+	handler := NewLogHandler(ds, b)
 	assert.NotNil(t, handler)
 
+	published := make(chan *tork.TaskLogPart, 1)
+	err = b.SubscribeForEvents(ctx, broker.TOPIC_LOG_PART, func(ev any) {
+		p, ok := ev.(*tork.TaskLogPart)
+		assert.True(t, ok)
+		published <- p
+	})
+	assert.NoError(t, err)
+
 	j1 := &tork.Job{
 		ID:   uuid.NewUUID(),
 		Name: "test job",
@@ -50,5 +60,9 @@ func Test_handleLog(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1, n11.TotalItems)
 	assert.Equal(t, "line 1", n11.Items[0].Contents)
+
+	p := <-published
+	assert.Equal(t, tk.ID, p.TaskID)
+	assert.Equal(t, "line 1", p.Contents)
 	assert.NoError(t, ds.Close())
 }
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/metrics"
+)
+
+// recordTaskEnd updates the metrics of a
+// task which reached a terminal state.
+func recordTaskEnd(t *tork.Task, state tork.TaskState, endedAt *time.Time) {
+	metrics.TasksTotal.Inc(string(state), t.Queue)
+	if t.StartedAt != nil && endedAt != nil {
+		metrics.TaskRunSeconds.Observe(endedAt.Sub(*t.StartedAt).Seconds(), string(state), t.Queue)
+	}
+}
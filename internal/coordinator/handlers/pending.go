@@ -35,9 +35,20 @@ func (h *pendingHandler) handle(ctx context.Context, et task.EventType, t *tork.
 		Msg("handling pending task")
 	if strings.TrimSpace(t.If) == "false" {
 		return h.skipTask(ctx, t)
-	} else {
-		return h.sched.ScheduleTask(ctx, t)
 	}
+	if err := h.sched.ScheduleTask(ctx, t); err != nil {
+		return err
+	}
+	switch {
+	case t.State == tork.TaskStateScheduled:
+		publishTaskEvent(ctx, h.broker, broker.TOPIC_TASK_SCHEDULED, t)
+	case t.State == tork.TaskStatePending && (t.Parallel != nil || t.Each != nil || t.SubJob != nil):
+		// composite tasks run as soon as they are scheduled
+		rt := t.Clone()
+		rt.State = tork.TaskStateRunning
+		publishTaskEvent(ctx, h.broker, broker.TOPIC_TASK_RUNNING, rt)
+	}
+	return nil
 }
 
 func (h *pendingHandler) skipTask(ctx context.Context, t *tork.Task) error {
@@ -7,20 +7,23 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
 )
 
 type progressHandler struct {
-	ds    datastore.Datastore
-	onJob job.HandlerFunc
+	ds     datastore.Datastore
+	broker broker.Broker
+	onJob  job.HandlerFunc
 }
 
-func NewProgressHandler(ds datastore.Datastore, onJob job.HandlerFunc) task.HandlerFunc {
+func NewProgressHandler(ds datastore.Datastore, b broker.Broker, onJob job.HandlerFunc) task.HandlerFunc {
 	h := &progressHandler{
-		ds:    ds,
-		onJob: onJob,
+		ds:     ds,
+		broker: b,
+		onJob:  onJob,
 	}
 	return h.handle
 }
@@ -38,6 +41,7 @@ func (h *progressHandler) handle(ctx context.Context, et task.EventType, t *tork
 	}); err != nil {
 		return errors.Wrapf(err, "error updating task progress: %s", err.Error())
 	}
+	publishTaskEvent(ctx, h.broker, broker.TOPIC_TASK_PROGRESS, t)
 	// calculate the overall job progress
 	j, err := h.ds.GetJobByID(ctx, t.JobID)
 	if err != nil {
@@ -56,5 +60,6 @@ func (h *progressHandler) handle(ctx context.Context, et task.EventType, t *tork
 	}); err != nil {
 		return errors.Wrapf(err, "error updating job progress: %s", err.Error())
 	}
+	publishJobEvent(ctx, h.broker, broker.TOPIC_JOB_PROGRESS, j)
 	return h.onJob(ctx, job.Progress, j)
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore/postgres"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/job"
@@ -17,7 +18,7 @@ func Test_handleProgress(t *testing.T) {
 	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
-	handler := NewProgressHandler(ds, job.NoOpHandlerFunc)
+	handler := NewProgressHandler(ds, broker.NewInMemoryBroker(), job.NoOpHandlerFunc)
 	assert.NotNil(t, handler)
 
 	t.Run("no progress", func(t *testing.T) {
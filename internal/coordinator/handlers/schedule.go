@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
 	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
@@ -19,6 +21,18 @@ import (
 // job lock should be held
 const minScheduledJobLockTTL = 10 * time.Second
 
+// defaultCatchUpWindow is how far back missed ticks are
+// looked for when a catch-up policy has no explicit window
+const defaultCatchUpWindow = 24 * time.Hour
+
+// tickTolerance allows for a small drift between the
+// scheduler's timer and the wall clock when claiming a tick
+const tickTolerance = time.Second
+
+// ErrInstanceSkipped is returned when an instance of a scheduled
+// job is not started because of the job's overlap policy.
+var ErrInstanceSkipped = errors.New("a previous instance of the scheduled job is still active")
+
 type jobSchedulerHandler struct {
 	ds        datastore.Datastore
 	broker    broker.Broker
@@ -81,6 +95,10 @@ func NewJobSchedulerHandler(ds datastore.Datastore, b broker.Broker, l locker.Lo
 	}
 
 	for _, aj := range activeJobs {
+		// fire any ticks missed while no coordinator was running
+		if err := h.catchUp(ctx, aj); err != nil {
+			return nil, err
+		}
 		if err := h.handle(ctx, aj); err != nil {
 			return nil, err
 		}
@@ -101,39 +119,66 @@ func (h *jobSchedulerHandler) handle(ctx context.Context, s *tork.ScheduledJob)
 }
 
 func (h *jobSchedulerHandler) handleActive(ctx context.Context, s *tork.ScheduledJob) error {
-	log.Info().Msgf("Scheduling job %s with cron %s", s.ID, s.Cron)
+	// the scheduled job was updated: replace its
+	// previous entry in the scheduler
+	h.mu.Lock()
+	gjob, ok := h.m[s.ID]
+	h.mu.Unlock()
+	if ok {
+		log.Info().Msgf("Rescheduling job %s", s.ID)
+		if err := h.scheduler.RemoveJob(gjob.ID()); err != nil {
+			return errors.Wrapf(err, "error unscheduling job %s", s.ID)
+		}
+		h.mu.Lock()
+		delete(h.m, s.ID)
+		h.mu.Unlock()
+	}
+	// triggered jobs are started by the job trigger
+	// handler rather than by the scheduler
+	if s.Trigger != nil {
+		log.Info().Msgf("Job %s is triggered by other jobs", s.ID)
+		return nil
+	}
+	log.Info().Msgf("Scheduling job %s with cron %s", s.ID, cronSpec(s))
+	sched, err := parseSchedule(s)
+	if err != nil {
+		return errors.Wrapf(err, "error scheduling job %s", s.ID)
+	}
 	cj, err := h.scheduler.NewJob(
-		gocron.CronJob(s.Cron, false),
+		gocron.CronJob(cronSpec(s), false),
 		gocron.NewTask(
 			func(sj *tork.ScheduledJob) {
 				now := time.Now().UTC()
-				job := &tork.Job{
-					ID:          uuid.NewUUID(),
-					CreatedBy:   s.CreatedBy,
-					CreatedAt:   now,
-					Permissions: s.Permissions,
-					Tags:        s.Tags,
-					Name:        s.Name,
-					Description: s.Description,
-					State:       tork.JobStatePending,
-					Tasks:       s.Tasks,
-					Inputs:      s.Inputs,
-					Secrets:     s.Secrets,
-					Context:     tork.JobContext{Inputs: s.Inputs},
-					TaskCount:   len(s.Tasks),
-					Output:      s.Output,
-					Webhooks:    s.Webhooks,
-					AutoDelete:  s.AutoDelete,
-					Schedule: &tork.JobSchedule{
-						ID:   s.ID,
-						Cron: s.Cron,
-					},
+				// claim the tick so that it is fired exactly once
+				// even when multiple coordinators are running.
+				var tick *time.Time
+				if err := h.ds.UpdateScheduledJob(ctx, sj.ID, func(u *tork.ScheduledJob) error {
+					if u.State != tork.ScheduledJobStateActive {
+						return nil
+					}
+					since := lastFiredAt(u)
+					// only look back a short while: ticks missed
+					// prior to that are handled by the catch-up policy
+					if lookback := now.Add(-time.Hour); since.Before(lookback) {
+						since = lookback
+					}
+					ticks := dueTicks(sched, since, now.Add(tickTolerance))
+					if len(ticks) == 0 {
+						return nil
+					}
+					tick = &ticks[len(ticks)-1]
+					u.LastFiredAt = tick
+					return nil
+				}); err != nil {
+					log.Error().Err(err).Msgf("error claiming tick for scheduled job: %s", sj.ID)
+					return
 				}
-				if err := h.ds.CreateJob(ctx, job); err != nil {
-					log.Error().Err(err).Msgf("error creating scheduled job instance: %s", s.ID)
+				if tick == nil {
+					log.Debug().Msgf("scheduled job %s was already fired", sj.ID)
+					return
 				}
-				if err := h.broker.PublishJob(ctx, job); err != nil {
-					log.Error().Err(err).Msgf("error publishing scheduled job instance: %s", s.ID)
+				if err := h.fire(ctx, sj, *tick); err != nil {
+					log.Error().Err(err).Msgf("error firing scheduled job: %s", sj.ID)
 				}
 			},
 			s,
@@ -149,11 +194,124 @@ func (h *jobSchedulerHandler) handleActive(ctx context.Context, s *tork.Schedule
 	return err
 }
 
+// catchUp fires the instances of a scheduled job for the ticks
+// which were missed while no coordinator was running, according
+// to the job's catch-up policy.
+func (h *jobSchedulerHandler) catchUp(ctx context.Context, s *tork.ScheduledJob) error {
+	if s.Trigger != nil || s.CatchUp == nil || s.CatchUp.Policy == "" || s.CatchUp.Policy == tork.ScheduleCatchUpNone {
+		return nil
+	}
+	window := defaultCatchUpWindow
+	if s.CatchUp.Window != "" {
+		dur, err := time.ParseDuration(s.CatchUp.Window)
+		if err != nil {
+			return errors.Wrapf(err, "invalid catch-up window: %s", s.CatchUp.Window)
+		}
+		window = dur
+	}
+	sched, err := parseSchedule(s)
+	if err != nil {
+		return errors.Wrapf(err, "error scheduling job %s", s.ID)
+	}
+	now := time.Now().UTC()
+	var missed []time.Time
+	if err := h.ds.UpdateScheduledJob(ctx, s.ID, func(u *tork.ScheduledJob) error {
+		since := lastFiredAt(u)
+		if start := now.Add(-window); since.Before(start) {
+			since = start
+		}
+		missed = dueTicks(sched, since, now)
+		if len(missed) == 0 {
+			return nil
+		}
+		if s.CatchUp.Policy == tork.ScheduleCatchUpLast {
+			missed = missed[len(missed)-1:]
+		}
+		u.LastFiredAt = &missed[len(missed)-1]
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "error catching up scheduled job %s", s.ID)
+	}
+	for _, tick := range missed {
+		log.Info().Msgf("Catching up scheduled job %s missed at %s", s.ID, tick)
+		if err := h.fire(ctx, s, tick); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fire creates a new instance of the scheduled job for the
+// given tick.
+func (h *jobSchedulerHandler) fire(ctx context.Context, s *tork.ScheduledJob, tick time.Time) error {
+	log.Debug().Msgf("Firing tick %s of scheduled job %s", tick, s.ID)
+	job := tork.NewScheduledJobInstance(s)
+	job.ID = uuid.NewUUID()
+	if err := StartScheduledJobInstance(ctx, h.ds, h.broker, s, job); err != nil && !errors.Is(err, ErrInstanceSkipped) {
+		return err
+	}
+	return nil
+}
+
+// StartScheduledJobInstance creates and starts a new instance of
+// the scheduled job, applying the job's overlap policy with respect
+// to any previous instance which is still active. ErrInstanceSkipped
+// is returned if the instance was skipped.
+func StartScheduledJobInstance(ctx context.Context, ds datastore.Datastore, b broker.Broker, s *tork.ScheduledJob, job *tork.Job) error {
+	overlap := s.Overlap
+	if overlap == "" {
+		overlap = tork.ScheduleOverlapAllow
+	}
+	var active []*tork.Job
+	if overlap != tork.ScheduleOverlapAllow {
+		instances, err := ds.GetActiveScheduledJobInstances(ctx, s.ID)
+		if err != nil {
+			return errors.Wrapf(err, "error getting active instances of scheduled job %s", s.ID)
+		}
+		active = instances
+	}
+	state := tork.JobStatePending
+	switch overlap {
+	case tork.ScheduleOverlapSkip:
+		if len(active) > 0 {
+			log.Info().Msgf("Skipping scheduled job %s: previous instance %s is still active", s.ID, active[0].ID)
+			return ErrInstanceSkipped
+		}
+	case tork.ScheduleOverlapCancelPrevious:
+		for _, j := range active {
+			log.Info().Msgf("Cancelling previous instance %s of scheduled job %s", j.ID, s.ID)
+			j.State = tork.JobStateCancelled
+			if err := b.PublishJob(ctx, j); err != nil {
+				return errors.Wrapf(err, "error cancelling previous instance %s", j.ID)
+			}
+		}
+	case tork.ScheduleOverlapQueue:
+		state = tork.JobStateQueued
+	}
+	job.State = state
+	if err := ds.CreateJob(ctx, job); err != nil {
+		return errors.Wrapf(err, "error creating scheduled job instance: %s", s.ID)
+	}
+	if state == tork.JobStateQueued {
+		// start the oldest queued instance if there's
+		// no other instance currently running
+		return releaseQueuedJob(ctx, ds, b, s.ID)
+	}
+	if err := b.PublishJob(ctx, job); err != nil {
+		return errors.Wrapf(err, "error publishing scheduled job instance: %s", s.ID)
+	}
+	return nil
+}
+
 func (h *jobSchedulerHandler) handlePaused(_ context.Context, s *tork.ScheduledJob) error {
 	h.mu.Lock()
 	gjob, ok := h.m[s.ID]
 	h.mu.Unlock()
 	if !ok {
+		if s.Trigger != nil {
+			// triggered jobs are not in the scheduler
+			return nil
+		}
 		return errors.Errorf("unknown scheduled job: %s", s.ID)
 	}
 	log.Info().Msgf("Pausing scheduled job %s", gjob.ID())
@@ -165,3 +323,72 @@ func (h *jobSchedulerHandler) handlePaused(_ context.Context, s *tork.ScheduledJ
 	h.mu.Unlock()
 	return nil
 }
+
+// releaseQueuedJob starts the oldest QUEUED instance of a
+// scheduled job, provided that no other instance of the
+// scheduled job is currently active.
+func releaseQueuedJob(ctx context.Context, ds datastore.Datastore, b broker.Broker, scheduledJobID string) error {
+	instances, err := ds.GetActiveScheduledJobInstances(ctx, scheduledJobID)
+	if err != nil {
+		return errors.Wrapf(err, "error getting active instances of scheduled job %s", scheduledJobID)
+	}
+	if len(instances) == 0 {
+		return nil
+	}
+	for _, j := range instances {
+		if j.State != tork.JobStateQueued {
+			// a previous instance is still active
+			return nil
+		}
+	}
+	next := instances[0]
+	released := false
+	if err := ds.UpdateJob(ctx, next.ID, func(u *tork.Job) error {
+		if u.State != tork.JobStateQueued {
+			return nil
+		}
+		u.State = tork.JobStatePending
+		released = true
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "error releasing queued job %s", next.ID)
+	}
+	if !released {
+		return nil
+	}
+	log.Debug().Msgf("releasing queued instance %s of scheduled job %s", next.ID, scheduledJobID)
+	next.State = tork.JobStatePending
+	return b.PublishJob(ctx, next)
+}
+
+// cronSpec returns the cron expression of the scheduled
+// job, prefixed with its timezone if it has one.
+func cronSpec(s *tork.ScheduledJob) string {
+	if s.Timezone == "" {
+		return s.Cron
+	}
+	return fmt.Sprintf("CRON_TZ=%s %s", s.Timezone, s.Cron)
+}
+
+func parseSchedule(s *tork.ScheduledJob) (cron.Schedule, error) {
+	return cron.ParseStandard(cronSpec(s))
+}
+
+// lastFiredAt returns the time the scheduled job was last
+// fired at or its creation time if it was never fired.
+func lastFiredAt(s *tork.ScheduledJob) time.Time {
+	if s.LastFiredAt != nil {
+		return *s.LastFiredAt
+	}
+	return s.CreatedAt
+}
+
+// dueTicks returns the ticks of the schedule which fall
+// after since and no later than until, in order.
+func dueTicks(sched cron.Schedule, since, until time.Time) []time.Time {
+	ticks := make([]time.Time, 0)
+	for t := sched.Next(since); !t.IsZero() && !t.After(until); t = sched.Next(t) {
+		ticks = append(ticks, t.UTC())
+	}
+	return ticks
+}
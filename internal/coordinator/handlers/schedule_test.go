@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/robfig/cron/v3"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dueTicks(t *testing.T) {
+	sched, err := cron.ParseStandard("0 * * * *")
+	assert.NoError(t, err)
+	since := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	ticks := dueTicks(sched, since, since.Add(3*time.Hour+time.Minute))
+	assert.Equal(t, []time.Time{
+		since.Add(time.Hour),
+		since.Add(2 * time.Hour),
+		since.Add(3 * time.Hour),
+	}, ticks)
+	assert.Empty(t, dueTicks(sched, since, since.Add(time.Minute)))
+}
+
+func Test_cronSpecTimezone(t *testing.T) {
+	s := &tork.ScheduledJob{Cron: "0 9 * * *", Timezone: "America/New_York"}
+	assert.Equal(t, "CRON_TZ=America/New_York 0 9 * * *", cronSpec(s))
+	sched, err := parseSchedule(s)
+	assert.NoError(t, err)
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	next := sched.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 1, 1, 9, 0, 0, 0, loc).Unix(), next.Unix())
+	assert.Equal(t, "0 9 * * *", cronSpec(&tork.ScheduledJob{Cron: "0 9 * * *"}))
+}
+
+func newTestScheduledJob(t *testing.T, h *jobSchedulerHandler, overlap string) *tork.ScheduledJob {
+	sj := &tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "test scheduled job",
+		Cron:      "* * * * *",
+		State:     tork.ScheduledJobStateActive,
+		CreatedAt: time.Now().UTC(),
+		Overlap:   overlap,
+		Tasks: []*tork.Task{
+			{
+				Name:  "some task",
+				Image: "ubuntu:mantic",
+			},
+		},
+	}
+	err := h.ds.CreateScheduledJob(context.Background(), sj)
+	assert.NoError(t, err)
+	return sj
+}
+
+func Test_fireOverlapSkip(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	h := &jobSchedulerHandler{ds: ds, broker: broker.NewInMemoryBroker()}
+
+	sj := newTestScheduledJob(t, h, tork.ScheduleOverlapSkip)
+
+	assert.NoError(t, h.fire(ctx, sj, time.Now().UTC()))
+	instances, err := ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 1)
+
+	// the previous instance is still active
+	assert.NoError(t, h.fire(ctx, sj, time.Now().UTC()))
+	instances, err = ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 1)
+
+	err = ds.UpdateJob(ctx, instances[0].ID, func(u *tork.Job) error {
+		u.State = tork.JobStateCompleted
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, h.fire(ctx, sj, time.Now().UTC()))
+	instances, err = ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 1)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_fireOverlapQueue(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+	h := &jobSchedulerHandler{ds: ds, broker: b}
+
+	published := make(chan *tork.Job, 10)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		published <- j
+		return nil
+	})
+	assert.NoError(t, err)
+
+	sj := newTestScheduledJob(t, h, tork.ScheduleOverlapQueue)
+
+	// nothing is running so the first instance starts right away
+	assert.NoError(t, h.fire(ctx, sj, time.Now().UTC()))
+	first := <-published
+	assert.Equal(t, tork.JobStatePending, first.State)
+
+	// the second instance waits for the first one
+	assert.NoError(t, h.fire(ctx, sj, time.Now().UTC()))
+	instances, err := ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 2)
+	assert.Equal(t, first.ID, instances[0].ID)
+	assert.Equal(t, tork.JobStatePending, instances[0].State)
+	assert.Equal(t, tork.JobStateQueued, instances[1].State)
+	second := instances[1]
+
+	err = ds.UpdateJob(ctx, first.ID, func(u *tork.Job) error {
+		u.State = tork.JobStateCompleted
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, releaseQueuedJob(ctx, ds, b, sj.ID))
+	released := <-published
+	assert.Equal(t, second.ID, released.ID)
+	assert.Equal(t, tork.JobStatePending, released.State)
+
+	j2, err := ds.GetJobByID(ctx, second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.JobStatePending, j2.State)
+
+	// releasing again is a no-op
+	assert.NoError(t, releaseQueuedJob(ctx, ds, b, sj.ID))
+	select {
+	case j := <-published:
+		t.Fatalf("unexpected job published: %s", j.ID)
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func Test_fireOverlapCancelPrevious(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+	h := &jobSchedulerHandler{ds: ds, broker: b}
+
+	published := make(chan *tork.Job, 10)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		published <- j
+		return nil
+	})
+	assert.NoError(t, err)
+
+	sj := newTestScheduledJob(t, h, tork.ScheduleOverlapCancelPrevious)
+
+	assert.NoError(t, h.fire(ctx, sj, time.Now().UTC()))
+	first := <-published
+
+	err = ds.UpdateJob(ctx, first.ID, func(u *tork.Job) error {
+		u.State = tork.JobStateRunning
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, h.fire(ctx, sj, time.Now().UTC()))
+	cancelled := <-published
+	assert.Equal(t, first.ID, cancelled.ID)
+	assert.Equal(t, tork.JobStateCancelled, cancelled.State)
+	second := <-published
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Equal(t, tork.JobStatePending, second.State)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_catchUp(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	h := &jobSchedulerHandler{ds: ds, broker: broker.NewInMemoryBroker()}
+
+	now := time.Now().UTC()
+	lastFiredAt := now.Truncate(time.Hour).Add(-5 * time.Hour)
+
+	tests := []struct {
+		policy   string
+		window   string
+		expected int
+	}{
+		{tork.ScheduleCatchUpNone, "", 0},
+		{tork.ScheduleCatchUpLast, "", 1},
+		{tork.ScheduleCatchUpAll, "", 5},
+		{tork.ScheduleCatchUpAll, "3h", 3},
+	}
+	for _, test := range tests {
+		sj := &tork.ScheduledJob{
+			ID:          uuid.NewUUID(),
+			Name:        "test scheduled job",
+			Cron:        "@hourly",
+			State:       tork.ScheduledJobStateActive,
+			CreatedAt:   lastFiredAt,
+			LastFiredAt: &lastFiredAt,
+			CatchUp: &tork.ScheduleCatchUp{
+				Policy: test.policy,
+				Window: test.window,
+			},
+			Tasks: []*tork.Task{
+				{
+					Name:  "some task",
+					Image: "ubuntu:mantic",
+				},
+			},
+		}
+		err := ds.CreateScheduledJob(ctx, sj)
+		assert.NoError(t, err)
+
+		assert.NoError(t, h.catchUp(ctx, sj))
+		instances, err := ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+		assert.NoError(t, err)
+		assert.Len(t, instances, test.expected, "%s %s", test.policy, test.window)
+
+		// catching up again doesn't fire anything new
+		assert.NoError(t, h.catchUp(ctx, sj))
+		instances, err = ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+		assert.NoError(t, err)
+		assert.Len(t, instances, test.expected)
+
+		if test.expected > 0 {
+			sj2, err := ds.GetScheduledJobByID(ctx, sj.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, now.Truncate(time.Hour).Unix(), sj2.LastFiredAt.Unix())
+		}
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func Test_rescheduleJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	sc, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	h := &jobSchedulerHandler{
+		ds:        ds,
+		broker:    broker.NewInMemoryBroker(),
+		scheduler: sc,
+		m:         make(map[string]gocron.Job),
+	}
+
+	sj := &tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "test scheduled job",
+		Cron:      "0 0 * * *",
+		State:     tork.ScheduledJobStateActive,
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, h.handle(ctx, sj))
+	assert.Len(t, sc.Jobs(), 1)
+	first := sc.Jobs()[0].ID()
+
+	// updating the scheduled job replaces its entry
+	sj.Cron = "0 1 * * *"
+	assert.NoError(t, h.handle(ctx, sj))
+	assert.Len(t, sc.Jobs(), 1)
+	assert.NotEqual(t, first, sc.Jobs()[0].ID())
+
+	sj.State = tork.ScheduledJobStatePaused
+	assert.NoError(t, h.handle(ctx, sj))
+	assert.Len(t, sc.Jobs(), 0)
+
+	// triggered jobs are not scheduled
+	sj.State = tork.ScheduledJobStateActive
+	assert.NoError(t, h.handle(ctx, sj))
+	assert.Len(t, sc.Jobs(), 1)
+	sj.Cron = ""
+	sj.Trigger = &tork.JobTrigger{Name: "some job"}
+	assert.NoError(t, h.handle(ctx, sj))
+	assert.Len(t, sc.Jobs(), 0)
+	sj.State = tork.ScheduledJobStatePaused
+	assert.NoError(t, h.handle(ctx, sj))
+	assert.NoError(t, sc.Shutdown())
+	assert.NoError(t, ds.Close())
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
 )
@@ -38,7 +39,9 @@ func (h *startedHandler) handle(ctx context.Context, et task.EventType, t *tork.
 	}
 	// if the job isn't running anymore we need
 	// to cancel the task
-	if j.State != tork.JobStateRunning && j.State != tork.JobStateScheduled {
+	if j.State != tork.JobStateRunning &&
+		j.State != tork.JobStateScheduled &&
+		j.State != tork.JobStatePaused {
 		t.State = tork.TaskStateCancelled
 		node, err := h.ds.GetNodeByID(ctx, t.NodeID)
 		if err != nil {
@@ -55,7 +58,8 @@ func (h *startedHandler) handle(ctx context.Context, et task.EventType, t *tork.
 			return err
 		}
 	}
-	return h.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
+	running := false
+	if err := h.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
 		// we don't want to mark the task as RUNNING
 		// if an out-of-order task completion/failure
 		// arrived earlier
@@ -64,6 +68,10 @@ func (h *startedHandler) handle(ctx context.Context, et task.EventType, t *tork.
 			t.StartedAt = &now
 			u.State = tork.TaskStateRunning
 			u.StartedAt = &now
+			running = true
+			if u.ScheduledAt != nil {
+				metrics.TaskQueueWaitSeconds.Observe(now.Sub(*u.ScheduledAt).Seconds(), u.Queue)
+			}
 		}
 		// if the worker crashed, the task
 		// would automatically be returned
@@ -73,5 +81,13 @@ func (h *startedHandler) handle(ctx context.Context, et task.EventType, t *tork.
 		// node that picked up the task.
 		u.NodeID = t.NodeID
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	if running {
+		rt := t.Clone()
+		rt.State = tork.TaskStateRunning
+		publishTaskEvent(ctx, h.broker, broker.TOPIC_TASK_RUNNING, rt)
+	}
+	return nil
 }
@@ -22,6 +22,12 @@ func Test_handleStartedTask(t *testing.T) {
 	handler := NewStartedHandler(ds, b)
 	assert.NotNil(t, handler)
 
+	events := make(chan *tork.Task, 1)
+	err = b.SubscribeForEvents(ctx, broker.TOPIC_TASK, func(ev any) {
+		events <- ev.(*tork.Task)
+	})
+	assert.NoError(t, err)
+
 	now := time.Now().UTC()
 
 	j1 := &tork.Job{
@@ -52,6 +58,10 @@ func Test_handleStartedTask(t *testing.T) {
 	assert.Equal(t, t1.StartedAt.Unix(), t2.StartedAt.Unix())
 	assert.Equal(t, t1.NodeID, t2.NodeID)
 
+	ev := <-events
+	assert.Equal(t, t1.ID, ev.ID)
+	assert.Equal(t, tork.TaskStateRunning, ev.State)
+
 	j2, err := ds.GetJobByID(ctx, j1.ID)
 	assert.NoError(t, err)
 
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/eval"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/internal/wildcard"
+	"golang.org/x/exp/maps"
+)
+
+type jobTriggerHandler struct {
+	ds     datastore.Datastore
+	broker broker.Broker
+}
+
+// NewJobTriggerHandler returns a handler for job completed/failed
+// events which starts the active scheduled jobs whose trigger
+// matches the finished job.
+func NewJobTriggerHandler(ds datastore.Datastore, b broker.Broker) func(ctx context.Context, j *tork.Job) error {
+	h := &jobTriggerHandler{
+		ds:     ds,
+		broker: b,
+	}
+	return h.handle
+}
+
+func (h *jobTriggerHandler) handle(ctx context.Context, j *tork.Job) error {
+	sjs, err := h.ds.GetActiveScheduledJobs(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error getting active scheduled jobs")
+	}
+	for _, sj := range sjs {
+		if sj.Trigger == nil {
+			continue
+		}
+		// a triggered job can't trigger itself
+		if j.Schedule != nil && j.Schedule.ID == sj.ID {
+			continue
+		}
+		ok, err := triggerMatches(sj.Trigger, j)
+		if err != nil {
+			log.Error().Err(err).Msgf("error evaluating the trigger of scheduled job %s", sj.ID)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := h.fire(ctx, sj, j); err != nil {
+			log.Error().Err(err).Msgf("error triggering scheduled job %s", sj.ID)
+		}
+	}
+	return nil
+}
+
+// fire starts an instance of the triggered job for the source
+// job. Job events are broadcast to every coordinator so each fire
+// is first recorded under an ID derived from the trigger and the
+// source job, which makes sure that it is only ever decided once:
+// whether the instance is started, skipped or rejected.
+func (h *jobTriggerHandler) fire(ctx context.Context, sj *tork.ScheduledJob, src *tork.Job) error {
+	id := uuid.NewNameUUID(fmt.Sprintf("%s.%s", sj.ID, src.ID))
+	if err := h.ds.CreateScheduledJobFire(ctx, sj.ID, id); err != nil {
+		if errors.Is(err, datastore.ErrScheduledJobFired) {
+			log.Debug().Msgf("scheduled job %s was already triggered by job %s", sj.ID, src.ID)
+			return nil
+		}
+		return err
+	}
+	log.Info().Msgf("Job %s triggered scheduled job %s", src.ID, sj.ID)
+	job := tork.NewScheduledJobInstance(sj)
+	job.ID = id
+	inputs := triggerInputs(sj, src)
+	if err := tork.CheckInputs(sj.InputSchema, inputs); err != nil {
+		return err
+	}
+	job.Inputs = inputs
+	job.Context.Inputs = inputs
+	if err := StartScheduledJobInstance(ctx, h.ds, h.broker, sj, job); err != nil && !errors.Is(err, ErrInstanceSkipped) {
+		return err
+	}
+	return nil
+}
+
+// triggerMatches returns true if the finished job satisfies
+// all the criteria of the trigger.
+func triggerMatches(t *tork.JobTrigger, j *tork.Job) (bool, error) {
+	on := t.On
+	if len(on) == 0 {
+		on = []tork.JobState{tork.JobStateCompleted}
+	}
+	if !slices.Contains(on, j.State) {
+		return false, nil
+	}
+	if t.Name != "" && !wildcard.Match(t.Name, j.Name) {
+		return false, nil
+	}
+	for _, tag := range t.Tags {
+		if !slices.Contains(j.Tags, tag) {
+			return false, nil
+		}
+	}
+	if t.If == "" {
+		return true, nil
+	}
+	val, err := eval.EvaluateExpr(t.If, map[string]any{
+		"job": tork.NewJobSummary(j),
+	})
+	if err != nil {
+		return false, err
+	}
+	ok, isBool := val.(bool)
+	if !isBool {
+		return false, errors.Errorf("trigger condition must evaluate to a boolean: %s", t.If)
+	}
+	return ok, nil
+}
+
+// triggerInputs returns the inputs of a triggered job instance:
+// the scheduled job's own inputs, overridden by the outputs of
+// the source job's tasks and the source job's details.
+func triggerInputs(sj *tork.ScheduledJob, src *tork.Job) map[string]string {
+	inputs := make(map[string]string)
+	maps.Copy(inputs, sj.Inputs)
+	maps.Copy(inputs, src.Context.Tasks)
+	inputs["sourceJobId"] = src.ID
+	inputs["sourceJobName"] = src.Name
+	inputs["sourceJobState"] = src.State
+	inputs["sourceJobResult"] = src.Result
+	return inputs
+}
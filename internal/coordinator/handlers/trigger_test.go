@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_triggerMatches(t *testing.T) {
+	j := &tork.Job{
+		Name:   "ingest-videos",
+		State:  tork.JobStateCompleted,
+		Tags:   []string{"etl", "video"},
+		Result: "42",
+	}
+	tests := []struct {
+		name     string
+		trigger  *tork.JobTrigger
+		expected bool
+	}{
+		{"name", &tork.JobTrigger{Name: "ingest-videos"}, true},
+		{"wildcard name", &tork.JobTrigger{Name: "ingest-*"}, true},
+		{"other name", &tork.JobTrigger{Name: "export-*"}, false},
+		{"tags", &tork.JobTrigger{Tags: []string{"etl"}}, true},
+		{"missing tag", &tork.JobTrigger{Tags: []string{"etl", "audio"}}, false},
+		{"failed only", &tork.JobTrigger{Name: "ingest-*", On: []tork.JobState{tork.JobStateFailed}}, false},
+		{"completed or failed", &tork.JobTrigger{Name: "ingest-*", On: []tork.JobState{tork.JobStateCompleted, tork.JobStateFailed}}, true},
+		{"if true", &tork.JobTrigger{Name: "ingest-*", If: "{{ job.Result == '42' }}"}, true},
+		{"if false", &tork.JobTrigger{Name: "ingest-*", If: "{{ job.Result == '7' }}"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := triggerMatches(tt.trigger, j)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ok)
+		})
+	}
+	_, err := triggerMatches(&tork.JobTrigger{If: "{{ job.Result }}"}, j)
+	assert.Error(t, err)
+}
+
+func Test_jobTrigger(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+
+	published := make(chan *tork.Job, 10)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		published <- j
+		return nil
+	})
+	assert.NoError(t, err)
+
+	sj := &tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "process videos",
+		State:     tork.ScheduledJobStateActive,
+		CreatedAt: time.Now().UTC(),
+		Inputs: map[string]string{
+			"quality": "high",
+			"bucket":  "default",
+		},
+		Trigger: &tork.JobTrigger{
+			Name: "ingest-*",
+			If:   "{{ job.Result != '' }}",
+		},
+		Tasks: []*tork.Task{
+			{
+				Name:  "some task",
+				Image: "ubuntu:mantic",
+			},
+		},
+	}
+	assert.NoError(t, ds.CreateScheduledJob(ctx, sj))
+
+	handle := NewJobTriggerHandler(ds, b)
+
+	src := &tork.Job{
+		ID:     uuid.NewUUID(),
+		Name:   "ingest-videos",
+		State:  tork.JobStateCompleted,
+		Result: "3 videos",
+		Context: tork.JobContext{
+			Tasks: map[string]string{
+				"bucket": "videos",
+			},
+		},
+	}
+	assert.NoError(t, handle(ctx, src))
+
+	j := <-published
+	assert.Equal(t, tork.JobStatePending, j.State)
+	assert.Equal(t, sj.ID, j.Schedule.ID)
+	assert.Equal(t, "high", j.Inputs["quality"])
+	assert.Equal(t, "videos", j.Inputs["bucket"])
+	assert.Equal(t, src.ID, j.Inputs["sourceJobId"])
+	assert.Equal(t, "ingest-videos", j.Inputs["sourceJobName"])
+	assert.Equal(t, tork.JobStateCompleted, j.Inputs["sourceJobState"])
+	assert.Equal(t, "3 videos", j.Inputs["sourceJobResult"])
+	assert.Equal(t, j.Inputs, j.Context.Inputs)
+
+	// the same event delivered to another coordinator
+	// doesn't start a second instance
+	assert.NoError(t, handle(ctx, src))
+	// a non-matching job doesn't start an instance
+	assert.NoError(t, handle(ctx, &tork.Job{
+		ID:    uuid.NewUUID(),
+		Name:  "export-videos",
+		State: tork.JobStateCompleted,
+	}))
+	// an instance of the triggered job doesn't trigger itself
+	assert.NoError(t, handle(ctx, &tork.Job{
+		ID:       uuid.NewUUID(),
+		Name:     "ingest-more",
+		State:    tork.JobStateCompleted,
+		Result:   "done",
+		Schedule: &tork.JobSchedule{ID: sj.ID},
+	}))
+	select {
+	case j := <-published:
+		t.Fatalf("unexpected job published: %s", j.ID)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	instances, err := ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 1)
+
+	// paused triggers are ignored
+	err = ds.UpdateScheduledJob(ctx, sj.ID, func(u *tork.ScheduledJob) error {
+		u.State = tork.ScheduledJobStatePaused
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, handle(ctx, &tork.Job{
+		ID:     uuid.NewUUID(),
+		Name:   "ingest-videos",
+		State:  tork.JobStateCompleted,
+		Result: "1 video",
+	}))
+	select {
+	case j := <-published:
+		t.Fatalf("unexpected job published: %s", j.ID)
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func Test_jobTriggerInputSchema(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+
+	published := make(chan *tork.Job, 10)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		published <- j
+		return nil
+	})
+	assert.NoError(t, err)
+
+	sj := &tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "process videos",
+		State:     tork.ScheduledJobStateActive,
+		CreatedAt: time.Now().UTC(),
+		InputSchema: map[string]tork.Input{
+			"count": {Type: tork.InputTypeInt, Required: true},
+		},
+		Trigger: &tork.JobTrigger{Name: "ingest-*"},
+		Tasks: []*tork.Task{
+			{
+				Name:  "some task",
+				Image: "ubuntu:mantic",
+			},
+		},
+	}
+	assert.NoError(t, ds.CreateScheduledJob(ctx, sj))
+
+	handle := NewJobTriggerHandler(ds, b)
+
+	// the inputs supplied by the source job don't match the schema
+	assert.NoError(t, handle(ctx, &tork.Job{
+		ID:      uuid.NewUUID(),
+		Name:    "ingest-videos",
+		State:   tork.JobStateCompleted,
+		Context: tork.JobContext{Tasks: map[string]string{"count": "many"}},
+	}))
+	select {
+	case j := <-published:
+		t.Fatalf("unexpected job published: %s", j.ID)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	assert.NoError(t, handle(ctx, &tork.Job{
+		ID:      uuid.NewUUID(),
+		Name:    "ingest-videos",
+		State:   tork.JobStateCompleted,
+		Context: tork.JobContext{Tasks: map[string]string{"count": "3"}},
+	}))
+	j := <-published
+	assert.Equal(t, 3, j.Context.AsMap()["inputs"].(map[string]any)["count"])
+	assert.NoError(t, ds.Close())
+}
+
+func Test_jobTriggerSkipped(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+
+	published := make(chan *tork.Job, 10)
+	err = b.SubscribeForJobs(func(j *tork.Job) error {
+		published <- j
+		return nil
+	})
+	assert.NoError(t, err)
+
+	sj := &tork.ScheduledJob{
+		ID:        uuid.NewUUID(),
+		Name:      "process videos",
+		State:     tork.ScheduledJobStateActive,
+		CreatedAt: time.Now().UTC(),
+		Overlap:   tork.ScheduleOverlapSkip,
+		Trigger:   &tork.JobTrigger{Name: "ingest-*"},
+		Tasks: []*tork.Task{
+			{
+				Name:  "some task",
+				Image: "ubuntu:mantic",
+			},
+		},
+	}
+	assert.NoError(t, ds.CreateScheduledJob(ctx, sj))
+
+	handle := NewJobTriggerHandler(ds, b)
+
+	assert.NoError(t, handle(ctx, &tork.Job{
+		ID:    uuid.NewUUID(),
+		Name:  "ingest-videos",
+		State: tork.JobStateCompleted,
+	}))
+	active := <-published
+
+	// skipped: the previous instance is still active
+	src := &tork.Job{
+		ID:    uuid.NewUUID(),
+		Name:  "ingest-videos",
+		State: tork.JobStateCompleted,
+	}
+	assert.NoError(t, handle(ctx, src))
+
+	err = ds.UpdateJob(ctx, active.ID, func(u *tork.Job) error {
+		u.State = tork.JobStateCompleted
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// the same event delivered to another coordinator
+	// doesn't overturn the skip
+	assert.NoError(t, handle(ctx, src))
+	select {
+	case j := <-published:
+		t.Fatalf("unexpected job published: %s", j.ID)
+	case <-time.After(time.Millisecond * 100):
+	}
+	instances, err := ds.GetActiveScheduledJobInstances(ctx, sj.ID)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 0)
+	assert.NoError(t, ds.Close())
+}
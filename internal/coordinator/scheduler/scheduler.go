@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"slices"
 	"time"
 
 	"github.com/pkg/errors"
@@ -66,6 +67,21 @@ func (s *Scheduler) scheduleRegularTask(ctx context.Context, t *tork.Task) error
 			if t.Retry.Limit == 0 {
 				t.Retry.Limit = job.Defaults.Retry.Limit
 			}
+			if t.Retry.InitialDelay == "" {
+				t.Retry.InitialDelay = job.Defaults.Retry.InitialDelay
+			}
+			if t.Retry.Scaling == "" {
+				t.Retry.Scaling = job.Defaults.Retry.Scaling
+			}
+			if t.Retry.MaxDelay == "" {
+				t.Retry.MaxDelay = job.Defaults.Retry.MaxDelay
+			}
+			if !t.Retry.Jitter {
+				t.Retry.Jitter = job.Defaults.Retry.Jitter
+			}
+			if t.Retry.On == nil && job.Defaults.Retry.On != nil {
+				t.Retry.On = job.Defaults.Retry.On.Clone()
+			}
 		}
 		if t.Priority == 0 {
 			t.Priority = job.Defaults.Priority
@@ -74,6 +90,27 @@ func (s *Scheduler) scheduleRegularTask(ctx context.Context, t *tork.Task) error
 	if t.Queue == "" {
 		t.Queue = broker.QUEUE_DEFAULT
 	}
+	qname := t.Queue
+	if job.Workspace != nil {
+		// all the tasks of a job which has a workspace
+		// run on the node which holds the workspace
+		nodeID, err := s.workspaceNode(ctx, job, t.Queue)
+		if err != nil {
+			t.Error = err.Error()
+			t.State = tork.TaskStateFailed
+			t.FailedAt = &now
+			return s.broker.PublishTask(ctx, broker.QUEUE_ERROR, t)
+		}
+		mountWorkspace(t, job)
+		qname = broker.NodeTaskQueue(nodeID)
+		// the task is reaped if the node
+		// is lost before it gets to run it
+		t.NodeID = nodeID
+	}
+	// the task's span is part of the job's trace
+	if t.TraceParent == "" {
+		t.TraceParent = job.TraceParent
+	}
 	// mark task state as scheduled
 	t.State = tork.TaskStateScheduled
 	t.ScheduledAt = &now
@@ -85,11 +122,88 @@ func (s *Scheduler) scheduleRegularTask(ctx context.Context, t *tork.Task) error
 		u.Timeout = t.Timeout
 		u.Retry = t.Retry
 		u.Priority = t.Priority
+		u.NodeID = t.NodeID
 		return nil
 	}); err != nil {
 		return errors.Wrapf(err, "error updating task in datastore")
 	}
-	return s.broker.PublishTask(ctx, t.Queue, t)
+	return s.broker.PublishTask(ctx, qname, t)
+}
+
+// workspaceNode returns the ID of the node which holds the
+// job's workspace. The workspace is assigned to the least busy
+// worker node which subscribes to the task's queue when the
+// first task of the job is scheduled. The following tasks of
+// the job must use a queue which that node subscribes to.
+func (s *Scheduler) workspaceNode(ctx context.Context, job *tork.Job, queue string) (string, error) {
+	nodes, err := s.ds.GetActiveNodes(ctx)
+	if err != nil {
+		return "", err
+	}
+	if job.Workspace.NodeID != "" {
+		for _, n := range nodes {
+			if n.ID != job.Workspace.NodeID || n.Status != tork.NodeStatusUP {
+				continue
+			}
+			if !slices.Contains(n.Queues, queue) {
+				return "", errors.Errorf("node %s holding the job's workspace is not subscribed to queue %s", n.ID, queue)
+			}
+			return n.ID, nil
+		}
+		return "", errors.Errorf("node %s holding the job's workspace is not available", job.Workspace.NodeID)
+	}
+	var node *tork.Node
+	for _, n := range nodes {
+		// only worker nodes have a queue
+		if n.Queue == "" || n.Status != tork.NodeStatusUP || !slices.Contains(n.Queues, queue) {
+			continue
+		}
+		if node == nil || n.TaskCount < node.TaskCount {
+			node = n
+		}
+	}
+	if node == nil {
+		return "", errors.Errorf("no worker node subscribed to queue %s is available to hold the job's workspace", queue)
+	}
+	nodeID := node.ID
+	if err := s.ds.UpdateJob(ctx, job.ID, func(u *tork.Job) error {
+		if u.Workspace == nil {
+			return errors.Errorf("job %s has no workspace", u.ID)
+		}
+		// another task of the job might have
+		// been assigned a node in the meantime
+		if u.Workspace.NodeID == "" {
+			u.Workspace.NodeID = nodeID
+		} else {
+			nodeID = u.Workspace.NodeID
+		}
+		return nil
+	}); err != nil {
+		return "", errors.Wrapf(err, "error assigning workspace node for job %s", job.ID)
+	}
+	return nodeID, nil
+}
+
+// mountWorkspace adds the job's workspace to the
+// task's mounts, unless it's already there (e.g. on retry).
+func mountWorkspace(t *tork.Task, job *tork.Job) {
+	for _, m := range t.Mounts {
+		if m.Target == job.Workspace.Target {
+			return
+		}
+	}
+	mnt := tork.Mount{
+		Type:   tork.MountTypeWorkspace,
+		Source: job.ID,
+		Target: job.Workspace.Target,
+	}
+	if job.Workspace.Tmpfs {
+		mnt.Opts = map[string]string{"type": "tmpfs"}
+		if job.Workspace.Size != "" {
+			mnt.Opts["size"] = job.Workspace.Size
+		}
+	}
+	t.Mounts = append(t.Mounts, mnt)
 }
 
 func (s *Scheduler) scheduleSubJob(ctx context.Context, t *tork.Task) error {
@@ -121,10 +235,11 @@ func (s *Scheduler) scheduleAttachedSubJob(ctx context.Context, t *tork.Task) er
 			Inputs:  t.SubJob.Inputs,
 			Secrets: t.SubJob.Secrets,
 		},
-		TaskCount:  len(t.SubJob.Tasks),
-		Output:     t.SubJob.Output,
-		Webhooks:   t.SubJob.Webhooks,
-		AutoDelete: t.SubJob.AutoDelete,
+		TaskCount:   len(t.SubJob.Tasks),
+		Output:      t.SubJob.Output,
+		Webhooks:    t.SubJob.Webhooks,
+		AutoDelete:  t.SubJob.AutoDelete,
+		TraceParent: job.TraceParent,
 	}
 	if err := s.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
 		u.State = tork.TaskStateRunning
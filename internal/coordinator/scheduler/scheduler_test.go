@@ -61,6 +61,49 @@ func Test_scheduleRegularTask(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_scheduleRegularTaskTraceParent(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	processed := make(chan *tork.Task, 1)
+	err := b.SubscribeForTasks("test-queue", func(t *tork.Task) error {
+		processed <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	s := NewScheduler(ds, b)
+
+	j1 := &tork.Job{
+		ID:          uuid.NewUUID(),
+		Name:        "test job",
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
+	tk := &tork.Task{
+		ID:        uuid.NewUUID(),
+		Queue:     "test-queue",
+		JobID:     j1.ID,
+		CreatedAt: &now,
+	}
+
+	err = ds.CreateTask(ctx, tk)
+	assert.NoError(t, err)
+
+	err = s.scheduleRegularTask(ctx, tk)
+	assert.NoError(t, err)
+
+	scheduled := <-processed
+	assert.Equal(t, j1.TraceParent, scheduled.TraceParent)
+	assert.NoError(t, ds.Close())
+}
+
 func Test_scheduleRegularTaskOverrideDefaultQueue(t *testing.T) {
 	ctx := context.Background()
 	b := broker.NewInMemoryBroker()
@@ -165,6 +208,156 @@ func Test_scheduleRegularTaskJobDefaults(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_scheduleRegularTaskWorkspace(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	s := NewScheduler(ds, b)
+
+	now := time.Now().UTC()
+	busy := &tork.Node{
+		ID:              uuid.NewShortUUID(),
+		Queue:           "x-busy",
+		Queues:          []string{broker.QUEUE_DEFAULT},
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: now,
+		TaskCount:       5,
+	}
+	idle := &tork.Node{
+		ID:              uuid.NewShortUUID(),
+		Queue:           "x-idle",
+		Queues:          []string{broker.QUEUE_DEFAULT},
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: now,
+		TaskCount:       1,
+	}
+	// the least busy node doesn't subscribe to the tasks' queue
+	gpu := &tork.Node{
+		ID:              uuid.NewShortUUID(),
+		Queue:           "x-gpu",
+		Queues:          []string{"gpu"},
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: now,
+	}
+	assert.NoError(t, ds.CreateNode(ctx, busy))
+	assert.NoError(t, ds.CreateNode(ctx, idle))
+	assert.NoError(t, ds.CreateNode(ctx, gpu))
+
+	processed := make(chan *tork.Task, 2)
+	err = b.SubscribeForTasks(broker.NodeTaskQueue(idle.ID), func(t *tork.Task) error {
+		processed <- t
+		return nil
+	})
+	assert.NoError(t, err)
+	failed := make(chan *tork.Task, 1)
+	err = b.SubscribeForTasks(broker.QUEUE_ERROR, func(t *tork.Task) error {
+		failed <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	j1 := &tork.Job{
+		ID:   uuid.NewUUID(),
+		Name: "test job",
+		Workspace: &tork.JobWorkspace{
+			Target: "/workspace",
+			Size:   "1GB",
+			Tmpfs:  true,
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		tk := &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     j1.ID,
+			CreatedAt: &now,
+		}
+		err = ds.CreateTask(ctx, tk)
+		assert.NoError(t, err)
+		err = s.scheduleRegularTask(ctx, tk)
+		assert.NoError(t, err)
+
+		scheduled := <-processed
+		assert.Equal(t, broker.QUEUE_DEFAULT, scheduled.Queue)
+		// the task is reaped if the node is lost
+		assert.Equal(t, idle.ID, scheduled.NodeID)
+		stored, err := ds.GetTaskByID(ctx, tk.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, idle.ID, stored.NodeID)
+		assert.Equal(t, []tork.Mount{{
+			Type:   tork.MountTypeWorkspace,
+			Source: j1.ID,
+			Target: "/workspace",
+			Opts:   map[string]string{"type": tork.MountTypeTmpfs, "size": "1GB"},
+		}}, scheduled.Mounts)
+	}
+
+	j1, err = ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, idle.ID, j1.Workspace.NodeID)
+
+	// the node holding the workspace doesn't subscribe to the queue
+	tk := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		Queue:     "gpu",
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, tk)
+	assert.NoError(t, err)
+	err = s.scheduleRegularTask(ctx, tk)
+	assert.NoError(t, err)
+	tk = <-failed
+	assert.Equal(t, tork.TaskStateFailed, tk.State)
+	assert.Contains(t, tk.Error, "is not subscribed to queue gpu")
+	assert.NoError(t, ds.Close())
+}
+
+func Test_scheduleRegularTaskWorkspaceNoNode(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	failed := make(chan *tork.Task)
+	err := b.SubscribeForTasks(broker.QUEUE_ERROR, func(t *tork.Task) error {
+		failed <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	s := NewScheduler(ds, b)
+
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		Name:      "test job",
+		Workspace: &tork.JobWorkspace{Target: "/workspace"},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	tk := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, tk)
+	assert.NoError(t, err)
+
+	err = s.scheduleRegularTask(ctx, tk)
+	assert.NoError(t, err)
+
+	tk = <-failed
+	assert.Equal(t, tork.TaskStateFailed, tk.State)
+	assert.Contains(t, tk.Error, "no worker node")
+	assert.NoError(t, ds.Close())
+}
+
 func Test_scheduleParallelTask(t *testing.T) {
 	ctx := context.Background()
 	b := broker.NewInMemoryBroker()
@@ -2,7 +2,9 @@ package eval
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"regexp"
 
 	"github.com/expr-lang/expr"
@@ -91,6 +93,15 @@ func EvaluateTask(t *tork.Task, c map[string]any) error {
 		}
 		cmd[i] = result
 	}
+	// evaluate artifacts
+	if t.Artifacts != nil {
+		if err := evaluateArtifacts(t.Artifacts.Inputs, c); err != nil {
+			return err
+		}
+		if err := evaluateArtifacts(t.Artifacts.Outputs, c); err != nil {
+			return err
+		}
+	}
 	// evaluate sub-job
 	if t.SubJob != nil {
 		name, err := EvaluateTemplate(t.SubJob.Name, c)
@@ -136,6 +147,22 @@ func EvaluateTask(t *tork.Task, c map[string]any) error {
 	return nil
 }
 
+func evaluateArtifacts(artifacts []*tork.TaskArtifact, c map[string]any) error {
+	for _, a := range artifacts {
+		name, err := EvaluateTemplate(a.Name, c)
+		if err != nil {
+			return err
+		}
+		a.Name = name
+		p, err := EvaluateTemplate(a.Path, c)
+		if err != nil {
+			return err
+		}
+		a.Path = p
+	}
+	return nil
+}
+
 func EvaluateTemplate(ex string, c map[string]any) (string, error) {
 	if ex == "" {
 		return "", nil
@@ -152,13 +179,46 @@ func EvaluateTemplate(ex string, c map[string]any) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		buf.WriteString(fmt.Sprintf("%v", ev))
+		buf.WriteString(formatValue(ev, c))
 		loc = endTag
 	}
 	buf.WriteString(ex[loc:])
 	return buf.String(), nil
 }
 
+// formatValue renders the result of an expression. The value of
+// a list or json typed input is rendered as JSON so that it can be
+// passed along as-is. Any other value is rendered with %v.
+func formatValue(v any, c map[string]any) string {
+	if isTypedInput(v, c) {
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// isTypedInput reports whether v is the value of one of the list or
+// json typed inputs of the context, as opposed to a list or a map
+// computed by the expression (e.g. sequence(1,3)).
+func isTypedInput(v any, c map[string]any) bool {
+	inputs, ok := c["inputs"].(map[string]any)
+	if !ok || v == nil {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Map {
+		return false
+	}
+	for _, in := range inputs {
+		iv := reflect.ValueOf(in)
+		if iv.Kind() == rv.Kind() && iv.Pointer() == rv.Pointer() && iv.Len() == rv.Len() {
+			return true
+		}
+	}
+	return false
+}
+
 func ValidExpr(ex string) bool {
 	ex = sanitizeExpr(ex)
 	_, err := expr.Compile(ex)
@@ -174,10 +234,12 @@ func sanitizeExpr(ex string) string {
 
 func EvaluateExpr(ex string, c map[string]any) (any, error) {
 	ex = sanitizeExpr(ex)
-	env := map[string]any{
-		"randomInt": randomInt,
-		"sequence":  sequence,
+	env := make(map[string]any)
+	funcsMu.RLock()
+	for k, v := range funcs {
+		env[k] = v
 	}
+	funcsMu.RUnlock()
 	for k, v := range c {
 		env[k] = v
 	}
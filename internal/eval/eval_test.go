@@ -98,6 +98,26 @@ func TestEvalQueue(t *testing.T) {
 	assert.Equal(t, "default", t1.Queue)
 }
 
+func TestEvalArtifacts(t *testing.T) {
+	t1 := &tork.Task{
+		Artifacts: &tork.TaskArtifacts{
+			Inputs:  []*tork.TaskArtifact{{Name: "video-{{ item.index }}", Path: "/in/{{ item.value }}"}},
+			Outputs: []*tork.TaskArtifact{{Name: "thumb-{{ item.index }}", Path: "/out"}},
+		},
+	}
+	err := eval.EvaluateTask(t1, map[string]any{
+		"item": map[string]any{
+			"index": 1,
+			"value": "video.mp4",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "video-1", t1.Artifacts.Inputs[0].Name)
+	assert.Equal(t, "/in/video.mp4", t1.Artifacts.Inputs[0].Path)
+	assert.Equal(t, "thumb-1", t1.Artifacts.Outputs[0].Name)
+	assert.Equal(t, "/out", t1.Artifacts.Outputs[0].Path)
+}
+
 func TestEvalFunc(t *testing.T) {
 	t1 := &tork.Task{
 		Env: map[string]string{
@@ -295,6 +315,54 @@ func TestEvalExpr(t *testing.T) {
 	assert.Equal(t, []string{"a", "b", "c"}, v)
 }
 
+func TestEvalTemplateTypedValues(t *testing.T) {
+	c := tork.JobContext{
+		Inputs: map[string]string{
+			"files": `["a.jpg","b.jpg"]`,
+			"width": "800",
+			"opts":  `{"quality":90}`,
+		},
+		InputTypes: map[string]string{
+			"files": tork.InputTypeList,
+			"width": tork.InputTypeInt,
+			"opts":  tork.InputTypeJSON,
+		},
+	}.AsMap()
+
+	v, err := eval.EvaluateExpr("{{ inputs.files }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"a.jpg", "b.jpg"}, v)
+
+	v, err = eval.EvaluateExpr("{{ inputs.width * 2 }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, 1600, v)
+
+	// lists and maps are rendered as JSON
+	s, err := eval.EvaluateTemplate("{{ inputs.files }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, `["a.jpg","b.jpg"]`, s)
+
+	s, err = eval.EvaluateTemplate("quality={{ inputs.opts.quality }} opts={{ inputs.opts }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, `quality=90 opts={"quality":90}`, s)
+
+	// values computed by the expression keep their usual format
+	s, err = eval.EvaluateTemplate("{{ filter(inputs.files, # != 'a.jpg') }} {{ sequence(1,4) }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, "[b.jpg] [1 2 3]", s)
+}
+
+func TestEvalTemplateUntypedValues(t *testing.T) {
+	c := tork.JobContext{
+		Inputs: map[string]string{
+			"files": `["a.jpg","b.jpg"]`,
+		},
+	}.AsMap()
+	s, err := eval.EvaluateTemplate("{{ inputs.files }} {{ sequence(1,4) }} {{ split('a,b', ',') }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, `["a.jpg","b.jpg"] [1 2 3] [a b]`, s)
+}
+
 func TestValidExpr(t *testing.T) {
 	assert.True(t, eval.ValidExpr("{{1+1}}"))
 	assert.False(t, eval.ValidExpr("{1+1}}"))
@@ -318,3 +386,24 @@ func BenchmarkEval(b *testing.B) {
 		assert.Equal(b, "SOME DATA", t1.Env["HELLO"])
 	}
 }
+
+func TestEvalTemplateTaskOutputs(t *testing.T) {
+	c := tork.JobContext{
+		Tasks: map[string]string{"probe": "h264"},
+		TaskOutputs: map[string]map[string]any{
+			"upload": {"url": "s3://bucket/a.mp4", "size": float64(1024), "renditions": []any{"720p", "1080p"}},
+		},
+	}.AsMap()
+
+	s, err := eval.EvaluateTemplate("{{ tasks.upload.url }} {{ tasks.probe }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3://bucket/a.mp4 h264", s)
+
+	v, err := eval.EvaluateExpr("{{ tasks.upload.size > 1000 }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+
+	v, err = eval.EvaluateExpr("{{ tasks.upload.renditions }}", c)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"720p", "1080p"}, v)
+}
@@ -1,12 +1,61 @@
 package eval
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"math/rand"
+	"path"
 	"reflect"
+	"regexp"
+	"sync"
+	"time"
 
+	"github.com/expr-lang/expr/builtin"
 	"github.com/pkg/errors"
 )
 
+var (
+	funcsMu sync.RWMutex
+	// funcs holds the functions available to every expression, on
+	// top of the built-in functions of the expression language (e.g.
+	// toJSON, fromJSON, split, join, replace, trim, upper, lower,
+	// toBase64, fromBase64, now, date, duration).
+	funcs = map[string]any{
+		"randomInt":    randomInt,
+		"sequence":     sequence,
+		"sha256":       sha256Hex,
+		"toHex":        toHex,
+		"fromHex":      fromHex,
+		"regexMatch":   regexMatch,
+		"regexReplace": regexReplace,
+		"basename":     path.Base,
+		"dirname":      path.Dir,
+		"ext":          path.Ext,
+		"default":      defaultValue,
+		"coalesce":     coalesce,
+		"formatTime":   formatTime,
+		"addTime":      addTime,
+	}
+)
+
+// RegisterFunction makes a custom function available to every
+// expression. The name must not clash with any other function.
+func RegisterFunction(name string, fn any) error {
+	if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		return errors.Errorf("%s is not a function", name)
+	}
+	if _, ok := builtin.Index[name]; ok {
+		return errors.Errorf("function %s is a built-in function", name)
+	}
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	if _, ok := funcs[name]; ok {
+		return errors.Errorf("function %s is already registered", name)
+	}
+	funcs[name] = fn
+	return nil
+}
+
 func randomInt(args ...any) (int, error) {
 	if len(args) == 1 {
 		if args[0] == nil {
@@ -35,3 +84,113 @@ func sequence(start, stop int) []int {
 	}
 	return result
 }
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func toHex(s string) string {
+	return hex.EncodeToString([]byte(s))
+}
+
+func fromHex(s string) (string, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid hex string")
+	}
+	return string(b), nil
+}
+
+func regexMatch(pattern, s string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+func regexReplace(pattern, s, repl string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// defaultValue returns def if v is empty.
+func defaultValue(v, def any) any {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+// coalesce returns the first of its arguments which is not empty.
+func coalesce(args ...any) any {
+	for _, arg := range args {
+		if !isEmpty(arg) {
+			return arg
+		}
+	}
+	return nil
+}
+
+func isEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// formatTime formats a time.Time, an RFC3339 string or a
+// unix timestamp (seconds) using the given Go layout.
+func formatTime(t any, layout string) (string, error) {
+	tm, err := toTime(t)
+	if err != nil {
+		return "", err
+	}
+	return tm.Format(layout), nil
+}
+
+// addTime adds a duration (e.g. "1h30m" or "-24h") to a time.Time,
+// an RFC3339 string or a unix timestamp (seconds).
+func addTime(t any, d string) (time.Time, error) {
+	tm, err := toTime(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	dur, err := time.ParseDuration(d)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid duration")
+	}
+	return tm.Add(dur), nil
+}
+
+func toTime(t any) (time.Time, error) {
+	switch v := t.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		tm, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "invalid time")
+		}
+		return tm, nil
+	case int:
+		return time.Unix(int64(v), 0).UTC(), nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case float64:
+		return time.Unix(int64(v), 0).UTC(), nil
+	default:
+		return time.Time{}, errors.Errorf("invalid time: %v", t)
+	}
+}
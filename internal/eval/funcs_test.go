@@ -2,6 +2,7 @@ package eval
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -56,3 +57,131 @@ func TestRandomInt(t *testing.T) {
 		assert.NoError(t, err)
 	}
 }
+
+func TestSha256(t *testing.T) {
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sha256Hex("hello"))
+}
+
+func TestHex(t *testing.T) {
+	assert.Equal(t, "68656c6c6f", toHex("hello"))
+	s, err := fromHex("68656c6c6f")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", s)
+	_, err = fromHex("xyz")
+	assert.Error(t, err)
+}
+
+func TestRegex(t *testing.T) {
+	ok, err := regexMatch(`^v[0-9]+\.[0-9]+$`, "v1.2")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = regexMatch(`^v[0-9]+\.[0-9]+$`, "main")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, err = regexMatch(`[0-9`, "1")
+	assert.Error(t, err)
+
+	s, err := regexReplace(`[^a-z0-9]+`, "Hello World!", "-")
+	assert.NoError(t, err)
+	assert.Equal(t, "-ello-orld-", s)
+	_, err = regexReplace(`[0-9`, "1", "")
+	assert.Error(t, err)
+}
+
+func TestDefaultValue(t *testing.T) {
+	assert.Equal(t, "fallback", defaultValue("", "fallback"))
+	assert.Equal(t, "fallback", defaultValue(nil, "fallback"))
+	assert.Equal(t, "fallback", defaultValue([]any{}, "fallback"))
+	assert.Equal(t, "value", defaultValue("value", "fallback"))
+	assert.Equal(t, 0, defaultValue(0, 5))
+	assert.Equal(t, false, defaultValue(false, true))
+}
+
+func TestCoalesce(t *testing.T) {
+	assert.Equal(t, "b", coalesce(nil, "", "b", "c"))
+	assert.Equal(t, map[string]any{"a": 1}, coalesce(map[string]any{}, map[string]any{"a": 1}))
+	assert.Nil(t, coalesce(nil, ""))
+	assert.Nil(t, coalesce())
+}
+
+func TestFormatTime(t *testing.T) {
+	ts := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	s, err := formatTime(ts, "2006-01-02")
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-03-15", s)
+	s, err = formatTime("2024-03-15T10:30:00Z", "15:04")
+	assert.NoError(t, err)
+	assert.Equal(t, "10:30", s)
+	s, err = formatTime(ts.Unix(), time.RFC3339)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-03-15T10:30:00Z", s)
+	_, err = formatTime("yesterday", "2006-01-02")
+	assert.Error(t, err)
+	_, err = formatTime(true, "2006-01-02")
+	assert.Error(t, err)
+}
+
+func TestAddTime(t *testing.T) {
+	tm, err := addTime("2024-03-15T10:30:00Z", "-24h")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 14, 10, 30, 0, 0, time.UTC), tm)
+	_, err = addTime("2024-03-15T10:30:00Z", "1 day")
+	assert.Error(t, err)
+}
+
+func TestRegisterFunction(t *testing.T) {
+	assert.NoError(t, RegisterFunction("funcsTestGreet", func(s string) string { return "hello " + s }))
+	v, err := EvaluateExpr("{{ funcsTestGreet(inputs.name) }}", map[string]any{
+		"inputs": map[string]string{"name": "world"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", v)
+
+	assert.Error(t, RegisterFunction("funcsTestGreet", func(s string) string { return s }))
+	assert.Error(t, RegisterFunction("sha256", func(s string) string { return s }))
+	assert.Error(t, RegisterFunction("toJSON", func(s string) string { return s }))
+	assert.Error(t, RegisterFunction("funcsTestNil", nil))
+}
+
+func TestExprFunctions(t *testing.T) {
+	c := map[string]any{
+		"inputs": map[string]string{
+			"json":  `{"name":"tork","tags":["a","b"]}`,
+			"path":  "/data/videos/movie.mp4",
+			"text":  "  Hello World  ",
+			"empty": "",
+		},
+	}
+	tests := []struct {
+		expr     string
+		expected any
+	}{
+		{`{{ fromJSON(inputs.json).name }}`, "tork"},
+		{`{{ toJSON(fromJSON(inputs.json).tags) }}`, "[\n  \"a\",\n  \"b\"\n]"},
+		{`{{ join(split("a,b,c", ","), "|") }}`, "a|b|c"},
+		{`{{ replace(inputs.path, ".mp4", ".mov") }}`, "/data/videos/movie.mov"},
+		{`{{ regexMatch("\\.mp4$", inputs.path) }}`, true},
+		{`{{ regexReplace("[0-9]+", "v12", "N") }}`, "vN"},
+		{`{{ trim(inputs.text) }}`, "Hello World"},
+		{`{{ upper(trim(inputs.text)) }}`, "HELLO WORLD"},
+		{`{{ lower(trim(inputs.text)) }}`, "hello world"},
+		{`{{ fromBase64(toBase64("tork")) }}`, "tork"},
+		{`{{ fromHex(toHex("tork")) }}`, "tork"},
+		{`{{ sha256("tork") }}`, sha256Hex("tork")},
+		{`{{ basename(inputs.path) }}`, "movie.mp4"},
+		{`{{ dirname(inputs.path) }}`, "/data/videos"},
+		{`{{ ext(inputs.path) }}`, ".mp4"},
+		{`{{ default(inputs.empty, "none") }}`, "none"},
+		{`{{ coalesce(inputs.empty, inputs.missing, "last") }}`, "last"},
+		{`{{ formatTime("2024-03-15T10:30:00Z", "2006-01-02") }}`, "2024-03-15"},
+		{`{{ formatTime(addTime("2024-03-15T10:30:00Z", "48h"), "2006-01-02") }}`, "2024-03-17"},
+		{`{{ date("2024-03-15").Format("Jan 2") }}`, "Mar 15"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			v, err := EvaluateExpr(tt.expr, c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
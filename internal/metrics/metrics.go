@@ -0,0 +1,307 @@
+// Package metrics implements a minimal registry of counters, gauges
+// and histograms which are exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default upper bounds of the
+// histograms' buckets, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600}
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]*metric
+}
+
+// metric holds the series of a counter, a gauge or a
+// histogram, keyed by their label values.
+type metric struct {
+	name    string
+	help    string
+	typ     metricType
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// histogram only
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Counter is a metric which only goes up.
+type Counter struct {
+	m *metric
+}
+
+// Gauge is a metric which can go up and down.
+type Gauge struct {
+	m *metric
+}
+
+// Histogram samples observations (e.g. durations)
+// and counts them in configurable buckets.
+type Histogram struct {
+	m *metric
+}
+
+// Default is the registry used by the package level functions.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*metric)}
+}
+
+// NewCounter registers a counter in the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewGauge registers a gauge in the default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewHistogram registers a histogram in the default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// Write writes the metrics of the default registry
+// in the Prometheus text format.
+func Write(w io.Writer) error {
+	return Default.Write(w)
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{m: r.register(name, help, typeCounter, nil, labels)}
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m: r.register(name, help, typeGauge, nil, labels)}
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{m: r.register(name, help, typeHistogram, buckets, labels)}
+}
+
+func (r *Registry) register(name, help string, typ metricType, buckets []float64, labels []string) *metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric %s", name))
+	}
+	m := &metric{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.metrics[name] = m
+	return m
+}
+
+// Write writes the metrics in the Prometheus text format,
+// sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	ms := make([]*metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		ms = append(ms, r.metrics[name])
+	}
+	r.mu.RUnlock()
+	var sb strings.Builder
+	for _, m := range ms {
+		m.write(&sb)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Inc increments the counter of the given label values by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the given non-negative value to the
+// counter of the given label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counters can not decrease")
+	}
+	c.m.with(labelValues, func(s *series) {
+		s.value = s.value + v
+	})
+}
+
+// Set sets the gauge of the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.with(labelValues, func(s *series) {
+		s.value = v
+	})
+}
+
+// Add adds the given (possibly negative) value
+// to the gauge of the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.with(labelValues, func(s *series) {
+		s.value = s.value + v
+	})
+}
+
+// Reset removes all the series of the gauge, e.g. before
+// setting the values of the currently known nodes.
+func (g *Gauge) Reset() {
+	g.m.mu.Lock()
+	defer g.m.mu.Unlock()
+	g.m.series = make(map[string]*series)
+}
+
+// ReplaceAll atomically replaces all the series of the gauge with
+// the ones set by f, so that a concurrent scrape never sees a
+// partially populated gauge.
+func (g *Gauge) ReplaceAll(f func(set func(v float64, labelValues ...string))) {
+	next := make(map[string]*series)
+	f(func(v float64, labelValues ...string) {
+		if len(labelValues) != len(g.m.labels) {
+			panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", g.m.name, len(g.m.labels), len(labelValues)))
+		}
+		key := strings.Join(labelValues, "\xff")
+		next[key] = &series{labelValues: append([]string{}, labelValues...), value: v}
+	})
+	g.m.mu.Lock()
+	defer g.m.mu.Unlock()
+	g.m.series = next
+}
+
+// Observe adds an observation to the histogram
+// of the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.with(labelValues, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.m.buckets))
+		}
+		for i, b := range h.m.buckets {
+			if v <= b {
+				s.counts[i]++
+			}
+		}
+		s.sum = s.sum + v
+		s.count++
+	})
+}
+
+func (m *metric) with(labelValues []string, f func(s *series)) {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		m.series[key] = s
+	}
+	f(s)
+}
+
+func (m *metric) write(sb *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(sb, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(sb, "# TYPE %s %s\n", m.name, m.typ)
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := m.series[key]
+		switch m.typ {
+		case typeHistogram:
+			for i, b := range m.buckets {
+				fmt.Fprintf(sb, "%s_bucket%s %d\n", m.name, m.labelPairs(s, "le", formatFloat(b)), s.counts[i])
+			}
+			fmt.Fprintf(sb, "%s_bucket%s %d\n", m.name, m.labelPairs(s, "le", "+Inf"), s.count)
+			fmt.Fprintf(sb, "%s_sum%s %s\n", m.name, m.labelPairs(s), formatFloat(s.sum))
+			fmt.Fprintf(sb, "%s_count%s %d\n", m.name, m.labelPairs(s), s.count)
+		default:
+			fmt.Fprintf(sb, "%s%s %s\n", m.name, m.labelPairs(s), formatFloat(s.value))
+		}
+	}
+}
+
+// labelPairs formats the labels of the series, followed
+// by the given extra name/value pairs.
+func (m *metric) labelPairs(s *series, extra ...string) string {
+	if len(m.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(m.labels)+len(extra)/2)
+	for i, name := range m.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(s.labelValues[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escapeLabelValue(extra[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(v string) string {
+	return helpEscaper.Replace(v)
+}
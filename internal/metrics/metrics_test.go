@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "Some counter.", "state", "queue")
+	c.Inc("COMPLETED", "default")
+	c.Inc("COMPLETED", "default")
+	c.Add(3, "FAILED", "some \"queue\"")
+	sb := &strings.Builder{}
+	assert.NoError(t, r.Write(sb))
+	assert.Equal(t, `# HELP test_total Some counter.
+# TYPE test_total counter
+test_total{state="COMPLETED",queue="default"} 2
+test_total{state="FAILED",queue="some \"queue\""} 3
+`, sb.String())
+	assert.Panics(t, func() { c.Inc("COMPLETED") })
+	assert.Panics(t, func() { c.Add(-1, "COMPLETED", "default") })
+	assert.Panics(t, func() { r.NewCounter("test_total", "duplicate") })
+}
+
+func TestGauge(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("test_running", "Some gauge.", "node")
+	g.Set(5, "node-1")
+	g.Add(-2, "node-1")
+	g.Set(1.5, "node-2")
+	sb := &strings.Builder{}
+	assert.NoError(t, r.Write(sb))
+	assert.Equal(t, `# HELP test_running Some gauge.
+# TYPE test_running gauge
+test_running{node="node-1"} 3
+test_running{node="node-2"} 1.5
+`, sb.String())
+	g.Reset()
+	sb.Reset()
+	assert.NoError(t, r.Write(sb))
+	assert.Equal(t, "# HELP test_running Some gauge.\n# TYPE test_running gauge\n", sb.String())
+}
+
+func TestGaugeReplaceAll(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("test_running", "Some gauge.", "node")
+	g.Set(5, "node-1")
+	g.Set(2, "node-2")
+	g.ReplaceAll(func(set func(v float64, labelValues ...string)) {
+		set(3, "node-2")
+		set(1, "node-3")
+	})
+	sb := &strings.Builder{}
+	assert.NoError(t, r.Write(sb))
+	assert.Equal(t, `# HELP test_running Some gauge.
+# TYPE test_running gauge
+test_running{node="node-2"} 3
+test_running{node="node-3"} 1
+`, sb.String())
+	assert.Panics(t, func() {
+		g.ReplaceAll(func(set func(v float64, labelValues ...string)) {
+			set(1)
+		})
+	})
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("test_seconds", "Some histogram.", []float64{10, 1})
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(20)
+	sb := &strings.Builder{}
+	assert.NoError(t, r.Write(sb))
+	assert.Equal(t, `# HELP test_seconds Some histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="10"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 21.5
+test_seconds_count 3
+`, sb.String())
+}
@@ -0,0 +1,71 @@
+package metrics
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	JobsTotal = NewCounter(
+		"tork_jobs_total",
+		"Number of jobs which reached a terminal state.",
+		"state",
+	)
+	TasksTotal = NewCounter(
+		"tork_tasks_total",
+		"Number of tasks which reached a terminal state.",
+		"state", "queue",
+	)
+	TaskRetriesTotal = NewCounter(
+		"tork_task_retries_total",
+		"Number of failed tasks which were retried.",
+		"queue",
+	)
+	TaskQueueWaitSeconds = NewHistogram(
+		"tork_task_queue_wait_seconds",
+		"Time between the scheduling of a task and its start.",
+		DefaultBuckets,
+		"queue",
+	)
+	TaskRunSeconds = NewHistogram(
+		"tork_task_run_seconds",
+		"Time between the start of a task and its completion or failure.",
+		DefaultBuckets,
+		"state", "queue",
+	)
+	WebhookDeliveriesTotal = NewCounter(
+		"tork_webhook_deliveries_total",
+		"Number of webhook deliveries by outcome (success or failure).",
+		"outcome",
+	)
+	BrokerPublishErrorsTotal = NewCounter(
+		"tork_broker_publish_errors_total",
+		"Number of messages which failed to be published to the broker.",
+		"kind",
+	)
+	ImagePullSeconds = NewHistogram(
+		"tork_image_pull_seconds",
+		"Time taken to pull a missing image.",
+		DefaultBuckets,
+		"runtime",
+	)
+	JobsRunning = NewGauge(
+		"tork_jobs_running",
+		"Number of running jobs.",
+	)
+	TasksRunning = NewGauge(
+		"tork_tasks_running",
+		"Number of running tasks.",
+	)
+	NodesOnline = NewGauge(
+		"tork_nodes_online",
+		"Number of online nodes.",
+	)
+	NodesCPUPercent = NewGauge(
+		"tork_nodes_cpu_percent",
+		"Average CPU utilization of the online nodes.",
+	)
+	NodeRunningTasks = NewGauge(
+		"tork_node_running_tasks",
+		"Number of tasks running on a node.",
+		"node",
+	)
+)
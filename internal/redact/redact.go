@@ -101,6 +101,9 @@ func (r *Redacter) RedactJob(j *tork.Job) {
 	redacted.Context.Inputs = r.redactVars(redacted.Context.Inputs, j.Secrets)
 	redacted.Context.Secrets = r.redactVars(redacted.Context.Secrets, j.Secrets)
 	redacted.Context.Tasks = r.redactVars(redacted.Context.Tasks, j.Secrets)
+	for k, v := range redacted.Context.TaskOutputs {
+		redacted.Context.TaskOutputs[k] = r.redactOutputs(v, j.Secrets)
+	}
 	// redact tasks
 	for _, t := range redacted.Tasks {
 		r.doRedactTask(t, j.Secrets)
@@ -132,3 +135,24 @@ func (r *Redacter) redactVars(m map[string]string, secrets map[string]string) ma
 	}
 	return redacted
 }
+
+func (r *Redacter) redactOutputs(m map[string]any, secrets map[string]string) map[string]any {
+	redacted := make(map[string]any)
+	for k, v := range m {
+		for _, m := range r.matchers {
+			if m(k) {
+				v = redactedStr
+				break
+			}
+		}
+		if s, ok := v.(string); ok {
+			for _, secret := range secrets {
+				if secret == s {
+					v = redactedStr
+				}
+			}
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
@@ -132,6 +132,13 @@ func TestRedactJob(t *testing.T) {
 				"secret": "password",
 				"task2":  "helloworld",
 			},
+			TaskOutputs: map[string]map[string]any{
+				"task3": {
+					"token":    "shhhhh",
+					"password": "abc",
+					"size":     float64(10),
+				},
+			},
 		},
 		Webhooks: []*tork.Webhook{
 			{
@@ -169,6 +176,11 @@ func TestRedactJob(t *testing.T) {
 		"secret": "[REDACTED]",
 		"task2":  "helloworld",
 	}, j.Context.Tasks)
+	assert.Equal(t, map[string]any{
+		"token":    "[REDACTED]",
+		"password": "[REDACTED]",
+		"size":     float64(10),
+	}, j.Context.TaskOutputs["task3"])
 	assert.Equal(t, "[REDACTED]", j.Execution[0].Env["secret_1"])
 	assert.Equal(t, "http://example.com/1", j.Webhooks[0].URL)
 	assert.Equal(t, "http://example.com/2", j.Webhooks[1].URL)
@@ -0,0 +1,105 @@
+// Package tracing propagates the trace of a job across the API,
+// the coordinator, the broker messages and the workers using
+// OpenTelemetry. Unless a provider is configured, all the spans
+// are no-ops.
+package tracing
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TRACING_NONE = "none"
+	TRACING_OTLP = "otlp"
+)
+
+// TRACEPARENT is the environment variable through which
+// tasks receive the W3C trace context of their span.
+const TRACEPARENT = "TRACEPARENT"
+
+const tracerName = "github.com/runabol/tork"
+
+var propagator = propagation.TraceContext{}
+
+type OTLPConfig struct {
+	// Endpoint is the host:port of the OTLP/HTTP collector
+	Endpoint string
+	// Insecure disables TLS
+	Insecure bool
+	// ServiceName identifies the process in the traces
+	ServiceName string
+	// SampleRatio is the ratio of the traces which are sampled
+	SampleRatio float64
+}
+
+// InitOTLP installs a global tracer provider which exports the
+// spans to an OTLP collector. The returned function flushes the
+// pending spans and must be called on shutdown.
+func InitOTLP(ctx context.Context, cfg OTLPConfig) (func(ctx context.Context) error, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating OTLP exporter")
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "tork"
+	}
+	res := resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start starts a span which is a child of
+// the span of the context, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceParent returns the W3C traceparent of the span of the
+// context, or an empty string if the context has no valid span.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// Extract returns a context which holds the remote span of the given
+// W3C traceparent. The context is returned as is if traceparent is empty.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
@@ -0,0 +1,59 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceParentNoSpan(t *testing.T) {
+	assert.Equal(t, "", tracing.TraceParent(context.Background()))
+	ctx := context.Background()
+	assert.Equal(t, ctx, tracing.Extract(ctx, ""))
+}
+
+func TestTraceParentRoundtrip(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := tracing.Extract(context.Background(), tp)
+	sc := trace.SpanContextFromContext(ctx)
+	assert.True(t, sc.IsValid())
+	assert.True(t, sc.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, tp, tracing.TraceParent(ctx))
+}
+
+func TestStartEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(prev)
+
+	ctx, root := tracing.Start(context.Background(), "job.submit", attribute.String("tork.job.id", "1234"))
+	traceparent := tracing.TraceParent(ctx)
+	assert.NotEmpty(t, traceparent)
+	tracing.End(root, nil)
+
+	// the worker continues the trace from the traceparent
+	_, child := tracing.Start(tracing.Extract(context.Background(), traceparent), "task.run")
+	tracing.End(child, errors.New("something bad happened"))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "job.submit", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, "task.run", spans[1].Name())
+	assert.Equal(t, spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	assert.Equal(t, spans[0].SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "something bad happened", spans[1].Status().Description)
+}
@@ -12,6 +12,13 @@ func NewUUID() string {
 	return strings.ReplaceAll(guuid.NewString(), "-", "")
 }
 
+// NewNameUUID returns a UUID derived from the given name, such
+// that the same name always yields the same UUID. The UUID is
+// formatted the same way as NewUUID's.
+func NewNameUUID(name string) string {
+	return strings.ReplaceAll(guuid.NewSHA1(guuid.NameSpaceOID, []byte(name)).String(), "-", "")
+}
+
 // NewShortUUID returns a new UUIDv4, encoded with base57
 func NewShortUUID() string {
 	return shortuuid.New()
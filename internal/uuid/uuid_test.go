@@ -11,6 +11,13 @@ func TestNewUUID(t *testing.T) {
 	assert.Equal(t, 32, len(uuid.NewUUID()))
 }
 
+func TestNewNameUUID(t *testing.T) {
+	id := uuid.NewNameUUID("some name")
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, uuid.NewNameUUID("some name"))
+	assert.NotEqual(t, id, uuid.NewNameUUID("some other name"))
+}
+
 func TestNewShortUUID(t *testing.T) {
 	ids := map[string]string{}
 	for i := 0; i < 100; i++ {
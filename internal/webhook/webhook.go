@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/internal/fns"
+	"github.com/runabol/tork/internal/metrics"
 )
 
 const (
@@ -67,10 +68,12 @@ func Call(wh *tork.Webhook, body any) error {
 		defer fns.CloseIgnore(resp.Body)
 		// Success (2xx)
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			metrics.WebhookDeliveriesTotal.Inc("success")
 			return nil
 		}
 		// Check if the status code is retryable
 		if !isRetryable(resp.StatusCode) {
+			metrics.WebhookDeliveriesTotal.Inc("failure")
 			return errors.Errorf("[Webhook] request to %s failed with non-retryable status %d", wh.URL, resp.StatusCode)
 		}
 		log.Info().Msgf("[Webhook] request to %s failed with %d", wh.URL, resp.StatusCode)
@@ -78,5 +81,6 @@ func Call(wh *tork.Webhook, body any) error {
 		time.Sleep(time.Second * time.Duration(attempts*2))
 		attempts = attempts + 1
 	}
+	metrics.WebhookDeliveriesTotal.Inc("failure")
 	return errors.Errorf("[Webhook] failed to call webhook %s. max attempts: %d)", wh.URL, webhookDefaultMaxAttempts)
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/health"
 	"github.com/runabol/tork/internal/httpx"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/syncx"
 	"github.com/runabol/tork/runtime"
 )
@@ -27,12 +28,14 @@ type api struct {
 	broker  broker.Broker
 	runtime runtime.Runtime
 	tasks   *syncx.Map[string, runningTask]
+	nodeID  string
 	port    int
 }
 
-func newAPI(cfg Config, tasks *syncx.Map[string, runningTask]) *api {
+func newAPI(cfg Config, nodeID string, tasks *syncx.Map[string, runningTask]) *api {
 	r := echo.New()
 	s := &api{
+		nodeID:  nodeID,
 		runtime: cfg.Runtime,
 		broker:  cfg.Broker,
 		tasks:   tasks,
@@ -42,9 +45,21 @@ func newAPI(cfg Config, tasks *syncx.Map[string, runningTask]) *api {
 		},
 	}
 	r.GET("/health", s.health)
+	r.GET("/metrics", s.metrics)
 	return s
 }
 
+func (s *api) metrics(c echo.Context) error {
+	running := 0
+	s.tasks.Iterate(func(_ string, _ runningTask) {
+		running = running + 1
+	})
+	metrics.NodeRunningTasks.Set(float64(running), s.nodeID)
+	c.Response().Header().Set(echo.HeaderContentType, metrics.ContentType)
+	c.Response().WriteHeader(http.StatusOK)
+	return metrics.Write(c.Response())
+}
+
 func (s *api) health(c echo.Context) error {
 	result := health.NewHealthCheck().
 		WithIndicator(health.ServiceRuntime, s.runtime.HealthCheck).
@@ -6,7 +6,9 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/syncx"
 	"github.com/runabol/tork/runtime/docker"
 	"github.com/stretchr/testify/assert"
@@ -18,7 +20,7 @@ func Test_health(t *testing.T) {
 	api := newAPI(Config{
 		Broker:  broker.NewInMemoryBroker(),
 		Runtime: rt,
-	}, &syncx.Map[string, runningTask]{})
+	}, "some-node", &syncx.Map[string, runningTask]{})
 	assert.NotNil(t, api)
 	req, err := http.NewRequest("GET", "/health", nil)
 	assert.NoError(t, err)
@@ -30,3 +32,24 @@ func Test_health(t *testing.T) {
 	assert.Contains(t, string(body), "\"status\":\"UP\"")
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func Test_metrics(t *testing.T) {
+	rt, err := docker.NewDockerRuntime()
+	assert.NoError(t, err)
+	tasks := &syncx.Map[string, runningTask]{}
+	tasks.Set("some-task", runningTask{task: &tork.Task{ID: "some-task"}})
+	api := newAPI(Config{
+		Broker:  broker.NewInMemoryBroker(),
+		Runtime: rt,
+	}, "some-node", tasks)
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, metrics.ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, string(body), "# TYPE tork_node_running_tasks gauge\n")
+	assert.Contains(t, string(body), "tork_node_running_tasks{node=\"some-node\"} 1\n")
+}
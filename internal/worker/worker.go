@@ -2,8 +2,10 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"sync/atomic"
 	"time"
 
@@ -16,9 +18,12 @@ import (
 
 	"github.com/runabol/tork/internal/host"
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/runtime"
 
 	"github.com/runabol/tork/internal/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/exp/maps"
 )
 
 type Worker struct {
@@ -34,6 +39,10 @@ type Worker struct {
 	api        *api
 	taskCount  int32
 	middleware []task.MiddlewareFunc
+	workspaces *runtime.WorkspaceMounter
+	// slots bounds the number of tasks the worker runs at once
+	// across its queues and the queue of the tasks pinned to it.
+	slots chan struct{}
 }
 
 type Config struct {
@@ -44,12 +53,20 @@ type Config struct {
 	Queues     map[string]int
 	Limits     Limits
 	Middleware []task.MiddlewareFunc
+	// Workspaces is the mounter of the jobs' workspaces,
+	// which are released when their job is finished.
+	Workspaces *runtime.WorkspaceMounter
 }
 
+// DefaultMaxOutputsSize is the maximum size, in bytes, of the
+// serialized outputs of a task when no limit is configured.
+const DefaultMaxOutputsSize = runtime.DefaultMaxOutputsSize
+
 type Limits struct {
 	DefaultCPUsLimit   string
 	DefaultMemoryLimit string
 	DefaultTimeout     string
+	MaxOutputsSize     int
 }
 
 type runningTask struct {
@@ -68,8 +85,9 @@ func NewWorker(cfg Config) (*Worker, error) {
 		return nil, errors.New("must provide runtime")
 	}
 	tasks := new(syncx.Map[string, runningTask])
+	id := uuid.NewShortUUID()
 	w := &Worker{
-		id:         uuid.NewShortUUID(),
+		id:         id,
 		name:       cfg.Name,
 		startTime:  time.Now().UTC(),
 		broker:     cfg.Broker,
@@ -77,9 +95,10 @@ func NewWorker(cfg Config) (*Worker, error) {
 		queues:     cfg.Queues,
 		tasks:      tasks,
 		limits:     cfg.Limits,
-		api:        newAPI(cfg, tasks),
+		api:        newAPI(cfg, id, tasks),
 		stop:       make(chan any),
 		middleware: cfg.Middleware,
+		workspaces: cfg.Workspaces,
 	}
 	return w, nil
 }
@@ -97,6 +116,12 @@ func (w *Worker) cancelTask(t *tork.Task) error {
 }
 
 func (w *Worker) handleTask(t *tork.Task) error {
+	if w.slots != nil {
+		w.slots <- struct{}{}
+		defer func() {
+			<-w.slots
+		}()
+	}
 	return w.doHandleTask(context.Background(), t)
 }
 
@@ -136,14 +161,18 @@ func (w *Worker) doHandleTask(ctx context.Context, t *tork.Task) error {
 	switch rt.State {
 	case tork.TaskStateCompleted:
 		t.Result = rt.Result
+		t.Outputs = rt.Outputs
 		t.CompletedAt = rt.CompletedAt
+		t.Usage = rt.Usage
 		t.State = rt.State
 		if err := w.broker.PublishTask(ctx, broker.QUEUE_COMPLETED, t); err != nil {
 			return err
 		}
 	case tork.TaskStateFailed:
 		t.Error = rt.Error
+		t.ExitCode = rt.ExitCode
 		t.FailedAt = rt.FailedAt
+		t.Usage = rt.Usage
 		t.State = rt.State
 		if err := w.broker.PublishTask(ctx, broker.QUEUE_ERROR, t); err != nil {
 			return err
@@ -164,6 +193,17 @@ func (w *Worker) runTask(t *tork.Task) error {
 	// task later on
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	// each attempt of a task is a span of the job's trace
+	ctx, span := tracing.Start(tracing.Extract(ctx, t.TraceParent), "task.run",
+		attribute.String("tork.job.id", t.JobID),
+		attribute.String("tork.task.id", t.ID),
+		attribute.String("tork.task.name", t.Name),
+		attribute.String("tork.task.queue", t.Queue),
+		attribute.String("tork.node.id", w.id),
+	)
+	if t.Retry != nil {
+		span.SetAttributes(attribute.Int("tork.task.attempt", t.Retry.Attempts+1))
+	}
 	w.tasks.Set(t.ID, runningTask{
 		cancel: cancel,
 		task:   t,
@@ -171,11 +211,27 @@ func (w *Worker) runTask(t *tork.Task) error {
 	defer w.tasks.Delete(t.ID)
 	// let the coordinator know that the task started executing
 	if err := w.broker.PublishTask(ctx, broker.QUEUE_STARTED, t); err != nil {
+		tracing.End(span, err)
 		return err
 	}
+	// let the task's code join the trace
+	if traceparent := tracing.TraceParent(ctx); traceparent != "" && t.Env[tracing.TRACEPARENT] == "" {
+		if t.Env == nil {
+			t.Env = make(map[string]string)
+		}
+		t.Env[tracing.TRACEPARENT] = traceparent
+		// the next attempt gets a traceparent of its own
+		defer delete(t.Env, tracing.TRACEPARENT)
+	}
 	if err := w.doRunTask(ctx, t); err != nil {
+		tracing.End(span, err)
 		return err
 	}
+	if t.State == tork.TaskStateFailed {
+		tracing.End(span, errors.New(t.Error))
+	} else {
+		tracing.End(span, nil)
+	}
 	return nil
 }
 
@@ -192,19 +248,80 @@ func (w *Worker) doRunTask(ctx context.Context, t *tork.Task) error {
 		rctx = tctx
 	}
 	// run the task
-	if err := w.runtime.Run(rctx, t); err != nil {
+	started := time.Now()
+	err := w.runtime.Run(rctx, t)
+	recordWallTime(t, time.Since(started))
+	if err != nil {
 		finished := time.Now().UTC()
 		t.FailedAt = &finished
 		t.State = tork.TaskStateFailed
 		t.Error = err.Error()
+		if code, ok := runtime.ExitCode(err); ok {
+			t.ExitCode = &code
+		}
 		return nil
 	}
 	finished := time.Now().UTC()
+	if err := w.checkOutputs(t); err != nil {
+		t.FailedAt = &finished
+		t.State = tork.TaskStateFailed
+		t.Error = err.Error()
+		t.Outputs = nil
+		return nil
+	}
 	t.CompletedAt = &finished
 	t.State = tork.TaskStateCompleted
 	return nil
 }
 
+// recordWallTime sets the wall time of the task's usage. The
+// other figures are up to the runtime and remain zero if it
+// can't measure them.
+func recordWallTime(t *tork.Task, elapsed time.Duration) {
+	if t.Usage == nil {
+		t.Usage = &tork.TaskUsage{}
+	}
+	t.Usage.WallSeconds = elapsed.Seconds()
+}
+
+// checkOutputs makes sure that the serialized outputs
+// of the task don't exceed the worker's limit.
+func (w *Worker) checkOutputs(t *tork.Task) error {
+	if len(t.Outputs) == 0 {
+		return nil
+	}
+	limit := w.limits.MaxOutputsSize
+	if limit <= 0 {
+		limit = DefaultMaxOutputsSize
+	}
+	b, err := json.Marshal(t.Outputs)
+	if err != nil {
+		return errors.Wrapf(err, "error serializing task outputs")
+	}
+	if len(b) > limit {
+		return errors.Errorf("task outputs size (%d bytes) exceeds the limit of %d bytes", len(b), limit)
+	}
+	return nil
+}
+
+// releaseWorkspace removes the workspace of
+// a job once it reaches a terminal state.
+func (w *Worker) releaseWorkspace(ev any) {
+	j, ok := ev.(*tork.Job)
+	if !ok {
+		log.Error().Msgf("error casting job: %v", ev)
+		return
+	}
+	if j.State != tork.JobStateCompleted &&
+		j.State != tork.JobStateFailed &&
+		j.State != tork.JobStateCancelled {
+		return
+	}
+	if err := w.workspaces.Release(context.Background(), j.ID); err != nil {
+		log.Error().Err(err).Msgf("error releasing workspace of job %s", j.ID)
+	}
+}
+
 func (w *Worker) sendHeartbeats() {
 	for {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -219,6 +336,8 @@ func (w *Worker) sendHeartbeats() {
 			log.Error().Err(err).Msgf("failed to get hostname for worker %s", w.id)
 		}
 		cpuPercent := host.GetCPUPercent()
+		queues := maps.Keys(w.queues)
+		slices.Sort(queues)
 		err = w.broker.PublishHeartbeat(
 			context.Background(),
 			&tork.Node{
@@ -227,6 +346,7 @@ func (w *Worker) sendHeartbeats() {
 				StartedAt:       w.startTime,
 				CPUPercent:      cpuPercent,
 				Queue:           fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, w.id),
+				Queues:          queues,
 				Status:          status,
 				LastHeartbeatAt: time.Now().UTC(),
 				Hostname:        hostname,
@@ -257,6 +377,18 @@ func (w *Worker) Start() error {
 	if err := w.broker.SubscribeForTasks(fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, w.id), w.cancelTask); err != nil {
 		return errors.Wrapf(err, "error subscribing for queue: %s", w.id)
 	}
+	// the tasks pinned to the node (i.e. the tasks which share
+	// their job's workspace) run one at a time and within the
+	// worker's concurrency
+	if w.workspaces != nil {
+		total := 0
+		for qname, concurrency := range w.queues {
+			if broker.IsWorkerQueue(qname) {
+				total = total + concurrency
+			}
+		}
+		w.slots = make(chan struct{}, max(total, 1))
+	}
 	// subscribe to shared work queues
 	for qname, concurrency := range w.queues {
 		if !broker.IsWorkerQueue(qname) {
@@ -269,6 +401,16 @@ func (w *Worker) Start() error {
 			}
 		}
 	}
+	if w.workspaces != nil {
+		// subscribe to the queue of the tasks pinned to the node
+		nodeq := broker.NodeTaskQueue(w.id)
+		if err := w.broker.SubscribeForTasks(nodeq, w.handleTask); err != nil {
+			return errors.Wrapf(err, "error subscribing for queue: %s", nodeq)
+		}
+		if err := w.broker.SubscribeForEvents(context.Background(), broker.TOPIC_JOB, w.releaseWorkspace); err != nil {
+			return errors.Wrapf(err, "error subscribing for job events")
+		}
+	}
 	go w.sendHeartbeats()
 	return nil
 }
@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"os/exec"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -11,7 +12,9 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/task"
+	"github.com/runabol/tork/runtime"
 	"github.com/runabol/tork/runtime/docker"
+	"github.com/runabol/tork/runtime/shell"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -127,6 +130,95 @@ func Test_handleTaskRunOutput(t *testing.T) {
 	assert.Equal(t, "hello world", t1.Result)
 }
 
+func Test_doRunTaskOutputsLimit(t *testing.T) {
+	rt := shell.NewShellRuntime(shell.Config{
+		UID: shell.DEFAULT_UID,
+		GID: shell.DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			return exec.Command(args[5], args[6:]...)
+		},
+	})
+
+	w, err := NewWorker(Config{
+		Broker:  broker.NewInMemoryBroker(),
+		Runtime: rt,
+		Limits:  Limits{MaxOutputsSize: 32},
+	})
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: `echo '{"url":"s3://bucket/a.mp4"}' > $REEXEC_TORK_OUTPUTS`,
+	}
+	err = w.doRunTask(context.Background(), t1)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateCompleted, t1.State)
+	assert.Equal(t, map[string]any{"url": "s3://bucket/a.mp4"}, t1.Outputs)
+
+	t2 := &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: `echo '{"url":"s3://bucket/a-much-longer-name.mp4"}' > $REEXEC_TORK_OUTPUTS`,
+	}
+	err = w.doRunTask(context.Background(), t2)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStateFailed, t2.State)
+	assert.Contains(t, t2.Error, "exceeds the limit of 32 bytes")
+	assert.Nil(t, t2.Outputs)
+}
+
+func Test_handleTaskUsage(t *testing.T) {
+	rt := shell.NewShellRuntime(shell.Config{
+		UID: shell.DEFAULT_UID,
+		GID: shell.DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			return exec.Command(args[5], args[6:]...)
+		},
+	})
+
+	b := broker.NewInMemoryBroker()
+
+	w, err := NewWorker(Config{
+		Broker:  b,
+		Runtime: rt,
+	})
+	assert.NoError(t, err)
+
+	completions := make(chan *tork.Task, 1)
+	err = b.SubscribeForTasks(broker.QUEUE_COMPLETED, func(tk *tork.Task) error {
+		completions <- tk
+		return nil
+	})
+	assert.NoError(t, err)
+
+	failures := make(chan *tork.Task, 1)
+	err = b.SubscribeForTasks(broker.QUEUE_ERROR, func(tk *tork.Task) error {
+		failures <- tk
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = w.handleTask(&tork.Task{
+		ID:    uuid.NewUUID(),
+		State: tork.TaskStateScheduled,
+		Run:   "sleep 0.1",
+	})
+	assert.NoError(t, err)
+	completed := <-completions
+	assert.NotNil(t, completed.Usage)
+	assert.GreaterOrEqual(t, completed.Usage.WallSeconds, 0.1)
+	assert.Greater(t, completed.Usage.MemoryPeak, int64(0))
+
+	err = w.handleTask(&tork.Task{
+		ID:    uuid.NewUUID(),
+		State: tork.TaskStateScheduled,
+		Run:   "exit 1",
+	})
+	assert.NoError(t, err)
+	failed := <-failures
+	assert.NotNil(t, failed.Usage)
+	assert.Greater(t, failed.Usage.WallSeconds, float64(0))
+}
+
 func Test_handleTaskRunWithPrePost(t *testing.T) {
 	rt, err := docker.NewDockerRuntime()
 	assert.NoError(t, err)
@@ -544,3 +636,103 @@ func Test_handleTaskRunDefaultLimitOK(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "/somevolume", t1.Mounts[0].Target)
 }
+
+type volumeCounter struct {
+	volumes int32
+}
+
+func (m *volumeCounter) Mount(ctx context.Context, mnt *tork.Mount) error {
+	mnt.Source = uuid.NewUUID()
+	atomic.AddInt32(&m.volumes, 1)
+	return nil
+}
+
+func (m *volumeCounter) Unmount(ctx context.Context, mnt *tork.Mount) error {
+	atomic.AddInt32(&m.volumes, -1)
+	return nil
+}
+
+func Test_releaseWorkspace(t *testing.T) {
+	b := broker.NewInMemoryBroker()
+	vc := &volumeCounter{}
+	ws := runtime.NewWorkspaceMounter(vc)
+	w, err := NewWorker(Config{
+		Broker:     b,
+		Runtime:    shell.NewShellRuntime(shell.Config{}),
+		Workspaces: ws,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Start())
+
+	ctx := context.Background()
+	j := &tork.Job{ID: uuid.NewUUID()}
+	mnt := &tork.Mount{ID: uuid.NewUUID(), Type: tork.MountTypeWorkspace, Source: j.ID, Target: "/workspace"}
+	assert.NoError(t, ws.Mount(ctx, mnt))
+	assert.NoError(t, ws.Unmount(ctx, mnt))
+
+	// the workspace outlives the job's tasks
+	assert.Equal(t, int32(1), atomic.LoadInt32(&vc.volumes))
+
+	j.State = tork.JobStateCancelled
+	assert.NoError(t, b.PublishEvent(ctx, broker.TOPIC_JOB_CANCELLED, j))
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&vc.volumes))
+}
+
+// blockingRuntime runs each task until it is released.
+type blockingRuntime struct {
+	running int32
+	release chan any
+}
+
+func (r *blockingRuntime) Run(ctx context.Context, t *tork.Task) error {
+	atomic.AddInt32(&r.running, 1)
+	defer atomic.AddInt32(&r.running, -1)
+	<-r.release
+	return nil
+}
+
+func (r *blockingRuntime) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func Test_handlePinnedTask(t *testing.T) {
+	b := broker.NewInMemoryBroker()
+	rt := &blockingRuntime{release: make(chan any)}
+	w, err := NewWorker(Config{
+		Broker:     b,
+		Runtime:    rt,
+		Queues:     map[string]int{"some-queue": 1},
+		Workspaces: runtime.NewWorkspaceMounter(&volumeCounter{}),
+	})
+	assert.NoError(t, err)
+
+	completions := make(chan any, 2)
+	err = b.SubscribeForTasks(broker.QUEUE_COMPLETED, func(tk *tork.Task) error {
+		completions <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Start())
+
+	ctx := context.Background()
+	err = b.PublishTask(ctx, "some-queue", &tork.Task{ID: uuid.NewUUID()})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&rt.running) == 1
+	}, time.Second, time.Millisecond*10)
+
+	// the pinned task waits for a free slot
+	err = b.PublishTask(ctx, broker.NodeTaskQueue(w.id), &tork.Task{ID: uuid.NewUUID()})
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&rt.running))
+
+	rt.release <- 1
+	<-completions
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&rt.running) == 1
+	}, time.Second, time.Millisecond*10)
+	rt.release <- 1
+	<-completions
+}
@@ -1,8 +1,14 @@
 package tork
 
 import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/exp/maps"
 )
 
@@ -16,6 +22,9 @@ const (
 	JobStateCompleted JobState = "COMPLETED"
 	JobStateFailed    JobState = "FAILED"
 	JobStateRestart   JobState = "RESTART"
+	JobStatePaused    JobState = "PAUSED"
+	JobStateResume    JobState = "RESUME"
+	JobStateQueued    JobState = "QUEUED"
 )
 
 type ScheduledJobState string
@@ -25,6 +34,43 @@ const (
 	ScheduledJobStatePaused ScheduledJobState = "PAUSED"
 )
 
+const (
+	// ScheduleOverlapAllow starts a new instance on every
+	// tick regardless of any previous instance still running.
+	ScheduleOverlapAllow = "allow"
+	// ScheduleOverlapSkip skips the tick if a previous
+	// instance is still running.
+	ScheduleOverlapSkip = "skip"
+	// ScheduleOverlapCancelPrevious cancels any previous
+	// instance still running before starting a new one.
+	ScheduleOverlapCancelPrevious = "cancel-previous"
+	// ScheduleOverlapQueue holds the new instance in the
+	// QUEUED state until the previous instance is done.
+	ScheduleOverlapQueue = "queue"
+)
+
+const (
+	// ScheduleCatchUpNone ignores the ticks missed while
+	// no coordinator was running.
+	ScheduleCatchUpNone = "none"
+	// ScheduleCatchUpLast fires a single instance if any
+	// tick was missed.
+	ScheduleCatchUpLast = "last"
+	// ScheduleCatchUpAll fires an instance for every
+	// missed tick.
+	ScheduleCatchUpAll = "all"
+)
+
+const (
+	InputTypeString = "string"
+	InputTypeInt    = "int"
+	InputTypeBool   = "bool"
+	// InputTypeList is a JSON array.
+	InputTypeList = "list"
+	// InputTypeJSON is any JSON value.
+	InputTypeJSON = "json"
+)
+
 type Job struct {
 	ID          string            `json:"id,omitempty"`
 	ParentID    string            `json:"parentId,omitempty"`
@@ -47,6 +93,7 @@ type Job struct {
 	Result      string            `json:"result,omitempty"`
 	Error       string            `json:"error,omitempty"`
 	Defaults    *JobDefaults      `json:"defaults,omitempty"`
+	Workspace   *JobWorkspace     `json:"workspace,omitempty"`
 	Webhooks    []*Webhook        `json:"webhooks,omitempty"`
 	Permissions []*Permission     `json:"permissions,omitempty"`
 	AutoDelete  *AutoDelete       `json:"autoDelete,omitempty"`
@@ -54,6 +101,37 @@ type Job struct {
 	Secrets     map[string]string `json:"secrets,omitempty"`
 	Progress    float64           `json:"progress,omitempty"`
 	Schedule    *JobSchedule      `json:"schedule,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	Deadline    *time.Time        `json:"deadline,omitempty"`
+	TimeoutAt   *time.Time        `json:"timeoutAt,omitempty"`
+	TraceParent string            `json:"traceParent,omitempty"`
+	Usage       *JobUsage         `json:"usage,omitempty"`
+}
+
+// JobUsage is the resource consumption of a job,
+// aggregated over all the attempts of its tasks.
+type JobUsage struct {
+	TaskUsage
+	// Tasks is the number of task attempts which reported their usage
+	Tasks int `json:"tasks"`
+}
+
+// NewJobUsage aggregates the usage of the given tasks.
+func NewJobUsage(tasks []*Task) *JobUsage {
+	u := &JobUsage{}
+	for _, t := range tasks {
+		if t.Usage == nil {
+			continue
+		}
+		u.Add(t.Usage)
+		u.Tasks = u.Tasks + 1
+	}
+	return u
+}
+
+func (u *JobUsage) Clone() *JobUsage {
+	c := *u
+	return &c
 }
 
 type ScheduledJob struct {
@@ -73,6 +151,59 @@ type ScheduledJob struct {
 	Tags        []string          `json:"tags,omitempty"`
 	Secrets     map[string]string `json:"secrets,omitempty"`
 	Output      string            `json:"output,omitempty"`
+	Timezone    string            `json:"timezone,omitempty"`
+	Overlap     string            `json:"overlap,omitempty"`
+	CatchUp     *ScheduleCatchUp  `json:"catchUp,omitempty"`
+	LastFiredAt *time.Time        `json:"lastFiredAt,omitempty"`
+	Trigger     *JobTrigger       `json:"trigger,omitempty"`
+	InputSchema map[string]Input  `json:"inputSchema,omitempty"`
+}
+
+// Input declares the type and the allowed values
+// of an input of a scheduled job.
+type Input struct {
+	Type     string   `json:"type,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Default  string   `json:"default,omitempty"`
+	Enum     []string `json:"enum,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+}
+
+// JobTrigger starts an instance of a scheduled job whenever
+// another job matching its criteria finishes, instead of on
+// a cron schedule.
+type JobTrigger struct {
+	// On lists the states of the source job the trigger
+	// reacts to. Defaults to COMPLETED.
+	On []JobState `json:"on,omitempty"`
+	// Name of the source job. May contain wildcards.
+	Name string `json:"name,omitempty"`
+	// Tags which the source job must all have.
+	Tags []string `json:"tags,omitempty"`
+	// If is an expression evaluated against the source
+	// job's summary (as `job`) which must be true.
+	If string `json:"if,omitempty"`
+}
+
+func (t *JobTrigger) Clone() *JobTrigger {
+	return &JobTrigger{
+		On:   slices.Clone(t.On),
+		Name: t.Name,
+		Tags: slices.Clone(t.Tags),
+		If:   t.If,
+	}
+}
+
+type ScheduleCatchUp struct {
+	Policy string `json:"policy,omitempty"`
+	Window string `json:"window,omitempty"`
+}
+
+func (c *ScheduleCatchUp) Clone() *ScheduleCatchUp {
+	return &ScheduleCatchUp{
+		Policy: c.Policy,
+		Window: c.Window,
+	}
 }
 
 type JobSchedule struct {
@@ -118,6 +249,9 @@ type ScheduledJobSummary struct {
 	Tags        []string          `json:"tags,omitempty"`
 	CreatedAt   time.Time         `json:"createdAt,omitempty"`
 	Cron        string            `json:"cron,omitempty"`
+	Timezone    string            `json:"timezone,omitempty"`
+	LastFiredAt *time.Time        `json:"lastFiredAt,omitempty"`
+	Trigger     *JobTrigger       `json:"trigger,omitempty"`
 }
 
 type Permission struct {
@@ -130,10 +264,17 @@ type AutoDelete struct {
 }
 
 type JobContext struct {
-	Job     map[string]string `json:"job,omitempty"`
-	Inputs  map[string]string `json:"inputs,omitempty"`
-	Secrets map[string]string `json:"secrets,omitempty"`
-	Tasks   map[string]string `json:"tasks,omitempty"`
+	Job    map[string]string `json:"job,omitempty"`
+	Inputs map[string]string `json:"inputs,omitempty"`
+	// InputTypes holds the declared type of the inputs
+	// which are exposed to expressions as typed values
+	// rather than strings.
+	InputTypes map[string]string `json:"inputTypes,omitempty"`
+	Secrets    map[string]string `json:"secrets,omitempty"`
+	Tasks      map[string]string `json:"tasks,omitempty"`
+	// TaskOutputs holds the named outputs of the tasks
+	// which emitted any, keyed by the task's var.
+	TaskOutputs map[string]map[string]any `json:"taskOutputs,omitempty"`
 }
 
 type JobDefaults struct {
@@ -142,6 +283,22 @@ type JobDefaults struct {
 	Timeout  string      `json:"timeout,omitempty"`
 	Queue    string      `json:"queue,omitempty"`
 	Priority int         `json:"priority,omitempty"`
+	// JobTimeout is the timeout of the job itself, unless it sets
+	// its own, whereas Timeout applies to each of its tasks.
+	JobTimeout string `json:"jobTimeout,omitempty"`
+}
+
+// JobWorkspace is a volume which is created for the lifetime of
+// a job and mounted at the same path in every one of its tasks.
+// All the tasks of a job with a workspace run on the same node,
+// regardless of their queue.
+type JobWorkspace struct {
+	Size   string `json:"size,omitempty"`
+	Target string `json:"target,omitempty"`
+	Tmpfs  bool   `json:"tmpfs,omitempty"`
+	// NodeID is the node which holds the workspace. It's
+	// assigned when the first task of the job is scheduled.
+	NodeID string `json:"nodeId,omitempty"`
 }
 
 type Webhook struct {
@@ -168,6 +325,14 @@ func (j *Job) Clone() *Job {
 	if j.Schedule != nil {
 		schedule = j.Schedule.Clone()
 	}
+	var workspace *JobWorkspace
+	if j.Workspace != nil {
+		workspace = j.Workspace.Clone()
+	}
+	var usage *JobUsage
+	if j.Usage != nil {
+		usage = j.Usage.Clone()
+	}
 	return &Job{
 		ID:          j.ID,
 		Name:        j.Name,
@@ -191,11 +356,18 @@ func (j *Job) Clone() *Job {
 		Result:      j.Result,
 		Error:       j.Error,
 		Defaults:    defaults,
+		Workspace:   workspace,
 		Webhooks:    CloneWebhooks(j.Webhooks),
 		Permissions: ClonePermissions(j.Permissions),
 		AutoDelete:  autoDelete,
+		DeleteAt:    j.DeleteAt,
 		Progress:    j.Progress,
 		Schedule:    schedule,
+		Timeout:     j.Timeout,
+		Deadline:    j.Deadline,
+		TimeoutAt:   j.TimeoutAt,
+		TraceParent: j.TraceParent,
+		Usage:       usage,
 	}
 }
 
@@ -212,6 +384,14 @@ func (j *ScheduledJob) Clone() *ScheduledJob {
 	if j.AutoDelete != nil {
 		autoDelete = j.AutoDelete.Clone()
 	}
+	var catchUp *ScheduleCatchUp
+	if j.CatchUp != nil {
+		catchUp = j.CatchUp.Clone()
+	}
+	var trigger *JobTrigger
+	if j.Trigger != nil {
+		trigger = j.Trigger.Clone()
+	}
 	return &ScheduledJob{
 		ID:          j.ID,
 		Cron:        j.Cron,
@@ -229,27 +409,188 @@ func (j *ScheduledJob) Clone() *ScheduledJob {
 		Permissions: ClonePermissions(j.Permissions),
 		AutoDelete:  autoDelete,
 		State:       j.State,
+		Timezone:    j.Timezone,
+		Overlap:     j.Overlap,
+		CatchUp:     catchUp,
+		LastFiredAt: j.LastFiredAt,
+		Trigger:     trigger,
+		InputSchema: CloneInputSchema(j.InputSchema),
 	}
 }
 
+func CloneInputSchema(schema map[string]Input) map[string]Input {
+	if schema == nil {
+		return nil
+	}
+	clone := make(map[string]Input, len(schema))
+	for name, in := range schema {
+		in.Enum = slices.Clone(in.Enum)
+		clone[name] = in
+	}
+	return clone
+}
+
 func (c JobContext) Clone() JobContext {
+	var outputs map[string]map[string]any
+	if c.TaskOutputs != nil {
+		outputs = make(map[string]map[string]any, len(c.TaskOutputs))
+		for k, v := range c.TaskOutputs {
+			outputs[k] = maps.Clone(v)
+		}
+	}
 	return JobContext{
-		Inputs:  maps.Clone(c.Inputs),
-		Secrets: maps.Clone(c.Secrets),
-		Tasks:   maps.Clone(c.Tasks),
-		Job:     maps.Clone(c.Job),
+		Inputs:      maps.Clone(c.Inputs),
+		InputTypes:  maps.Clone(c.InputTypes),
+		Secrets:     maps.Clone(c.Secrets),
+		Tasks:       maps.Clone(c.Tasks),
+		TaskOutputs: outputs,
+		Job:         maps.Clone(c.Job),
 	}
 }
 
 func (c JobContext) AsMap() map[string]any {
 	return map[string]any{
-		"inputs":  c.Inputs,
+		"inputs":  c.typedInputs(),
 		"secrets": c.Secrets,
-		"tasks":   c.Tasks,
+		"tasks":   c.taskValues(),
 		"job":     c.Job,
 	}
 }
 
+// SetTask records the result and the outputs of
+// the task in the context under the task's var.
+func (c *JobContext) SetTask(t *Task) {
+	if t.Var == "" {
+		return
+	}
+	if t.Result != "" {
+		if c.Tasks == nil {
+			c.Tasks = make(map[string]string)
+		}
+		c.Tasks[t.Var] = t.Result
+	}
+	if len(t.Outputs) > 0 {
+		if c.TaskOutputs == nil {
+			c.TaskOutputs = make(map[string]map[string]any)
+		}
+		c.TaskOutputs[t.Var] = t.Outputs
+	}
+}
+
+// taskValues returns the values of the tasks as exposed
+// to expressions: the named outputs of tasks which emitted
+// any, so they can be referred to as tasks.<var>.<key>,
+// and the result of the other tasks.
+func (c JobContext) taskValues() any {
+	if len(c.TaskOutputs) == 0 {
+		return c.Tasks
+	}
+	result := make(map[string]any, len(c.Tasks)+len(c.TaskOutputs))
+	for k, v := range c.Tasks {
+		result[k] = v
+	}
+	for k, v := range c.TaskOutputs {
+		result[k] = v
+	}
+	return result
+}
+
+// typedInputs returns the job's inputs converted to
+// their declared type. Inputs which fail to convert are
+// left as strings.
+func (c JobContext) typedInputs() any {
+	if len(c.InputTypes) == 0 {
+		return c.Inputs
+	}
+	result := make(map[string]any, len(c.Inputs))
+	for k, v := range c.Inputs {
+		result[k] = v
+		if typ, ok := c.InputTypes[k]; ok {
+			if tv, err := ParseInput(typ, v); err == nil {
+				result[k] = tv
+			}
+		}
+	}
+	return result
+}
+
+// ParseInput converts the value of an input to the given type.
+func ParseInput(typ, v string) (any, error) {
+	switch typ {
+	case "", InputTypeString:
+		return v, nil
+	case InputTypeInt:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Errorf("%q is not a valid int", v)
+		}
+		return i, nil
+	case InputTypeBool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Errorf("%q is not a valid bool", v)
+		}
+		return b, nil
+	case InputTypeList:
+		var l []any
+		if err := json.Unmarshal([]byte(v), &l); err != nil {
+			return nil, errors.Errorf("%q is not a valid list", v)
+		}
+		return l, nil
+	case InputTypeJSON:
+		var val any
+		if err := json.Unmarshal([]byte(v), &val); err != nil {
+			return nil, errors.Errorf("%q is not valid json", v)
+		}
+		return val, nil
+	default:
+		return nil, errors.Errorf("unknown input type: %s", typ)
+	}
+}
+
+// CheckInputs checks the inputs against the schema. Inputs
+// which are not declared by the schema are not checked.
+func CheckInputs(schema map[string]Input, inputs map[string]string) error {
+	names := maps.Keys(schema)
+	slices.Sort(names)
+	for _, name := range names {
+		in := schema[name]
+		v, ok := inputs[name]
+		if !ok {
+			if in.Required && in.Default == "" {
+				return errors.Errorf("missing required input: %s", name)
+			}
+			continue
+		}
+		if err := CheckInput(in.Type, in.Enum, in.Pattern, v); err != nil {
+			return errors.Wrapf(err, "invalid input %s", name)
+		}
+	}
+	return nil
+}
+
+// CheckInput returns an error if the value of an input isn't of the
+// given type, isn't one of the allowed values or doesn't match the
+// pattern. The allowed values and the pattern are optional.
+func CheckInput(typ string, enum []string, pattern, v string) error {
+	if _, err := ParseInput(typ, v); err != nil {
+		return err
+	}
+	if len(enum) > 0 && !slices.Contains(enum, v) {
+		return errors.Errorf("%q is not one of [%s]", v, strings.Join(enum, ", "))
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(v) {
+			return errors.Errorf("%q does not match %s", v, pattern)
+		}
+	}
+	return nil
+}
+
 func (d *JobDefaults) Clone() *JobDefaults {
 	clone := JobDefaults{}
 	if d.Limits != nil {
@@ -261,6 +602,7 @@ func (d *JobDefaults) Clone() *JobDefaults {
 	clone.Queue = d.Queue
 	clone.Timeout = d.Timeout
 	clone.Priority = d.Priority
+	clone.JobTimeout = d.JobTimeout
 	return &clone
 }
 
@@ -298,9 +640,56 @@ func NewScheduledJobSummary(sj *ScheduledJob) *ScheduledJobSummary {
 		Inputs:      maps.Clone(sj.Inputs),
 		Cron:        sj.Cron,
 		CreatedAt:   sj.CreatedAt,
+		Timezone:    sj.Timezone,
+		LastFiredAt: sj.LastFiredAt,
+		Trigger:     sj.Trigger,
 	}
 }
 
+// NewScheduledJobInstance creates a new, PENDING, job from
+// the scheduled job's definition which is linked back to the
+// scheduled job through its Schedule. The caller is expected
+// to assign the job's ID.
+func NewScheduledJobInstance(sj *ScheduledJob) *Job {
+	return &Job{
+		CreatedBy:   sj.CreatedBy,
+		CreatedAt:   time.Now().UTC(),
+		Permissions: sj.Permissions,
+		Tags:        sj.Tags,
+		Name:        sj.Name,
+		Description: sj.Description,
+		State:       JobStatePending,
+		Tasks:       CloneTasks(sj.Tasks),
+		Inputs:      sj.Inputs,
+		Secrets:     sj.Secrets,
+		Context:     JobContext{Inputs: sj.Inputs, InputTypes: inputTypes(sj.InputSchema)},
+		TaskCount:   len(sj.Tasks),
+		Output:      sj.Output,
+		Webhooks:    sj.Webhooks,
+		AutoDelete:  sj.AutoDelete,
+		Schedule: &JobSchedule{
+			ID:   sj.ID,
+			Cron: sj.Cron,
+		},
+	}
+}
+
+// inputTypes returns the declared type of the inputs
+// which are not strings.
+func inputTypes(schema map[string]Input) map[string]string {
+	var types map[string]string
+	for name, in := range schema {
+		if in.Type == "" || in.Type == InputTypeString {
+			continue
+		}
+		if types == nil {
+			types = make(map[string]string)
+		}
+		types[name] = in.Type
+	}
+	return types
+}
+
 func CloneWebhooks(webhooks []*Webhook) []*Webhook {
 	copy := make([]*Webhook, len(webhooks))
 	for i, w := range webhooks {
@@ -336,6 +725,15 @@ func (p *Permission) Clone() *Permission {
 	return c
 }
 
+func (w *JobWorkspace) Clone() *JobWorkspace {
+	return &JobWorkspace{
+		Size:   w.Size,
+		Target: w.Target,
+		Tmpfs:  w.Tmpfs,
+		NodeID: w.NodeID,
+	}
+}
+
 func (a *AutoDelete) Clone() *AutoDelete {
 	return &AutoDelete{
 		After: a.After,
@@ -48,3 +48,114 @@ func TestClone(t *testing.T) {
 	assert.NotEqual(t, j1.Tasks[0].Env, j2.Tasks[0].Env)
 	assert.NotEqual(t, j1.Execution[0].Env, j2.Execution[0].Env)
 }
+
+func TestNewJobUsage(t *testing.T) {
+	u := tork.NewJobUsage([]*tork.Task{
+		{
+			Usage: &tork.TaskUsage{
+				WallSeconds: 10,
+				CPUSeconds:  4,
+				MemoryPeak:  512,
+				DiskWrite:   100,
+				NetworkRx:   1000,
+			},
+		},
+		{
+			// no usage reported yet
+		},
+		{
+			Usage: &tork.TaskUsage{
+				WallSeconds: 5,
+				CPUSeconds:  1.5,
+				MemoryPeak:  1024,
+				DiskWrite:   50,
+				NetworkRx:   10,
+			},
+		},
+	})
+	assert.Equal(t, &tork.JobUsage{
+		TaskUsage: tork.TaskUsage{
+			WallSeconds: 15,
+			CPUSeconds:  5.5,
+			MemoryPeak:  1024,
+			DiskWrite:   150,
+			NetworkRx:   1010,
+		},
+		Tasks: 2,
+	}, u)
+
+	assert.Equal(t, &tork.JobUsage{}, tork.NewJobUsage(nil))
+}
+
+func TestParseInput(t *testing.T) {
+	v, err := tork.ParseInput(tork.InputTypeInt, "42")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+	v, err = tork.ParseInput(tork.InputTypeBool, "true")
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+	v, err = tork.ParseInput(tork.InputTypeList, `[1,"two"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{float64(1), "two"}, v)
+	v, err = tork.ParseInput(tork.InputTypeJSON, `{"a":"b"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": "b"}, v)
+	v, err = tork.ParseInput("", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", v)
+
+	_, err = tork.ParseInput(tork.InputTypeInt, "4.2")
+	assert.Error(t, err)
+	_, err = tork.ParseInput(tork.InputTypeList, `{"a":"b"}`)
+	assert.Error(t, err)
+	_, err = tork.ParseInput("float", "4.2")
+	assert.Error(t, err)
+}
+
+func TestJobContextTypedInputs(t *testing.T) {
+	c := tork.JobContext{
+		Inputs: map[string]string{
+			"count": "3",
+			"name":  "hello",
+			"bad":   "nope",
+		},
+		InputTypes: map[string]string{
+			"count": tork.InputTypeInt,
+			"bad":   tork.InputTypeBool,
+		},
+	}
+	inputs, ok := c.AsMap()["inputs"].(map[string]any)
+	assert.True(t, ok)
+	assert.Equal(t, 3, inputs["count"])
+	assert.Equal(t, "hello", inputs["name"])
+	assert.Equal(t, "nope", inputs["bad"])
+
+	c2 := c.Clone()
+	assert.Equal(t, c.InputTypes, c2.InputTypes)
+
+	// untyped inputs are left as-is
+	c.InputTypes = nil
+	_, ok = c.AsMap()["inputs"].(map[string]string)
+	assert.True(t, ok)
+}
+
+func TestJobContextTaskOutputs(t *testing.T) {
+	c := tork.JobContext{}
+	c.SetTask(&tork.Task{Var: "hello", Result: "world"})
+	c.SetTask(&tork.Task{Result: "no var"})
+	_, ok := c.AsMap()["tasks"].(map[string]string)
+	assert.True(t, ok)
+
+	c.SetTask(&tork.Task{
+		Var:     "upload",
+		Outputs: map[string]any{"url": "s3://bucket/a.mp4", "size": float64(42)},
+	})
+	tasks, ok := c.AsMap()["tasks"].(map[string]any)
+	assert.True(t, ok)
+	assert.Equal(t, "world", tasks["hello"])
+	assert.Equal(t, map[string]any{"url": "s3://bucket/a.mp4", "size": float64(42)}, tasks["upload"])
+
+	c2 := c.Clone()
+	c2.TaskOutputs["upload"]["url"] = "changed"
+	assert.Equal(t, "s3://bucket/a.mp4", c.TaskOutputs["upload"]["url"])
+}
@@ -4,6 +4,9 @@ const (
 	MountTypeVolume string = "volume"
 	MountTypeBind   string = "bind"
 	MountTypeTmpfs  string = "tmpfs"
+	// MountTypeWorkspace mounts the workspace of the task's job,
+	// a volume which is shared by all the tasks of the job.
+	MountTypeWorkspace string = "workspace"
 )
 
 type Mount struct {
@@ -11,4 +14,7 @@ type Mount struct {
 	Type   string `json:"type,omitempty"`
 	Source string `json:"source,omitempty"`
 	Target string `json:"target,omitempty"`
+	// Opts are mounter-specific options (e.g. the size
+	// of a volume)
+	Opts map[string]string `json:"opts,omitempty"`
 }
@@ -1,6 +1,7 @@
 package tork
 
 import (
+	"slices"
 	"time"
 )
 
@@ -16,17 +17,20 @@ const (
 )
 
 type Node struct {
-	ID              string     `json:"id,omitempty"`
-	Name            string     `json:"name,omitempty"`
-	StartedAt       time.Time  `json:"startedAt,omitempty"`
-	CPUPercent      float64    `json:"cpuPercent,omitempty"`
-	LastHeartbeatAt time.Time  `json:"lastHeartbeatAt,omitempty"`
-	Queue           string     `json:"queue,omitempty"`
-	Status          NodeStatus `json:"status,omitempty"`
-	Hostname        string     `json:"hostname,omitempty"`
-	Port            int        `json:"port,omitempty"`
-	TaskCount       int        `json:"taskCount,omitempty"`
-	Version         string     `json:"version"`
+	ID              string    `json:"id,omitempty"`
+	Name            string    `json:"name,omitempty"`
+	StartedAt       time.Time `json:"startedAt,omitempty"`
+	CPUPercent      float64   `json:"cpuPercent,omitempty"`
+	LastHeartbeatAt time.Time `json:"lastHeartbeatAt,omitempty"`
+	Queue           string    `json:"queue,omitempty"`
+	// Queues lists the task queues the
+	// worker node is subscribed to.
+	Queues    []string   `json:"queues,omitempty"`
+	Status    NodeStatus `json:"status,omitempty"`
+	Hostname  string     `json:"hostname,omitempty"`
+	Port      int        `json:"port,omitempty"`
+	TaskCount int        `json:"taskCount,omitempty"`
+	Version   string     `json:"version"`
 }
 
 func (n *Node) Clone() *Node {
@@ -37,6 +41,7 @@ func (n *Node) Clone() *Node {
 		CPUPercent:      n.CPUPercent,
 		LastHeartbeatAt: n.LastHeartbeatAt,
 		Queue:           n.Queue,
+		Queues:          slices.Clone(n.Queues),
 		Status:          n.Status,
 		Hostname:        n.Hostname,
 		Port:            n.Port,
@@ -0,0 +1,70 @@
+package runtime
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
+)
+
+// FetchArtifacts downloads the input artifacts of the task from
+// the store and hands each of them to place, along with the path
+// the task expects it at.
+func FetchArtifacts(ctx context.Context, store artifact.Store, t *tork.Task, place func(ctx context.Context, path string, r io.Reader) error) error {
+	if t.Artifacts == nil || len(t.Artifacts.Inputs) == 0 {
+		return nil
+	}
+	if store == nil {
+		return errors.New("artifacts are not supported: no artifact store is configured")
+	}
+	for _, a := range t.Artifacts.Inputs {
+		if err := fetchArtifact(ctx, store, t, a, place); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fetchArtifact(ctx context.Context, store artifact.Store, t *tork.Task, a *tork.TaskArtifact, place func(ctx context.Context, path string, r io.Reader) error) error {
+	r, err := store.Get(ctx, t.JobID, a.Name)
+	if err != nil {
+		return errors.Wrapf(err, "error fetching artifact %s", a.Name)
+	}
+	defer r.Close()
+	if err := place(ctx, a.Path, r); err != nil {
+		return errors.Wrapf(err, "error placing artifact %s at %s", a.Name, a.Path)
+	}
+	return nil
+}
+
+// PublishArtifacts collects the output artifacts of the task,
+// as tar archives returned by collect, and uploads them to the
+// store.
+func PublishArtifacts(ctx context.Context, store artifact.Store, t *tork.Task, collect func(ctx context.Context, path string) (io.ReadCloser, error)) error {
+	if t.Artifacts == nil || len(t.Artifacts.Outputs) == 0 {
+		return nil
+	}
+	if store == nil {
+		return errors.New("artifacts are not supported: no artifact store is configured")
+	}
+	for _, a := range t.Artifacts.Outputs {
+		if err := publishArtifact(ctx, store, t, a, collect); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func publishArtifact(ctx context.Context, store artifact.Store, t *tork.Task, a *tork.TaskArtifact, collect func(ctx context.Context, path string) (io.ReadCloser, error)) error {
+	r, err := collect(ctx, a.Path)
+	if err != nil {
+		return errors.Wrapf(err, "error collecting artifact %s from %s", a.Name, a.Path)
+	}
+	defer r.Close()
+	if err := store.Put(ctx, t.JobID, a.Name, r); err != nil {
+		return errors.Wrapf(err, "error publishing artifact %s", a.Name)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishFetchArtifacts(t *testing.T) {
+	ctx := context.Background()
+	store, err := artifact.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	jobID := uuid.NewUUID()
+	t1 := &tork.Task{
+		JobID: jobID,
+		Artifacts: &tork.TaskArtifacts{
+			Outputs: []*tork.TaskArtifact{{Name: "video", Path: "/out/video.mp4"}},
+		},
+	}
+	err = PublishArtifacts(ctx, store, t1, func(_ context.Context, path string) (io.ReadCloser, error) {
+		assert.Equal(t, "/out/video.mp4", path)
+		return io.NopCloser(bytes.NewReader([]byte("some video"))), nil
+	})
+	assert.NoError(t, err)
+
+	t2 := &tork.Task{
+		JobID: jobID,
+		Artifacts: &tork.TaskArtifacts{
+			Inputs: []*tork.TaskArtifact{{Name: "video", Path: "/in/video.mp4"}},
+		},
+	}
+	var placed string
+	err = FetchArtifacts(ctx, store, t2, func(_ context.Context, path string, r io.Reader) error {
+		assert.Equal(t, "/in/video.mp4", path)
+		b, err := io.ReadAll(r)
+		placed = string(b)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "some video", placed)
+
+	t3 := &tork.Task{
+		JobID: jobID,
+		Artifacts: &tork.TaskArtifacts{
+			Inputs: []*tork.TaskArtifact{{Name: "nothing", Path: "/in/nothing"}},
+		},
+	}
+	err = FetchArtifacts(ctx, store, t3, func(_ context.Context, path string, r io.Reader) error { return nil })
+	assert.ErrorIs(t, err, artifact.ErrArtifactNotFound)
+
+	// tasks without artifacts don't require a store
+	assert.NoError(t, FetchArtifacts(ctx, nil, &tork.Task{}, nil))
+	assert.NoError(t, PublishArtifacts(ctx, nil, &tork.Task{}, nil))
+	err = FetchArtifacts(ctx, nil, t2, nil)
+	assert.ErrorContains(t, err, "no artifact store is configured")
+}
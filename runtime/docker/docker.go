@@ -21,11 +21,15 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/fns"
 	"github.com/runabol/tork/internal/logging"
+	"github.com/runabol/tork/internal/metrics"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // defaultWorkdir is the directory where `Task.File`s are
@@ -48,6 +52,8 @@ type DockerRuntime struct {
 	privileged  bool
 	imageTTL    time.Duration
 	imageVerify bool
+	artifacts   artifact.Store
+	maxOutputs  int
 	mu          sync.Mutex
 }
 
@@ -106,6 +112,20 @@ func WithImageVerify(verify bool) Option {
 	}
 }
 
+func WithArtifactStore(store artifact.Store) Option {
+	return func(rt *DockerRuntime) {
+		rt.artifacts = store
+	}
+}
+
+// WithMaxOutputsSize sets the maximum size, in bytes,
+// of the outputs file of a task.
+func WithMaxOutputsSize(size int) Option {
+	return func(rt *DockerRuntime) {
+		rt.maxOutputs = size
+	}
+}
+
 func NewDockerRuntime(opts ...Option) (*DockerRuntime, error) {
 	dc, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
@@ -198,7 +218,9 @@ func (rt *DockerRuntime) Run(ctx context.Context, t *tork.Task) error {
 		pre.Mounts = t.Mounts
 		pre.Networks = t.Networks
 		pre.Limits = t.Limits
-		if err := rt.doRun(ctx, pre, logger); err != nil {
+		err := rt.doRun(ctx, pre, logger)
+		runtime.AddUsage(t, pre.Usage)
+		if err != nil {
 			return err
 		}
 	}
@@ -212,7 +234,9 @@ func (rt *DockerRuntime) Run(ctx context.Context, t *tork.Task) error {
 		post.Mounts = t.Mounts
 		post.Networks = t.Networks
 		post.Limits = t.Limits
-		if err := rt.doRun(ctx, post, logger); err != nil {
+		err := rt.doRun(ctx, post, logger)
+		runtime.AddUsage(t, post.Usage)
+		if err != nil {
 			return err
 		}
 	}
@@ -254,20 +278,39 @@ func (rt *DockerRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writ
 		}
 	}
 
+	// place the task's input artifacts
+	if err := runtime.FetchArtifacts(ctx, rt.artifacts, t, tc.placeArtifact); err != nil {
+		return err
+	}
+
 	// start the main task container
 	if err := tc.Start(ctx); err != nil {
 		return err
 	}
 
+	// collect the resource usage of the task container
+	stats := tc.collectStats(ctx)
+
 	// wait for the task container to finish
-	result, err := tc.Wait(ctx)
+	wctx, span := tracing.Start(ctx, "container.wait", attribute.String("tork.container.id", tc.id))
+	result, err := tc.Wait(wctx)
+	tracing.End(span, err)
+	runtime.AddUsage(t, stats.stop())
+	if err != nil {
+		return err
+	}
+
+	// read the task's named outputs
+	outputs, err := tc.readOutputs(ctx)
 	if err != nil {
 		return err
 	}
 
 	t.Result = result
+	t.Outputs = outputs
 
-	return nil
+	// publish the task's output artifacts
+	return runtime.PublishArtifacts(ctx, rt.artifacts, t, tc.collectArtifact)
 }
 
 func (rt *DockerRuntime) HealthCheck(ctx context.Context) error {
@@ -391,6 +434,7 @@ func (d *DockerRuntime) doPullRequest(pr *pullRequest) error {
 			return err
 		}
 		authStr := base64.URLEncoding.EncodeToString(encodedJSON)
+		started := time.Now()
 		reader, err := d.client.ImagePull(
 			pr.ctx, pr.image, image.PullOptions{RegistryAuth: authStr})
 		if err != nil {
@@ -401,6 +445,7 @@ func (d *DockerRuntime) doPullRequest(pr *pullRequest) error {
 		if _, err := io.Copy(pr.logger, reader); err != nil {
 			return err
 		}
+		metrics.ImagePullSeconds.Observe(time.Since(started).Seconds(), "docker")
 	}
 
 	// verify the intergrity of the image
@@ -18,6 +18,7 @@ import (
 
 	"github.com/runabol/tork"
 
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime"
@@ -868,3 +869,39 @@ func TestVerifyImage_PartialReadError(t *testing.T) {
 	err = rt.verifyImage(ctx, "busybox:stable", io.Discard)
 	assert.Error(t, err)
 }
+
+func TestRunTaskWithArtifacts(t *testing.T) {
+	store, err := artifact.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	rt, err := NewDockerRuntime(WithArtifactStore(store))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	jobID := uuid.NewUUID()
+
+	t1 := &tork.Task{
+		ID:    uuid.NewUUID(),
+		JobID: jobID,
+		Image: "busybox:stable",
+		Run:   "mkdir out && echo -n hello > out/greeting.txt",
+		Artifacts: &tork.TaskArtifacts{
+			Outputs: []*tork.TaskArtifact{{Name: "greeting", Path: "out"}},
+		},
+	}
+	err = rt.Run(ctx, t1)
+	assert.NoError(t, err)
+
+	t2 := &tork.Task{
+		ID:    uuid.NewUUID(),
+		JobID: jobID,
+		Image: "busybox:stable",
+		Run:   "cat /data/in/greeting.txt > $TORK_OUTPUT",
+		Artifacts: &tork.TaskArtifacts{
+			Inputs: []*tork.TaskArtifact{{Name: "greeting", Path: "/data/in"}},
+		},
+	}
+	err = rt.Run(ctx, t2)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", t2.Result)
+}
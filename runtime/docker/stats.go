@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/fns"
+)
+
+// statsCollector streams the stats of a running container
+// and keeps track of its resource usage.
+type statsCollector struct {
+	usage  tork.TaskUsage
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// collectStats starts streaming the stats of the container
+// until the container stops or the collector is stopped.
+func (tc *tcontainer) collectStats(ctx context.Context) *statsCollector {
+	ctx, cancel := context.WithCancel(ctx)
+	sc := &statsCollector{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(sc.done)
+		if err := sc.stream(ctx, tc); err != nil && !errors.Is(err, context.Canceled) {
+			log.Warn().Err(err).Msgf("error collecting the stats of container %s", tc.id)
+		}
+	}()
+	return sc
+}
+
+func (sc *statsCollector) stream(ctx context.Context, tc *tcontainer) error {
+	resp, err := tc.client.ContainerStats(ctx, tc.id, true)
+	if err != nil {
+		return errors.Wrapf(err, "error getting stats of container %s", tc.id)
+	}
+	defer fns.CloseIgnore(resp.Body)
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var s types.StatsJSON
+		if err := dec.Decode(&s); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return nil // the container stopped
+		}
+		updateUsage(&sc.usage, &s)
+	}
+}
+
+// stop waits for the collector to stop and returns the usage of
+// the container. The stats are sampled about every second, so the
+// last second of the container's run may not be accounted for.
+func (sc *statsCollector) stop() *tork.TaskUsage {
+	sc.cancel()
+	<-sc.done
+	u := sc.usage
+	return &u
+}
+
+// updateUsage updates the usage from a sample of the container's
+// stats. The counters are cumulative, so the highest sample
+// is the total, and the memory keeps its highest value.
+func updateUsage(u *tork.TaskUsage, s *types.StatsJSON) {
+	if s.Read.IsZero() {
+		return // the container isn't running anymore
+	}
+	u.CPUSeconds = max(u.CPUSeconds, float64(s.CPUStats.CPUUsage.TotalUsage)/1e9)
+	// max_usage is only reported on cgroup v1
+	u.MemoryPeak = max(u.MemoryPeak, int64(s.MemoryStats.MaxUsage), int64(s.MemoryStats.Usage))
+	var read, write int64
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read = read + int64(e.Value)
+		case "write":
+			write = write + int64(e.Value)
+		}
+	}
+	u.DiskRead = max(u.DiskRead, read)
+	u.DiskWrite = max(u.DiskWrite, write)
+	var rx, tx int64
+	for _, n := range s.Networks {
+		rx = rx + int64(n.RxBytes)
+		tx = tx + int64(n.TxBytes)
+	}
+	u.NetworkRx = max(u.NetworkRx, rx)
+	u.NetworkTx = max(u.NetworkTx, tx)
+}
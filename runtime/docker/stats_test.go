@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_updateUsage(t *testing.T) {
+	u := &tork.TaskUsage{}
+	s1 := &types.StatsJSON{
+		Stats: types.Stats{
+			Read: time.Now(),
+			CPUStats: types.CPUStats{
+				CPUUsage: types.CPUUsage{TotalUsage: 1_500_000_000},
+			},
+			MemoryStats: types.MemoryStats{Usage: 200},
+			BlkioStats: types.BlkioStats{
+				IoServiceBytesRecursive: []types.BlkioStatEntry{
+					{Op: "read", Value: 100},
+					{Op: "write", Value: 50},
+				},
+			},
+		},
+		Networks: map[string]types.NetworkStats{
+			"eth0": {RxBytes: 10, TxBytes: 20},
+			"eth1": {RxBytes: 1, TxBytes: 2},
+		},
+	}
+	updateUsage(u, s1)
+	assert.Equal(t, tork.TaskUsage{
+		CPUSeconds: 1.5,
+		MemoryPeak: 200,
+		DiskRead:   100,
+		DiskWrite:  50,
+		NetworkRx:  11,
+		NetworkTx:  22,
+	}, *u)
+
+	// cgroup v1 sample with a lower current usage
+	s2 := &types.StatsJSON{
+		Stats: types.Stats{
+			Read: time.Now(),
+			CPUStats: types.CPUStats{
+				CPUUsage: types.CPUUsage{TotalUsage: 3_000_000_000},
+			},
+			MemoryStats: types.MemoryStats{Usage: 100, MaxUsage: 300},
+			BlkioStats: types.BlkioStats{
+				IoServiceBytesRecursive: []types.BlkioStatEntry{
+					{Op: "Read", Value: 400},
+					{Op: "Write", Value: 60},
+					{Op: "Total", Value: 460},
+				},
+			},
+		},
+	}
+	updateUsage(u, s2)
+	assert.Equal(t, float64(3), u.CPUSeconds)
+	assert.Equal(t, int64(300), u.MemoryPeak)
+	assert.Equal(t, int64(400), u.DiskRead)
+	assert.Equal(t, int64(60), u.DiskWrite)
+	assert.Equal(t, int64(11), u.NetworkRx)
+
+	// the empty sample of a stopped container is ignored
+	updateUsage(u, &types.StatsJSON{})
+	assert.Equal(t, float64(3), u.CPUSeconds)
+	assert.Equal(t, int64(300), u.MemoryPeak)
+}
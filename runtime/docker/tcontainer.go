@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -24,27 +25,34 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/fns"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type tcontainer struct {
-	id      string
-	client  *client.Client
-	mounter runtime.Mounter
-	broker  broker.Broker
-	task    *tork.Task
-	logger  io.Writer
-	torkdir *tork.Mount
+	id         string
+	client     *client.Client
+	mounter    runtime.Mounter
+	broker     broker.Broker
+	task       *tork.Task
+	logger     io.Writer
+	torkdir    *tork.Mount
+	maxOutputs int
 }
 
 func createTaskContainer(ctx context.Context, rt *DockerRuntime, t *tork.Task, logger io.Writer) (*tcontainer, error) {
 	if t.ID == "" {
 		return nil, errors.New("task id is required")
 	}
-	if err := rt.imagePull(ctx, t, logger); err != nil {
+	pctx, span := tracing.Start(ctx, "image.pull", attribute.String("tork.image", t.Image))
+	err := rt.imagePull(pctx, t, logger)
+	tracing.End(span, err)
+	if err != nil {
 		return nil, errors.Wrapf(err, "error pulling image: %s", t.Image)
 	}
 	env := []string{}
@@ -53,6 +61,7 @@ func createTaskContainer(ctx context.Context, rt *DockerRuntime, t *tork.Task, l
 	}
 	env = append(env, "TORK_OUTPUT=/tork/stdout")
 	env = append(env, "TORK_PROGRESS=/tork/progress")
+	env = append(env, "TORK_OUTPUTS=/tork/outputs")
 
 	var mounts []mount.Mount
 
@@ -162,11 +171,11 @@ func createTaskContainer(ctx context.Context, rt *DockerRuntime, t *tork.Task, l
 
 	// we want to override the default
 	// image WORKDIR only if the task
-	// introduces work files _or_ if the
-	// user specifies a WORKDIR
+	// introduces work files or artifacts
+	// _or_ if the user specifies a WORKDIR
 	if t.Workdir != "" {
 		containerConf.WorkingDir = t.Workdir
-	} else if len(t.Files) > 0 {
+	} else if len(t.Files) > 0 || t.Artifacts != nil {
 		t.Workdir = defaultWorkdir
 		containerConf.WorkingDir = t.Workdir
 	}
@@ -190,8 +199,10 @@ func createTaskContainer(ctx context.Context, rt *DockerRuntime, t *tork.Task, l
 	// where the attached volumes can't be removed and cleaned up.
 	createCtx, createCancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer createCancel()
+	_, span = tracing.Start(ctx, "container.create", attribute.String("tork.image", t.Image))
 	resp, err := rt.client.ContainerCreate(
 		createCtx, &containerConf, &hc, &nc, nil, "")
+	tracing.End(span, err)
 	if err != nil {
 		log.Error().Msgf(
 			"Error creating container using image %s: %v\n",
@@ -201,13 +212,14 @@ func createTaskContainer(ctx context.Context, rt *DockerRuntime, t *tork.Task, l
 	}
 
 	tc := &tcontainer{
-		id:      resp.ID,
-		client:  rt.client,
-		mounter: rt.mounter,
-		broker:  rt.broker,
-		task:    t,
-		torkdir: torkdir,
-		logger:  logger,
+		id:         resp.ID,
+		client:     rt.client,
+		mounter:    rt.mounter,
+		broker:     rt.broker,
+		task:       t,
+		torkdir:    torkdir,
+		logger:     logger,
+		maxOutputs: rt.maxOutputs,
 	}
 
 	// initialize the tork and, optionally, the work directory
@@ -306,13 +318,19 @@ func (tc *tcontainer) Wait(ctx context.Context) (string, error) {
 			)
 			if err != nil {
 				log.Error().Err(err).Msg("error tailing the log")
-				return "", errors.Errorf("exit code %d", status.StatusCode)
+				return "", &runtime.ExitError{
+					Code:    int(status.StatusCode),
+					Message: fmt.Sprintf("exit code %d", status.StatusCode),
+				}
 			}
 			buf, err := io.ReadAll(dockerLogsReader{reader: out})
 			if err != nil {
 				log.Error().Err(err).Msg("error copying the output")
 			}
-			return "", errors.Errorf("exit code %d: %s", status.StatusCode, string(buf))
+			return "", &runtime.ExitError{
+				Code:    int(status.StatusCode),
+				Message: fmt.Sprintf("exit code %d: %s", status.StatusCode, string(buf)),
+			}
 		} else {
 			stdout, err := tc.readOutput(ctx)
 			if err != nil {
@@ -424,65 +442,105 @@ func (tc *tcontainer) reportProgress(ctx context.Context) {
 }
 
 func (tc *tcontainer) readOutput(ctx context.Context) (string, error) {
-	r, _, err := tc.client.CopyFromContainer(ctx, tc.id, "/tork/stdout")
+	b, err := tc.readFile(ctx, "/tork/stdout")
 	if err != nil {
 		return "", err
 	}
-	defer func() {
-		err := r.Close()
-		if err != nil {
-			log.Error().Err(err).Msgf("error closing /tork/stdout reader")
-		}
-	}()
-	tr := tar.NewReader(r)
-	var buf bytes.Buffer
-	for {
-		_, err := tr.Next()
-		if err == io.EOF {
-			break // End of archive
-		}
-		if err != nil {
-			return "", err
-		}
+	return string(b), nil
+}
 
-		if _, err := io.Copy(&buf, tr); err != nil {
-			return "", err
-		}
-	}
-	return buf.String(), nil
+func (tc *tcontainer) readOutputs(ctx context.Context) (map[string]any, error) {
+	var outputs map[string]any
+	err := tc.walkFile(ctx, "/tork/outputs", func(r io.Reader) error {
+		var err error
+		outputs, err = runtime.ReadOutputs(r, tc.maxOutputs)
+		return err
+	})
+	return outputs, err
 }
 
 func (tc *tcontainer) readProgress(ctx context.Context) (float64, error) {
-	r, _, err := tc.client.CopyFromContainer(ctx, tc.id, "/tork/progress")
+	b, err := tc.readFile(ctx, "/tork/progress")
 	if err != nil {
 		return 0, err
 	}
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 32)
+}
+
+func (tc *tcontainer) readFile(ctx context.Context, path string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tc.walkFile(ctx, path, func(r io.Reader) error {
+		_, err := io.Copy(&buf, r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// walkFile streams the contents of a file in the
+// container to fn, without buffering it in memory.
+func (tc *tcontainer) walkFile(ctx context.Context, path string, fn func(r io.Reader) error) error {
+	r, _, err := tc.client.CopyFromContainer(ctx, tc.id, path)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		err := r.Close()
 		if err != nil {
-			log.Error().Err(err).Msgf("error closing /tork/progress reader")
+			log.Error().Err(err).Msgf("error closing %s reader", path)
 		}
 	}()
 	tr := tar.NewReader(r)
-	var buf bytes.Buffer
 	for {
 		_, err := tr.Next()
 		if err == io.EOF {
 			break // End of archive
 		}
 		if err != nil {
-			return 0, err
+			return err
 		}
 
-		if _, err := io.Copy(&buf, tr); err != nil {
-			return 0, err
+		if err := fn(tr); err != nil {
+			return err
 		}
 	}
-	s := strings.TrimSpace(buf.String())
-	if s == "" {
-		return 0, nil
+	return nil
+}
+
+// placeArtifact copies the archive of an input artifact
+// into the container at the given path.
+func (tc *tcontainer) placeArtifact(ctx context.Context, p string, r io.Reader) error {
+	ar, err := artifact.Rebase(r, tc.artifactPath(p))
+	if err != nil {
+		return err
 	}
-	return strconv.ParseFloat(s, 32)
+	defer fns.CloseIgnore(ar)
+	return tc.client.CopyToContainer(ctx, tc.id, "/", ar, types.CopyToContainerOptions{})
+}
+
+// collectArtifact returns an archive of the file or
+// directory at the given path inside the container.
+func (tc *tcontainer) collectArtifact(ctx context.Context, p string) (io.ReadCloser, error) {
+	r, _, err := tc.client.CopyFromContainer(ctx, tc.id, tc.artifactPath(p))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// artifactPath resolves the path of an artifact, which is
+// relative to the task's workdir unless it's absolute.
+func (tc *tcontainer) artifactPath(p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(tc.task.Workdir, p)
 }
 
 func (tc *tcontainer) initTorkdir(ctx context.Context) error {
@@ -503,6 +561,9 @@ func (tc *tcontainer) initTorkdir(ctx context.Context) error {
 	if err := ar.WriteFile("progress", 0222, []byte{}); err != nil {
 		return err
 	}
+	if err := ar.WriteFile("outputs", 0222, []byte{}); err != nil {
+		return err
+	}
 
 	if tc.task.Run != "" {
 		if err := ar.WriteFile("entrypoint", 0555, []byte(tc.task.Run)); err != nil {
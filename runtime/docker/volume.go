@@ -2,16 +2,22 @@ package docker
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/internal/uuid"
 )
 
+// VolumeMounter creates a docker volume for each mount. The volume
+// is disk-backed unless the mount's "type" option is "tmpfs", in
+// which case it's held in memory and can be size-limited with the
+// "size" option. The size of a disk-backed volume can't be limited.
 type VolumeMounter struct {
 	client *client.Client
 }
@@ -27,7 +33,26 @@ func NewVolumeMounter() (*VolumeMounter, error) {
 func (m *VolumeMounter) Mount(ctx context.Context, mn *tork.Mount) error {
 	name := uuid.NewUUID()
 	mn.Source = name
-	v, err := m.client.VolumeCreate(ctx, volume.CreateOptions{Name: name})
+	opts := volume.CreateOptions{Name: name}
+	size := mn.Opts["size"]
+	if mn.Opts["type"] == tork.MountTypeTmpfs {
+		opts.DriverOpts = map[string]string{
+			"type":   "tmpfs",
+			"device": "tmpfs",
+		}
+		if size != "" {
+			bytes, err := units.RAMInBytes(size)
+			if err != nil {
+				return errors.Wrapf(err, "invalid volume size: %s", size)
+			}
+			opts.DriverOpts["o"] = fmt.Sprintf("size=%d", bytes)
+		}
+	} else if size != "" {
+		// the local driver can only limit the
+		// size of tmpfs-backed volumes
+		return errors.Errorf("the size of a disk-backed volume can't be limited")
+	}
+	v, err := m.client.VolumeCreate(ctx, opts)
 	if err != nil {
 		return err
 	}
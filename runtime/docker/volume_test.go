@@ -57,3 +57,33 @@ func Test_createMountVolume(t *testing.T) {
 	assert.Equal(t, "/somevol", mnt.Target)
 	assert.NotEmpty(t, mnt.Source)
 }
+
+func TestCreateVolumeSizeRequiresTmpfs(t *testing.T) {
+	vm, err := NewVolumeMounter()
+	assert.NoError(t, err)
+	mnt := &tork.Mount{
+		Type:   tork.MountTypeVolume,
+		Target: "/somevol",
+		Opts:   map[string]string{"size": "1GB"},
+	}
+	err = vm.Mount(context.Background(), mnt)
+	assert.ErrorContains(t, err, "can't be limited")
+}
+
+func TestCreateTmpfsVolume(t *testing.T) {
+	vm, err := NewVolumeMounter()
+	assert.NoError(t, err)
+	ctx := context.Background()
+	mnt := &tork.Mount{
+		Type:   tork.MountTypeVolume,
+		Target: "/somevol",
+		Opts:   map[string]string{"type": tork.MountTypeTmpfs, "size": "1GB"},
+	}
+	err = vm.Mount(ctx, mnt)
+	assert.NoError(t, err)
+	v, err := vm.client.VolumeInspect(ctx, mnt.Source)
+	assert.NoError(t, err)
+	assert.Equal(t, "tmpfs", v.Options["type"])
+	assert.Equal(t, "size=1073741824", v.Options["o"])
+	assert.NoError(t, vm.Unmount(ctx, mnt))
+}
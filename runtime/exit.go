@@ -0,0 +1,26 @@
+package runtime
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ExitError is returned by a Runtime when the
+// task's process exits with a non-zero exit code.
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (e *ExitError) Error() string {
+	return e.Message
+}
+
+// ExitCode returns the exit code carried by err
+// if it wraps an ExitError.
+func ExitCode(err error) (int, bool) {
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		return ee.Code, true
+	}
+	return 0, false
+}
@@ -0,0 +1,19 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	err := errors.Wrapf(&ExitError{Code: 3, Message: "exit code 3"}, "error running task")
+	code, ok := ExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "error running task: exit code 3", err.Error())
+
+	_, ok = ExitCode(errors.New("something bad happened"))
+	assert.False(t, ok)
+}
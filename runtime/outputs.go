@@ -0,0 +1,45 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxOutputsSize is the maximum size, in bytes,
+// of the file a task writes its named outputs to.
+const DefaultMaxOutputsSize = 64 * 1024
+
+// ReadOutputs reads and parses the outputs file of a task. It fails
+// as soon as more than limit bytes are read, so that an oversized
+// file is never held in memory. A limit <= 0 means the default one.
+func ReadOutputs(r io.Reader, limit int) (map[string]any, error) {
+	if limit <= 0 {
+		limit = DefaultMaxOutputsSize
+	}
+	b, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading the task outputs")
+	}
+	if len(b) > limit {
+		return nil, errors.Errorf("task outputs size exceeds the limit of %d bytes", limit)
+	}
+	return ParseOutputs(b)
+}
+
+// ParseOutputs parses the contents of the file a task writes its
+// named outputs to (TORK_OUTPUTS). The file is expected to hold a
+// JSON object. An empty file means the task emitted no outputs.
+func ParseOutputs(b []byte) (map[string]any, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, nil
+	}
+	var outputs map[string]any
+	if err := json.Unmarshal(b, &outputs); err != nil {
+		return nil, errors.Wrapf(err, "task outputs must be a JSON object")
+	}
+	return outputs, nil
+}
@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOutputs(t *testing.T) {
+	outputs, err := ParseOutputs(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, outputs)
+
+	outputs, err = ParseOutputs([]byte("  \n"))
+	assert.NoError(t, err)
+	assert.Nil(t, outputs)
+
+	outputs, err = ParseOutputs([]byte(`{"url":"s3://bucket/video.mp4","size":1024,"tags":["a","b"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"url":  "s3://bucket/video.mp4",
+		"size": float64(1024),
+		"tags": []any{"a", "b"},
+	}, outputs)
+
+	_, err = ParseOutputs([]byte(`["a","b"]`))
+	assert.ErrorContains(t, err, "must be a JSON object")
+
+	_, err = ParseOutputs([]byte(`{"url":`))
+	assert.Error(t, err)
+}
+
+func TestReadOutputs(t *testing.T) {
+	outputs, err := ReadOutputs(strings.NewReader(`{"url":"s3://bucket/video.mp4"}`), 31)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"url": "s3://bucket/video.mp4"}, outputs)
+
+	_, err = ReadOutputs(strings.NewReader(`{"url":"s3://bucket/video.mp4"}`), 30)
+	assert.ErrorContains(t, err, "exceeds the limit of 30 bytes")
+
+	// an endless outputs file is not read past the limit
+	_, err = ReadOutputs(endless{}, 0)
+	assert.ErrorContains(t, err, "exceeds the limit")
+}
+
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
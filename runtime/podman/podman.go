@@ -17,11 +17,15 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/logging"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -38,6 +42,8 @@ type PodmanRuntime struct {
 	tasks      *syncx.Map[string, string]
 	mounter    runtime.Mounter
 	privileged bool
+	artifacts  artifact.Store
+	maxOutputs int
 }
 
 type pullRequest struct {
@@ -67,6 +73,20 @@ func WithMounter(mounter runtime.Mounter) Option {
 	}
 }
 
+func WithArtifactStore(store artifact.Store) Option {
+	return func(rt *PodmanRuntime) {
+		rt.artifacts = store
+	}
+}
+
+// WithMaxOutputsSize sets the maximum size, in bytes,
+// of the outputs file of a task.
+func WithMaxOutputsSize(size int) Option {
+	return func(rt *PodmanRuntime) {
+		rt.maxOutputs = size
+	}
+}
+
 func NewPodmanRuntime(opts ...Option) *PodmanRuntime {
 	rt := &PodmanRuntime{
 		tasks:  new(syncx.Map[string, string]),
@@ -132,7 +152,9 @@ func (d *PodmanRuntime) Run(ctx context.Context, t *tork.Task) error {
 		pre.Mounts = t.Mounts
 		pre.Networks = t.Networks
 		pre.Limits = t.Limits
-		if err := d.doRun(ctx, pre, logger); err != nil {
+		err := d.doRun(ctx, pre, logger)
+		runtime.AddUsage(t, pre.Usage)
+		if err != nil {
 			return err
 		}
 	}
@@ -146,7 +168,9 @@ func (d *PodmanRuntime) Run(ctx context.Context, t *tork.Task) error {
 		post.Mounts = t.Mounts
 		post.Networks = t.Networks
 		post.Limits = t.Limits
-		if err := d.doRun(ctx, post, logger); err != nil {
+		err := d.doRun(ctx, post, logger)
+		runtime.AddUsage(t, post.Usage)
+		if err != nil {
 			return err
 		}
 	}
@@ -181,6 +205,14 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 	if err := os.Chmod(progressFile, 0777); err != nil {
 		return errors.Wrapf(err, "failed to chmod %s", progressFile)
 	}
+	// Create the outputs file
+	outputsFile := fmt.Sprintf("%s/outputs", workDir)
+	if _, err := os.Create(outputsFile); err != nil {
+		return errors.Wrapf(err, "failed to create %s", outputsFile)
+	}
+	if err := os.Chmod(outputsFile, 0777); err != nil {
+		return errors.Wrapf(err, "failed to chmod %s", outputsFile)
+	}
 	// Write the task run script
 	runScriptPath := fmt.Sprintf("%s/entrypoint.sh", workDir)
 	var runScriptContent []byte
@@ -195,7 +227,10 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 	}
 
 	// pull the image
-	if err := d.imagePull(ctx, t, logger); err != nil {
+	pctx, span := tracing.Start(ctx, "image.pull", attribute.String("tork.image", t.Image))
+	err := d.imagePull(pctx, t, logger)
+	tracing.End(span, err)
+	if err != nil {
 		return errors.Wrapf(err, "error pulling image: %s", t.Image)
 	}
 
@@ -218,6 +253,7 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 	}
 	env = append(env, "TORK_OUTPUT=/tork/output")
 	env = append(env, "TORK_PROGRESS=/tork/progress")
+	env = append(env, "TORK_OUTPUTS=/tork/outputs")
 	for _, ev := range env {
 		createCmd.Args = append(createCmd.Args, "-e", ev)
 	}
@@ -241,11 +277,11 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 
 	// we want to override the default
 	// image WORKDIR only if the task
-	// introduces work files _or_ if the
-	// user specifies a WORKDIR
+	// introduces work files or artifacts
+	// _or_ if the user specifies a WORKDIR
 	if t.Workdir != "" {
 		createCmd.Args = append(createCmd.Args, "-w", t.Workdir)
-	} else if len(t.Files) > 0 {
+	} else if len(t.Files) > 0 || t.Artifacts != nil {
 		t.Workdir = defaultWorkdir
 		createCmd.Args = append(createCmd.Args, "-w", defaultWorkdir)
 	}
@@ -272,7 +308,10 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 	createCmd.Stdout = &stdoutBuf
 	createCmd.Stderr = logger
 
-	if err := createCmd.Run(); err != nil {
+	_, span = tracing.Start(ctx, "container.create", attribute.String("tork.image", t.Image))
+	err = createCmd.Run()
+	tracing.End(span, err)
+	if err != nil {
 		return fmt.Errorf("failed to create container: %w", err)
 	}
 
@@ -297,6 +336,14 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 		}
 	}()
 
+	// Place the task's input artifacts
+	err = runtime.FetchArtifacts(ctx, d.artifacts, t, func(ctx context.Context, p string, r io.Reader) error {
+		return d.placeArtifact(ctx, containerID, artifactPath(t, p), r)
+	})
+	if err != nil {
+		return err
+	}
+
 	// Start a goroutine to report user-reported progress
 	pctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -309,6 +356,9 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 		return fmt.Errorf("failed to start container %s: %w", containerID, err)
 	}
 
+	// collect the resource usage of the container
+	stats := d.collectStats(ctx, containerID)
+
 	// read logs
 	errCh := make(chan error, 1)
 	done := make(chan struct{})
@@ -324,11 +374,16 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 	}()
 
 	// Wait for the container to exit
+	_, span = tracing.Start(ctx, "container.wait", attribute.String("tork.container.id", containerID))
 	select {
 	case <-done:
+		tracing.End(span, nil)
 	case err := <-errCh:
+		tracing.End(span, err)
+		runtime.AddUsage(t, stats.stop())
 		return err
 	}
+	runtime.AddUsage(t, stats.stop())
 
 	// check the exit code
 	exitCmd := exec.CommandContext(ctx, "podman", "inspect", "--format", "{{.State.ExitCode}}", containerID)
@@ -339,7 +394,14 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 	}
 	exitCode := strings.TrimSpace(exitCodeBuf.String())
 	if exitCode != "0" {
-		return fmt.Errorf("container exited with code %s", exitCode)
+		code, err := strconv.Atoi(exitCode)
+		if err != nil {
+			return fmt.Errorf("container exited with code %s", exitCode)
+		}
+		return &runtime.ExitError{
+			Code:    code,
+			Message: fmt.Sprintf("container exited with code %s", exitCode),
+		}
 	}
 
 	// Read the output
@@ -349,9 +411,69 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 	}
 	t.Result = string(stdout)
 
+	// Read the outputs
+	outputs, err := readOutputs(outputsFile, d.maxOutputs)
+	if err != nil {
+		return err
+	}
+	t.Outputs = outputs
+
+	// Publish the task's output artifacts
+	return runtime.PublishArtifacts(ctx, d.artifacts, t, func(ctx context.Context, p string) (io.ReadCloser, error) {
+		return d.collectArtifact(ctx, containerID, workDir, artifactPath(t, p))
+	})
+}
+
+// placeArtifact copies the archive of an input artifact
+// into the container at the given path.
+func (d *PodmanRuntime) placeArtifact(ctx context.Context, containerID, p string, r io.Reader) error {
+	ar, err := artifact.Rebase(r, p)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+	var stderr bytes.Buffer
+	cpCmd := exec.CommandContext(ctx, "podman", "cp", "-", fmt.Sprintf("%s:/", containerID))
+	cpCmd.Stdin = ar
+	cpCmd.Stderr = &stderr
+	if err := cpCmd.Run(); err != nil {
+		return errors.Wrapf(err, "failed to copy artifact to %s: %s", p, strings.TrimSpace(stderr.String()))
+	}
 	return nil
 }
 
+// collectArtifact returns an archive of the file or directory
+// at the given path inside the container. The archive is staged
+// in the task's work directory.
+func (d *PodmanRuntime) collectArtifact(ctx context.Context, containerID, workDir, p string) (io.ReadCloser, error) {
+	f, err := os.CreateTemp(workDir, "artifact-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cpCmd := exec.CommandContext(ctx, "podman", "cp", fmt.Sprintf("%s:%s", containerID, p), "-")
+	cpCmd.Stdout = f
+	cpCmd.Stderr = &stderr
+	if err := cpCmd.Run(); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "failed to copy artifact from %s: %s", p, strings.TrimSpace(stderr.String()))
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// artifactPath resolves the path of an artifact, which is
+// relative to the task's workdir unless it's absolute.
+func artifactPath(t *tork.Task, p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(t.Workdir, p)
+}
+
 func (d *PodmanRuntime) stop(ctx context.Context, t *tork.Task) error {
 	containerID, ok := d.tasks.Get(t.ID)
 	if !ok {
@@ -450,12 +572,14 @@ func (d *PodmanRuntime) doPullRequest(pr *pullRequest) error {
 	if !imageExists {
 		// pull the image
 		log.Debug().Msgf("Pulling image %s", pr.image)
+		started := time.Now()
 		cmd := exec.CommandContext(pr.ctx, "podman", "pull", pr.image)
 		cmd.Stdout = pr.logger
 		cmd.Stderr = pr.logger
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("failed to pull image %s: %w", pr.image, err)
 		}
+		metrics.ImagePullSeconds.Observe(time.Since(started).Seconds(), "podman")
 	}
 	return nil
 }
@@ -467,3 +591,12 @@ func (d *PodmanRuntime) imageExistsLocally(ctx context.Context, name string) (bo
 	}
 	return true, nil
 }
+
+func readOutputs(path string, limit int) (map[string]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outputs: %w", err)
+	}
+	defer f.Close()
+	return runtime.ReadOutputs(f, limit)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
 
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime"
@@ -47,6 +48,38 @@ func TestPodmanRunTaskRun(t *testing.T) {
 	assert.Equal(t, "hello world\n", tk.Result)
 }
 
+func TestPodmanRunTaskWithArtifacts(t *testing.T) {
+	store, err := artifact.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	rt := NewPodmanRuntime(WithArtifactStore(store))
+
+	jobID := uuid.NewUUID()
+	t1 := &tork.Task{
+		ID:    uuid.NewUUID(),
+		JobID: jobID,
+		Image: "busybox:stable",
+		Run:   "mkdir out && echo -n hello > out/greeting.txt",
+		Artifacts: &tork.TaskArtifacts{
+			Outputs: []*tork.TaskArtifact{{Name: "greeting", Path: "out"}},
+		},
+	}
+	err = rt.Run(context.Background(), t1)
+	assert.NoError(t, err)
+
+	t2 := &tork.Task{
+		ID:    uuid.NewUUID(),
+		JobID: jobID,
+		Image: "busybox:stable",
+		Run:   "cat /data/in/greeting.txt > $TORK_OUTPUT",
+		Artifacts: &tork.TaskArtifacts{
+			Inputs: []*tork.TaskArtifact{{Name: "greeting", Path: "/data/in"}},
+		},
+	}
+	err = rt.Run(context.Background(), t2)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", t2.Result)
+}
+
 func TestPodmanCoustomEntrypoint(t *testing.T) {
 	rt := NewPodmanRuntime()
 
@@ -0,0 +1,97 @@
+package podman
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+)
+
+// statsInterval is the frequency at which
+// the stats of a container are sampled.
+const statsInterval = time.Second
+
+// statsFormat prints the raw counters of a container's stats:
+// CPU time (ns), memory usage, block IO and network IO (bytes).
+const statsFormat = "{{.ContainerStats.CPUNano}} {{.ContainerStats.MemUsage}} " +
+	"{{.ContainerStats.BlockInput}} {{.ContainerStats.BlockOutput}} " +
+	"{{.ContainerStats.NetInput}} {{.ContainerStats.NetOutput}}"
+
+// statsCollector samples the stats of a running
+// container and keeps track of its resource usage.
+type statsCollector struct {
+	usage  tork.TaskUsage
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// collectStats starts sampling the stats of the container
+// until the collector is stopped.
+func (d *PodmanRuntime) collectStats(ctx context.Context, containerID string) *statsCollector {
+	ctx, cancel := context.WithCancel(ctx)
+	sc := &statsCollector{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(sc.done)
+		for {
+			if err := sc.sample(ctx, containerID); err != nil && ctx.Err() == nil {
+				log.Debug().Err(err).Msgf("error sampling the stats of container %s", containerID)
+			}
+			select {
+			case <-time.After(statsInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return sc
+}
+
+func (sc *statsCollector) sample(ctx context.Context, containerID string) error {
+	cmd := exec.CommandContext(ctx, "podman", "stats", "--no-stream", "--no-reset", "--format", statsFormat, containerID)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "error getting stats of container %s", containerID)
+	}
+	return updateUsage(&sc.usage, out.String())
+}
+
+// stop stops the sampling and returns the usage of the container.
+// Whatever happened since the last sample is not accounted for.
+func (sc *statsCollector) stop() *tork.TaskUsage {
+	sc.cancel()
+	<-sc.done
+	u := sc.usage
+	return &u
+}
+
+// updateUsage updates the usage from a sample printed in the
+// statsFormat. The counters are cumulative, so the highest sample
+// is the total, and the memory keeps its highest value.
+func updateUsage(u *tork.TaskUsage, sample string) error {
+	fields := strings.Fields(sample)
+	if len(fields) != 6 {
+		return errors.Errorf("unexpected stats format: %s", sample)
+	}
+	vals := make([]uint64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid stats value: %s", f)
+		}
+		vals[i] = v
+	}
+	u.CPUSeconds = max(u.CPUSeconds, float64(vals[0])/1e9)
+	u.MemoryPeak = max(u.MemoryPeak, int64(vals[1]))
+	u.DiskRead = max(u.DiskRead, int64(vals[2]))
+	u.DiskWrite = max(u.DiskWrite, int64(vals[3]))
+	u.NetworkRx = max(u.NetworkRx, int64(vals[4]))
+	u.NetworkTx = max(u.NetworkTx, int64(vals[5]))
+	return nil
+}
@@ -0,0 +1,31 @@
+package podman
+
+import (
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_updateUsage(t *testing.T) {
+	u := &tork.TaskUsage{}
+	assert.NoError(t, updateUsage(u, "1500000000 2048 100 50 10 20\n"))
+	assert.Equal(t, tork.TaskUsage{
+		CPUSeconds: 1.5,
+		MemoryPeak: 2048,
+		DiskRead:   100,
+		DiskWrite:  50,
+		NetworkRx:  10,
+		NetworkTx:  20,
+	}, *u)
+
+	// the memory keeps its peak
+	assert.NoError(t, updateUsage(u, "3000000000 1024 200 50 10 30"))
+	assert.Equal(t, float64(3), u.CPUSeconds)
+	assert.Equal(t, int64(2048), u.MemoryPeak)
+	assert.Equal(t, int64(200), u.DiskRead)
+	assert.Equal(t, int64(30), u.NetworkTx)
+
+	assert.Error(t, updateUsage(u, "--"))
+	assert.Error(t, updateUsage(u, "1 2 3 4 5 x"))
+}
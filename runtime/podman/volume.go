@@ -2,12 +2,21 @@ package podman
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 
+	"github.com/docker/go-units"
 	"github.com/pkg/errors"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/uuid"
 )
 
+// VolumeMounter creates a temporary directory for each mount, or
+// a tmpfs-backed podman volume when the mount's "type" option is
+// "tmpfs", which can be size-limited with the "size" option. The
+// size of a disk-backed volume can't be limited.
 type VolumeMounter struct {
 }
 
@@ -16,6 +25,13 @@ func NewVolumeMounter() *VolumeMounter {
 }
 
 func (m *VolumeMounter) Mount(ctx context.Context, mn *tork.Mount) error {
+	if mn.Opts["type"] == tork.MountTypeTmpfs {
+		return m.createVolume(ctx, mn, mn.Opts["size"])
+	}
+	if mn.Opts["size"] != "" {
+		// a temporary directory can't be size-limited
+		return errors.Errorf("the size of a disk-backed volume can't be limited")
+	}
 	vol, err := os.MkdirTemp("", "tork-volume-*")
 	if err != nil {
 		return errors.Wrap(err, "failed to create temporary directory")
@@ -27,6 +43,34 @@ func (m *VolumeMounter) Mount(ctx context.Context, mn *tork.Mount) error {
 	return nil
 }
 
+// createVolume creates a tmpfs-backed podman volume,
+// size-limited if a size is given.
+func (m *VolumeMounter) createVolume(ctx context.Context, mn *tork.Mount, size string) error {
+	args := []string{"volume", "create", "--opt", "type=tmpfs", "--opt", "device=tmpfs"}
+	if size != "" {
+		bytes, err := units.RAMInBytes(size)
+		if err != nil {
+			return errors.Wrapf(err, "invalid volume size: %s", size)
+		}
+		args = append(args, "--opt", fmt.Sprintf("o=size=%d", bytes))
+	}
+	name := uuid.NewUUID()
+	args = append(args, name)
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "error creating volume: %s", string(out))
+	}
+	mn.Source = name
+	return nil
+}
+
 func (m *VolumeMounter) Unmount(ctx context.Context, mn *tork.Mount) error {
-	return os.RemoveAll(mn.Source)
+	if filepath.IsAbs(mn.Source) {
+		return os.RemoveAll(mn.Source)
+	}
+	cmd := exec.CommandContext(ctx, "podman", "volume", "rm", "-f", mn.Source)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "error removing volume %s: %s", mn.Source, string(out))
+	}
+	return nil
 }
@@ -43,3 +43,15 @@ func Test_createMountVolume(t *testing.T) {
 	assert.Equal(t, "/somevol", mnt.Target)
 	assert.NotEmpty(t, mnt.Source)
 }
+
+func TestCreateVolumeSizeRequiresTmpfs(t *testing.T) {
+	vm := NewVolumeMounter()
+	mnt := &tork.Mount{
+		Type:   tork.MountTypeVolume,
+		Target: "/somevol",
+		Opts:   map[string]string{"size": "1GB"},
+	}
+	err := vm.Mount(context.Background(), mnt)
+	assert.ErrorContains(t, err, "can't be limited")
+	assert.Empty(t, mnt.Source)
+}
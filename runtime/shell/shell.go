@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"io"
+	"io/fs"
 	"strconv"
 	"strings"
 	"time"
@@ -11,17 +12,22 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/fns"
 	"github.com/runabol/tork/internal/logging"
 	"github.com/runabol/tork/internal/reexec"
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/runtime"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Rexec func(args ...string) *exec.Cmd
@@ -37,20 +43,27 @@ func init() {
 }
 
 type ShellRuntime struct {
-	cmds   *syncx.Map[string, *exec.Cmd]
-	shell  []string
-	uid    string
-	gid    string
-	reexec Rexec
-	broker broker.Broker
+	cmds      *syncx.Map[string, *exec.Cmd]
+	shell     []string
+	uid       string
+	gid       string
+	reexec    Rexec
+	broker    broker.Broker
+	artifacts artifact.Store
+	// the maximum size of the outputs file
+	maxOutputs int
 }
 
 type Config struct {
-	CMD    []string
-	UID    string
-	GID    string
-	Rexec  Rexec
-	Broker broker.Broker
+	CMD           []string
+	UID           string
+	GID           string
+	Rexec         Rexec
+	Broker        broker.Broker
+	ArtifactStore artifact.Store
+	// MaxOutputsSize is the maximum size, in bytes, of
+	// the outputs file of a task. Defaults to runtime.DefaultMaxOutputsSize.
+	MaxOutputsSize int
 }
 
 func NewShellRuntime(cfg Config) *ShellRuntime {
@@ -67,12 +80,14 @@ func NewShellRuntime(cfg Config) *ShellRuntime {
 		cfg.GID = DEFAULT_GID
 	}
 	return &ShellRuntime{
-		cmds:   new(syncx.Map[string, *exec.Cmd]),
-		shell:  cfg.CMD,
-		uid:    cfg.UID,
-		gid:    cfg.GID,
-		reexec: cfg.Rexec,
-		broker: cfg.Broker,
+		cmds:       new(syncx.Map[string, *exec.Cmd]),
+		shell:      cfg.CMD,
+		uid:        cfg.UID,
+		gid:        cfg.GID,
+		reexec:     cfg.Rexec,
+		broker:     cfg.Broker,
+		artifacts:  cfg.ArtifactStore,
+		maxOutputs: cfg.MaxOutputsSize,
 	}
 }
 
@@ -116,7 +131,9 @@ func (r *ShellRuntime) Run(ctx context.Context, t *tork.Task) error {
 	// excute pre-tasks
 	for _, pre := range t.Pre {
 		pre.ID = uuid.NewUUID()
-		if err := r.doRun(ctx, pre, logger); err != nil {
+		err := r.doRun(ctx, pre, logger)
+		runtime.AddUsage(t, pre.Usage)
+		if err != nil {
 			return err
 		}
 	}
@@ -127,15 +144,21 @@ func (r *ShellRuntime) Run(ctx context.Context, t *tork.Task) error {
 	// execute post tasks
 	for _, post := range t.Post {
 		post.ID = uuid.NewUUID()
-		if err := r.doRun(ctx, post, logger); err != nil {
+		err := r.doRun(ctx, post, logger)
+		runtime.AddUsage(t, post.Usage)
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer) error {
+func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer) (err error) {
 	defer r.cmds.Delete(t.ID)
+	ctx, span := tracing.Start(ctx, "process.run", attribute.String("tork.task.id", t.ID))
+	defer func() {
+		tracing.End(span, err)
+	}()
 
 	workdir, err := os.MkdirTemp("", "tork")
 	if err != nil {
@@ -157,6 +180,10 @@ func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer
 		return errors.Wrapf(err, "error writing the progress file")
 	}
 
+	if err := os.WriteFile(fmt.Sprintf("%s/outputs", workdir), []byte{}, 0606); err != nil {
+		return errors.Wrapf(err, "error writing the outputs file")
+	}
+
 	for filename, contents := range t.Files {
 		filename = fmt.Sprintf("%s/%s", workdir, filename)
 		if err := os.WriteFile(filename, []byte(contents), 0444); err != nil {
@@ -164,12 +191,24 @@ func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer
 		}
 	}
 
+	err = runtime.FetchArtifacts(ctx, r.artifacts, t, func(_ context.Context, p string, rd io.Reader) error {
+		ap, err := artifactPath(workdir, p)
+		if err != nil {
+			return err
+		}
+		return artifact.Extract(rd, ap)
+	})
+	if err != nil {
+		return err
+	}
+
 	env := []string{}
 	for name, value := range t.Env {
 		env = append(env, fmt.Sprintf("%s%s=%s", envVarPrefix, name, value))
 	}
 	env = append(env, fmt.Sprintf("%sTORK_OUTPUT=%s/stdout", envVarPrefix, workdir))
 	env = append(env, fmt.Sprintf("%sTORK_PROGRESS=%s/progress", envVarPrefix, workdir))
+	env = append(env, fmt.Sprintf("%sTORK_OUTPUTS=%s/outputs", envVarPrefix, workdir))
 	env = append(env, fmt.Sprintf("WORKDIR=%s", workdir))
 	env = append(env, fmt.Sprintf("PATH=%s", os.Getenv("PATH")))
 	env = append(env, fmt.Sprintf("HOME=%s", os.Getenv("HOME")))
@@ -245,6 +284,11 @@ func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer
 	}()
 	select {
 	case err := <-errCh:
+		runtime.AddUsage(t, processUsage(cmd.ProcessState))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			err = &runtime.ExitError{Code: exitErr.ExitCode(), Message: err.Error()}
+		}
 		return errors.Wrapf(err, "error executing command")
 	case <-ctx.Done():
 		if err := cmd.Process.Kill(); err != nil {
@@ -252,6 +296,7 @@ func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer
 		}
 		return ctx.Err()
 	case <-doneCh:
+		runtime.AddUsage(t, processUsage(cmd.ProcessState))
 	}
 
 	output, err := os.ReadFile(fmt.Sprintf("%s/stdout", workdir))
@@ -261,7 +306,59 @@ func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer
 
 	t.Result = string(output)
 
-	return nil
+	outputs, err := readOutputs(fmt.Sprintf("%s/outputs", workdir), r.maxOutputs)
+	if err != nil {
+		return err
+	}
+
+	t.Outputs = outputs
+
+	return runtime.PublishArtifacts(ctx, r.artifacts, t, func(_ context.Context, p string) (io.ReadCloser, error) {
+		ap, err := artifactPath(workdir, p)
+		if err != nil {
+			return nil, err
+		}
+		return artifact.Archive(ap)
+	})
+}
+
+// artifactPath resolves the path of an artifact, which must be
+// relative to the task's workdir. Absolute paths and paths which
+// escape the workdir, through .. or through a symlink created by
+// the task, are rejected.
+func artifactPath(workdir, p string) (string, error) {
+	if !filepath.IsLocal(p) {
+		return "", errors.Errorf("artifact path must be relative to the task's workdir: %s", p)
+	}
+	root, err := filepath.EvalSymlinks(workdir)
+	if err != nil {
+		return "", errors.Wrapf(err, "error resolving the task's workdir")
+	}
+	resolved, err := resolvePath(filepath.Join(root, p))
+	if err != nil {
+		return "", errors.Wrapf(err, "error resolving artifact path %s", p)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", errors.Errorf("artifact path escapes the task's workdir: %s", p)
+	}
+	return resolved, nil
+}
+
+// resolvePath evaluates the symlinks of the part
+// of the path which exists.
+func resolvePath(p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) || filepath.Dir(p) == p {
+		return "", err
+	}
+	parent, err := resolvePath(filepath.Dir(p))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, filepath.Base(p)), nil
 }
 
 func (r *ShellRuntime) readProgress(workdir string) (float64, error) {
@@ -306,6 +403,12 @@ func reexecRun() {
 	cmd.Dir = workdir
 
 	if err := cmd.Run(); err != nil {
+		// propagate the command's exit code
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			log.Error().Err(err).Msgf("error reexecing: %s", strings.Join(flag.Args(), " "))
+			os.Exit(exitErr.ExitCode())
+		}
 		log.Fatal().Err(err).Msgf("error reexecing: %s", strings.Join(flag.Args(), " "))
 	}
 }
@@ -329,3 +432,12 @@ func buildEnv() ([]string, error) {
 func (r *ShellRuntime) HealthCheck(ctx context.Context) error {
 	return nil
 }
+
+func readOutputs(path string, limit int) (map[string]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading the task outputs")
+	}
+	defer f.Close()
+	return runtime.ReadOutputs(f, limit)
+}
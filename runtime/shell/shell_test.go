@@ -4,13 +4,20 @@ import (
 	"context"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/artifact"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/runtime"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestShellRuntimeRunResult(t *testing.T) {
@@ -34,6 +41,210 @@ func TestShellRuntimeRunResult(t *testing.T) {
 	assert.Equal(t, "hello world", tk.Result)
 }
 
+func TestShellRuntimeRunSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(prev)
+
+	rt := NewShellRuntime(Config{
+		UID: DEFAULT_UID,
+		GID: DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			cmd := exec.Command(args[5], args[6:]...)
+			return cmd
+		},
+	})
+
+	tk := &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: "exit 1",
+	}
+
+	err := rt.Run(context.Background(), tk)
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "process.run", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestShellRuntimeRunUsage(t *testing.T) {
+	rt := NewShellRuntime(Config{
+		UID: DEFAULT_UID,
+		GID: DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			cmd := exec.Command(args[5], args[6:]...)
+			return cmd
+		},
+	})
+
+	tk := &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: "i=0; while [ $i -lt 100000 ]; do i=$((i+1)); done",
+		Pre: []*tork.Task{{
+			Run: "echo pre",
+		}},
+	}
+
+	err := rt.Run(context.Background(), tk)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, tk.Usage)
+	assert.Greater(t, tk.Usage.CPUSeconds, float64(0))
+	assert.Greater(t, tk.Usage.MemoryPeak, int64(0))
+	assert.NotNil(t, tk.Pre[0].Usage)
+	assert.GreaterOrEqual(t, tk.Usage.MemoryPeak, tk.Pre[0].Usage.MemoryPeak)
+}
+
+func TestShellRuntimeRunOutputs(t *testing.T) {
+	rt := NewShellRuntime(Config{
+		UID: DEFAULT_UID,
+		GID: DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			cmd := exec.Command(args[5], args[6:]...)
+			return cmd
+		},
+	})
+
+	tk := &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: `echo '{"url":"s3://bucket/out.mp4","size":42}' > $REEXEC_TORK_OUTPUTS`,
+	}
+	err := rt.Run(context.Background(), tk)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"url": "s3://bucket/out.mp4", "size": float64(42)}, tk.Outputs)
+
+	tk = &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: "echo -n not json > $REEXEC_TORK_OUTPUTS",
+	}
+	err = rt.Run(context.Background(), tk)
+	assert.ErrorContains(t, err, "must be a JSON object")
+}
+
+func TestShellRuntimeRunOutputsTooLarge(t *testing.T) {
+	rt := NewShellRuntime(Config{
+		UID: DEFAULT_UID,
+		GID: DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			cmd := exec.Command(args[5], args[6:]...)
+			return cmd
+		},
+		MaxOutputsSize: 1024,
+	})
+
+	tk := &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: `head -c 1048576 /dev/zero > $REEXEC_TORK_OUTPUTS`,
+	}
+	err := rt.Run(context.Background(), tk)
+	assert.ErrorContains(t, err, "exceeds the limit of 1024 bytes")
+	assert.Nil(t, tk.Outputs)
+}
+
+func TestShellRuntimeRunArtifacts(t *testing.T) {
+	store, err := artifact.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	rt := NewShellRuntime(Config{
+		UID: DEFAULT_UID,
+		GID: DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			cmd := exec.Command(args[5], args[6:]...)
+			return cmd
+		},
+		ArtifactStore: store,
+	})
+
+	jobID := uuid.NewUUID()
+	tk := &tork.Task{
+		ID:    uuid.NewUUID(),
+		JobID: jobID,
+		Run:   "mkdir out && echo -n hello > out/greeting.txt",
+		Artifacts: &tork.TaskArtifacts{
+			Outputs: []*tork.TaskArtifact{{Name: "greeting", Path: "out"}},
+		},
+	}
+	err = rt.Run(context.Background(), tk)
+	assert.NoError(t, err)
+
+	tk = &tork.Task{
+		ID:    uuid.NewUUID(),
+		JobID: jobID,
+		Run:   "cat in/greeting.txt > $REEXEC_TORK_OUTPUT",
+		Artifacts: &tork.TaskArtifacts{
+			Inputs: []*tork.TaskArtifact{{Name: "greeting", Path: "in"}},
+		},
+	}
+	err = rt.Run(context.Background(), tk)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", tk.Result)
+
+	// the output path doesn't exist
+	tk = &tork.Task{
+		ID:    uuid.NewUUID(),
+		JobID: jobID,
+		Run:   "echo nothing",
+		Artifacts: &tork.TaskArtifacts{
+			Outputs: []*tork.TaskArtifact{{Name: "missing", Path: "missing"}},
+		},
+	}
+	err = rt.Run(context.Background(), tk)
+	assert.ErrorContains(t, err, "error collecting artifact missing")
+
+	// artifacts require a store
+	rt = NewShellRuntime(Config{
+		UID: DEFAULT_UID,
+		GID: DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			cmd := exec.Command(args[5], args[6:]...)
+			return cmd
+		},
+	})
+	tk = &tork.Task{
+		ID:    uuid.NewUUID(),
+		JobID: jobID,
+		Run:   "cat in/greeting.txt",
+		Artifacts: &tork.TaskArtifacts{
+			Inputs: []*tork.TaskArtifact{{Name: "greeting", Path: "in"}},
+		},
+	}
+	err = rt.Run(context.Background(), tk)
+	assert.ErrorContains(t, err, "no artifact store is configured")
+}
+
+func Test_artifactPath(t *testing.T) {
+	workdir := t.TempDir()
+	root, err := filepath.EvalSymlinks(workdir)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Mkdir(filepath.Join(workdir, "out"), 0755))
+	assert.NoError(t, os.Symlink("/etc", filepath.Join(workdir, "etc")))
+	assert.NoError(t, os.Symlink("out", filepath.Join(workdir, "link")))
+
+	p, err := artifactPath(workdir, "out")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "out"), p)
+	// yet to be extracted
+	p, err = artifactPath(workdir, "in/data")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "in/data"), p)
+	// symlinks which stay in the workdir are fine
+	p, err = artifactPath(workdir, "link/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "out/file.txt"), p)
+
+	_, err = artifactPath(workdir, "/etc/passwd")
+	assert.ErrorContains(t, err, "must be relative")
+	_, err = artifactPath(workdir, "../secret")
+	assert.ErrorContains(t, err, "must be relative")
+	_, err = artifactPath(workdir, "out/../../secret")
+	assert.ErrorContains(t, err, "must be relative")
+	_, err = artifactPath(workdir, "etc/passwd")
+	assert.ErrorContains(t, err, "escapes the task's workdir")
+}
+
 func TestShellRuntimeRunPath(t *testing.T) {
 	rt := NewShellRuntime(Config{
 		UID: DEFAULT_UID,
@@ -205,3 +416,26 @@ func TestRunTaskWithPrePost(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "hello pre\n", t1.Result)
 }
+
+func TestShellRuntimeRunExitCode(t *testing.T) {
+	rt := NewShellRuntime(Config{
+		UID: DEFAULT_UID,
+		GID: DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			cmd := exec.Command(args[5], args[6:]...)
+			return cmd
+		},
+	})
+
+	tk := &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: "exit 3",
+	}
+
+	err := rt.Run(context.Background(), tk)
+	assert.Error(t, err)
+
+	code, ok := runtime.ExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, code)
+}
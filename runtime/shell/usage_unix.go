@@ -0,0 +1,33 @@
+//go:build freebsd || darwin || linux
+
+package shell
+
+import (
+	"os"
+	goruntime "runtime"
+	"syscall"
+
+	"github.com/runabol/tork"
+)
+
+// processUsage returns the resource usage of an exited process,
+// which includes the usage of the children it waited for.
+func processUsage(ps *os.ProcessState) *tork.TaskUsage {
+	if ps == nil {
+		return nil
+	}
+	u := &tork.TaskUsage{
+		CPUSeconds: (ps.UserTime() + ps.SystemTime()).Seconds(),
+	}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok && ru != nil {
+		// ru_maxrss is in bytes on darwin and in kilobytes elsewhere
+		u.MemoryPeak = int64(ru.Maxrss)
+		if goruntime.GOOS != "darwin" {
+			u.MemoryPeak = u.MemoryPeak * 1024
+		}
+		// block operations are counted in 512-byte units
+		u.DiskRead = int64(ru.Inblock) * 512
+		u.DiskWrite = int64(ru.Oublock) * 512
+	}
+	return u
+}
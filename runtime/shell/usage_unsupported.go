@@ -0,0 +1,20 @@
+//go:build !freebsd && !darwin && !linux
+
+package shell
+
+import (
+	"os"
+
+	"github.com/runabol/tork"
+)
+
+// processUsage returns the CPU time of an exited process. The
+// memory and IO figures are only available on unix systems.
+func processUsage(ps *os.ProcessState) *tork.TaskUsage {
+	if ps == nil {
+		return nil
+	}
+	return &tork.TaskUsage{
+		CPUSeconds: (ps.UserTime() + ps.SystemTime()).Seconds(),
+	}
+}
@@ -0,0 +1,17 @@
+package runtime
+
+import (
+	"github.com/runabol/tork"
+)
+
+// AddUsage adds the resource usage of a run (e.g. the task's
+// container or one of its pre/post tasks) to the task's usage.
+func AddUsage(t *tork.Task, u *tork.TaskUsage) {
+	if u == nil {
+		return
+	}
+	if t.Usage == nil {
+		t.Usage = &tork.TaskUsage{}
+	}
+	t.Usage.Add(u)
+}
@@ -0,0 +1,23 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddUsage(t *testing.T) {
+	tk := &tork.Task{}
+	AddUsage(tk, nil)
+	assert.Nil(t, tk.Usage)
+
+	AddUsage(tk, &tork.TaskUsage{CPUSeconds: 1.5, MemoryPeak: 100, DiskRead: 10, NetworkTx: 5})
+	AddUsage(tk, &tork.TaskUsage{CPUSeconds: 0.5, MemoryPeak: 50, DiskRead: 20, NetworkTx: 5})
+	assert.Equal(t, &tork.TaskUsage{
+		CPUSeconds: 2,
+		MemoryPeak: 100,
+		DiskRead:   30,
+		NetworkTx:  10,
+	}, tk.Usage)
+}
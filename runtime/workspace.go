@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/uuid"
+)
+
+// WorkspaceMounter mounts the workspace of a job: a volume which is
+// created when the first task of the job is mounted and which is shared
+// by all the subsequent tasks of the job until the job is released.
+//
+// The source of a workspace mount is the ID of the job.
+type WorkspaceMounter struct {
+	mounter    Mounter
+	workspaces map[string]*workspace
+	mounts     map[string]string
+	mu         sync.Mutex
+}
+
+type workspace struct {
+	volume   *tork.Mount
+	refs     int
+	released bool
+}
+
+// NewWorkspaceMounter creates a WorkspaceMounter which uses
+// the given volume mounter to create the jobs' workspaces.
+func NewWorkspaceMounter(volumes Mounter) *WorkspaceMounter {
+	return &WorkspaceMounter{
+		mounter:    volumes,
+		workspaces: make(map[string]*workspace),
+		mounts:     make(map[string]string),
+	}
+}
+
+func (m *WorkspaceMounter) Mount(ctx context.Context, mnt *tork.Mount) error {
+	if mnt.ID == "" {
+		return errors.New("must provide a mount ID")
+	}
+	jobID := mnt.Source
+	if jobID == "" {
+		return errors.New("must provide the job ID as the workspace source")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ws, ok := m.workspaces[jobID]
+	if !ok {
+		vol := &tork.Mount{
+			ID:     uuid.NewUUID(),
+			Type:   tork.MountTypeVolume,
+			Target: mnt.Target,
+			Opts:   mnt.Opts,
+		}
+		if err := m.mounter.Mount(ctx, vol); err != nil {
+			return errors.Wrapf(err, "error creating workspace for job %s", jobID)
+		}
+		ws = &workspace{volume: vol}
+		m.workspaces[jobID] = ws
+	}
+	if ws.released {
+		return errors.Errorf("workspace of job %s was released", jobID)
+	}
+	ws.refs = ws.refs + 1
+	m.mounts[mnt.ID] = jobID
+	mnt.Type = tork.MountTypeVolume
+	mnt.Source = ws.volume.Source
+	return nil
+}
+
+func (m *WorkspaceMounter) Unmount(ctx context.Context, mnt *tork.Mount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobID, ok := m.mounts[mnt.ID]
+	if !ok {
+		return errors.Errorf("unknown workspace mount: %s", mnt.ID)
+	}
+	delete(m.mounts, mnt.ID)
+	ws := m.workspaces[jobID]
+	ws.refs = ws.refs - 1
+	if ws.released && ws.refs == 0 {
+		return m.remove(ctx, jobID, ws)
+	}
+	return nil
+}
+
+// Release removes the workspace of the job once none of
+// its tasks use it anymore. It should be called when the
+// job reaches a terminal state.
+func (m *WorkspaceMounter) Release(ctx context.Context, jobID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ws, ok := m.workspaces[jobID]
+	if !ok {
+		return nil
+	}
+	ws.released = true
+	if ws.refs == 0 {
+		return m.remove(ctx, jobID, ws)
+	}
+	return nil
+}
+
+func (m *WorkspaceMounter) remove(ctx context.Context, jobID string, ws *workspace) error {
+	delete(m.workspaces, jobID)
+	if err := m.mounter.Unmount(ctx, ws.volume); err != nil {
+		return errors.Wrapf(err, "error removing workspace of job %s", jobID)
+	}
+	return nil
+}
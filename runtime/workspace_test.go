@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeVolumeMounter struct {
+	volumes map[string]bool
+}
+
+func (m *fakeVolumeMounter) Mount(ctx context.Context, mnt *tork.Mount) error {
+	mnt.Source = uuid.NewUUID()
+	m.volumes[mnt.Source] = true
+	return nil
+}
+
+func (m *fakeVolumeMounter) Unmount(ctx context.Context, mnt *tork.Mount) error {
+	delete(m.volumes, mnt.Source)
+	return nil
+}
+
+func TestWorkspaceMounter(t *testing.T) {
+	ctx := context.Background()
+	vm := &fakeVolumeMounter{volumes: make(map[string]bool)}
+	m := NewWorkspaceMounter(vm)
+	jobID := uuid.NewUUID()
+
+	mnt1 := &tork.Mount{ID: uuid.NewUUID(), Type: tork.MountTypeWorkspace, Source: jobID, Target: "/workspace"}
+	assert.NoError(t, m.Mount(ctx, mnt1))
+	assert.Equal(t, tork.MountTypeVolume, mnt1.Type)
+	assert.Len(t, vm.volumes, 1)
+
+	// the second task of the job shares the same volume
+	mnt2 := &tork.Mount{ID: uuid.NewUUID(), Type: tork.MountTypeWorkspace, Source: jobID, Target: "/workspace"}
+	assert.NoError(t, m.Mount(ctx, mnt2))
+	assert.Equal(t, mnt1.Source, mnt2.Source)
+	assert.Len(t, vm.volumes, 1)
+
+	// the volume outlives the tasks
+	assert.NoError(t, m.Unmount(ctx, mnt1))
+	assert.NoError(t, m.Unmount(ctx, mnt2))
+	assert.Len(t, vm.volumes, 1)
+
+	assert.NoError(t, m.Release(ctx, jobID))
+	assert.Len(t, vm.volumes, 0)
+
+	// releasing an unknown job is a no-op
+	assert.NoError(t, m.Release(ctx, jobID))
+}
+
+func TestWorkspaceMounterReleaseWhileMounted(t *testing.T) {
+	ctx := context.Background()
+	vm := &fakeVolumeMounter{volumes: make(map[string]bool)}
+	m := NewWorkspaceMounter(vm)
+	jobID := uuid.NewUUID()
+
+	mnt := &tork.Mount{ID: uuid.NewUUID(), Type: tork.MountTypeWorkspace, Source: jobID, Target: "/workspace"}
+	assert.NoError(t, m.Mount(ctx, mnt))
+
+	assert.NoError(t, m.Release(ctx, jobID))
+	assert.Len(t, vm.volumes, 1)
+
+	err := m.Mount(ctx, &tork.Mount{ID: uuid.NewUUID(), Type: tork.MountTypeWorkspace, Source: jobID, Target: "/workspace"})
+	assert.Error(t, err)
+
+	assert.NoError(t, m.Unmount(ctx, mnt))
+	assert.Len(t, vm.volumes, 0)
+}
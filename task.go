@@ -57,12 +57,14 @@ type Task struct {
 	Post        []*Task           `json:"post,omitempty"`
 	Sidecars    []*Task           `json:"sidecars,omitempty"`
 	Mounts      []Mount           `json:"mounts,omitempty"`
+	Artifacts   *TaskArtifacts    `json:"artifacts,omitempty"`
 	Networks    []string          `json:"networks,omitempty"`
 	NodeID      string            `json:"nodeId,omitempty"`
 	Retry       *TaskRetry        `json:"retry,omitempty"`
 	Limits      *TaskLimits       `json:"limits,omitempty"`
 	Timeout     string            `json:"timeout,omitempty"`
 	Result      string            `json:"result,omitempty"`
+	Outputs     map[string]any    `json:"outputs,omitempty"`
 	Var         string            `json:"var,omitempty"`
 	If          string            `json:"if,omitempty"`
 	Parallel    *ParallelTask     `json:"parallel,omitempty"`
@@ -74,24 +76,32 @@ type Task struct {
 	Priority    int               `json:"priority,omitempty"`
 	Progress    float64           `json:"progress,omitempty"`
 	Probe       *Probe            `json:"probe,omitempty"`
+	DependsOn   []string          `json:"dependsOn,omitempty"`
+	RetryAt     *time.Time        `json:"retryAt,omitempty"`
+	ExitCode    *int              `json:"exitCode,omitempty"`
+	TraceParent string            `json:"traceParent,omitempty"`
+	Usage       *TaskUsage        `json:"usage,omitempty"`
 }
 
 type TaskSummary struct {
-	ID          string     `json:"id,omitempty"`
-	JobID       string     `json:"jobId,omitempty"`
-	Position    int        `json:"position,omitempty"`
-	Progress    float64    `json:"progress,omitempty"`
-	Name        string     `json:"name,omitempty"`
-	Description string     `json:"description,omitempty"`
-	State       TaskState  `json:"state,omitempty"`
-	CreatedAt   *time.Time `json:"createdAt,omitempty"`
-	ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
-	StartedAt   *time.Time `json:"startedAt,omitempty"`
-	CompletedAt *time.Time `json:"completedAt,omitempty"`
-	Error       string     `json:"error,omitempty"`
-	Result      string     `json:"result,omitempty"`
-	Var         string     `json:"var,omitempty"`
-	Tags        []string   `json:"tags,omitempty"`
+	ID          string         `json:"id,omitempty"`
+	JobID       string         `json:"jobId,omitempty"`
+	Position    int            `json:"position,omitempty"`
+	Progress    float64        `json:"progress,omitempty"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	State       TaskState      `json:"state,omitempty"`
+	CreatedAt   *time.Time     `json:"createdAt,omitempty"`
+	ScheduledAt *time.Time     `json:"scheduledAt,omitempty"`
+	StartedAt   *time.Time     `json:"startedAt,omitempty"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	ExitCode    *int           `json:"exitCode,omitempty"`
+	Result      string         `json:"result,omitempty"`
+	Outputs     map[string]any `json:"outputs,omitempty"`
+	Var         string         `json:"var,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Usage       *TaskUsage     `json:"usage,omitempty"`
 }
 
 type TaskLogPart struct {
@@ -130,9 +140,32 @@ type EachTask struct {
 	Index       int    `json:"index,omitempty"`
 }
 
+// RetryScaling defines how the delay between
+// consecutive retry attempts grows.
+type RetryScaling = string
+
+const (
+	RetryScalingFixed       RetryScaling = "fixed"
+	RetryScalingExponential RetryScaling = "exponential"
+)
+
 type TaskRetry struct {
-	Limit    int `json:"limit,omitempty"`
-	Attempts int `json:"attempts,omitempty"`
+	Limit        int          `json:"limit,omitempty"`
+	Attempts     int          `json:"attempts,omitempty"`
+	InitialDelay string       `json:"initialDelay,omitempty"`
+	Scaling      RetryScaling `json:"scaling,omitempty"`
+	MaxDelay     string       `json:"maxDelay,omitempty"`
+	Jitter       bool         `json:"jitter,omitempty"`
+	On           *RetryOn     `json:"on,omitempty"`
+}
+
+// RetryOn restricts retries to failures which match
+// any of the given exit codes, error message patterns
+// or expression.
+type RetryOn struct {
+	ExitCodes []int    `json:"exitCodes,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+	If        string   `json:"if,omitempty"`
 }
 
 type TaskLimits struct {
@@ -140,6 +173,23 @@ type TaskLimits struct {
 	Memory string `json:"memory,omitempty"`
 }
 
+// TaskUsage is the resource consumption of a task's attempt,
+// including its pre and post tasks.
+type TaskUsage struct {
+	// WallSeconds is the time spent running the task
+	WallSeconds float64 `json:"wallSeconds"`
+	// CPUSeconds is the user and system CPU time
+	CPUSeconds float64 `json:"cpuSeconds"`
+	// MemoryPeak is the peak memory usage, in bytes
+	MemoryPeak int64 `json:"memoryPeak"`
+	// DiskRead and DiskWrite are the bytes read from and written to block devices
+	DiskRead  int64 `json:"diskRead"`
+	DiskWrite int64 `json:"diskWrite"`
+	// NetworkRx and NetworkTx are the bytes received and sent over the network
+	NetworkRx int64 `json:"networkRx"`
+	NetworkTx int64 `json:"networkTx"`
+}
+
 type Registry struct {
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
@@ -184,6 +234,14 @@ func (t *Task) Clone() *Task {
 	if t.Probe != nil {
 		probe = t.Probe.Clone()
 	}
+	var artifacts *TaskArtifacts
+	if t.Artifacts != nil {
+		artifacts = t.Artifacts.Clone()
+	}
+	var usage *TaskUsage
+	if t.Usage != nil {
+		usage = t.Usage.Clone()
+	}
 	return &Task{
 		ID:          t.ID,
 		JobID:       t.JobID,
@@ -209,12 +267,14 @@ func (t *Task) Clone() *Task {
 		Post:        CloneTasks(t.Post),
 		Sidecars:    CloneTasks(t.Sidecars),
 		Mounts:      slices.Clone(t.Mounts),
+		Artifacts:   artifacts,
 		Networks:    t.Networks,
 		NodeID:      t.NodeID,
 		Retry:       retry,
 		Limits:      limits,
 		Timeout:     t.Timeout,
 		Result:      t.Result,
+		Outputs:     maps.Clone(t.Outputs),
 		Var:         t.Var,
 		If:          t.If,
 		Parallel:    parallel,
@@ -227,6 +287,11 @@ func (t *Task) Clone() *Task {
 		Priority:    t.Priority,
 		Progress:    t.Progress,
 		Probe:       probe,
+		DependsOn:   slices.Clone(t.DependsOn),
+		RetryAt:     t.RetryAt,
+		ExitCode:    t.ExitCode,
+		TraceParent: t.TraceParent,
+		Usage:       usage,
 	}
 }
 
@@ -239,9 +304,26 @@ func CloneTasks(tasks []*Task) []*Task {
 }
 
 func (r *TaskRetry) Clone() *TaskRetry {
+	var on *RetryOn
+	if r.On != nil {
+		on = r.On.Clone()
+	}
 	return &TaskRetry{
-		Limit:    r.Limit,
-		Attempts: r.Attempts,
+		Limit:        r.Limit,
+		Attempts:     r.Attempts,
+		InitialDelay: r.InitialDelay,
+		Scaling:      r.Scaling,
+		MaxDelay:     r.MaxDelay,
+		Jitter:       r.Jitter,
+		On:           on,
+	}
+}
+
+func (o *RetryOn) Clone() *RetryOn {
+	return &RetryOn{
+		ExitCodes: slices.Clone(o.ExitCodes),
+		Errors:    slices.Clone(o.Errors),
+		If:        o.If,
 	}
 }
 
@@ -252,6 +334,23 @@ func (l *TaskLimits) Clone() *TaskLimits {
 	}
 }
 
+func (u *TaskUsage) Clone() *TaskUsage {
+	c := *u
+	return &c
+}
+
+// Add adds the usage of another attempt or of a pre/post
+// task. The memory peak is the highest of both peaks.
+func (u *TaskUsage) Add(o *TaskUsage) {
+	u.WallSeconds = u.WallSeconds + o.WallSeconds
+	u.CPUSeconds = u.CPUSeconds + o.CPUSeconds
+	u.MemoryPeak = max(u.MemoryPeak, o.MemoryPeak)
+	u.DiskRead = u.DiskRead + o.DiskRead
+	u.DiskWrite = u.DiskWrite + o.DiskWrite
+	u.NetworkRx = u.NetworkRx + o.NetworkRx
+	u.NetworkTx = u.NetworkTx + o.NetworkTx
+}
+
 func (e *EachTask) Clone() *EachTask {
 	return &EachTask{
 		Var:         e.Var,
@@ -319,8 +418,11 @@ func NewTaskSummary(t *Task) *TaskSummary {
 		StartedAt:   t.StartedAt,
 		CompletedAt: t.CompletedAt,
 		Error:       t.Error,
+		ExitCode:    t.ExitCode,
 		Result:      t.Result,
+		Outputs:     t.Outputs,
 		Var:         t.Var,
 		Tags:        t.Tags,
+		Usage:       t.Usage,
 	}
 }
@@ -15,6 +15,9 @@ func TestCloneTask(t *testing.T) {
 		Limits: &tork.TaskLimits{
 			CPUs: "1",
 		},
+		Usage: &tork.TaskUsage{
+			CPUSeconds: 1,
+		},
 		Parallel: &tork.ParallelTask{
 			Tasks: []*tork.Task{
 				{
@@ -28,13 +31,16 @@ func TestCloneTask(t *testing.T) {
 	t2 := t1.Clone()
 	assert.Equal(t, t1.Env, t2.Env)
 	assert.Equal(t, t1.Limits.CPUs, t2.Limits.CPUs)
+	assert.Equal(t, t1.Usage, t2.Usage)
 	assert.Equal(t, t1.Parallel.Tasks[0].Env, t2.Parallel.Tasks[0].Env)
 
 	t2.Env["VAR2"] = "VAL2"
 	t2.Limits.CPUs = "2"
+	t2.Usage.CPUSeconds = 2
 	t2.Parallel.Tasks[0].Env["PVAR2"] = "PVAL2"
 	assert.NotEqual(t, t1.Env, t2.Env)
 	assert.NotEqual(t, t1.Limits.CPUs, t2.Limits.CPUs)
+	assert.NotEqual(t, t1.Usage.CPUSeconds, t2.Usage.CPUSeconds)
 	assert.NotEqual(t, t1.Parallel.Tasks[0].Env, t2.Parallel.Tasks[0].Env)
 }
 
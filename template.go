@@ -0,0 +1,137 @@
+package tork
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Template is a named, versioned job definition which declares
+// the parameters it accepts. Versions are immutable: updating a
+// template creates a new version of it.
+type Template struct {
+	ID          string               `json:"id,omitempty"`
+	Name        string               `json:"name,omitempty"`
+	Version     int                  `json:"version,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Parameters  []*TemplateParameter `json:"parameters,omitempty"`
+	// Job is the definition of the job, as submitted
+	// to the jobs API.
+	Job       json.RawMessage `json:"job,omitempty"`
+	CreatedAt time.Time       `json:"createdAt,omitempty"`
+	CreatedBy *User           `json:"createdBy,omitempty"`
+}
+
+// TemplateParameter declares an input of the template. Its type
+// is one of the input types of a job's inputSchema (InputTypeString,
+// InputTypeInt etc.).
+type TemplateParameter struct {
+	Name     string   `json:"name,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Default  string   `json:"default,omitempty"`
+	Enum     []string `json:"enum,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+}
+
+func (t *Template) Clone() *Template {
+	var createdBy *User
+	if t.CreatedBy != nil {
+		createdBy = t.CreatedBy.Clone()
+	}
+	params := make([]*TemplateParameter, len(t.Parameters))
+	for i, p := range t.Parameters {
+		params[i] = p.Clone()
+	}
+	return &Template{
+		ID:          t.ID,
+		Name:        t.Name,
+		Version:     t.Version,
+		Description: t.Description,
+		Parameters:  params,
+		Job:         slices.Clone(t.Job),
+		CreatedAt:   t.CreatedAt,
+		CreatedBy:   createdBy,
+	}
+}
+
+func (p *TemplateParameter) Clone() *TemplateParameter {
+	return &TemplateParameter{
+		Name:     p.Name,
+		Type:     p.Type,
+		Required: p.Required,
+		Default:  p.Default,
+		Enum:     slices.Clone(p.Enum),
+		Pattern:  p.Pattern,
+	}
+}
+
+// ResolveInputs validates the supplied inputs against the template's
+// parameters and returns them along with the default value of every
+// parameter which was not supplied.
+//
+// Values which contain an expression (e.g. inputs of a sub-job which
+// refer to the outputs of previous tasks) can't be known in advance
+// so only their presence is checked.
+func (t *Template) ResolveInputs(inputs map[string]string) (map[string]string, error) {
+	params := make(map[string]*TemplateParameter)
+	for _, p := range t.Parameters {
+		params[p.Name] = p
+	}
+	for k := range inputs {
+		if _, ok := params[k]; !ok {
+			return nil, errors.Errorf("unknown parameter %s for template %s", k, t.Name)
+		}
+	}
+	result := make(map[string]string)
+	for _, p := range t.Parameters {
+		v, ok := inputs[p.Name]
+		if !ok {
+			if p.Required {
+				return nil, errors.Errorf("missing required parameter %s for template %s", p.Name, t.Name)
+			}
+			if p.Default == "" {
+				continue
+			}
+			v = p.Default
+		}
+		if !strings.Contains(v, "{{") {
+			if err := p.Check(v); err != nil {
+				return nil, err
+			}
+		}
+		result[p.Name] = v
+	}
+	return result, nil
+}
+
+// Check returns an error if the value doesn't satisfy the
+// parameter's type, allowed values or pattern.
+func (p *TemplateParameter) Check(v string) error {
+	if err := CheckInput(p.Type, p.Enum, p.Pattern, v); err != nil {
+		return errors.Wrapf(err, "invalid parameter %s", p.Name)
+	}
+	return nil
+}
+
+// ParseTemplateRef parses a reference to a template in the form
+// of name@version. The version is 0 (i.e. the latest version
+// of the template) when omitted.
+func ParseTemplateRef(ref string) (string, int, error) {
+	name, version, ok := strings.Cut(ref, "@")
+	if name == "" {
+		return "", 0, errors.Errorf("invalid template reference: %s", ref)
+	}
+	if !ok {
+		return name, 0, nil
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil || v < 1 {
+		return "", 0, errors.Errorf("invalid template version: %s", ref)
+	}
+	return name, v, nil
+}
@@ -0,0 +1,77 @@
+package tork_test
+
+import (
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateResolveInputs(t *testing.T) {
+	tmpl := &tork.Template{
+		Name: "transcode",
+		Parameters: []*tork.TemplateParameter{
+			{Name: "source", Required: true},
+			{Name: "quality", Enum: []string{"low", "high"}, Default: "high"},
+			{Name: "width", Type: tork.InputTypeInt},
+			{Name: "dryRun", Type: tork.InputTypeBool},
+			{Name: "files", Type: tork.InputTypeList},
+			{Name: "prefix", Pattern: "^out/"},
+		},
+	}
+
+	inputs, err := tmpl.ResolveInputs(map[string]string{"source": "s3://bucket/video.mov"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"source":  "s3://bucket/video.mov",
+		"quality": "high",
+	}, inputs)
+
+	inputs, err = tmpl.ResolveInputs(map[string]string{
+		"source":  "{{ tasks.upload }}",
+		"quality": "low",
+		"width":   "1280",
+		"dryRun":  "true",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "low", inputs["quality"])
+	assert.Equal(t, "1280", inputs["width"])
+
+	// expressions are only known at runtime
+	_, err = tmpl.ResolveInputs(map[string]string{"source": "x", "width": "{{ inputs.width }}"})
+	assert.NoError(t, err)
+
+	_, err = tmpl.ResolveInputs(map[string]string{})
+	assert.ErrorContains(t, err, "missing required parameter source")
+	_, err = tmpl.ResolveInputs(map[string]string{"source": "x", "other": "y"})
+	assert.ErrorContains(t, err, "unknown parameter other")
+	_, err = tmpl.ResolveInputs(map[string]string{"source": "x", "quality": "medium"})
+	assert.ErrorContains(t, err, `invalid parameter quality: "medium" is not one of [low, high]`)
+	_, err = tmpl.ResolveInputs(map[string]string{"source": "x", "width": "wide"})
+	assert.ErrorContains(t, err, `invalid parameter width: "wide" is not a valid int`)
+	_, err = tmpl.ResolveInputs(map[string]string{"source": "x", "dryRun": "maybe"})
+	assert.ErrorContains(t, err, `invalid parameter dryRun: "maybe" is not a valid bool`)
+	_, err = tmpl.ResolveInputs(map[string]string{"source": "x", "files": "a.jpg"})
+	assert.ErrorContains(t, err, `invalid parameter files: "a.jpg" is not a valid list`)
+	_, err = tmpl.ResolveInputs(map[string]string{"source": "x", "prefix": "tmp/"})
+	assert.ErrorContains(t, err, `invalid parameter prefix: "tmp/" does not match ^out/`)
+}
+
+func TestParseTemplateRef(t *testing.T) {
+	name, version, err := tork.ParseTemplateRef("transcode")
+	assert.NoError(t, err)
+	assert.Equal(t, "transcode", name)
+	assert.Equal(t, 0, version)
+
+	name, version, err = tork.ParseTemplateRef("transcode@3")
+	assert.NoError(t, err)
+	assert.Equal(t, "transcode", name)
+	assert.Equal(t, 3, version)
+
+	_, _, err = tork.ParseTemplateRef("transcode@latest")
+	assert.Error(t, err)
+	_, _, err = tork.ParseTemplateRef("transcode@0")
+	assert.Error(t, err)
+	_, _, err = tork.ParseTemplateRef("@1")
+	assert.Error(t, err)
+}
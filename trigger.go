@@ -0,0 +1,47 @@
+package tork
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// Trigger exposes a job definition through an inbound webhook
+// endpoint (POST /hooks/{name}) which launches a new job for
+// every request it receives.
+type Trigger struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Secret is the shared secret used to verify the HMAC-SHA256
+	// signature of incoming requests. Requests are not required
+	// to be signed when empty.
+	Secret string `json:"-"`
+	// Inputs maps the inputs of the launched job to expressions
+	// which are evaluated against the incoming request.
+	Inputs map[string]string `json:"inputs,omitempty"`
+	// Job is the definition of the job to launch, as submitted
+	// to the jobs API.
+	Job       json.RawMessage `json:"job,omitempty"`
+	CreatedAt time.Time       `json:"createdAt,omitempty"`
+	CreatedBy *User           `json:"createdBy,omitempty"`
+}
+
+func (t *Trigger) Clone() *Trigger {
+	var createdBy *User
+	if t.CreatedBy != nil {
+		createdBy = t.CreatedBy.Clone()
+	}
+	return &Trigger{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		Secret:      t.Secret,
+		Inputs:      maps.Clone(t.Inputs),
+		Job:         slices.Clone(t.Job),
+		CreatedAt:   t.CreatedAt,
+		CreatedBy:   createdBy,
+	}
+}